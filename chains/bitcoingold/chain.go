@@ -6,103 +6,213 @@ The current supported transfer types are Fungible, Nonfungible, and generic.
 
 There are 3 major components: the connection, the listener, and the writer.
 
-Connection
+# Connection
 
 The connection contains the bitcoingold RPC client and can be accessed by both the writer and listener.
 
-Listener
+# Listener
 
-The substrate listener polls utxos and parses the associated events for the three transfer types. It then forwards these into the router.
+The chain is configured by its options, see config.go.
 
-Writer
+The substrate listener polls utxos and parses the associated events for the three transfer types. It then forwards these into the router.
+Each deposit is credited to the recipient of the OP_RETURN memo of its transaction (see the memo package), deposits without a valid memo are quarantined.
+The amount credited is the deposit minus the bridge fee, scaled exactly from satoshis to the decimals of the destination token; deposits out of the configured limits are rejected.
+The deposits are credited with the first resource of the resourceIds option. The listener never writes to the Substrate chain: a development chain is prepared for the bridge by the cmd/bootstrap command.
 
-As the writer receives messages from the router, it constructs proposals. If a proposal is still active, the writer will attempt to vote on it. Resource IDs are resolved to method name on-chain, which are then used in the proposals when constructing the resulting Call struct.
+# Writer
 
+As the writer receives fungible transfers from the router, it pays them out of the multisig to the BTG address of their recipient, the network fee deducted: the node's estimate within the bounds of the fee options, see the fee package.
+Each relayer signs the withdrawal with its key of the multisig (signerKeyFile), which is broadcast once the threshold of signatures is met.
+The relayers agree on the withdrawal through the coordinator: in turns, one proposes it to the others (cosigners) and gathers their signatures, see coordinator.go.
+The payouts are stored by source chain and nonce, so a transfer delivered twice is paid once.
 */
 package bitcoingold
 
 import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
 	"github.com/ChainSafe/chainbridge-utils/core"
 	metrics "github.com/ChainSafe/chainbridge-utils/metrics/types"
 	"github.com/ChainSafe/chainbridge-utils/msg"
 	"github.com/ChainSafe/log15"
-        "github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/mempool"
+	"github.com/www222fff/watchUTXO/go-bitcoind/merkle"
+	"github.com/www222fff/watchUTXO/go-bitcoind/scanner"
+	"github.com/www222fff/watchUTXO/go-bitcoind/sink"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/webhook"
 )
 
 var _ core.Chain = &Chain{}
 
 type Chain struct {
-	cfg      *core.ChainConfig // The config of the chain
-	conn     *bitcoind.Bitcoind       // The chains connection
-	listener *listener         // The listener of this chain
-	writer   *writer           // The writer of the chain
+	cfg      *core.ChainConfig  // The config of the chain
+	conn     *bitcoind.Bitcoind // The chains connection
+	listener *listener          // The listener of this chain
+	writer   *writer            // The writer of the chain
+	coord    *coordinator       // The signing of the withdrawals, nil without a signer key
+	store    *store.Store       // The deposits and payouts, shared by the components
 	stop     chan<- int
 }
 
-
-const (
-        RPCUSER            = "user"
-        RPCPASSWD          = "passwd"
-        WALLET_NAME        = "danny"
-        WALLET_PASSPHRASE  = "test"
-      )
-
-
 func findWallet(slice []string, s string) int {
-        for index, value := range slice {
-                if value == s {
-                        return index
-                }
-        }
-        return -1
+	for index, value := range slice {
+		if value == s {
+			return index
+		}
+	}
+	return -1
 }
 
-
 func InitializeChain(cfg *core.ChainConfig, logger log15.Logger, sysErr chan<- error, m *metrics.ChainMetrics) (*Chain, error) {
+	c, err := parseConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-        conn_chain, err := bitcoind.New(cfg.Endpoint, "", RPCUSER, RPCPASSWD, false)
-        if err != nil {
-                return nil, err
-        }
+	conn_chain, err := bitcoind.New(c.endpoint, "", c.rpcUser, c.rpcPassword, c.useSSL)
+	if err != nil {
+		return nil, err
+	}
 
-        wallets, err := conn_chain.ListWallet()
-        r := findWallet(wallets, WALLET_NAME)
-        if r == -1 {
-                err = conn_chain.LoadWallet(WALLET_NAME, false)
-                if err != nil {
+	wallets, err := conn_chain.ListWallet()
+	if err != nil {
+		return nil, err
+	}
+	r := findWallet(wallets, c.wallet)
+	if r == -1 {
+		err = conn_chain.LoadWallet(c.wallet, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	conn_wallet, err := bitcoind.New(c.endpoint, c.wallet, c.rpcUser, c.rpcPassword, c.useSSL)
+	if err != nil {
+		return nil, err
+	}
+
+	// an unencrypted wallet has no passphrase
+	if c.walletPassphrase != "" {
+		err = conn_wallet.WalletPassphrase(c.walletPassphrase, 100000000)
+		if err != nil {
 			return nil, err
 		}
-        }
+	}
+
+	// deposits and nonces survive restarts in the blockstore directory
+	err = os.MkdirAll(cfg.BlockstorePath, 0700)
+	if err != nil {
+		return nil, err
+	}
+	st, err := store.Open(filepath.Join(cfg.BlockstorePath, fmt.Sprintf("bitcoingold-%d.db", cfg.Id)))
+	if err != nil {
+		return nil, err
+	}
+	// from here the store is closed by Stop, or before returning an error
 
-        conn_wallet, err := bitcoind.New(cfg.Endpoint, WALLET_NAME, RPCUSER, RPCPASSWD, false)
-        if err != nil {
+	// the deposit events are published to the sinks as well as routed, the
+	// events are queued with the changes so the dispatcher comes first
+	sinks, err := openSinks(c.sinks)
+	if err != nil {
+		st.Close()
 		return nil, err
-        }
+	}
+	var dispatcher *sink.Dispatcher
+	if len(sinks) > 0 {
+		dispatcher = sink.NewDispatcher(st, sinks)
+	}
 
-        err = conn_wallet.WalletPassphrase(WALLET_PASSPHRASE, 100000000)
-        if err != nil {
+	// a fresh store is filled from startBlock, or from the current tip
+	startBlock := c.startBlock
+	if !c.hasStartBlock {
+		startBlock, err = conn_chain.GetBlockCount()
+		if err != nil {
+			st.Close()
+			return nil, err
+		}
+	}
+
+	sc, err := scanner.New(conn_chain, st, c.params, c.policy, []string{c.watchAddress}, startBlock)
+	if err != nil {
+		st.Close()
 		return nil, err
-        }
+	}
+
+	// unconfirmed deposits are reported as pending when `mempool` is true,
+	// through the wallet which knows their conflicts
+	var mp *mempool.Watcher
+	if c.mempool {
+		mp, err = mempool.New(conn_wallet, c.params, []string{c.watchAddress})
+		if err != nil {
+			st.Close()
+			return nil, err
+		}
+	}
 
 	stop := make(chan int)
 
 	// Setup listener & writer
-	l := NewListener(conn_wallet, cfg.Name, cfg.From, cfg.Id, logger, stop, sysErr, m)
-	w := NewWriter(conn_wallet, logger, sysErr, m, false)
+	// the deposits must be in the hash chain the scanner verified
+	verifier := merkle.NewVerifier(conn_chain, st, c.params, merkle.DefaultMaxDepth)
+	utxos := deposit.NewRPCSource(conn_wallet, 1, 999999, []string{c.watchAddress})
+	l := NewListener(conn_wallet, utxos, verifier, c, sc, mp, dispatcher, st, logger, stop, sysErr, m)
+	w := NewWriter(conn_wallet, utxos, c, st, logger, sysErr, m, false)
+	var coord *coordinator
+	if c.signer != nil {
+		transport := newHTTPTransport(c.cosigners, c.signingTimeout)
+		coord = newCoordinator(w, transport, c.signingTimeout, logger, stop)
+	}
 	return &Chain{
 		cfg:      cfg,
 		conn:     conn_wallet,
 		listener: l,
 		writer:   w,
+		coord:    coord,
+		store:    st,
 		stop:     stop,
 	}, nil
 }
 
+// openSinks returns the configured sinks, named after their options:
+// `sinkStdout` true writes JSON lines to stdout, `sinkFile` appends them to a
+// file, `sinkWebhook` posts them signed with `sinkWebhookSecret`, and
+// `sinkStream` (tcp:host:port or unix:path) publishes them to a NATS
+// compatible server on `sinkStreamSubject`
+func openSinks(cfg sinkConfig) (map[string]sink.Sink, error) {
+	sinks := make(map[string]sink.Sink)
+	if cfg.stdout {
+		sinks[SinkStdoutOpt] = sink.NewWriter(os.Stdout)
+	}
+	if cfg.file != "" {
+		f, err := sink.OpenFile(cfg.file)
+		if err != nil {
+			return nil, err
+		}
+		sinks[SinkFileOpt] = f
+	}
+	if cfg.webhook != "" {
+		sinks[SinkWebhookOpt] = webhook.New(cfg.webhook, cfg.webhookSecret, &http.Client{})
+	}
+	if cfg.streamAddress != "" {
+		sinks[SinkStreamOpt] = sink.NewStream(cfg.streamNetwork, cfg.streamAddress, cfg.streamSubject)
+	}
+	return sinks, nil
+}
+
 func (c *Chain) Start() error {
 	err := c.listener.start()
 	if err != nil {
 		return err
 	}
+	if c.coord != nil {
+		c.coord.start()
+	}
 	log15.Debug("Successfully started chain", "chainId", c.cfg.Id)
 	return nil
 }
@@ -124,6 +234,12 @@ func (c *Chain) Name() string {
 	return c.cfg.Name
 }
 
+// Stop stops the components, then closes the store they share once the
+// listener is done with it
 func (c *Chain) Stop() {
 	close(c.stop)
+	c.listener.wait()
+	if err := c.store.Close(); err != nil {
+		log15.Error("Failed to close the store", "chainId", c.cfg.Id, "err", err)
+	}
 }
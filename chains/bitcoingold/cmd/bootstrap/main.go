@@ -0,0 +1,76 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Command bootstrap prepares a Substrate development chain for the bitcoingold
+bridge. With the Alice test key, it registers Alice as the relayer, whitelists
+the bitcoingold chain and registers the resources with the example pallet's
+transfer method, then prints the resource id of the chain's native token, the
+resource to give the bitcoingold chain in its resourceIds option.
+
+It needs sudo on the Substrate chain and is meant for local development and
+tests only; the relayers never bootstrap the chains they connect to.
+
+	bootstrap -endpoint ws://127.0.0.1:9944 -chain 2 -resources 0x000000000000000000000000000000c76ebe4a02bbc34786d860b355f5a5ce00
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	utils "github.com/ChainSafe/ChainBridge/shared/substrate"
+	"github.com/ChainSafe/chainbridge-utils/keystore"
+	"github.com/ChainSafe/chainbridge-utils/msg"
+	"github.com/centrifuge/go-substrate-rpc-client/types"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", "ws://127.0.0.1:9944", "Substrate node websocket endpoint")
+	chainId := flag.Uint("chain", 2, "bridge chain id of bitcoingold")
+	resourceIds := flag.String("resources", "0x000000000000000000000000000000c76ebe4a02bbc34786d860b355f5a5ce00", "resource ids in hex separated by commas, as shown by the Polkadot JS UI (Chain State -> Constants)")
+	threshold := flag.Uint("threshold", 1, "relayer threshold")
+	flag.Parse()
+
+	if err := bootstrap(*endpoint, msg.ChainId(*chainId), *resourceIds, uint32(*threshold)); err != nil {
+		fmt.Fprintln(os.Stderr, "bootstrap:", err)
+		os.Exit(1)
+	}
+}
+
+func bootstrap(endpoint string, chainId msg.ChainId, resourceIds string, threshold uint32) error {
+	alice := keystore.TestKeyRing.SubstrateKeys[keystore.AliceKey].AsKeyringPair()
+	relayers := []types.AccountID{types.NewAccountID(alice.PublicKey)}
+
+	resources := make(map[msg.ResourceId]utils.Method)
+	for _, s := range strings.Split(resourceIds, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := hexutil.Decode(s)
+		if err != nil || len(id) != 32 {
+			return fmt.Errorf("invalid resource id %q", s)
+		}
+		resources[msg.ResourceIdFromSlice(id)] = utils.ExampleTransferMethod
+	}
+
+	client, err := utils.CreateClient(alice, endpoint)
+	if err != nil {
+		return err
+	}
+	err = utils.InitializeChain(client, relayers, []msg.ChainId{chainId}, resources, threshold)
+	if err != nil {
+		return err
+	}
+	var native msg.ResourceId
+	err = utils.QueryConst(client, "Example", "NativeTokenId", &native)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hexutil.Encode(native[:]))
+	return nil
+}
@@ -0,0 +1,670 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package bitcoingold
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChainSafe/chainbridge-utils/core"
+	"github.com/ChainSafe/chainbridge-utils/msg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/descriptor"
+	"github.com/www222fff/watchUTXO/go-bitcoind/fee"
+)
+
+// Options of the chain, the keys of core.ChainConfig.Opts. The chain's
+// endpoint is the node's RPC address and its From the watched address,
+// unless watchDescriptor gives it.
+const (
+	// node RPC credentials, rpcUser and rpcPassword or the node's cookie file
+	RpcUserOpt     = "rpcUser"
+	RpcPasswordOpt = "rpcPassword"
+	CookieFileOpt  = "cookieFile"
+	UseSSLOpt      = "useSSL"
+
+	// the node's network, main, test or regtest, main by default
+	NetworkOpt = "network"
+
+	// the wallet watching the multisig, unlocked with the passphrase or the
+	// content of the passphrase file if it is encrypted
+	WalletOpt               = "wallet"
+	WalletPassphraseOpt     = "walletPassphrase"
+	WalletPassphraseFileOpt = "walletPassphraseFile"
+
+	// a descriptor of the watched address, e.g. wsh(sortedmulti(...))
+	WatchDescriptorOpt = "watchDescriptor"
+
+	// the first block a fresh store scans, the tip by default
+	StartBlockOpt = "startBlock"
+
+	// depth of final deposits, and more for the tiers of larger ones
+	// (satoshis:confirmations,...)
+	ConfirmationsOpt     = "confirmations"
+	ConfirmationTiersOpt = "confirmationTiers"
+
+	// interval of the polls, e.g. 5s
+	PollIntervalOpt = "pollInterval"
+
+	// the bridge's resources in hex separated by commas, the deposits are
+	// credited with the first, the decimals of their tokens, required for
+	// every resource (resourceId:decimals,...), and the limits and fee of the
+	// deposits in satoshis
+	ResourceIdsOpt      = "resourceIds"
+	ResourceDecimalsOpt = "resourceDecimals"
+	MinAmountOpt        = "minAmount"
+	MaxAmountOpt        = "maxAmount"
+	BridgeFeeOpt        = "bridgeFee"
+
+	// pending deposits from the mempool, and the node's ZMQ notifications
+	MempoolOpt     = "mempool"
+	ZmqEndpointOpt = "zmqEndpoint"
+
+	// the file holding this relayer's key of the multisig in wallet import
+	// format
+	SignerKeyFileOpt = "signerKeyFile"
+
+	// the network fee of the withdrawals, deducted from the amounts paid:
+	// the node's estimate for a confirmation within feeConfTarget blocks, 0
+	// to always pay minFeeRate, between minFeeRate and maxFeeRate, in
+	// sat/vB. fallbackFeeRate is paid when the node has no estimate, and no
+	// withdrawal pays more than maxFee satoshis.
+	FeeConfTargetOpt   = "feeConfTarget"
+	MinFeeRateOpt      = "minFeeRate"
+	MaxFeeRateOpt      = "maxFeeRate"
+	FallbackFeeRateOpt = "fallbackFeeRate"
+	MaxFeeOpt          = "maxFee"
+
+	// the other relayers signing the withdrawals, as key=url pairs separated
+	// by commas, the key being the relayer's key of the multisig in hex, the
+	// address serving them, e.g. :8089, and how long a relayer waits for the
+	// others to sign a withdrawal
+	CosignersOpt      = "cosigners"
+	CosignerListenOpt = "cosignerListen"
+	SigningTimeoutOpt = "signingTimeout"
+
+	// the sinks of the deposit events, see openSinks
+	SinkStdoutOpt        = "sinkStdout"
+	SinkFileOpt          = "sinkFile"
+	SinkWebhookOpt       = "sinkWebhook"
+	SinkWebhookSecretOpt = "sinkWebhookSecret"
+	SinkStreamOpt        = "sinkStream"
+	SinkStreamSubjectOpt = "sinkStreamSubject"
+)
+
+var knownOpts = map[string]bool{
+	RpcUserOpt: true, RpcPasswordOpt: true, CookieFileOpt: true, UseSSLOpt: true, NetworkOpt: true,
+	WalletOpt: true, WalletPassphraseOpt: true, WalletPassphraseFileOpt: true,
+	WatchDescriptorOpt: true, StartBlockOpt: true, ConfirmationsOpt: true, ConfirmationTiersOpt: true, PollIntervalOpt: true,
+	ResourceIdsOpt: true, ResourceDecimalsOpt: true, MinAmountOpt: true, MaxAmountOpt: true, BridgeFeeOpt: true,
+	MempoolOpt: true, ZmqEndpointOpt: true, SignerKeyFileOpt: true,
+	FeeConfTargetOpt: true, MinFeeRateOpt: true, MaxFeeRateOpt: true, FallbackFeeRateOpt: true, MaxFeeOpt: true,
+	CosignersOpt: true, CosignerListenOpt: true, SigningTimeoutOpt: true,
+	SinkStdoutOpt: true, SinkFileOpt: true, SinkWebhookOpt: true, SinkWebhookSecretOpt: true, SinkStreamOpt: true, SinkStreamSubjectOpt: true,
+}
+
+// Fee policy without the fee options: estimates for a confirmation within
+// 6 blocks between 1 and 100 sat/vB, falling back to minFeeRate, and at
+// most 0.01 BTG a withdrawal
+const (
+	DefaultFeeConfTarget = 6
+	DefaultMinFeeRate    = 1
+	DefaultMaxFeeRate    = 100
+	DefaultMaxFee        = 1000000
+)
+
+// DefaultSigningTimeout is how long a relayer waits for the others to sign a
+// withdrawal without the signingTimeout option
+const DefaultSigningTimeout = 2 * time.Minute
+
+// Config is the configuration of a bitcoingold chain, read from the chain
+// options
+type Config struct {
+	name     string
+	id       msg.ChainId
+	endpoint string
+
+	// node RPC, the credentials read from the cookie file if given
+	rpcUser     string
+	rpcPassword string
+	useSSL      bool
+
+	// the parameters of the node's network
+	params *address.Params
+
+	// the wallet of the watched address, walletPassphrase is empty for an
+	// unencrypted wallet
+	wallet           string
+	walletPassphrase string
+
+	// the watched address, the one of watchDescriptor or the chain's From
+	watchAddress string
+
+	// the scripts of the watchDescriptor's output, its threshold and this
+	// relayer's key in it, nil unless the relayer signs withdrawals, and the
+	// fees of the withdrawals, without estimator
+	multisig *descriptor.Output
+	required int
+	signer   *secp256k1.PrivateKey
+	fees     fee.Policy
+
+	// the keys of the multisig in hex and in script order, this relayer's
+	// among them, and the urls of the other relayers by key
+	relayers       []string
+	self           string
+	cosigners      map[string]string
+	cosignerListen string
+	signingTimeout time.Duration
+
+	startBlock    uint64
+	hasStartBlock bool // otherwise a fresh store starts from the tip
+	policy        *deposit.Policy
+	pollInterval  time.Duration
+
+	resourceIds []msg.ResourceId
+	decimals    map[msg.ResourceId]uint8
+	limits      *deposit.Limits
+
+	mempool     bool
+	zmqEndpoint string
+	sinks       sinkConfig
+}
+
+// sinkConfig is the configuration of the sinks of the deposit events, see
+// openSinks
+type sinkConfig struct {
+	stdout        bool
+	file          string
+	webhook       string
+	webhookSecret string
+	streamNetwork string
+	streamAddress string
+	streamSubject string
+}
+
+// parseConfig reads and checks the chain options. Every unknown, missing or
+// invalid option is reported at once.
+func parseConfig(cfg *core.ChainConfig) (*Config, error) {
+	var errs []string
+	errorf := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, a...))
+	}
+	opts := cfg.Opts
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !knownOpts[k] {
+			errorf("unknown option %q", k)
+		}
+	}
+
+	c := &Config{
+		name:         cfg.Name,
+		id:           cfg.Id,
+		endpoint:     cfg.Endpoint,
+		wallet:       opts[WalletOpt],
+		zmqEndpoint:  opts[ZmqEndpointOpt],
+		pollInterval: BlockRetryInterval,
+	}
+	if c.endpoint == "" {
+		errorf("endpoint is required")
+	}
+
+	// credentials
+	_, hasUser := opts[RpcUserOpt]
+	_, hasPassword := opts[RpcPasswordOpt]
+	switch cookie := opts[CookieFileOpt]; {
+	case cookie != "" && (hasUser || hasPassword):
+		errorf("%s excludes %s and %s", CookieFileOpt, RpcUserOpt, RpcPasswordOpt)
+	case cookie != "":
+		user, password, err := readCookie(cookie)
+		if err != nil {
+			errorf("%s: %v", CookieFileOpt, err)
+		}
+		c.rpcUser, c.rpcPassword = user, password
+	case opts[RpcUserOpt] == "" || opts[RpcPasswordOpt] == "":
+		errorf("%s and %s, or %s, are required", RpcUserOpt, RpcPasswordOpt, CookieFileOpt)
+	default:
+		c.rpcUser, c.rpcPassword = opts[RpcUserOpt], opts[RpcPasswordOpt]
+	}
+	boolOpt := func(key string) bool {
+		v, ok := opts[key]
+		if !ok {
+			return false
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errorf("%s must be true or false, got %q", key, v)
+		}
+		return b
+	}
+	c.useSSL = boolOpt(UseSSLOpt)
+	c.mempool = boolOpt(MempoolOpt)
+
+	// network, before the addresses and keys encoded for it
+	c.params = &address.MainNetParams
+	if v, ok := opts[NetworkOpt]; ok {
+		params, err := address.ParamsForNetwork(v)
+		if err != nil {
+			errorf("%s must be main, test or regtest, got %q", NetworkOpt, v)
+		} else {
+			c.params = params
+		}
+	}
+
+	// wallet
+	if c.wallet == "" {
+		errorf("%s is required", WalletOpt)
+	}
+	if path := opts[WalletPassphraseFileOpt]; path != "" {
+		if _, ok := opts[WalletPassphraseOpt]; ok {
+			errorf("%s excludes %s", WalletPassphraseFileOpt, WalletPassphraseOpt)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			errorf("%s: %v", WalletPassphraseFileOpt, err)
+		}
+		c.walletPassphrase = strings.TrimRight(string(b), "\r\n")
+	} else {
+		c.walletPassphrase = opts[WalletPassphraseOpt]
+	}
+
+	// watched address
+	c.watchAddress = cfg.From
+	var watched *descriptor.Descriptor
+	if s := opts[WatchDescriptorOpt]; s != "" {
+		d, addr, err := parseDescriptor(s, c.params)
+		switch {
+		case err != nil:
+			errorf("%s: %v", WatchDescriptorOpt, err)
+		case cfg.From != "" && cfg.From != addr:
+			errorf("%s pays to %s, not to from %s", WatchDescriptorOpt, addr, cfg.From)
+		default:
+			watched, c.watchAddress = d, addr
+		}
+	}
+	if c.watchAddress == "" {
+		errorf("from or %s is required", WatchDescriptorOpt)
+	}
+
+	// withdrawals
+	if path := opts[SignerKeyFileOpt]; path != "" {
+		key, err := readSignerKey(path, c.params)
+		switch {
+		case err != nil:
+			errorf("%s: %v", SignerKeyFileOpt, err)
+		case opts[WatchDescriptorOpt] == "":
+			errorf("%s requires %s", SignerKeyFileOpt, WatchDescriptorOpt)
+		case watched != nil:
+			c.multisig, err = watched.Expand(0)
+			if err != nil {
+				errorf("%s: %v", WatchDescriptorOpt, err)
+			} else if !hasKey(watched, key) {
+				errorf("%s: the key is not one of %s", SignerKeyFileOpt, WatchDescriptorOpt)
+			} else {
+				c.signer, c.required = key, threshold(watched)
+				c.self = hex.EncodeToString(key.PubKey().SerializeCompressed())
+				c.relayers = descriptorKeys(watched)
+			}
+		}
+	}
+	cosigners, err := parseCosigners(opts[CosignersOpt])
+	if err != nil {
+		errorf("%s: %v", CosignersOpt, err)
+	}
+	c.cosigners = cosigners
+	for key := range c.cosigners {
+		switch {
+		case c.signer == nil:
+			errorf("%s requires %s", CosignersOpt, SignerKeyFileOpt)
+		case key == c.self:
+			errorf("%s: %s is this relayer's key", CosignersOpt, key)
+		case !contains(c.relayers, key):
+			errorf("%s: %s is not a key of %s", CosignersOpt, key, WatchDescriptorOpt)
+		}
+	}
+	c.cosignerListen = opts[CosignerListenOpt]
+	c.signingTimeout = DefaultSigningTimeout
+	if v, ok := opts[SigningTimeoutOpt]; ok {
+		d, err := time.ParseDuration(v)
+		switch {
+		case err != nil:
+			errorf("%s must be a duration, e.g. 2m, got %q", SigningTimeoutOpt, v)
+		case d < time.Second:
+			errorf("%s must be at least 1s", SigningTimeoutOpt)
+		default:
+			c.signingTimeout = d
+		}
+	}
+	fees, err := parseFees(opts)
+	if err != nil {
+		errorf("%v", err)
+	}
+	c.fees = fees
+
+	// polling
+	if v, ok := opts[StartBlockOpt]; ok {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			errorf("%s must be a block height, got %q", StartBlockOpt, v)
+		}
+		c.startBlock, c.hasStartBlock = n, true
+	}
+	confirmations := uint64(deposit.DefaultConfirmations)
+	if v, ok := opts[ConfirmationsOpt]; ok {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			errorf("%s must be a number of blocks, got %q", ConfirmationsOpt, v)
+		} else {
+			confirmations = n
+		}
+	}
+	tiers, err := deposit.ParseTiers(opts[ConfirmationTiersOpt])
+	if err != nil {
+		errorf("%s: %v", ConfirmationTiersOpt, err)
+	} else if c.policy, err = deposit.NewPolicy(uint32(confirmations), tiers); err != nil {
+		errorf("%s: %v", ConfirmationsOpt, err)
+	}
+	if v, ok := opts[PollIntervalOpt]; ok {
+		d, err := time.ParseDuration(v)
+		switch {
+		case err != nil:
+			errorf("%s must be a duration, e.g. 5s, got %q", PollIntervalOpt, v)
+		case d < 100*time.Millisecond:
+			errorf("%s must be at least 100ms", PollIntervalOpt)
+		default:
+			c.pollInterval = d
+		}
+	}
+
+	// bridge
+	if c.resourceIds, err = parseResourceIds(opts[ResourceIdsOpt]); err != nil {
+		errorf("%s: %v", ResourceIdsOpt, err)
+	} else if len(c.resourceIds) == 0 {
+		errorf("%s is required", ResourceIdsOpt)
+	}
+	if strings.TrimSpace(opts[ResourceDecimalsOpt]) == "" {
+		errorf("%s is required", ResourceDecimalsOpt)
+	} else if c.decimals, err = parseDecimals(opts[ResourceDecimalsOpt]); err != nil {
+		errorf("%s: %v", ResourceDecimalsOpt, err)
+	} else {
+		for _, id := range c.resourceIds {
+			if _, ok := c.decimals[id]; !ok {
+				errorf("%s: no decimals for resource %x", ResourceDecimalsOpt, id)
+			}
+		}
+	}
+	if c.limits, err = parseLimits(opts); err != nil {
+		errorf("%v", err)
+	}
+
+	// sinks
+	c.sinks = sinkConfig{
+		stdout:        boolOpt(SinkStdoutOpt),
+		file:          opts[SinkFileOpt],
+		webhook:       opts[SinkWebhookOpt],
+		webhookSecret: opts[SinkWebhookSecretOpt],
+		streamSubject: opts[SinkStreamSubjectOpt],
+	}
+	if c.sinks.webhook != "" && c.sinks.webhookSecret == "" {
+		errorf("%s is required with %s", SinkWebhookSecretOpt, SinkWebhookOpt)
+	}
+	if v := opts[SinkStreamOpt]; v != "" {
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 || (parts[0] != "tcp" && parts[0] != "unix") || parts[1] == "" {
+			errorf("%s must be tcp:host:port or unix:path, got %q", SinkStreamOpt, v)
+		} else {
+			c.sinks.streamNetwork, c.sinks.streamAddress = parts[0], parts[1]
+		}
+	}
+	if c.sinks.streamSubject == "" {
+		c.sinks.streamSubject = "bitcoingold.deposits"
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.New("invalid bitcoingold chain options:\n  " + strings.Join(errs, "\n  "))
+	}
+	return c, nil
+}
+
+// readCookie returns the credentials of the node's .cookie file
+func readCookie(path string) (string, string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(b)), ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", errors.New("expected user:password")
+	}
+	return parts[0], parts[1], nil
+}
+
+// parseDescriptor parses a descriptor that is not ranged, e.g. the
+// wsh(sortedmulti(...)) of the bridge's multisig, and returns its address on
+// the network of params
+func parseDescriptor(s string, params *address.Params) (*descriptor.Descriptor, string, error) {
+	d, err := descriptor.Parse(s, params)
+	if err != nil {
+		return nil, "", err
+	}
+	if d.IsRange() {
+		return nil, "", errors.New("a ranged descriptor watches several addresses, expected one")
+	}
+	addr, err := d.Address(0)
+	if err != nil {
+		return nil, "", err
+	}
+	return d, addr.String(), nil
+}
+
+// readSignerKey reads a private key in wallet import format, the one of
+// dumpprivkey on the network of params. The multisig's keys are compressed.
+func readSignerKey(path string, params *address.Params) (*secp256k1.PrivateKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, compressed, err := address.DecodeWIF(strings.TrimSpace(string(b)), params)
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		return nil, errors.New("the key is not compressed, segwit requires compressed keys")
+	}
+	return secp256k1.PrivKeyFromBytes(key), nil
+}
+
+// hasKey reports whether key is one of the keys of d
+func hasKey(d *descriptor.Descriptor, key *secp256k1.PrivateKey) bool {
+	pubKey := key.PubKey().SerializeCompressed()
+	for _, k := range d.AllKeys() {
+		b, err := k.PubKey(0)
+		if err == nil && bytes.Equal(b, pubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// descriptorKeys returns the keys of d in hex, sorted as sortedmulti sorts
+// them
+func descriptorKeys(d *descriptor.Descriptor) []string {
+	var keys []string
+	for _, k := range d.AllKeys() {
+		if b, err := k.PubKey(0); err == nil {
+			keys = append(keys, hex.EncodeToString(b))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// threshold returns the number of signatures d requires
+func threshold(d *descriptor.Descriptor) int {
+	for ; d != nil; d = d.Sub {
+		if d.Required > 0 {
+			return d.Required
+		}
+	}
+	return 0
+}
+
+// parseCosigners parses key=url pairs separated by commas
+func parseCosigners(s string) (map[string]string, error) {
+	cosigners := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid pair %q, expected key=url", pair)
+		}
+		key := strings.ToLower(parts[0])
+		if b, err := hex.DecodeString(key); err != nil || len(b) != 33 {
+			return nil, fmt.Errorf("invalid key %q", parts[0])
+		}
+		if _, ok := cosigners[key]; ok {
+			return nil, fmt.Errorf("duplicate key %s", key)
+		}
+		cosigners[key] = strings.TrimRight(parts[1], "/")
+	}
+	return cosigners, nil
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// parseResourceIds parses resource ids in hex separated by commas
+func parseResourceIds(s string) ([]msg.ResourceId, error) {
+	var ids []msg.ResourceId
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		id, err := parseResourceId(v)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func parseResourceId(s string) (msg.ResourceId, error) {
+	b, err := hexutil.Decode(s)
+	if err != nil || len(b) != 32 {
+		return msg.ResourceId{}, fmt.Errorf("invalid resource id %q", s)
+	}
+	return msg.ResourceIdFromSlice(b), nil
+}
+
+// parseFees returns the fee policy of the fee options
+func parseFees(opts map[string]string) (fee.Policy, error) {
+	p := fee.Policy{
+		ConfTarget: DefaultFeeConfTarget,
+		Floor:      fee.PerVByte(DefaultMinFeeRate),
+		Ceiling:    fee.PerVByte(DefaultMaxFeeRate),
+		MaxFee:     DefaultMaxFee,
+	}
+	if v, ok := opts[FeeConfTargetOpt]; ok {
+		n, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return p, fmt.Errorf("%s must be a number of blocks, got %q", FeeConfTargetOpt, v)
+		}
+		p.ConfTarget = int(n)
+	}
+	rates := map[string]*fee.Rate{MinFeeRateOpt: &p.Floor, MaxFeeRateOpt: &p.Ceiling, FallbackFeeRateOpt: &p.Fallback}
+	for _, key := range []string{MinFeeRateOpt, MaxFeeRateOpt, FallbackFeeRateOpt} {
+		v, ok := opts[key]
+		if !ok {
+			continue
+		}
+		r, err := fee.ParseRate(v)
+		if err != nil {
+			return p, fmt.Errorf("%s must be a rate in sat/vB, got %q", key, v)
+		}
+		*rates[key] = r
+	}
+	if _, ok := opts[FallbackFeeRateOpt]; !ok {
+		p.Fallback = p.Floor
+	}
+	if v, ok := opts[MaxFeeOpt]; ok {
+		amount, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("%s must be an amount in satoshis, got %q", MaxFeeOpt, v)
+		}
+		p.MaxFee = amount
+	}
+	return p, p.Validate()
+}
+
+// parseLimits returns the limits of the `minAmount`, `maxAmount` and
+// `bridgeFee` options, in satoshis, none by default
+func parseLimits(opts map[string]string) (*deposit.Limits, error) {
+	var amounts [3]int64
+	for i, key := range []string{MinAmountOpt, MaxAmountOpt, BridgeFeeOpt} {
+		v, ok := opts[key]
+		if !ok {
+			continue
+		}
+		amount, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an amount in satoshis, got %q", key, v)
+		}
+		amounts[i] = amount
+	}
+	return deposit.NewLimits(amounts[0], amounts[1], amounts[2])
+}
+
+// parseDecimals parses the decimals of the destination tokens written as
+// resourceId:decimals pairs separated by commas, the resource ids in hex
+func parseDecimals(s string) (map[msg.ResourceId]uint8, error) {
+	decimals := make(map[msg.ResourceId]uint8)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid pair %q, expected resourceId:decimals", pair)
+		}
+		id, err := parseResourceId(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		d, err := strconv.ParseUint(parts[1], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid decimals %q", parts[1])
+		}
+		if _, ok := decimals[id]; ok {
+			return nil, fmt.Errorf("duplicate decimals for %s", parts[0])
+		}
+		decimals[id] = uint8(d)
+	}
+	return decimals, nil
+}
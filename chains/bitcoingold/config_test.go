@@ -0,0 +1,226 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package bitcoingold
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/chainbridge-utils/core"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit/deposittest"
+	"github.com/www222fff/watchUTXO/go-bitcoind/fee"
+)
+
+const (
+	testResourceId = "0x000000000000000000000000000000c76ebe4a02bbc34786d860b355f5a5ce00"
+	testMultisig   = "wsh(sortedmulti(2,02ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8,02fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f))"
+)
+
+func TestParseConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cookie := filepath.Join(dir, ".cookie")
+	if err := ioutil.WriteFile(cookie, []byte("__cookie__:s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &core.ChainConfig{
+		Name:     "btg",
+		Id:       2,
+		Endpoint: "127.0.0.1:8332",
+		Opts: map[string]string{
+			CookieFileOpt:       cookie,
+			WalletOpt:           "bridge",
+			WatchDescriptorOpt:  testMultisig,
+			StartBlockOpt:       "700000",
+			ConfirmationsOpt:    "12",
+			PollIntervalOpt:     "30s",
+			ResourceIdsOpt:      testResourceId,
+			ResourceDecimalsOpt: testResourceId + ":18",
+		},
+	}
+	c, err := parseConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.rpcUser != "__cookie__" || c.rpcPassword != "s3cret" {
+		t.Errorf("credentials %q:%q, want the cookie's", c.rpcUser, c.rpcPassword)
+	}
+	if !strings.HasPrefix(c.watchAddress, "btg1q") {
+		t.Errorf("watched address %q, want the multisig's", c.watchAddress)
+	}
+	if !c.hasStartBlock || c.startBlock != 700000 {
+		t.Errorf("start block %d", c.startBlock)
+	}
+	if c.policy.Required(1) != 12 || c.pollInterval != 30*time.Second {
+		t.Errorf("confirmations %d, poll interval %s", c.policy.Required(1), c.pollInterval)
+	}
+	if len(c.resourceIds) != 1 || c.decimals[c.resourceIds[0]] != 18 {
+		t.Errorf("resources %x, decimals %v", c.resourceIds, c.decimals)
+	}
+	if c.fees.ConfTarget != 6 || c.fees.Floor != fee.PerVByte(1) || c.fees.Fallback != c.fees.Floor || c.fees.Ceiling != fee.PerVByte(100) || c.fees.MaxFee != DefaultMaxFee {
+		t.Errorf("fees %+v", c.fees)
+	}
+	if c.params != &address.MainNetParams {
+		t.Errorf("network %s, want main by default", c.params.Name)
+	}
+	if c.walletPassphrase != "" || c.useSSL {
+		t.Errorf("passphrase %q, ssl %v", c.walletPassphrase, c.useSSL)
+	}
+	if c.sinks != (sinkConfig{streamSubject: "bitcoingold.deposits"}) {
+		t.Errorf("sinks %+v, want none", c.sinks)
+	}
+
+	// the fallback rate is one of the rates paid
+	cfg.Opts[FallbackFeeRateOpt] = "150"
+	if _, err := parseConfig(cfg); err == nil || !strings.Contains(err.Error(), "fallback") {
+		t.Errorf("fallback over maxFeeRate accepted: %v", err)
+	}
+	delete(cfg.Opts, FallbackFeeRateOpt)
+
+	// every resource has its decimals
+	cfg.Opts[ResourceIdsOpt] = testResourceId + ",0x" + strings.Repeat("01", 32)
+	if _, err := parseConfig(cfg); err == nil || !strings.Contains(err.Error(), "resourceDecimals: no decimals for resource 0101") {
+		t.Errorf("resource without decimals accepted: %v", err)
+	}
+	cfg.Opts[ResourceIdsOpt] = testResourceId
+
+	// the addresses are encoded for the node's network
+	cfg.Opts[NetworkOpt] = "regtest"
+	c, err = parseConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.params != &address.RegTestParams || !strings.HasPrefix(c.watchAddress, "tbtg1q") {
+		t.Errorf("network %s, watched address %q", c.params.Name, c.watchAddress)
+	}
+	delete(cfg.Opts, NetworkOpt)
+
+	// the sinks are checked with the other options
+	cfg.Opts[SinkStreamOpt] = "unix:/run/nats.sock"
+	c, err = parseConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.sinks.streamNetwork != "unix" || c.sinks.streamAddress != "/run/nats.sock" {
+		t.Errorf("stream sink %+v", c.sinks)
+	}
+	delete(cfg.Opts, SinkStreamOpt)
+
+	// the chain's from must be the descriptor's address
+	cfg.From = "GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE5"
+	if _, err := parseConfig(cfg); err == nil || !strings.Contains(err.Error(), "not to from") {
+		t.Errorf("from %s accepted: %v", cfg.From, err)
+	}
+}
+
+func TestParseConfigReportsEveryError(t *testing.T) {
+	cfg := &core.ChainConfig{
+		Name: "btg",
+		Opts: map[string]string{
+			RpcUserOpt:          "user",
+			CookieFileOpt:       "/nonexistent/.cookie",
+			UseSSLOpt:           "maybe",
+			StartBlockOpt:       "tip",
+			PollIntervalOpt:     "1ms",
+			ResourceIdsOpt:      testResourceId,
+			MinAmountOpt:        "1 BTG",
+			SignerKeyFileOpt:    "/nonexistent/signer.wif",
+			MinFeeRateOpt:       "slow",
+			CosignersOpt:        "http://relayer2:8000",
+			SigningTimeoutOpt:   "500ms",
+			NetworkOpt:          "signet",
+			SinkStdoutOpt:       "yes please",
+			SinkWebhookOpt:      "https://ops.example/deposits",
+			SinkStreamOpt:       "nats://127.0.0.1:4222",
+			"rpcPasword":        "typo",
+			"substrateEndpoint": "ws://127.0.0.1:9944",
+		},
+	}
+	_, err := parseConfig(cfg)
+	if err == nil {
+		t.Fatal("invalid options accepted")
+	}
+	for _, want := range []string{
+		`unknown option "rpcPasword"`,
+		`unknown option "substrateEndpoint"`,
+		"endpoint is required",
+		"cookieFile excludes rpcUser and rpcPassword",
+		"useSSL must be true or false",
+		"wallet is required",
+		"from or watchDescriptor is required",
+		"startBlock must be a block height",
+		"pollInterval must be at least 100ms",
+		"resourceDecimals is required",
+		`network must be main, test or regtest, got "signet"`,
+		"minAmount must be an amount in satoshis",
+		"signerKeyFile: open /nonexistent/signer.wif",
+		"minFeeRate must be a rate in sat/vB",
+		`cosigners: invalid pair "http://relayer2:8000", expected key=url`,
+		"signingTimeout must be at least 1s",
+		"sinkStdout must be true or false",
+		"sinkWebhookSecret is required with sinkWebhook",
+		`sinkStream must be tcp:host:port or unix:path, got "nats://127.0.0.1:4222"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestParseConfigCosigners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keys := testKeys()
+	w, _, _ := newTestWriter(t, dir, 2, keys[0], deposittest.NewFakeSource())
+	w.store.Close()
+	if len(w.cfg.relayers) != 3 || !contains(w.cfg.relayers, w.cfg.self) || w.cfg.signingTimeout != DefaultSigningTimeout {
+		t.Fatalf("relayers %v, self %s, signing timeout %s", w.cfg.relayers, w.cfg.self, w.cfg.signingTimeout)
+	}
+
+	pubKey := func(i int) string { return fmt.Sprintf("%x", keys[i].PubKey().SerializeCompressed()) }
+	opts := map[string]string{
+		RpcUserOpt:         "user",
+		RpcPasswordOpt:     "password",
+		WalletOpt:          "bridge",
+		WatchDescriptorOpt: testDescriptor(2),
+		ResourceIdsOpt:     testResourceId,
+		SignerKeyFileOpt:   filepath.Join(dir, pubKey(0)[2:10]+".wif"),
+		CosignersOpt:       pubKey(1) + "=http://relayer2:8000/, " + pubKey(2) + "=http://relayer3:8000",
+		CosignerListenOpt:  ":8000",
+		SigningTimeoutOpt:  "30s",
+	}
+	opts[ResourceDecimalsOpt] = testResourceId + ":18"
+	c, err := parseConfig(&core.ChainConfig{Name: "btg", Endpoint: "127.0.0.1:8332", Opts: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.cosigners[pubKey(1)] != "http://relayer2:8000" || len(c.cosigners) != 2 || c.cosignerListen != ":8000" || c.signingTimeout != 30*time.Second {
+		t.Errorf("cosigners %v, listen %q, signing timeout %s", c.cosigners, c.cosignerListen, c.signingTimeout)
+	}
+
+	other := fmt.Sprintf("%x", secp256k1.PrivKeyFromBytes([]byte{4}).PubKey().SerializeCompressed())
+	for cosigners, want := range map[string]string{
+		pubKey(0) + "=http://relayer1:8000": "is this relayer's key",
+		other + "=http://relayer4:8000":     "is not a key of watchDescriptor",
+	} {
+		opts[CosignersOpt] = cosigners
+		if _, err := parseConfig(&core.ChainConfig{Name: "btg", Endpoint: "127.0.0.1:8332", Opts: opts}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: %v, want %q", cosigners, err, want)
+		}
+	}
+}
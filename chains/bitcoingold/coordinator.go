@@ -0,0 +1,299 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package bitcoingold
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ChainSafe/chainbridge-utils/msg"
+	"github.com/ChainSafe/log15"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// Kinds of the requests between relayers
+const (
+	// KindPropose asks a relayer to sign a withdrawal
+	KindPropose = "propose"
+
+	// KindBroadcast tells a relayer a withdrawal is broadcast
+	KindBroadcast = "broadcast"
+)
+
+// A Request is sent by a relayer to another about the withdrawal of a
+// transfer. The relayers are named by their key of the multisig in hex, and
+// sign their requests with it.
+type Request struct {
+	Kind   string      `json:"kind"`
+	Source msg.ChainId `json:"source"`
+	Nonce  msg.Nonce   `json:"nonce"`
+	Height uint64      `json:"height"`
+	From   string      `json:"from"`
+	PSBT   string      `json:"psbt"`
+
+	// The DER signature of the request by From, in hex
+	Signature string `json:"signature"`
+}
+
+// requestTag separates the digests of the requests from other data signed
+// with the relayers' keys
+const requestTag = "bitcoingold/cosign"
+
+// digest returns the hash signed by the sender of r
+func (r *Request) digest() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(requestTag)
+	for _, s := range []string{r.Kind, r.From, r.PSBT} {
+		wire.WriteVarBytes(&buf, []byte(s))
+	}
+	buf.WriteByte(byte(r.Source))
+	binary.Write(&buf, binary.LittleEndian, uint64(r.Nonce))
+	binary.Write(&buf, binary.LittleEndian, r.Height)
+	h := sha256.Sum256(buf.Bytes())
+	return h[:]
+}
+
+// sign signs r with key, the key of r.From
+func (r *Request) sign(key *secp256k1.PrivateKey) {
+	r.Signature = hex.EncodeToString(ecdsa.Sign(key, r.digest()).Serialize())
+}
+
+// verify checks that r is signed by the key of r.From
+func (r *Request) verify() error {
+	b, err := hex.DecodeString(r.From)
+	if err != nil {
+		return err
+	}
+	pubKey, err := secp256k1.ParsePubKey(b)
+	if err != nil {
+		return err
+	}
+	if b, err = hex.DecodeString(r.Signature); err != nil {
+		return err
+	}
+	sig, err := ecdsa.ParseDERSignature(b)
+	if err != nil {
+		return err
+	}
+	if !sig.Verify(r.digest(), pubKey) {
+		return fmt.Errorf("request not signed by %s", r.From)
+	}
+	return nil
+}
+
+// A Response is the answer to a request
+type Response struct {
+	// The withdrawal with the relayer's signatures
+	PSBT string `json:"psbt,omitempty"`
+
+	// The relayer signed another withdrawal of the transfer, given in PSBT
+	Conflict bool `json:"conflict,omitempty"`
+
+	// The relayer knows the withdrawal in PSBT is broadcast
+	Broadcast bool `json:"broadcast,omitempty"`
+}
+
+// A Transport carries the requests to the other relayers
+type Transport interface {
+	Send(peer string, req *Request) (*Response, error)
+}
+
+// A Handler answers the requests of the other relayers
+type Handler interface {
+	Handle(req *Request) (*Response, error)
+}
+
+// The coordinator has the relayers sign the same withdrawal of each transfer.
+// The relayers take turns proposing it: at the best block height h of their
+// nodes, the proposer of the transfer of nonce n is the relayer n+h of the
+// multisig's keys, in script order. The proposer sends its withdrawal to the
+// others, merges their signatures once verified, signs last and broadcasts
+// the withdrawal. A relayer offline or slow at its height passes its turn to
+// the next at the next block. The others accept the proposals of the
+// heights a block away from theirs, their nodes not being in sync.
+//
+// A relayer only signs withdrawals spending an input of the first it signed
+// for a transfer, so with a threshold over half of the relayers no two
+// withdrawals of a transfer can both be mined.
+type coordinator struct {
+	w         *writer
+	transport Transport
+	timeout   time.Duration
+	log       log15.Logger
+	stop      <-chan int
+}
+
+func newCoordinator(w *writer, transport Transport, timeout time.Duration, log log15.Logger, stop <-chan int) *coordinator {
+	return &coordinator{
+		w:         w,
+		transport: transport,
+		timeout:   timeout,
+		log:       log,
+		stop:      stop,
+	}
+}
+
+// start runs the coordinator, and serves the other relayers on the
+// cosignerListen address if any
+func (c *coordinator) start() {
+	if listen := c.w.cfg.cosignerListen; listen != "" {
+		srv := &http.Server{Addr: listen, Handler: cosignHandler(c)}
+		go func() {
+			<-c.stop
+			srv.Close()
+		}()
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				c.w.sysErr <- fmt.Errorf("bitcoingold cosigner server: %v", err)
+			}
+		}()
+	}
+	go c.run()
+}
+
+// run proposes the withdrawals of the relayer's turns, four times a signing
+// timeout and as a transfer is received
+func (c *coordinator) run() {
+	ticker := time.NewTicker(c.timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		case <-c.w.wake:
+		}
+		c.poll()
+	}
+}
+
+// poll proposes the withdrawals of the payouts the relayer proposes at the
+// node's height
+func (c *coordinator) poll() {
+	payouts, err := c.w.store.Payouts(store.PayoutSigning)
+	if err != nil {
+		c.log.Error("Failed to list the payouts", "err", err)
+		return
+	}
+	if len(payouts) == 0 {
+		return
+	}
+	height, err := c.w.conn.GetBlockCount()
+	if err != nil {
+		c.log.Error("Failed to get the block height", "err", err)
+		return
+	}
+	for _, p := range payouts {
+		err := c.step(p, height)
+		switch {
+		case errors.Is(err, errRejected):
+			c.w.report(msg.ChainId(p.Source), msg.Nonce(p.Nonce), err)
+		case err != nil:
+			c.log.Warn("Withdrawal not signed", "source", p.Source, "nonce", p.Nonce, "err", err)
+		}
+	}
+}
+
+// proposer returns the relayer proposing the withdrawal of the transfer of
+// nonce at a height
+func (c *coordinator) proposer(nonce msg.Nonce, height uint64) string {
+	relayers := c.w.cfg.relayers
+	return relayers[(uint64(nonce)+height)%uint64(len(relayers))]
+}
+
+// send signs req as the relayer and sends it to peer
+func (c *coordinator) send(peer string, req *Request) (*Response, error) {
+	req.From = c.w.cfg.self
+	req.sign(c.w.cfg.signer)
+	return c.transport.Send(peer, req)
+}
+
+// step proposes the withdrawal of p to the other relayers if the relayer is
+// its proposer at height, until it is broadcast
+func (c *coordinator) step(p *store.Payout, height uint64) error {
+	if c.proposer(msg.Nonce(p.Nonce), height) != c.w.cfg.self {
+		return nil
+	}
+	source, nonce := msg.ChainId(p.Source), msg.Nonce(p.Nonce)
+	b64, done, err := c.w.propose(source, nonce)
+	if err != nil {
+		return err
+	}
+	for _, peer := range c.w.cfg.relayers {
+		if done {
+			break
+		}
+		if peer == c.w.cfg.self {
+			continue
+		}
+		r, err := c.send(peer, &Request{Kind: KindPropose, Source: source, Nonce: nonce, Height: height, PSBT: b64})
+		if err != nil {
+			c.log.Debug("Relayer did not sign", "peer", peer, "source", source, "nonce", nonce, "err", err)
+			continue
+		}
+		next, ok, err := c.w.collect(source, nonce, r)
+		if errors.Is(err, errRejected) {
+			return err
+		}
+		if err != nil {
+			c.log.Warn("Invalid signatures", "peer", peer, "source", source, "nonce", nonce, "err", err)
+			continue
+		}
+		b64, done = next, ok
+	}
+	if done {
+		c.announce(source, nonce, height, b64)
+	}
+	return nil
+}
+
+// announce tells the other relayers the withdrawal of a transfer is
+// broadcast, they stop waiting for it
+func (c *coordinator) announce(source msg.ChainId, nonce msg.Nonce, height uint64, b64 string) {
+	for _, peer := range c.w.cfg.relayers {
+		if peer == c.w.cfg.self {
+			continue
+		}
+		_, err := c.send(peer, &Request{Kind: KindBroadcast, Source: source, Nonce: nonce, Height: height, PSBT: b64})
+		if err != nil {
+			c.log.Debug("Relayer not told of the broadcast", "peer", peer, "source", source, "nonce", nonce, "err", err)
+		}
+	}
+}
+
+// Handle answers the requests of the other relayers
+func (c *coordinator) Handle(req *Request) (*Response, error) {
+	if req.From == c.w.cfg.self || !contains(c.w.cfg.relayers, req.From) {
+		return nil, fmt.Errorf("%s is not a relayer", req.From)
+	}
+	if err := req.verify(); err != nil {
+		return nil, err
+	}
+	switch req.Kind {
+	case KindPropose:
+		height, err := c.w.conn.GetBlockCount()
+		if err != nil {
+			return nil, err
+		}
+		if req.Height+1 < height || req.Height > height+1 {
+			return nil, fmt.Errorf("proposal at height %d, the node is at %d", req.Height, height)
+		}
+		if c.proposer(req.Nonce, req.Height) != req.From {
+			return nil, fmt.Errorf("%s is not the proposer at height %d", req.From, req.Height)
+		}
+		return c.w.cosign(req.Source, req.Nonce, req.PSBT)
+	case KindBroadcast:
+		return &Response{}, c.w.announced(req.Source, req.Nonce, req.PSBT)
+	}
+	return nil, errors.New("unknown request")
+}
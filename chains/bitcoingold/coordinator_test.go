@@ -0,0 +1,385 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package bitcoingold
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/chainbridge-utils/msg"
+	"github.com/ChainSafe/log15"
+	bitcoind "github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit/deposittest"
+	"github.com/www222fff/watchUTXO/go-bitcoind/fee"
+	"github.com/www222fff/watchUTXO/go-bitcoind/psbt"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+)
+
+const testTimeout = time.Minute
+
+// testRelayer is a relayer of a test multisig
+type testRelayer struct {
+	w      *writer
+	node   *fakeNode
+	sysErr chan error
+	utxos  *deposittest.FakeSource
+	coord  *coordinator
+}
+
+// newTestRelayers returns the three relayers of a required-of-3 multisig in
+// script order, connected by the returned transport, their nodes at height 0
+func newTestRelayers(t *testing.T, dir string, required int) ([]*testRelayer, *memoryTransport) {
+	transport := newMemoryTransport()
+	var relayers []*testRelayer
+	for _, key := range testKeys() {
+		utxos := deposittest.NewFakeSource()
+		w, node, sysErr := newTestWriter(t, dir, required, key, utxos)
+		c := newCoordinator(w, transport, testTimeout, log15.Root(), nil)
+		transport.register(w.cfg.self, c)
+		relayers = append(relayers, &testRelayer{w: w, node: node, sysErr: sysErr, utxos: utxos, coord: c})
+	}
+	sort.Slice(relayers, func(i, j int) bool { return relayers[i].w.cfg.self < relayers[j].w.cfg.self })
+	for i, r := range relayers {
+		if r.w.cfg.self != r.w.cfg.relayers[i] {
+			t.Fatalf("relayer %d is %s, not %s", i, r.w.cfg.self, r.w.cfg.relayers[i])
+		}
+	}
+	return relayers, transport
+}
+
+// fund gives r's view of the multisig the outputs numbered seqs, of 1 BTG
+// each, and of amount btg for the last
+func fund(r *testRelayer, btg int64, seqs ...uint32) {
+	multisig := fmt.Sprintf("%x", r.w.cfg.multisig.ScriptPubKey)
+	var utxos []bitcoind.UTXO
+	for i, seq := range seqs {
+		amount := int64(100000000)
+		if i == len(seqs)-1 {
+			amount = btg * 100000000
+		}
+		utxos = append(utxos, deposittest.UTXO(seq, r.w.cfg.watchAddress, multisig, amount, 10))
+	}
+	r.utxos.Set(utxos...)
+}
+
+// mine moves the nodes of the relayers to height
+func mine(relayers []*testRelayer, height uint64) {
+	for _, r := range relayers {
+		r.node.height = height
+	}
+}
+
+// resolve delivers m to the relayers
+func resolve(t *testing.T, relayers []*testRelayer, m msg.Message) {
+	for i, r := range relayers {
+		if !r.w.ResolveMessage(m) {
+			t.Fatalf("relayer %d did not resolve the transfer: %v", i, drain(r.sysErr))
+		}
+	}
+}
+
+// sent returns the transactions broadcast by the relayers
+func sent(relayers []*testRelayer) []string {
+	var txids []string
+	for _, r := range relayers {
+		for _, tx := range r.node.sent {
+			txids = append(txids, tx.TxHash().String())
+		}
+	}
+	return txids
+}
+
+func closeRelayers(relayers []*testRelayer) {
+	for _, r := range relayers {
+		r.w.store.Close()
+	}
+}
+
+func TestCoordinatorPaysWithTheThreshold(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	relayers, _ := newTestRelayers(t, dir, 2)
+	defer closeRelayers(relayers)
+	for _, r := range relayers {
+		fund(r, 5, 1, 2)
+	}
+	resolve(t, relayers, testTransfer(t, 7, 3, testRecipient))
+
+	// nonce 7 is proposed by the second relayer at height 0
+	for _, r := range relayers {
+		r.coord.poll()
+	}
+	txids := sent(relayers)
+	if len(txids) != 1 || len(relayers[1].node.sent) != 1 {
+		t.Fatalf("sent %v", txids)
+	}
+	tx := relayers[1].node.sent[0]
+	charged := fee.PerVByte(10).Fee(fee.MultisigVSize(tx, 2, relayers[1].w.cfg.multisig.WitnessScript))
+	if len(tx.TxIn) != 1 || len(tx.TxIn[0].Witness) != 4 || tx.TxOut[0].Value != 300000000-charged || tx.TxOut[1].Value != 200000000 {
+		t.Fatalf("withdrawal %+v", tx)
+	}
+	for i, r := range relayers {
+		p, err := r.w.store.Payout(1, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Status != store.PayoutBroadcast || p.TxID != txids[0] {
+			t.Errorf("relayer %d: payout %s, txid %s", i, p.Status, p.TxID)
+		}
+		if errs := drain(r.sysErr); len(errs) != 0 {
+			t.Errorf("relayer %d: %v", i, errs)
+		}
+	}
+}
+
+func TestCoordinatorRotatesTheProposer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	relayers, transport := newTestRelayers(t, dir, 2)
+	defer closeRelayers(relayers)
+	for _, r := range relayers {
+		fund(r, 5, 1, 2)
+	}
+	resolve(t, relayers, testTransfer(t, 7, 3, testRecipient))
+
+	// the proposer at height 0 is offline
+	transport.setOffline(relayers[1].w.cfg.self, true)
+	relayers[0].coord.poll()
+	relayers[2].coord.poll()
+	if txids := sent(relayers); len(txids) != 0 {
+		t.Fatalf("sent %v at height 0", txids)
+	}
+
+	// the third relayer proposes at height 1
+	mine(relayers, 1)
+	relayers[0].coord.poll()
+	relayers[2].coord.poll()
+	if txids := sent(relayers); len(txids) != 1 || len(relayers[2].node.sent) != 1 {
+		t.Fatalf("sent %v at height 1", txids)
+	}
+
+	// back in its turn, the second relayer learns of the broadcast
+	transport.setOffline(relayers[1].w.cfg.self, false)
+	if p, _ := relayers[1].w.store.Payout(1, 7); p.Status != store.PayoutSigning {
+		t.Fatalf("payout %s while offline", p.Status)
+	}
+	mine(relayers, 3)
+	relayers[1].coord.poll()
+	p, err := relayers[1].w.store.Payout(1, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != store.PayoutBroadcast || p.TxID != relayers[2].node.sent[0].TxHash().String() {
+		t.Errorf("payout %s, txid %s", p.Status, p.TxID)
+	}
+	if txids := sent(relayers); len(txids) != 1 {
+		t.Errorf("sent %v", txids)
+	}
+}
+
+func TestCoordinatorRetriesTheBroadcast(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	relayers, _ := newTestRelayers(t, dir, 2)
+	defer closeRelayers(relayers)
+	for _, r := range relayers {
+		fund(r, 5, 1, 2)
+	}
+	resolve(t, relayers, testTransfer(t, 7, 3, testRecipient))
+
+	// the mempool rejects the withdrawal for now, it stays signed
+	proposer := relayers[1]
+	proposer.node.reject = &bitcoind.RPCError{Code: -26, Message: "min relay fee not met"}
+	proposer.coord.poll()
+	p, _ := proposer.w.store.Payout(1, 7)
+	if p.Status != store.PayoutSigning || p.Anchor == "" {
+		t.Fatalf("payout %+v after a rejection by the mempool", p)
+	}
+	if errs := drain(proposer.sysErr); len(errs) != 0 {
+		t.Fatalf("rejection by the mempool reported: %v", errs)
+	}
+
+	proposer.node.reject = nil
+	proposer.coord.poll()
+	if p, _ := proposer.w.store.Payout(1, 7); p.Status != store.PayoutBroadcast || len(proposer.node.sent) != 1 {
+		t.Fatalf("payout %s, sent %v", p.Status, sent(relayers))
+	}
+}
+
+func TestCoordinatorFailsRejectedWithdrawals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	relayers, _ := newTestRelayers(t, dir, 2)
+	defer closeRelayers(relayers)
+	for _, r := range relayers {
+		fund(r, 5, 1, 2)
+	}
+	resolve(t, relayers, testTransfer(t, 7, 3, testRecipient))
+
+	proposer := relayers[1]
+	proposer.node.reject = &bitcoind.RPCError{Code: -22, Message: "TX decode failed"}
+	proposer.coord.poll()
+	if p, _ := proposer.w.store.Payout(1, 7); p.Status != store.PayoutFailed {
+		t.Fatalf("payout %s after a final rejection", p.Status)
+	}
+	if errs := drain(proposer.sysErr); len(errs) != 1 {
+		t.Fatalf("reported %v", errs)
+	}
+}
+
+func TestCoordinatorAdoptsTheWithdrawalSignedBefore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	relayers, transport := newTestRelayers(t, dir, 3)
+	defer closeRelayers(relayers)
+	fund(relayers[0], 5, 1, 2)
+	fund(relayers[1], 5, 1, 2)
+	// the third relayer sees a larger output, it would spend it instead
+	fund(relayers[2], 9, 1, 2, 3)
+	resolve(t, relayers, testTransfer(t, 7, 3, testRecipient))
+
+	// the first relayer signs the withdrawal proposed at height 0, the third
+	// is offline so it is not complete
+	transport.setOffline(relayers[2].w.cfg.self, true)
+	relayers[1].coord.poll()
+	signed, _ := relayers[0].w.store.Payout(1, 7)
+	if signed.Anchor == "" {
+		t.Fatal("the first relayer did not sign")
+	}
+
+	// at height 1 the third relayer proposes its own withdrawal and adopts
+	// the one the first relayer signed, its proposer offline in turn
+	transport.setOffline(relayers[2].w.cfg.self, false)
+	transport.setOffline(relayers[1].w.cfg.self, true)
+	mine(relayers, 1)
+	relayers[2].coord.poll()
+	p, _ := relayers[2].w.store.Payout(1, 7)
+	if p.Status != store.PayoutSigning || p.PSBT == "" || !contains(p.Inputs, signed.Anchor) {
+		t.Fatalf("payout %+v", p)
+	}
+
+	transport.setOffline(relayers[1].w.cfg.self, false)
+	relayers[2].coord.poll()
+	txids := sent(relayers)
+	if len(txids) != 1 || len(relayers[2].node.sent) != 1 {
+		t.Fatalf("sent %v", txids)
+	}
+	tx := relayers[2].node.sent[0]
+	if len(tx.TxIn) != 1 || tx.TxIn[0].PreviousOutPoint.String() != signed.Anchor || len(tx.TxIn[0].Witness) != 5 {
+		t.Fatalf("withdrawal %+v", tx)
+	}
+	for i, r := range relayers {
+		p, _ := r.w.store.Payout(1, 7)
+		if p.Status != store.PayoutBroadcast || p.TxID != txids[0] {
+			t.Errorf("relayer %d: payout %s, txid %s", i, p.Status, p.TxID)
+		}
+	}
+	// the output the third relayer meant to spend is free again
+	reserved, err := relayers[2].w.store.Reserved()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reserved) != 1 || !reserved[signed.Anchor] {
+		t.Errorf("reserved %v", reserved)
+	}
+}
+
+func TestCoordinatorRejectsBadProposals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	relayers, _ := newTestRelayers(t, dir, 2)
+	defer closeRelayers(relayers)
+	for _, r := range relayers {
+		fund(r, 5, 1, 2)
+	}
+	resolve(t, relayers, testTransfer(t, 7, 3, testRecipient))
+
+	p, _ := relayers[1].w.store.Payout(1, 7)
+	pkt, err := relayers[1].w.build(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposal := func(modify func(pkt *psbt.Packet)) string {
+		c := pkt.Copy()
+		modify(c)
+		b64, err := c.B64Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b64
+	}
+	request := func(from int, height uint64, b64 string) *Request {
+		req := &Request{Kind: KindPropose, Source: 1, Nonce: 7, Height: height, From: relayers[from].w.cfg.self, PSBT: b64}
+		req.sign(relayers[from].w.cfg.signer)
+		return req
+	}
+	good := proposal(func(*psbt.Packet) {})
+	unknown := request(1, 2, good)
+	unknown.Nonce = 8
+	unknown.sign(relayers[1].w.cfg.signer)
+	forged := request(1, 0, good)
+	forged.sign(relayers[2].w.cfg.signer)
+	tampered := request(1, 0, good)
+	tampered.Nonce = 4
+
+	// the first relayer's node is at height 2
+	mine(relayers[:1], 2)
+	for name, req := range map[string]*Request{
+		"not the proposer":  request(2, 2, good),
+		"not a relayer":     {Kind: KindPropose, Source: 1, Nonce: 7, From: "02aa", PSBT: good},
+		"unsigned":          {Kind: KindPropose, Source: 1, Nonce: 7, Height: 3, From: relayers[1].w.cfg.self, PSBT: good},
+		"forged":            forged,
+		"tampered":          tampered,
+		"stale height":      request(1, 0, good),
+		"unknown transfer":  unknown,
+		"not a psbt":        request(1, 3, base64.StdEncoding.EncodeToString([]byte("withdrawal"))),
+		"over the transfer": request(1, 3, proposal(func(c *psbt.Packet) { c.UnsignedTx.TxOut[0].Value = 300000001 })),
+		"over maxFeeRate":   request(1, 3, proposal(func(c *psbt.Packet) { c.UnsignedTx.TxOut[0].Value -= 20000 })),
+		"fee not deducted":  request(1, 3, proposal(func(c *psbt.Packet) { c.UnsignedTx.TxOut[1].Value -= DustLimit })),
+		"change to another": request(1, 3, proposal(func(c *psbt.Packet) { c.UnsignedTx.TxOut[1].PkScript = c.UnsignedTx.TxOut[0].PkScript })),
+		"hash type":         request(1, 3, proposal(func(c *psbt.Packet) { c.Inputs[0].SighashType = 0x42 })),
+	} {
+		if _, err := relayers[0].coord.Handle(req); err == nil {
+			t.Errorf("%s: signed", name)
+		}
+	}
+	if p, _ := relayers[0].w.store.Payout(1, 7); p.Anchor != "" || p.PSBT != "" {
+		t.Errorf("payout %+v after bad proposals", p)
+	}
+
+	r, err := relayers[0].coord.Handle(request(1, 3, good))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := psbt.NewFromBase64(r.PSBT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := signed.SignatureStatus(0); len(status.SignedBy) != 1 {
+		t.Errorf("signatures %s", status)
+	}
+}
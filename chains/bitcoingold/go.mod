@@ -1,3 +1,11 @@
 module github.com/www222fff/watchUTXO/chains/bitcoingold
 
 go 1.13
+
+replace github.com/www222fff/watchUTXO/go-bitcoind => ../../go-bitcoind
+
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.1
+	github.com/ethereum/go-ethereum v1.9.25
+	github.com/www222fff/watchUTXO/go-bitcoind v0.0.0-00010101000000-000000000000
+)
@@ -5,53 +5,93 @@ package bitcoingold
 
 import (
 	"errors"
-	"time"
-	"strconv"
+	"fmt"
 	"math/big"
-	"github.com/ChainSafe/log15"
+	"sync"
+	"time"
+
 	"github.com/ChainSafe/ChainBridge/chains"
 	metrics "github.com/ChainSafe/chainbridge-utils/metrics/types"
 	"github.com/ChainSafe/chainbridge-utils/msg"
-        "github.com/www222fff/watchUTXO/go-bitcoind"
-	"github.com/ethereum/go-ethereum/common/hexutil"
-	utils "github.com/ChainSafe/ChainBridge/shared/substrate"
-	"github.com/ChainSafe/chainbridge-utils/keystore"
-	"github.com/centrifuge/go-substrate-rpc-client/types"
+	"github.com/ChainSafe/log15"
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/memo"
+	"github.com/www222fff/watchUTXO/go-bitcoind/mempool"
+	"github.com/www222fff/watchUTXO/go-bitcoind/merkle"
+	"github.com/www222fff/watchUTXO/go-bitcoind/scanner"
+	"github.com/www222fff/watchUTXO/go-bitcoind/sink"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+	"github.com/www222fff/watchUTXO/go-bitcoind/zmq"
 )
 
 type listener struct {
-	name          string
-        watchAddr     []string
-	chainId       msg.ChainId
-	conn          *bitcoind.Bitcoind
-	router        chains.Router
-	log           log15.Logger
-	stop          <-chan int
-	sysErr        chan<- error
-	latestBlock   metrics.LatestBlock
-	metrics       *metrics.ChainMetrics
+	name         string
+	watchAddr    []string
+	chainId      msg.ChainId
+	conn         *bitcoind.Bitcoind
+	utxos        deposit.UTXOSource
+	verifier     *merkle.Verifier
+	policy       *deposit.Policy
+	limits       *deposit.Limits
+	decimals     map[msg.ResourceId]uint8 // of the destination tokens
+	scanner      *scanner.Scanner
+	mempool      *mempool.Watcher // nil unless enabled
+	zmqEndpoint  string           // node notifications cutting the polling interval short, if any
+	pollInterval time.Duration
+	resourceId   msg.ResourceId   // the resource the deposits are credited with
+	sinks        *sink.Dispatcher // nil without sinks
+	store        *store.Store
+	router       chains.Router
+	log          log15.Logger
+	stop         <-chan int
+	done         chan struct{}      // closed when the polling stops, nil before start
+	resends      map[string]*resend // by outpoint, the deposits whose send failed
+	sysErr       chan<- error
+	latestBlock  metrics.LatestBlock
+	metrics      *metrics.ChainMetrics
 }
 
 // Frequency of polling for a new block
 var BlockRetryInterval = time.Second * 5
 var BlockRetryLimit = 5
 var ErrFatalPolling = errors.New("listener UTXO polling failed")
-var substrateChainId msg.ChainId = 1
-var bitcoingoldChain msg.ChainId = 2
-var resourceId [32]byte
-var AliceKey = keystore.TestKeyRing.SubstrateKeys[keystore.AliceKey].AsKeyringPair()
 
-func NewListener(conn *bitcoind.Bitcoind, name string, from string, id msg.ChainId, log log15.Logger, stop <-chan int, sysErr chan<- error, m *metrics.ChainMetrics) *listener {
+// Bounds of the delay before a final deposit whose send failed is routed
+// again, doubling with each failure
+var ResendMinBackoff = 30 * time.Second
+var ResendMaxBackoff = time.Hour
+
+// a resend is the backoff of a deposit whose send failed
+type resend struct {
+	attempts int
+	next     time.Time
+}
+
+func NewListener(conn *bitcoind.Bitcoind, utxos deposit.UTXOSource, verifier *merkle.Verifier, cfg *Config, sc *scanner.Scanner, mp *mempool.Watcher, sinks *sink.Dispatcher, st *store.Store, log log15.Logger, stop <-chan int, sysErr chan<- error, m *metrics.ChainMetrics) *listener {
 	return &listener{
-		name:          name,
-                watchAddr:     []string{from},
-		chainId:       id,
-		conn:          conn,
-		log:           log,
-		stop:          stop,
-		sysErr:        sysErr,
-		latestBlock:   metrics.LatestBlock{LastUpdated: time.Now()},
-		metrics:       m,
+		name:         cfg.name,
+		watchAddr:    []string{cfg.watchAddress},
+		chainId:      cfg.id,
+		conn:         conn,
+		utxos:        utxos,
+		verifier:     verifier,
+		policy:       cfg.policy,
+		limits:       cfg.limits,
+		decimals:     cfg.decimals,
+		scanner:      sc,
+		mempool:      mp,
+		zmqEndpoint:  cfg.zmqEndpoint,
+		pollInterval: cfg.pollInterval,
+		resourceId:   cfg.resourceIds[0],
+		sinks:        sinks,
+		store:        st,
+		log:          log,
+		stop:         stop,
+		sysErr:       sysErr,
+		latestBlock:  metrics.LatestBlock{LastUpdated: time.Now()},
+		metrics:      m,
 	}
 }
 
@@ -59,15 +99,11 @@ func (l *listener) setRouter(r chains.Router) {
 	l.router = r
 }
 
-// start creates the initial subscription for all events
+// start polls the deposits in the background
 func (l *listener) start() error {
-
-	err := l.initSubstrateChain()
-	if err != nil {
-		return err
-	}
-
+	l.done = make(chan struct{})
 	go func() {
+		defer close(l.done)
 		err := l.poolUtxo()
 		if err != nil {
 			l.log.Error("Polling blocks failed", "err", err)
@@ -77,37 +113,11 @@ func (l *listener) start() error {
 	return nil
 }
 
-//danny for test
-func (l *listener) initSubstrateChain() error {
-
-	var AliceKey = keystore.TestKeyRing.SubstrateKeys[keystore.AliceKey].AsKeyringPair()
-
-	var relayers = []types.AccountID{
-		types.NewAccountID(AliceKey.PublicKey),
-	}
-
-	var resources = map[msg.ResourceId]utils.Method{
-		// These are taken from the Polkadot JS UI (Chain State -> Constants)
-		msg.ResourceIdFromSlice(hexutil.MustDecode("0x000000000000000000000000000000c76ebe4a02bbc34786d860b355f5a5ce00")): utils.ExampleTransferMethod,
+// wait returns once the polling started by start has stopped
+func (l *listener) wait() {
+	if l.done != nil {
+		<-l.done
 	}
-
-	const relayerThreshold = 1
-	const TestEndpoint = "ws://127.0.0.1:9944"
-
-        client, err := utils.CreateClient(AliceKey, TestEndpoint)
-        if err != nil {
-                return err
-        }
-        err = utils.InitializeChain(client, relayers, []msg.ChainId{bitcoingoldChain}, resources, relayerThreshold)
-        if err != nil {
-                return err
-        }
-        err = utils.QueryConst(client, "Example", "NativeTokenId", &resourceId)
-        if err != nil {
-                return err
-        }
-
-	return nil
 }
 
 // poolUtxo will poll for the latest block and proceed to parse the associated events as it sees new blocks.
@@ -116,95 +126,416 @@ func (l *listener) initSubstrateChain() error {
 func (l *listener) poolUtxo() error {
 	l.log.Info("Polling UTXO...")
 	var retry = BlockRetryLimit
-        utxoMap := make(map[string]bitcoind.UTXO)
-	var nonce = 0
+	tracker := deposit.NewTracker()
+
+	// the sinks receive the deposit events next to the router, until the
+	// polling stops
+	if l.sinks != nil {
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.sinks.Run(time.Second, done, func(err error) {
+				l.log.Warn("Publishing deposit events failed", "err", err)
+			})
+		}()
+		defer wg.Wait()
+		defer close(done)
+	}
 
-        for {
+	var notifications <-chan *zmq.Notification
+	if l.zmqEndpoint != "" {
+		done := make(chan struct{})
+		defer close(done)
+		notifications = zmq.Follow(l.zmqEndpoint, []string{zmq.TopicHashBlock, zmq.TopicHashTx, zmq.TopicSequence}, BlockRetryInterval, done, func(err error) {
+			l.log.Warn("ZMQ subscription failed", "err", err)
+		})
+	}
+
+	for {
 		select {
 		case <-l.stop:
 			return errors.New("terminated")
 		default:
-                        // No more retries, goto next block
-                        if retry == 0 {
-                                l.log.Error("Polling failed, retries exceeded")
-                                l.sysErr <- ErrFatalPolling
-                                return nil
-                        }
+			// No more retries, goto next block
+			if retry == 0 {
+				l.log.Error("Polling failed, retries exceeded")
+				l.sysErr <- ErrFatalPolling
+				return nil
+			}
+
+			// follow the best chain block by block, rolling back on reorgs
+			_, err := l.scanner.Scan(l)
+			if err != nil {
+				l.log.Error("Block scan failed", "err", err)
+				retry--
+				time.Sleep(BlockRetryInterval)
+				continue
+			}
+
+			// pending deposits are only reported, a failure doesn't count as a retry
+			if l.mempool != nil {
+				if err := l.mempool.Poll(l); err != nil {
+					l.log.Warn("Mempool poll failed", "err", err)
+				}
+			}
 
 			//list all utxo of watched multisig address
-			/*utxos, err := l.conn.ListUnspent(1, 999999, l.watchAddr)
+			utxos, err := l.utxos.ListUnspent()
 			if err != nil {
 				l.log.Error("Listunspent failed", "err", err)
-                                retry--
-                                time.Sleep(BlockRetryInterval)
-                                continue
-			}*/
-
-			//danny for test
-			var utxos []bitcoind.UTXO
-			var utxo bitcoind.UTXO
-			nonce ++
-			utxo.TxID = "f35103085b7145e569eb8053365c662cb7b9b7fd6009e37cafbb684bd89b638b" + strconv.Itoa(nonce)
-			utxo.Amount = 1000000000000000000 //1Mill
-			utxo.Address = "btg1qmc6uua0jngs9qr38w3pchcvdcrzu878t8p8nwqtj32rtjvjfvnfqywt5pr"
-			utxos = append(utxos, utxo)
-
-			//filter delta utxo
-			deltaUtxoMap := make(map[string]bitcoind.UTXO)
-
-			for _, utxo := range utxos {
-				if _, ok := utxoMap[utxo.TxID]; ok {
-					l.log.Info("existing", "utxo", utxo)
-				} else {
-					l.log.Info("new added", "utxo", utxo)
-					deltaUtxoMap[utxo.TxID] = utxo
-				}
-				utxo.Refresh = true
-				utxoMap[utxo.TxID] = utxo
+				retry--
+				time.Sleep(BlockRetryInterval)
+				continue
 			}
 
-			//update utxoMap based on the latest utxos
-			for k, v := range utxoMap {
-				if v.Refresh {
-					v.Refresh = false
-				} else {
-					delete(utxoMap, k)
-				}
+			if err := l.observeUnspent(utxos, tracker); err != nil {
+				return err
+			}
+
+			// final deposits not sent, before a crash or for a failed send,
+			// are routed again with the same nonce once their backoff is
+			// over, the relayers drop the duplicates by nonce
+			if err := l.resendPending(); err != nil {
+				l.log.Error("Resending the pending deposits failed", "err", err)
 			}
 
-			//handle new utxo, send deposit event TBD?
-			for k, v := range deltaUtxoMap {
-                                l.log.Info("send deposit event", "txid", k);
-				// Parse out events
-	                        err := l.triggerDepositEvent(v, nonce)
-		                if err != nil {
-					l.log.Error("Failed to trigger events for utxo", "tx", v, "err", err)
+			//pooling interval, cut short by the node's notifications
+			select {
+			case <-l.stop:
+				return errors.New("terminated")
+			case <-time.After(l.pollInterval):
+			case n := <-notifications:
+				if n.Gap {
+					l.log.Warn("ZMQ notifications lost, catching up", "topic", n.Topic)
 				}
 			}
+			retry = BlockRetryLimit
+		}
+	}
+}
+
+// observeUnspent records the deposits of a listunspent poll and routes the
+// final ones. The wallet is not trusted: the confirmations of every deposit
+// come from the verified chain, on every poll. A new deposit that can't be
+// verified is left out of the tracker and checked again on the next poll.
+func (l *listener) observeUnspent(utxos []bitcoind.UTXO, tracker *deposit.Tracker) error {
+	//every output is a deposit of its own, keyed by txid:vout
+	var latest, verified []*deposit.Deposit
+	for _, utxo := range utxos {
+		d, err := deposit.FromUTXO(utxo)
+		if err != nil {
+			l.log.Error("Invalid utxo", "utxo", utxo, "err", err)
+			continue
+		}
+		seen, err := l.store.Seen(d.OutPoint)
+		if err != nil {
+			return err
+		}
+		_, tracked := tracker.Get(d.OutPoint)
+		if err := l.verify(d); err != nil {
+			l.log.Error("Inclusion proof failed, skipping utxo", "outpoint", d.ID(), "err", err)
+			if tracked || seen {
+				// still unspent, its state is left as it was
+				latest = append(latest, d)
+			}
+			continue
+		}
+		latest = append(latest, d)
+		verified = append(verified, d)
+	}
 
-			//pooling interval
-			time.Sleep(BlockRetryInterval)
-                        retry = BlockRetryLimit
+	//handle new utxo, send deposit event
+	_, removed := tracker.Update(latest)
+	for _, d := range verified {
+		// the nonce derives from the position of the deposit, persisted
+		// before routing so a restart routes it again with the same one
+		_, c, err := l.store.Observe(d, l.policy)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			l.DepositChanged(c)
 		}
 	}
+	for _, d := range removed {
+		c, err := l.store.SetState(d.OutPoint, deposit.StateSpent)
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+		if c != nil {
+			l.DepositChanged(c)
+		}
+	}
+	return nil
 }
 
-func (l *listener) triggerDepositEvent(utxo bitcoind.UTXO, nonce int) error {
-        l.log.Debug("Construct deposit events", "utxo", utxo)
+// verify sets the confirmations of d from the verified chain, never from
+// the wallet's count. A stored deposit whose block the scanner stored is
+// confirmed by the scanned blocks. Any other deposit is proven in the best
+// chain again, and placed in the proven block: its position gives the
+// nonce every relayer derives.
+func (l *listener) verify(d *deposit.Deposit) error {
+	r, err := l.store.Get(d.OutPoint)
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+	if r != nil && r.Block != "" {
+		depth, err := l.scannedDepth(r)
+		if err != nil {
+			return err
+		}
+		if depth > 0 {
+			d.Confirmations = depth
+			return nil
+		}
+	}
+	inclusion, err := l.verifier.VerifyTx(d.OutPoint.Hash.String(), "")
+	if err != nil {
+		return err
+	}
+	d.Block, d.Height, d.TxIndex = inclusion.BlockHash.String(), inclusion.Height, inclusion.Index
+	d.Confirmations = uint32(inclusion.Confirmations)
+	l.log.Info("Deposit proven", "outpoint", d.ID(), "block", inclusion.BlockHash, "height", inclusion.Height, "confirmations", inclusion.Confirmations)
+	return nil
+}
 
-	srcId := msg.ChainId(l.chainId)
-	destId := msg.ChainId(substrateChainId)
-	depositNonce := msg.Nonce(nonce)
-        amount := big.NewInt(utxo.Amount)
-	//recipient := []byte("Btg/FromAddress/" + utxo.Address)
-	recipient := AliceKey.PublicKey
+// scannedDepth returns the number of scanned blocks from the block of r,
+// the stored tip height - its height + 1, or 0 if the scanner did not store
+// its block at its height
+func (l *listener) scannedDepth(r *store.Record) (uint32, error) {
+	tip, err := l.store.Tip()
+	if err != nil || tip == nil || r.Height > tip.Height {
+		return 0, err
+	}
+	hash, err := l.store.BlockHash(r.Height)
+	if err == store.ErrNoBlock || err == nil && hash != r.Block {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint32(tip.Height - r.Height + 1), nil
+}
+
+// BlockConnected implements scanner.Handler
+func (l *listener) BlockConnected(block store.Tip) {
+	l.log.Debug("Block connected", "height", block.Height, "hash", block.Hash)
+	l.latestBlock.Height = new(big.Int).SetUint64(block.Height)
+	l.latestBlock.LastUpdated = time.Now()
+	if l.metrics != nil {
+		l.metrics.LatestProcessedBlock.Set(float64(block.Height))
+	}
+}
+
+// BlockDisconnected implements scanner.Handler
+func (l *listener) BlockDisconnected(block store.Tip) {
+	l.log.Warn("Block disconnected by reorg", "height", block.Height, "hash", block.Hash)
+}
+
+// Withdrawn implements scanner.Handler. The withdrawals are logged for the
+// operators to reconcile them with the bridge's: any spend of the multisig
+// is worth a look.
+func (l *listener) Withdrawn(w *deposit.Withdrawal) {
+	l.log.Warn("Withdrawal from the multisig", "txid", w.TxID, "spent", w.Spent, "fee", w.Fee, "block", w.Block, "height", w.Height)
+	for _, o := range w.Outputs {
+		l.log.Info("Withdrawal output", "txid", w.TxID, "address", o.Address, "amount", o.Amount)
+	}
+}
+
+// DepositChanged implements scanner.Handler, it is also called for the
+// changes seen by polling. Only final deposits are routed.
+func (l *listener) DepositChanged(c *store.Change) {
+	r := c.Record
+	l.log.Info("Deposit state changed", "outpoint", r.OutPoint, "from", c.From, "to", r.State, "confirmations", r.Confirmations, "nonce", r.Nonce)
+	switch {
+	case r.State == deposit.StateOrphaned && r.Status == store.StatusSent:
+		// deposits already routed can't be recalled, the operators have to follow up
+		l.log.Error("Routed deposit orphaned by reorg", "outpoint", r.OutPoint, "nonce", r.Nonce)
+	case r.State == deposit.StateFinal && r.Status == store.StatusPending:
+		d, err := r.Deposit()
+		if err != nil {
+			l.log.Error("Invalid deposit record", "outpoint", r.OutPoint, "err", err)
+			return
+		}
+		l.sendDeposit(d, r.Nonce)
+	}
+}
+
+// MempoolChanged implements mempool.Handler. Mempool deposits are never
+// routed, they are logged and published to the sinks for the operators and
+// the UI.
+func (l *listener) MempoolChanged(e *mempool.Event) {
+	d := e.Deposit
+	l.log.Info("Pending deposit", "event", e.Kind, "outpoint", d.ID(), "address", d.Address, "amount", d.Amount, "replaceable", e.Replaceable, "by", e.By)
+	if err := l.store.Publish(e.Change()); err != nil {
+		l.log.Warn("Failed to publish pending deposit", "outpoint", d.ID(), "err", err)
+	}
+}
+
+// resendPending routes the final deposits whose send was not confirmed and
+// whose backoff is over
+func (l *listener) resendPending() error {
+	pending, err := l.store.List(store.StatusPending)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, r := range pending {
+		if r.State != deposit.StateFinal {
+			continue
+		}
+		if b, ok := l.resends[r.OutPoint]; ok && now.Before(b.next) {
+			continue
+		}
+		d, err := r.Deposit()
+		if err != nil {
+			return err
+		}
+		l.sendDeposit(d, r.Nonce)
+	}
+	return nil
+}
+
+// sendDeposit routes a deposit to the recipient of its memo and marks it
+// sent. On failure it stays pending and is sent again by resendPending,
+// after a backoff doubling from ResendMinBackoff with each failure up to
+// ResendMaxBackoff. A deposit out of the limits is rejected, with an event
+// for the sinks. A deposit without a valid memo is quarantined, with an
+// event too, never credited to a default account.
+func (l *listener) sendDeposit(d *deposit.Deposit, nonce uint64) {
+	if l.routeDeposit(d, nonce) {
+		delete(l.resends, d.ID())
+		return
+	}
+	if l.resends == nil {
+		l.resends = make(map[string]*resend)
+	}
+	b, ok := l.resends[d.ID()]
+	if !ok {
+		b = &resend{}
+		l.resends[d.ID()] = b
+	}
+	b.next = time.Now().Add(resendBackoff(b.attempts))
+	b.attempts++
+	l.log.Warn("Deposit left pending", "outpoint", d.ID(), "nonce", nonce, "attempts", b.attempts, "next", b.next)
+}
+
+// resendBackoff returns the delay before routing again a deposit whose send
+// failed attempts times before
+func resendBackoff(attempts int) time.Duration {
+	b := ResendMinBackoff
+	for i := 0; i < attempts && b < ResendMaxBackoff; i++ {
+		b *= 2
+	}
+	if b > ResendMaxBackoff {
+		b = ResendMaxBackoff
+	}
+	return b
+}
+
+// routeDeposit makes one attempt at sending a deposit, it reports whether
+// the deposit left the pending status: sent, rejected or quarantined
+func (l *listener) routeDeposit(d *deposit.Deposit, nonce uint64) bool {
+	l.log.Info("send deposit event", "outpoint", d.ID(), "nonce", nonce)
+	if nonce == 0 {
+		// the other relayers would derive another nonce, wait for the block
+		l.log.Error("Deposit position unknown, not routed", "outpoint", d.ID())
+		return false
+	}
+	amount, err := l.transferAmount(d)
+	if err != nil {
+		l.log.Warn("Deposit rejected", "outpoint", d.ID(), "nonce", nonce, "reason", err)
+		if _, err := l.store.Reject(d.OutPoint, err.Error()); err != nil {
+			l.log.Error("Failed to reject deposit", "outpoint", d.ID(), "err", err)
+			return false
+		}
+		return true
+	}
+	tx, err := l.depositTx(d)
+	if err != nil {
+		l.log.Error("Failed to fetch the deposit transaction", "outpoint", d.ID(), "err", err)
+		return false
+	}
+	m, err := memo.Find(tx)
+	if err == nil && msg.ChainId(m.ChainID) == l.chainId {
+		err = fmt.Errorf("memo: destination chain %d is the source chain", m.ChainID)
+	}
+	if err != nil {
+		l.log.Error("Deposit quarantined", "outpoint", d.ID(), "nonce", nonce, "reason", err)
+		if _, err := l.store.Quarantine(d.OutPoint, err.Error()); err != nil {
+			l.log.Error("Failed to quarantine deposit", "outpoint", d.ID(), "err", err)
+			return false
+		}
+		return true
+	}
+	err = l.triggerDepositEvent(d, nonce, amount, m)
+	if err != nil {
+		l.log.Error("Failed to trigger events for utxo", "outpoint", d.ID(), "err", err)
+		return false
+	}
+	err = l.store.SetStatus(d.OutPoint, store.StatusSent)
+	if err != nil {
+		l.log.Error("Failed to mark deposit sent", "outpoint", d.ID(), "err", err)
+		return false
+	}
+	return true
+}
 
-        m := msg.NewFungibleTransfer(srcId, destId, depositNonce, amount, resourceId, recipient)
-        l.log.Info("Construct deposit message", "msg", m)
-        err := l.router.Send(m)
+// depositTx returns the transaction of a deposit from the wallet, checked
+// against its txid
+func (l *listener) depositTx(d *deposit.Deposit) (*wire.MsgTx, error) {
+	txid := d.OutPoint.Hash.String()
+	t, err := l.conn.GetTransaction(txid)
 	if err != nil {
-                l.log.Error("subscription error: failed to route message", "err", err)
+		return nil, err
+	}
+	tx, err := wire.NewMsgTxFromHex(t.Hex)
+	if err != nil {
+		return nil, err
+	}
+	if tx.TxHash() != d.OutPoint.Hash {
+		return nil, fmt.Errorf("transaction %s hashes to %s", txid, tx.TxHash())
+	}
+	return tx, nil
+}
+
+// transferAmount returns the amount credited for a deposit, the fee
+// deducted, in units of the destination token
+func (l *listener) transferAmount(d *deposit.Deposit) (*big.Int, error) {
+	net, err := l.limits.Net(d.Amount)
+	if err != nil {
+		return nil, err
+	}
+	decimals, ok := l.decimals[l.resourceId]
+	if !ok {
+		return nil, fmt.Errorf("no resourceDecimals for resource %x", l.resourceId)
+	}
+	return deposit.Scale(net, decimals)
+}
+
+func (l *listener) triggerDepositEvent(d *deposit.Deposit, nonce uint64, amount *big.Int, m *memo.Memo) error {
+	l.log.Debug("Construct deposit events", "outpoint", d.ID(), "address", d.Address, "amount", d.Amount, "credited", amount)
+
+	message := l.depositMessage(nonce, amount, m)
+	l.log.Info("Construct deposit message", "msg", message)
+	err := l.router.Send(message)
+	if err != nil {
+		l.log.Error("subscription error: failed to route message", "err", err)
 		return err
 	}
 	return nil
 }
+
+// depositMessage returns the transfer of a deposit's amount to the
+// recipient of its memo. It only depends on the deposit's nonce, amount and
+// memo, so every relayer builds the same message and the bridge counts
+// their votes together.
+func (l *listener) depositMessage(nonce uint64, amount *big.Int, m *memo.Memo) msg.Message {
+	srcId := msg.ChainId(l.chainId)
+	destId := msg.ChainId(m.ChainID)
+	depositNonce := msg.Nonce(nonce)
+	recipient := m.Recipient[:]
+	return msg.NewFungibleTransfer(srcId, destId, depositNonce, amount, l.resourceId, recipient)
+}
@@ -0,0 +1,321 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package bitcoingold
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/chainbridge-utils/core"
+	"github.com/ChainSafe/chainbridge-utils/msg"
+	"github.com/ChainSafe/log15"
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/memo"
+	"github.com/www222fff/watchUTXO/go-bitcoind/mempool"
+	"github.com/www222fff/watchUTXO/go-bitcoind/sink"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+const testTxID = "f35103085b7145e569eb8053365c662cb7b9b7fd6009e37cafbb684bd89b638b"
+
+// newTestListener returns a listener with a state file of its own, as run
+// by another relayer
+func newTestListener(t *testing.T, dir, name string) *listener {
+	st, err := store.Open(filepath.Join(dir, name+".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := deposit.NewPolicy(6, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := deposit.NewLimits(100000, 0, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rid := testResource(t)
+	decimals := map[msg.ResourceId]uint8{rid: 18}
+	return &listener{name: name, chainId: 2, policy: policy, limits: limits, decimals: decimals, resourceId: rid, store: st}
+}
+
+func testResource(t *testing.T) msg.ResourceId {
+	id, err := parseResourceId(testResourceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// testDeposit returns the final deposit at vout of the test transaction,
+// the 13th of block 700000
+func testDeposit(t *testing.T, vout uint32) *deposit.Deposit {
+	op, err := wire.NewOutPoint(testTxID, vout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &deposit.Deposit{
+		OutPoint:      op,
+		Address:       "btg1qmc6uua0jngs9qr38w3pchcvdcrzu878t8p8nwqtj32rtjvjfvnfqywt5pr",
+		Amount:        100000 * int64(vout+1),
+		Confirmations: 6,
+		Block:         "000000000000001c6bb1d1c4ea0a0be2b5b1da8b2ce6c1e3f8b8ac1f2c0a3d1e",
+		Height:        700000,
+		TxIndex:       12,
+	}
+}
+
+func TestListenersBuildTheSameMessages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := newTestListener(t, dir, "a")
+	defer a.store.Close()
+	b := newTestListener(t, dir, "b")
+	defer b.store.Close()
+
+	deposits := []*deposit.Deposit{testDeposit(t, 0), testDeposit(t, 1), testDeposit(t, 2)}
+
+	// a saw the deposits from the mempool on, next to an unrelated one, b
+	// caught up once they were final, in another order
+	unrelated := testDeposit(t, 7)
+	unrelated.Confirmations, unrelated.Block, unrelated.Height, unrelated.TxIndex = 0, "", 0, 0
+	if _, _, err := a.store.Observe(unrelated, a.policy); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range deposits {
+		pending := *d
+		pending.Confirmations, pending.Block, pending.Height, pending.TxIndex = 0, "", 0, 0
+		if _, _, err := a.store.Observe(&pending, a.policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, d := range deposits {
+		if _, _, err := a.store.Observe(d, a.policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := len(deposits) - 1; i >= 0; i-- {
+		if _, _, err := b.store.Observe(deposits[i], b.policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &memo.Memo{Version: memo.Version1, ChainID: 1, Recipient: [32]byte{0xd4, 0x35, 0x93, 0xc7}}
+	nonces := make(map[uint64]bool)
+	for _, d := range deposits {
+		ra, err := a.store.Get(d.OutPoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rb, err := b.store.Get(d.OutPoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ra.State != deposit.StateFinal || rb.State != deposit.StateFinal {
+			t.Fatalf("%s: states %s and %s, want final", d.ID(), ra.State, rb.State)
+		}
+		if ra.Nonce == 0 || nonces[ra.Nonce] {
+			t.Fatalf("%s: nonce %d is not unique", d.ID(), ra.Nonce)
+		}
+		nonces[ra.Nonce] = true
+
+		amount, err := a.transferAmount(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ma := a.depositMessage(ra.Nonce, amount, m)
+		amount, err = b.transferAmount(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mb := b.depositMessage(rb.Nonce, amount, m)
+		if !reflect.DeepEqual(ma, mb) {
+			t.Errorf("%s: messages differ\n%+v\n%+v", d.ID(), ma, mb)
+		}
+	}
+}
+
+func TestTransferAmount(t *testing.T) {
+	rid := testResource(t)
+	l := &listener{decimals: map[msg.ResourceId]uint8{rid: 18}, resourceId: rid}
+	var err error
+	l.limits, err = deposit.NewLimits(100000, 100000000000, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1.5 BTG less the 0.0001 BTG fee, with 18 decimals
+	op, _ := wire.NewOutPoint(testTxID, 0)
+	amount, err := l.transferAmount(&deposit.Deposit{OutPoint: op, Amount: 150000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := new(big.Int).SetString("1499900000000000000", 10)
+	if amount.Cmp(want) != 0 {
+		t.Errorf("amount %s, want %s", amount, want)
+	}
+
+	for _, sats := range []int64{99999, 100000000001} {
+		if _, err := l.transferAmount(&deposit.Deposit{OutPoint: op, Amount: sats}); err == nil {
+			t.Errorf("%d satoshis accepted", sats)
+		}
+	}
+}
+
+// recordSink records the events published to it
+type recordSink struct {
+	events []sink.DepositEvent
+}
+
+func (s *recordSink) Publish(ctx context.Context, e sink.DepositEvent) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func TestListenerPublishesMempoolEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := newTestListener(t, dir, "a")
+	defer l.store.Close()
+	l.log = log15.Root()
+	rec := &recordSink{}
+	l.sinks = sink.NewDispatcher(l.store, map[string]sink.Sink{"rec": rec})
+
+	d := testDeposit(t, 0)
+	d.Confirmations, d.Block, d.Height, d.TxIndex = 0, "", 0, 0
+	l.MempoolChanged(&mempool.Event{Kind: mempool.EventPending, Deposit: d, Replaceable: true})
+	l.MempoolChanged(&mempool.Event{Kind: mempool.EventReplaced, Deposit: d, By: []string{"aa", "bb"}})
+	if _, err := l.sinks.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.events) != 2 {
+		t.Fatalf("%d events published, want 2", len(rec.events))
+	}
+	for i, want := range []struct {
+		from   deposit.State
+		reason string
+	}{{"", "pending"}, {deposit.StateMempool, "replaced by aa, bb"}} {
+		e := rec.events[i]
+		if e.OutPoint != d.ID() || e.State != deposit.StateMempool || e.PreviousState != want.from || e.Status != store.StatusPending || e.Nonce != 0 || e.Reason != want.reason {
+			t.Errorf("event %d: %+v", i, e)
+		}
+	}
+	// mempool deposits are not stored, nor routed
+	if seen, err := l.store.Seen(d.OutPoint); err != nil || seen {
+		t.Errorf("mempool deposit stored: %v", err)
+	}
+}
+
+func TestChainClosesTheStoreOnceTheListenerStopped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := newTestListener(t, dir, "a")
+	l.log = log15.Root()
+	stopped := make(chan int)
+	close(stopped)
+	l.stop = stopped
+	c := &Chain{cfg: &core.ChainConfig{Id: 2}, listener: l, store: l.store, stop: make(chan int)}
+	if err := l.start(); err != nil {
+		t.Fatal(err)
+	}
+	l.wait()
+
+	// the writer and the coordinator keep using the store
+	op := testDeposit(t, 0).OutPoint
+	if _, err := l.store.Seen(op); err != nil {
+		t.Fatalf("store closed by the listener: %v", err)
+	}
+	c.Stop()
+	if _, err := l.store.Seen(op); err == nil {
+		t.Error("store still open after Stop")
+	}
+}
+
+func TestListenerTakesTheConfirmationsFromTheVerifiedChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := newTestListener(t, dir, "a")
+	defer l.store.Close()
+	l.log = log15.Root()
+
+	// the scanner stored the block of the deposit and the next one
+	d := testDeposit(t, 0)
+	d.Confirmations = 1
+	next := "0000000000000006f1c3f2a9a0b6a2d0e1f4c5b6a7980a1b2c3d4e5f60718293"
+	if _, err := l.store.ConnectBlock(store.Tip{Hash: d.Block, Height: d.Height}, "", []*deposit.Deposit{d}, nil, l.policy); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.store.ConnectBlock(store.Tip{Hash: next, Height: d.Height + 1}, d.Block, nil, nil, l.policy); err != nil {
+		t.Fatal(err)
+	}
+
+	// the wallet reports the deposit final, the verified chain has 2 blocks
+	utxo := bitcoind.UTXO{TxID: testTxID, Vout: 0, Amount: d.Amount, Address: d.Address, Confirmations: 100}
+	if err := l.observeUnspent([]bitcoind.UTXO{utxo}, deposit.NewTracker()); err != nil {
+		t.Fatal(err)
+	}
+	r, err := l.store.Get(d.OutPoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.State != deposit.StateConfirmed || r.Confirmations != 2 || r.Status != store.StatusPending {
+		t.Errorf("deposit %s with %d confirmations, status %s, want confirmed with 2", r.State, r.Confirmations, r.Status)
+	}
+}
+
+func TestListenerBacksOffFailedSends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := newTestListener(t, dir, "a")
+	defer l.store.Close()
+	l.log = log15.Root()
+
+	// a final deposit without its position can't be routed
+	d := testDeposit(t, 0)
+	d.Block, d.Height, d.TxIndex = "", 0, 0
+	if _, _, err := l.store.Observe(d, l.policy); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := l.resendPending(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := l.resends[d.ID()]
+	if b == nil || b.attempts != 1 {
+		t.Fatalf("resend %+v, want one attempt within the backoff", b)
+	}
+
+	// the next attempt waits twice as long
+	b.next = time.Now()
+	if err := l.resendPending(); err != nil {
+		t.Fatal(err)
+	}
+	if b.attempts != 2 || b.next.Before(time.Now().Add(ResendMinBackoff)) {
+		t.Errorf("resend %+v, want a second attempt and a doubled backoff", b)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package bitcoingold
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cosignPath is the path the relayers serve the requests on
+const cosignPath = "/bitcoingold/cosign"
+
+// maxRequestSize bounds the requests served, a PSBT of a few hundred inputs
+const maxRequestSize = 1 << 20
+
+// An httpTransport posts the requests as JSON to the other relayers
+type httpTransport struct {
+	peers  map[string]string // urls by key
+	client *http.Client
+}
+
+func newHTTPTransport(peers map[string]string, timeout time.Duration) *httpTransport {
+	return &httpTransport{peers: peers, client: &http.Client{Timeout: timeout}}
+}
+
+// Send implements Transport
+func (t *httpTransport) Send(peer string, req *Request) (*Response, error) {
+	url, ok := t.peers[peer]
+	if !ok {
+		return nil, fmt.Errorf("no url for relayer %s, see the cosigners option", peer)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Post(url+cosignPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxRequestSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	r := &Response{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// cosignHandler serves the requests of the other relayers to h
+func cosignHandler(h Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(cosignPath, func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		req := &Request{}
+		if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxRequestSize)).Decode(req); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := h.Handle(req)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusConflict)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(resp)
+	})
+	return mux
+}
+
+// A memoryTransport hands the requests to the handlers of relayers in the
+// same process, e.g. in tests. A relayer can be taken offline.
+type memoryTransport struct {
+	mu       sync.Mutex
+	handlers map[string]Handler
+	offline  map[string]bool
+}
+
+func newMemoryTransport() *memoryTransport {
+	return &memoryTransport{handlers: make(map[string]Handler), offline: make(map[string]bool)}
+}
+
+// register makes h the handler of the requests to peer
+func (t *memoryTransport) register(peer string, h Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[peer] = h
+}
+
+// setOffline makes the requests to peer fail, or succeed again
+func (t *memoryTransport) setOffline(peer string, offline bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.offline[peer] = offline
+}
+
+// Send implements Transport
+func (t *memoryTransport) Send(peer string, req *Request) (*Response, error) {
+	t.mu.Lock()
+	h, ok := t.handlers[peer]
+	offline := t.offline[peer]
+	t.mu.Unlock()
+	if !ok || offline {
+		return nil, fmt.Errorf("relayer %s is offline", peer)
+	}
+	copied := *req
+	return h.Handle(&copied)
+}
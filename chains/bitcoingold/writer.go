@@ -4,26 +4,96 @@
 package bitcoingold
 
 import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
 	"github.com/ChainSafe/chainbridge-utils/core"
 	metrics "github.com/ChainSafe/chainbridge-utils/metrics/types"
 	"github.com/ChainSafe/chainbridge-utils/msg"
 	"github.com/ChainSafe/log15"
-        "github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/coinselect"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/fee"
+	"github.com/www222fff/watchUTXO/go-bitcoind/psbt"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
 )
 
 var _ core.Writer = &writer{}
 
+// DustLimit is the smallest output a withdrawal pays, smaller change is left
+// to the fee
+const DustLimit = 546
+
+// MaxWithdrawalInputs bounds the outputs of the multisig a withdrawal spends,
+// keeping it under the standard transaction size
+const MaxWithdrawalInputs = 100
+
+// Errors of sendrawtransaction: a transaction whose inputs are missing or
+// unconfirmed, one the mempool rejects, e.g. for a conflict or a fee under
+// the relay fee, and one already mined. The first two can be accepted later.
+const (
+	rpcVerifyError          = -25
+	rpcVerifyRejected       = -26
+	rpcVerifyAlreadyInChain = -27
+)
+
+var (
+	// errNotAnchored is returned for a withdrawal that does not spend the
+	// anchor of the payout
+	errNotAnchored = errors.New("the withdrawal does not spend the input of the withdrawal signed before")
+
+	// errRejected is returned when the node rejects a withdrawal for good,
+	// which fails its payout
+	errRejected = errors.New("withdrawal rejected")
+)
+
+// A node sends signed transactions to the network, estimates their fees and
+// gives the best block height the relayers take turns by. *bitcoind.Bitcoind
+// implements it.
+type node interface {
+	fee.Estimator
+	GetBlockCount() (uint64, error)
+	SendRawTransaction(txHex string) (string, error)
+}
+
+// The writer pays the transfers from the other chains out of the multisig.
+// Each transfer gets a payout in the store, keyed by its source chain and
+// nonce, holding the withdrawal and the signatures gathered for it, so a
+// transfer delivered twice is paid once. The coordinator has the relayers
+// agree on the withdrawal and sign it.
 type writer struct {
-	conn       *bitcoind.Bitcoind
+	conn       node
+	utxos      deposit.UTXOSource
+	cfg        *Config
+	fees       *fee.Policy // the policy of cfg, estimated by conn
+	store      *store.Store
+	lock       sync.Mutex    // serializes the payouts, which reserve the multisig's outputs
+	wake       chan struct{} // tells the coordinator of a new payout
 	log        log15.Logger
 	sysErr     chan<- error
 	metrics    *metrics.ChainMetrics
 	extendCall bool // Extend extrinsic calls to substrate with ResourceID.Used for backward compatibility with example pallet.
 }
 
-func NewWriter(conn *bitcoind.Bitcoind, log log15.Logger, sysErr chan<- error, m *metrics.ChainMetrics, extendCall bool) *writer {
+func NewWriter(conn node, utxos deposit.UTXOSource, cfg *Config, st *store.Store, log log15.Logger, sysErr chan<- error, m *metrics.ChainMetrics, extendCall bool) *writer {
+	fees := cfg.fees
+	if fees.ConfTarget > 0 {
+		fees.Estimator = conn
+	}
 	return &writer{
 		conn:       conn,
+		utxos:      utxos,
+		cfg:        cfg,
+		fees:       &fees,
+		store:      st,
+		wake:       make(chan struct{}, 1),
 		log:        log,
 		sysErr:     sysErr,
 		metrics:    m,
@@ -31,8 +101,544 @@ func NewWriter(conn *bitcoind.Bitcoind, log log15.Logger, sysErr chan<- error, m
 	}
 }
 
+// ResolveMessage records a fungible transfer to pay to the BTG address of
+// its recipient, the coordinator has the relayers sign and broadcast its
+// withdrawal. Transfers that can't be paid are reported on sysErr; without a
+// signer key, the relayer only logs the transfers.
 func (w *writer) ResolveMessage(m msg.Message) bool {
+	if m.Type != msg.FungibleTransfer {
+		w.log.Error("Unsupported message type", "type", m.Type, "nonce", m.DepositNonce)
+		return false
+	}
+	if w.cfg.signer == nil {
+		w.log.Error("Transfer not paid, no signer key, see the signerKeyFile option", "source", m.Source, "nonce", m.DepositNonce)
+		return false
+	}
+	ok, err := w.resolve(m)
+	if err != nil {
+		w.report(m.Source, m.DepositNonce, err)
+	}
+	return ok
+}
+
+// resolve stores the payout of a transfer, if new, and returns whether it is
+// being paid or was. It returns an error for a new payout that can't be
+// paid.
+func (w *writer) resolve(m msg.Message) (bool, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	p, err := w.store.Payout(uint8(m.Source), uint64(m.DepositNonce))
+	if err == store.ErrNoPayout {
+		p, err = w.newPayout(m)
+		if err == nil && p.Status == store.PayoutFailed {
+			return false, errors.New(p.Reason)
+		}
+		if err == nil {
+			select {
+			case w.wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch p.Status {
+	case store.PayoutBroadcast:
+		w.log.Info("Transfer already paid", "source", m.Source, "nonce", m.DepositNonce, "txid", p.TxID)
+	case store.PayoutFailed:
+		w.log.Warn("Transfer can't be paid", "source", m.Source, "nonce", m.DepositNonce, "reason", p.Reason)
+		return false, nil
+	}
+	return true, nil
+}
+
+// report sends the failure of a payout to sysErr. The writer's lock must not
+// be held, the channel may block.
+func (w *writer) report(source msg.ChainId, nonce msg.Nonce, err error) {
+	w.log.Error("Payout failed", "source", source, "nonce", nonce, "err", err)
+	w.sysErr <- fmt.Errorf("bitcoingold payout of nonce %d from chain %d: %v", nonce, source, err)
+}
+
+// newPayout stores the payout of a transfer seen for the first time. A
+// transfer that can't be paid, e.g. to a recipient that is not an address,
+// is stored as failed.
+func (w *writer) newPayout(m msg.Message) (*store.Payout, error) {
+	p := &store.Payout{Source: uint8(m.Source), Nonce: uint64(m.DepositNonce), Status: store.PayoutSigning}
+	recipient, amount, err := w.transfer(m)
+	if err != nil {
+		p.Status, p.Reason = store.PayoutFailed, err.Error()
+		return p, w.store.PutPayout(p)
+	}
+	p.Recipient = recipient.String()
+	p.Amount = amount
+	w.log.Info("New payout", "source", m.Source, "nonce", m.DepositNonce, "recipient", p.Recipient, "amount", p.Amount)
+	return p, w.store.PutPayout(p)
+}
+
+// transfer returns the recipient of a fungible transfer and its amount in
+// satoshis, the payload being the amount in the units of the resource's
+// token and the recipient's address as a string
+func (w *writer) transfer(m msg.Message) (*address.Address, int64, error) {
+	if len(m.Payload) != 2 {
+		return nil, 0, fmt.Errorf("malformed payload of %d items", len(m.Payload))
+	}
+	units, ok := m.Payload[0].([]byte)
+	if !ok {
+		return nil, 0, errors.New("malformed amount")
+	}
+	recipient, ok := m.Payload[1].([]byte)
+	if !ok {
+		return nil, 0, errors.New("malformed recipient")
+	}
+	decimals, ok := w.cfg.decimals[m.ResourceId]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown resource %x", m.ResourceId)
+	}
+	amount, err := deposit.Unscale(new(big.Int).SetBytes(units), decimals)
+	if err != nil {
+		return nil, 0, err
+	}
+	addr, err := address.Decode(string(recipient), w.cfg.params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("recipient %q: %v", recipient, err)
+	}
+	// the fee of the smallest withdrawal, one input paying the recipient
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{})
+	tx.AddTxOut(&wire.TxOut{PkScript: addr.ScriptPubKey()})
+	if least := w.fees.Floor.Fee(fee.MultisigVSize(tx, w.cfg.required, w.cfg.multisig.WitnessScript)); amount-least < DustLimit {
+		return nil, 0, fmt.Errorf("%d satoshis do not cover the fee of %d", amount, least)
+	}
+	return addr, amount, nil
+}
+
+// build makes the unsigned withdrawal of p out of the multisig's outputs
+// final for this relayer's node that no other payout spends, picked by
+// coinselect. The other relayers check the proposed withdrawal rather than
+// build their own. The change goes back to the
+// multisig, and the fee at the rate of the fee policy is deducted from the
+// payment. A fee over the policy's maximum fails the build, which is tried
+// again later.
+func (w *writer) build(p *store.Payout) (*psbt.Packet, error) {
+	recipient, err := address.Decode(p.Recipient, w.cfg.params)
+	if err != nil {
+		return nil, err
+	}
+	utxos, err := w.utxos.ListUnspent()
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := w.reserved(p)
+	if err != nil {
+		return nil, err
+	}
+	multisig := hex.EncodeToString(w.cfg.multisig.ScriptPubKey)
+	var spendable []bitcoind.UTXO
+	for _, u := range utxos {
+		if u.ScriptPubKey == multisig && !reserved[u.OutPoint()] && u.Confirmations >= w.cfg.policy.Required(u.Amount) {
+			spendable = append(spendable, u)
+		}
+	}
+	rate, err := w.fees.Rate()
+	if err != nil {
+		return nil, err
+	}
+	sel, err := coinselect.Select(spendable, coinselect.Params{
+		Target:    p.Amount,
+		Dust:      DustLimit,
+		MaxInputs: MaxWithdrawalInputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tx, err := sel.Tx(&wire.TxOut{Value: p.Amount, PkScript: recipient.ScriptPubKey()}, w.cfg.multisig.ScriptPubKey)
+	if err != nil {
+		return nil, err
+	}
+	charged, err := w.fees.Fee(rate, fee.MultisigVSize(tx, w.cfg.required, w.cfg.multisig.WitnessScript))
+	if err != nil {
+		return nil, err
+	}
+	if tx.TxOut[0].Value -= charged; tx.TxOut[0].Value < DustLimit {
+		return nil, fmt.Errorf("%d satoshis do not cover the fee of %d at %s", p.Amount, charged, rate)
+	}
+	pkt, err := psbt.New(tx)
+	if err != nil {
+		return nil, err
+	}
+	for i, u := range sel.Inputs {
+		if err := pkt.AddInWitnessUtxo(i, &wire.TxOut{Value: u.Amount, PkScript: w.cfg.multisig.ScriptPubKey}); err != nil {
+			return nil, err
+		}
+		if err := pkt.AddInWitnessScript(i, w.cfg.multisig.WitnessScript); err != nil {
+			return nil, err
+		}
+	}
+	return pkt, nil
+}
+
+// reserved returns the outpoints spent by the other payouts
+func (w *writer) reserved(p *store.Payout) (map[string]bool, error) {
+	reserved, err := w.store.Reserved()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range p.Inputs {
+		delete(reserved, op)
+	}
+	return reserved, nil
+}
+
+// check verifies that a proposed withdrawal pays the transfer of p: the
+// payment to the recipient first, the fee deducted, and the change only
+// back to the multisig. The fee deducted must be in the bounds of the fee
+// policy for the withdrawal's size, whose fee is that plus change under the
+// dust limit. The inputs, at
+// most MaxWithdrawalInputs, are the multisig's, spent by no other payout and
+// signed with SIGHASH_ALL|SIGHASH_FORKID. It returns errNotAnchored for a
+// withdrawal that does not spend the anchor of p.
+func (w *writer) check(p *store.Payout, pkt *psbt.Packet) error {
+	tx := pkt.UnsignedTx
+	recipient, err := address.Decode(p.Recipient, w.cfg.params)
+	if err != nil {
+		return err
+	}
+	if len(tx.TxOut) == 0 || !bytes.Equal(tx.TxOut[0].PkScript, recipient.ScriptPubKey()) {
+		return fmt.Errorf("the withdrawal does not pay %s first", p.Recipient)
+	}
+	if tx.TxOut[0].Value > p.Amount || tx.TxOut[0].Value < DustLimit {
+		return fmt.Errorf("the withdrawal pays %d satoshis of %d", tx.TxOut[0].Value, p.Amount)
+	}
+	var out int64
+	for i, o := range tx.TxOut {
+		if i > 0 && !bytes.Equal(o.PkScript, w.cfg.multisig.ScriptPubKey) {
+			return fmt.Errorf("output %d is not the change", i)
+		}
+		out += o.Value
+	}
+
+	reserved, err := w.reserved(p)
+	if err != nil {
+		return err
+	}
+	if len(tx.TxIn) > MaxWithdrawalInputs {
+		return fmt.Errorf("%d inputs, at most %d", len(tx.TxIn), MaxWithdrawalInputs)
+	}
+	var in int64
+	anchored := p.Anchor == ""
+	for i, txIn := range tx.TxIn {
+		op := txIn.PreviousOutPoint.String()
+		if reserved[op] {
+			return fmt.Errorf("input %s is spent by another payout", op)
+		}
+		spent := pkt.Inputs[i].WitnessUtxo
+		if spent == nil || !bytes.Equal(spent.PkScript, w.cfg.multisig.ScriptPubKey) || !bytes.Equal(pkt.Inputs[i].WitnessScript, w.cfg.multisig.WitnessScript) {
+			return fmt.Errorf("input %s is not the multisig's", op)
+		}
+		if t := pkt.Inputs[i].SighashType; t != 0 && t != psbt.SigHashAllForkID {
+			return fmt.Errorf("input %s is signed with hash type %#x", op, t)
+		}
+		in += spent.Value
+		anchored = anchored || op == p.Anchor
+	}
+	charged := p.Amount - tx.TxOut[0].Value
+	if err := w.fees.Check(charged, fee.MultisigVSize(tx, w.cfg.required, w.cfg.multisig.WitnessScript)); err != nil {
+		return err
+	}
+	if excess := in - out - charged; excess < 0 || excess >= DustLimit {
+		return fmt.Errorf("fee of %d satoshis, %d deducted from the payment", in-out, charged)
+	}
+	if !anchored {
+		return errNotAnchored
+	}
+	return nil
+}
+
+// payout returns the payout of a transfer and its withdrawal, nil if the
+// payout has none yet
+func (w *writer) payout(source msg.ChainId, nonce msg.Nonce) (*store.Payout, *psbt.Packet, error) {
+	p, err := w.store.Payout(uint8(source), uint64(nonce))
+	if err != nil || p.PSBT == "" {
+		return p, nil, err
+	}
+	pkt, err := psbt.NewFromBase64(p.PSBT)
+	return p, pkt, err
+}
+
+// adopt makes pkt the withdrawal of p, its inputs reserved by p
+func (w *writer) adopt(p *store.Payout, pkt *psbt.Packet) error {
+	b64, err := pkt.B64Encode()
+	if err != nil {
+		return err
+	}
+	p.PSBT, p.Fee = b64, p.Amount-pkt.UnsignedTx.TxOut[0].Value
+	for _, op := range outpoints(pkt) {
+		if !contains(p.Inputs, op) {
+			p.Inputs = append(p.Inputs, op)
+		}
+	}
+	return nil
+}
+
+// outpoints returns the outpoints pkt spends
+func outpoints(pkt *psbt.Packet) []string {
+	var ops []string
+	for _, in := range pkt.UnsignedTx.TxIn {
+		ops = append(ops, in.PreviousOutPoint.String())
+	}
+	return ops
+}
+
+// merge adds the valid signatures of src to dst, a packet of the same
+// withdrawal
+func merge(dst, src *psbt.Packet) error {
+	if src.UnsignedTx.TxHash() != dst.UnsignedTx.TxHash() {
+		return fmt.Errorf("the signatures are for withdrawal %s, not %s", src.UnsignedTx.TxHash(), dst.UnsignedTx.TxHash())
+	}
+	for i, in := range src.Inputs {
+		for _, ps := range in.PartialSigs {
+			if err := dst.AddPartialSig(i, ps); err != nil {
+				return fmt.Errorf("input %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sign adds this relayer's signatures to pkt, the withdrawal of p, which
+// anchors p if it is the first it signs
+func (w *writer) sign(p *store.Payout, pkt *psbt.Packet) error {
+	for i := range pkt.Inputs {
+		if err := pkt.Sign(i, w.cfg.signer); err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+	}
+	if p.Anchor == "" {
+		p.Anchor = pkt.UnsignedTx.TxIn[0].PreviousOutPoint.String()
+	}
+	return w.adopt(p, pkt)
+}
+
+// propose returns the withdrawal this relayer proposes for a transfer, the
+// one it holds or a new one. It signs the withdrawal last, once the other
+// relayers' signatures meet the threshold, and broadcasts it; it returns
+// whether it did.
+func (w *writer) propose(source msg.ChainId, nonce msg.Nonce) (string, bool, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	p, pkt, err := w.payout(source, nonce)
+	if err != nil {
+		return "", false, err
+	}
+	if p.Status != store.PayoutSigning {
+		return p.PSBT, p.Status == store.PayoutBroadcast, nil
+	}
+	if pkt == nil {
+		if pkt, err = w.build(p); err != nil {
+			return "", false, err
+		}
+		if err := w.adopt(p, pkt); err != nil {
+			return "", false, err
+		}
+		w.log.Info("New withdrawal", "source", source, "nonce", nonce, "txid", pkt.UnsignedTx.TxHash(), "inputs", len(pkt.Inputs), "fee", p.Fee)
+	}
+	return w.finish(p, pkt)
+}
+
+// collect adds the answer of another relayer to this relayer's proposal:
+// its signatures, or the withdrawal it signed before, adopted unless this
+// relayer signed another, or the withdrawal it knows is broadcast. It
+// returns the withdrawal to propose next and whether it is broadcast.
+func (w *writer) collect(source msg.ChainId, nonce msg.Nonce, r *Response) (string, bool, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	p, pkt, err := w.payout(source, nonce)
+	if err != nil {
+		return "", false, err
+	}
+	if p.Status != store.PayoutSigning || pkt == nil {
+		return p.PSBT, p.Status == store.PayoutBroadcast, nil
+	}
+	peer, err := psbt.NewFromBase64(r.PSBT)
+	if err != nil {
+		return p.PSBT, false, err
+	}
+	switch {
+	case r.Broadcast:
+		done, err := w.settle(p, peer)
+		return p.PSBT, done, err
+	case r.Conflict:
+		if p.Anchor != "" {
+			return p.PSBT, false, fmt.Errorf("the relayer signed withdrawal %s", peer.UnsignedTx.TxHash())
+		}
+		if err := w.check(p, peer); err != nil {
+			return p.PSBT, false, fmt.Errorf("withdrawal %s: %v", peer.UnsignedTx.TxHash(), err)
+		}
+		w.log.Info("Adopting the withdrawal signed before", "source", source, "nonce", nonce, "txid", peer.UnsignedTx.TxHash())
+		if err := w.adopt(p, peer); err != nil {
+			return p.PSBT, false, err
+		}
+		return p.PSBT, false, w.store.PutPayout(p)
+	}
+	if err := merge(pkt, peer); err != nil {
+		return p.PSBT, false, err
+	}
+	return w.finish(p, pkt)
+}
+
+// finish stores pkt, the withdrawal of p. Once the other relayers'
+// signatures meet the threshold, this relayer signs and broadcasts it.
+func (w *writer) finish(p *store.Payout, pkt *psbt.Packet) (string, bool, error) {
+	ready := true
+	for i := range pkt.Inputs {
+		status, err := pkt.SignatureStatus(i)
+		if err != nil {
+			return p.PSBT, false, err
+		}
+		others := 0
+		for _, key := range status.SignedBy {
+			if hex.EncodeToString(key) != w.cfg.self {
+				others++
+			}
+		}
+		ready = ready && others >= status.Required-1
+	}
+	if !ready {
+		if err := w.adopt(p, pkt); err != nil {
+			return p.PSBT, false, err
+		}
+		return p.PSBT, false, w.store.PutPayout(p)
+	}
+	if err := w.sign(p, pkt); err != nil {
+		return p.PSBT, false, err
+	}
+	err := w.broadcast(p, pkt)
+	return p.PSBT, p.Status == store.PayoutBroadcast, err
+}
 
-	//TBD
-	return true
+// cosign signs the withdrawal another relayer proposes for a transfer if it
+// pays the transfer as this relayer received it. A relayer that signed
+// another withdrawal answers with it, and one that knows the withdrawal is
+// broadcast answers with the broadcast withdrawal.
+func (w *writer) cosign(source msg.ChainId, nonce msg.Nonce, b64 string) (*Response, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	p, held, err := w.payout(source, nonce)
+	if err == store.ErrNoPayout {
+		return nil, errors.New("transfer not received")
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch p.Status {
+	case store.PayoutBroadcast:
+		return &Response{PSBT: p.PSBT, Broadcast: true}, nil
+	case store.PayoutFailed:
+		return nil, fmt.Errorf("the payout failed: %s", p.Reason)
+	}
+	pkt, err := psbt.NewFromBase64(b64)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.check(p, pkt); err == errNotAnchored {
+		return &Response{PSBT: p.PSBT, Conflict: true}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if held != nil && held.UnsignedTx.TxHash() == pkt.UnsignedTx.TxHash() {
+		if err := merge(pkt, held); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.sign(p, pkt); err != nil {
+		return nil, err
+	}
+	if err := w.store.PutPayout(p); err != nil {
+		return nil, err
+	}
+	w.log.Info("Signed withdrawal", "source", source, "nonce", nonce, "txid", pkt.UnsignedTx.TxHash())
+	return &Response{PSBT: p.PSBT}, nil
+}
+
+// announced records the broadcast of a transfer's withdrawal, announced by
+// the relayer who broadcast it
+func (w *writer) announced(source msg.ChainId, nonce msg.Nonce, b64 string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	p, err := w.store.Payout(uint8(source), uint64(nonce))
+	if err != nil {
+		return err
+	}
+	if p.Status != store.PayoutSigning {
+		return nil
+	}
+	pkt, err := psbt.NewFromBase64(b64)
+	if err != nil {
+		return err
+	}
+	_, err = w.settle(p, pkt)
+	return err
+}
+
+// settle records pkt as the broadcast withdrawal of p if it pays the
+// transfer of p and holds the signatures of the threshold of relayers
+func (w *writer) settle(p *store.Payout, pkt *psbt.Packet) (bool, error) {
+	if err := w.check(p, pkt); err != nil && err != errNotAnchored {
+		return false, err
+	}
+	for i := range pkt.Inputs {
+		status, err := pkt.SignatureStatus(i)
+		if err != nil {
+			return false, err
+		}
+		if !status.Complete() {
+			return false, fmt.Errorf("input %d: %s", i, status)
+		}
+	}
+	if err := w.adopt(p, pkt); err != nil {
+		return false, err
+	}
+	// the inputs of the withdrawals not broadcast are free again
+	p.Status, p.TxID, p.Inputs = store.PayoutBroadcast, pkt.UnsignedTx.TxHash().String(), outpoints(pkt)
+	w.log.Info("Payout broadcast by another relayer", "source", p.Source, "nonce", p.Nonce, "txid", p.TxID)
+	return true, w.store.PutPayout(p)
+}
+
+// broadcast sends the withdrawal of p, complete with pkt, to the network.
+// A withdrawal the node can accept later stays signed and is sent again;
+// one it rejects for good fails the payout, with errRejected.
+func (w *writer) broadcast(p *store.Payout, pkt *psbt.Packet) error {
+	// stored first, a failed broadcast is retried with the signatures kept
+	if err := w.store.PutPayout(p); err != nil {
+		return err
+	}
+	final := pkt.Copy()
+	if err := final.FinalizeAll(); err != nil {
+		return err
+	}
+	tx, err := final.Extract()
+	if err != nil {
+		return err
+	}
+	txid, err := w.conn.SendRawTransaction(tx.Hex())
+	var rejected *bitcoind.RPCError
+	switch {
+	case errors.As(err, &rejected) && rejected.Code == rpcVerifyAlreadyInChain:
+		txid = tx.TxHash().String()
+	case errors.As(err, &rejected) && (rejected.Code == rpcVerifyError || rejected.Code == rpcVerifyRejected):
+		return fmt.Errorf("withdrawal %s not accepted yet: %v", tx.TxHash(), err)
+	case errors.As(err, &rejected):
+		p.Status, p.Reason = store.PayoutFailed, fmt.Sprintf("withdrawal %s rejected: %v", tx.TxHash(), err)
+		if err := w.store.PutPayout(p); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", errRejected, p.Reason)
+	case err != nil:
+		return fmt.Errorf("sendrawtransaction: %v", err)
+	}
+	p.Status, p.TxID, p.Inputs = store.PayoutBroadcast, txid, outpoints(pkt)
+	w.log.Info("Payout broadcast", "source", p.Source, "nonce", p.Nonce, "txid", txid)
+	return w.store.PutPayout(p)
 }
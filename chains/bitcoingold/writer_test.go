@@ -0,0 +1,264 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package bitcoingold
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChainSafe/chainbridge-utils/core"
+	"github.com/ChainSafe/chainbridge-utils/msg"
+	"github.com/ChainSafe/log15"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	bitcoind "github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit/deposittest"
+	"github.com/www222fff/watchUTXO/go-bitcoind/fee"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+const testRecipient = "GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE5"
+
+// fakeNode records the transactions broadcast, and estimates the fees
+type fakeNode struct {
+	sent     []*wire.MsgTx
+	estimate bitcoind.EstimateSmartFeeResult
+	height   uint64
+	reject   error // returned by SendRawTransaction if set
+}
+
+func (n *fakeNode) GetBlockCount() (uint64, error) {
+	return n.height, nil
+}
+
+func (n *fakeNode) EstimateSmartFee(confTarget int) (bitcoind.EstimateSmartFeeResult, error) {
+	return n.estimate, nil
+}
+
+func (n *fakeNode) SendRawTransaction(txHex string) (string, error) {
+	if n.reject != nil {
+		return "", n.reject
+	}
+	tx, err := wire.NewMsgTxFromHex(txHex)
+	if err != nil {
+		return "", err
+	}
+	n.sent = append(n.sent, tx)
+	return tx.TxHash().String(), nil
+}
+
+// testKeys returns the keys of the three relayers of the multisig
+func testKeys() []*secp256k1.PrivateKey {
+	var keys []*secp256k1.PrivateKey
+	for i := byte(1); i <= 3; i++ {
+		b := make([]byte, 32)
+		b[31] = i
+		keys = append(keys, secp256k1.PrivKeyFromBytes(b))
+	}
+	return keys
+}
+
+// testDescriptor returns the required-of-3 multisig of testKeys
+func testDescriptor(required int) string {
+	desc := fmt.Sprintf("wsh(sortedmulti(%d", required)
+	for _, k := range testKeys() {
+		desc += fmt.Sprintf(",%x", k.PubKey().SerializeCompressed())
+	}
+	return desc + "))"
+}
+
+// newTestWriter returns the writer of the relayer signing with key a
+// required-of-3 multisig, with a state file of its own
+func newTestWriter(t *testing.T, dir string, required int, key *secp256k1.PrivateKey, utxos *deposittest.FakeSource) (*writer, *fakeNode, chan error) {
+	name := fmt.Sprintf("%x", key.PubKey().SerializeCompressed()[1:5])
+	keyFile := filepath.Join(dir, name+".wif")
+	if err := ioutil.WriteFile(keyFile, []byte(address.EncodeWIF(key.Serialize(), true, &address.MainNetParams)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig(&core.ChainConfig{
+		Name:     name,
+		Id:       2,
+		Endpoint: "127.0.0.1:8332",
+		Opts: map[string]string{
+			RpcUserOpt:          "user",
+			RpcPasswordOpt:      "password",
+			WalletOpt:           "bridge",
+			WatchDescriptorOpt:  testDescriptor(required),
+			ConfirmationsOpt:    "6",
+			ResourceIdsOpt:      testResourceId,
+			ResourceDecimalsOpt: testResourceId + ":18",
+			SignerKeyFileOpt:    keyFile,
+			MaxFeeRateOpt:       "50",
+			MaxFeeOpt:           "100000",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := store.Open(filepath.Join(dir, name+".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &fakeNode{estimate: bitcoind.EstimateSmartFeeResult{FeeRate: 0.0001, Blocks: 6}} // 10 sat/vB
+	sysErr := make(chan error, 10)
+	return NewWriter(node, utxos, cfg, st, log15.Root(), sysErr, nil, false), node, sysErr
+}
+
+// testTransfer returns the transfer of btg, in units of an 18 decimals
+// token, to recipient
+func testTransfer(t *testing.T, nonce msg.Nonce, btg int64, recipient string) msg.Message {
+	units := new(big.Int).Mul(big.NewInt(btg), big.NewInt(1e18))
+	return msg.NewFungibleTransfer(1, 2, nonce, units, testResource(t), []byte(recipient))
+}
+
+func TestWriterStoresEachTransferOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	w, _, sysErr := newTestWriter(t, dir, 2, testKeys()[0], deposittest.NewFakeSource())
+	defer w.store.Close()
+
+	m := testTransfer(t, 7, 3, testRecipient)
+	if !w.ResolveMessage(m) {
+		t.Fatalf("transfer not resolved: %v", drain(sysErr))
+	}
+	p, err := w.store.Payout(1, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != store.PayoutSigning || p.Recipient != testRecipient || p.Amount != 300000000 || p.Fee != 0 {
+		t.Fatalf("payout %+v", p)
+	}
+	select {
+	case <-w.wake:
+	default:
+		t.Error("coordinator not woken")
+	}
+
+	if !w.ResolveMessage(m) {
+		t.Fatalf("transfer not resolved again: %v", drain(sysErr))
+	}
+	again, _ := w.store.Payout(1, 7)
+	if !again.CreatedAt.Equal(p.CreatedAt) {
+		t.Error("payout stored again")
+	}
+	select {
+	case <-w.wake:
+		t.Error("coordinator woken again")
+	default:
+	}
+}
+
+func TestWriterReportsFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	w, _, sysErr := newTestWriter(t, dir, 2, testKeys()[1], deposittest.NewFakeSource())
+	defer w.store.Close()
+
+	// not an address: the payout fails for good
+	m := testTransfer(t, 1, 1, "0xd43593c715fdd31c61141abd04a99fd6822c8558")
+	if w.ResolveMessage(m) || len(drain(sysErr)) != 1 {
+		t.Fatal("invalid recipient not reported")
+	}
+	if p, err := w.store.Payout(1, 1); err != nil || p.Status != store.PayoutFailed {
+		t.Fatalf("payout %+v, %v", p, err)
+	}
+	if w.ResolveMessage(m) || len(drain(sysErr)) != 0 {
+		t.Error("failed payout reported again")
+	}
+
+	// less than the fee
+	m = testTransfer(t, 2, 0, testRecipient)
+	if w.ResolveMessage(m) || len(drain(sysErr)) != 1 {
+		t.Fatal("transfer of nothing not reported")
+	}
+
+	// without a signer key the transfers are only logged
+	w.cfg.signer = nil
+	if w.ResolveMessage(testTransfer(t, 3, 1, testRecipient)) || len(drain(sysErr)) != 0 {
+		t.Fatal("transfer without a signer key reported")
+	}
+	if _, err := w.store.Payout(1, 3); err != store.ErrNoPayout {
+		t.Errorf("payout stored without a signer key: %v", err)
+	}
+}
+
+func TestWriterFees(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcoingold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	utxos := deposittest.NewFakeSource()
+	w, node, sysErr := newTestWriter(t, dir, 2, testKeys()[0], utxos)
+	defer w.store.Close()
+	multisig := fmt.Sprintf("%x", w.cfg.multisig.ScriptPubKey)
+	utxos.Set(deposittest.UTXO(1, w.cfg.watchAddress, multisig, 500000000, 10))
+	if !w.ResolveMessage(testTransfer(t, 7, 3, testRecipient)) {
+		t.Fatalf("transfer not resolved: %v", drain(sysErr))
+	}
+	p, _ := w.store.Payout(1, 7)
+
+	// the node's estimate, deducted from the payment
+	pkt, err := w.build(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := pkt.UnsignedTx
+	charged := fee.PerVByte(10).Fee(fee.MultisigVSize(tx, 2, w.cfg.multisig.WitnessScript))
+	if tx.TxOut[0].Value != 300000000-charged || tx.TxOut[1].Value != 200000000 {
+		t.Fatalf("payment %d, change %d, fee %d", tx.TxOut[0].Value, tx.TxOut[1].Value, charged)
+	}
+	if err := w.check(p, pkt); err != nil {
+		t.Errorf("own withdrawal rejected: %v", err)
+	}
+
+	// no estimate on a quiet chain: the fallback, minFeeRate
+	node.estimate = bitcoind.EstimateSmartFeeResult{Errors: []string{"Insufficient data or no feerate found"}}
+	if pkt, err = w.build(p); err != nil {
+		t.Fatal(err)
+	}
+	if got := 300000000 - pkt.UnsignedTx.TxOut[0].Value; got != fee.PerVByte(1).Fee(fee.MultisigVSize(pkt.UnsignedTx, 2, w.cfg.multisig.WitnessScript)) {
+		t.Errorf("fallback fee %d", got)
+	}
+
+	// held to maxFeeRate, and by maxFee rather than overpaying
+	node.estimate = bitcoind.EstimateSmartFeeResult{FeeRate: 0.1}
+	if pkt, err = w.build(p); err != nil {
+		t.Fatal(err)
+	}
+	if got := 300000000 - pkt.UnsignedTx.TxOut[0].Value; got != fee.PerVByte(50).Fee(fee.MultisigVSize(pkt.UnsignedTx, 2, w.cfg.multisig.WitnessScript)) {
+		t.Errorf("fee %d over maxFeeRate", got)
+	}
+	w.fees.MaxFee = 1000
+	if _, err := w.build(p); !errors.Is(err, fee.ErrFeeTooHigh) {
+		t.Errorf("overpaying: %v", err)
+	}
+	if err := w.check(p, pkt); !errors.Is(err, fee.ErrFeeTooHigh) {
+		t.Errorf("overpaying withdrawal accepted: %v", err)
+	}
+}
+
+func drain(c chan error) []error {
+	var errs []error
+	for {
+		select {
+		case err := <-c:
+			errs = append(errs, err)
+		default:
+			return errs
+		}
+	}
+}
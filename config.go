@@ -0,0 +1,509 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/descriptor"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	DEFAULT_RPC_ENDPOINT     = "127.0.0.1:8332"
+	DEFAULT_RPC_TIMEOUT      = 30
+	DEFAULT_NETWORK          = "main"
+	DEFAULT_MINCONF          = 1
+	DEFAULT_MAXCONF          = 999999
+	DEFAULT_POLL_INTERVAL    = 5 * time.Second
+	DEFAULT_DESCRIPTOR_RANGE = 100
+	DEFAULT_STATE_DIR        = "state"
+	DEFAULT_CONFIRMATIONS    = deposit.DefaultConfirmations
+	DEFAULT_SINK_INTERVAL    = time.Second
+	DEFAULT_SINK_TIMEOUT     = 10 * time.Second
+
+	// ENV_PREFIX prefixes the environment variables overriding the config file
+	ENV_PREFIX = "WATCHUTXO_"
+)
+
+// RPCConfig holds the connection settings of the bitcoind node
+type RPCConfig struct {
+	Endpoint string `yaml:"endpoint"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	SSL      bool   `yaml:"ssl"`
+	Timeout  int    `yaml:"timeout"`
+}
+
+// WatcherConfig describes one set of watched outputs and the wallet holding them
+type WatcherConfig struct {
+	Name             string `yaml:"name"`
+	Wallet           string `yaml:"wallet"`
+	WalletPassphrase string `yaml:"wallet_passphrase"`
+
+	// Addresses are watched as given
+	Addresses []string `yaml:"addresses"`
+
+	// Descriptors are expanded to addresses locally; ranged descriptors
+	// are derived from index 0 up to DescriptorRange
+	Descriptors     []string `yaml:"descriptors"`
+	DescriptorRange uint32   `yaml:"descriptor_range"`
+}
+
+// TierConfig requires more confirmations from deposits of at least MinAmount BTG
+type TierConfig struct {
+	MinAmount     string `yaml:"min_amount"`
+	Confirmations uint32 `yaml:"confirmations"`
+}
+
+// Types of sinks
+const (
+	SINK_STDOUT  = "stdout"
+	SINK_FILE    = "file"
+	SINK_WEBHOOK = "webhook"
+	SINK_STREAM  = "stream"
+)
+
+// SinkConfig is an output of the deposit events. The fields used depend on
+// the type: Path for file, URL and Secret for webhook, Network, Address and
+// Subject for stream.
+type SinkConfig struct {
+	Type string `yaml:"type"`
+
+	// Name keys the events queued for the sink in the state files, it
+	// defaults to the type and target. Renaming a sink drops its queue.
+	Name string `yaml:"name"`
+
+	Path string `yaml:"path"`
+
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+
+	Network string `yaml:"network"` // tcp or unix
+	Address string `yaml:"address"`
+	Subject string `yaml:"subject"`
+}
+
+// defaultName names a sink after its type and target
+func (s *SinkConfig) defaultName() string {
+	switch s.Type {
+	case SINK_FILE:
+		return s.Type + ":" + s.Path
+	case SINK_WEBHOOK:
+		return s.Type + ":" + s.URL
+	case SINK_STREAM:
+		return s.Type + ":" + s.Network + ":" + s.Address + "/" + s.Subject
+	}
+	return s.Type
+}
+
+// Config is the watcher configuration. It is read from a YAML or JSON file,
+// then overridden by WATCHUTXO_* environment variables and command line flags.
+type Config struct {
+	RPC          RPCConfig       `yaml:"rpc"`
+	Network      string          `yaml:"network"`
+	MinConf      uint32          `yaml:"minconf"`
+	PollInterval time.Duration   `yaml:"poll_interval"`
+	Watchers     []WatcherConfig `yaml:"watchers"`
+
+	// StateDir holds one state file per watcher, named after it
+	StateDir string `yaml:"state_dir"`
+
+	// Deposits are final, and reported, once they have Confirmations
+	// confirmations, or those of the highest tier their amount reaches
+	Confirmations     uint32       `yaml:"confirmations"`
+	ConfirmationTiers []TierConfig `yaml:"confirmation_tiers"`
+
+	// Mempool reports the deposits of unconfirmed transactions as pending.
+	// They are shown only, never reported as deposits.
+	Mempool bool `yaml:"mempool"`
+
+	// ZMQEndpoint, e.g. tcp://127.0.0.1:28332, wakes the watchers up on the
+	// node's ZMQ notifications instead of waiting for the next poll
+	ZMQEndpoint string `yaml:"zmq_endpoint"`
+
+	// Sinks receive every deposit state change as a JSON event, on top of
+	// the log
+	Sinks []SinkConfig `yaml:"sinks"`
+
+	params *address.Params
+	policy *deposit.Policy
+}
+
+// Params returns the network parameters, once the config is validated
+func (c *Config) Params() *address.Params {
+	return c.params
+}
+
+// Policy returns the confirmation policy, once the config is validated
+func (c *Config) Policy() *deposit.Policy {
+	return c.policy
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		RPC:          RPCConfig{Endpoint: DEFAULT_RPC_ENDPOINT, Timeout: DEFAULT_RPC_TIMEOUT},
+		Network:      DEFAULT_NETWORK,
+		MinConf:      DEFAULT_MINCONF,
+		PollInterval: DEFAULT_POLL_INTERVAL,
+		StateDir:     DEFAULT_STATE_DIR,
+
+		Confirmations: DEFAULT_CONFIRMATIONS,
+	}
+}
+
+// stringList is a repeatable command line flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// LoadConfig builds the configuration from the command line arguments, the
+// environment (see lookupEnv) and the optional -config file, in increasing
+// order of precedence: file, environment, flags. Addresses or descriptors
+// given on the command line form an additional watcher named "cli".
+func LoadConfig(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	fs := flag.NewFlagSet("watchUTXO", flag.ContinueOnError)
+	var (
+		configFile = fs.String("config", "", "path of a YAML or JSON config file")
+		endpoint   = fs.String("rpc-endpoint", "", "bitcoind RPC host:port")
+		user       = fs.String("rpc-user", "", "bitcoind RPC user")
+		password   = fs.String("rpc-password", "", "bitcoind RPC password")
+		ssl        = fs.Bool("rpc-ssl", false, "connect to bitcoind over https")
+		network    = fs.String("network", "", "network of the watched addresses: main, test or regtest")
+		minconf    = fs.Uint("minconf", 0, "minimum confirmations of a reported UTXO")
+		interval   = fs.Duration("poll-interval", 0, "delay between two ListUnspent polls")
+		stateDir   = fs.String("state-dir", "", "directory of the watcher state files")
+		confs      = fs.Uint("confirmations", 0, "confirmations making a deposit final")
+		mempool    = fs.Bool("mempool", false, "report the deposits of unconfirmed transactions as pending")
+		zmqEndpt   = fs.String("zmq-endpoint", "", "ZMQ endpoint of the node's hashblock, hashtx and sequence notifications")
+		wallet     = fs.String("wallet", "", "wallet of the -address/-descriptor watcher")
+		passphrase = fs.String("wallet-passphrase", "", "passphrase of the -wallet")
+		addresses  stringList
+		descs      stringList
+	)
+	fs.Var(&addresses, "address", "watched address (repeatable)")
+	fs.Var(&descs, "descriptor", "watched output descriptor (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := defaultConfig()
+	if *configFile == "" {
+		*configFile, _ = lookupEnv(ENV_PREFIX + "CONFIG")
+	}
+	if *configFile != "" {
+		b, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		// JSON is a subset of YAML, so one decoder handles both formats
+		if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+			return nil, fmt.Errorf("config %s: %v", *configFile, err)
+		}
+	}
+
+	if err := cfg.applyEnv(lookupEnv); err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["rpc-endpoint"] {
+		cfg.RPC.Endpoint = *endpoint
+	}
+	if set["rpc-user"] {
+		cfg.RPC.User = *user
+	}
+	if set["rpc-password"] {
+		cfg.RPC.Password = *password
+	}
+	if set["rpc-ssl"] {
+		cfg.RPC.SSL = *ssl
+	}
+	if set["network"] {
+		cfg.Network = *network
+	}
+	if set["minconf"] {
+		cfg.MinConf = uint32(*minconf)
+	}
+	if set["poll-interval"] {
+		cfg.PollInterval = *interval
+	}
+	if set["state-dir"] {
+		cfg.StateDir = *stateDir
+	}
+	if set["confirmations"] {
+		cfg.Confirmations = uint32(*confs)
+	}
+	if set["mempool"] {
+		cfg.Mempool = *mempool
+	}
+	if set["zmq-endpoint"] {
+		cfg.ZMQEndpoint = *zmqEndpt
+	}
+	if len(addresses) > 0 || len(descs) > 0 {
+		cfg.Watchers = append(cfg.Watchers, WatcherConfig{
+			Name:             "cli",
+			Wallet:           *wallet,
+			WalletPassphrase: *passphrase,
+			Addresses:        addresses,
+			Descriptors:      descs,
+		})
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the global settings with WATCHUTXO_* environment variables
+func (c *Config) applyEnv(lookupEnv func(string) (string, bool)) error {
+	strs := map[string]*string{
+		"RPC_ENDPOINT": &c.RPC.Endpoint,
+		"RPC_USER":     &c.RPC.User,
+		"RPC_PASSWORD": &c.RPC.Password,
+		"NETWORK":      &c.Network,
+		"STATE_DIR":    &c.StateDir,
+		"ZMQ_ENDPOINT": &c.ZMQEndpoint,
+	}
+	for name, dst := range strs {
+		if v, ok := lookupEnv(ENV_PREFIX + name); ok {
+			*dst = v
+		}
+	}
+	if v, ok := lookupEnv(ENV_PREFIX + "RPC_SSL"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sRPC_SSL: %v", ENV_PREFIX, err)
+		}
+		c.RPC.SSL = b
+	}
+	if v, ok := lookupEnv(ENV_PREFIX + "MEMPOOL"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sMEMPOOL: %v", ENV_PREFIX, err)
+		}
+		c.Mempool = b
+	}
+	if v, ok := lookupEnv(ENV_PREFIX + "MINCONF"); ok {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%sMINCONF: %v", ENV_PREFIX, err)
+		}
+		c.MinConf = uint32(n)
+	}
+	if v, ok := lookupEnv(ENV_PREFIX + "CONFIRMATIONS"); ok {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%sCONFIRMATIONS: %v", ENV_PREFIX, err)
+		}
+		c.Confirmations = uint32(n)
+	}
+	if v, ok := lookupEnv(ENV_PREFIX + "POLL_INTERVAL"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%sPOLL_INTERVAL: %v", ENV_PREFIX, err)
+		}
+		c.PollInterval = d
+	}
+	return nil
+}
+
+// Validate checks the whole configuration and reports every problem found
+func (c *Config) Validate() error {
+	var errs []string
+	fail := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, a...))
+	}
+
+	if c.RPC.Endpoint == "" {
+		fail("rpc.endpoint is required")
+	}
+	if c.RPC.User == "" {
+		fail("rpc.user is required")
+	}
+	if c.RPC.Timeout <= 0 {
+		fail("rpc.timeout must be positive, got %d", c.RPC.Timeout)
+	}
+	params, err := address.ParamsForNetwork(c.Network)
+	if err != nil {
+		fail("network: %v", err)
+	}
+	c.params = params
+	if c.MinConf > DEFAULT_MAXCONF {
+		fail("minconf must be at most %d, got %d", DEFAULT_MAXCONF, c.MinConf)
+	}
+	if c.PollInterval < time.Second {
+		fail("poll_interval must be at least 1s, got %s", c.PollInterval)
+	}
+	if c.StateDir == "" {
+		fail("state_dir is required")
+	}
+	if c.ZMQEndpoint != "" && !strings.HasPrefix(c.ZMQEndpoint, "tcp://") && !strings.HasPrefix(c.ZMQEndpoint, "ipc://") {
+		fail("zmq_endpoint must be a tcp:// or ipc:// endpoint, got %q", c.ZMQEndpoint)
+	}
+	var tiers []deposit.Tier
+	for i, t := range c.ConfirmationTiers {
+		amount, err := bitcoind.AmountToSatoshi(t.MinAmount)
+		if err != nil {
+			fail("confirmation_tiers[%d]: min_amount: %v", i, err)
+			continue
+		}
+		tiers = append(tiers, deposit.Tier{MinAmount: amount, Confirmations: t.Confirmations})
+	}
+	sinks := make(map[string]bool)
+	for i := range c.Sinks {
+		sk := &c.Sinks[i]
+		prefix := fmt.Sprintf("sinks[%d]", i)
+		switch sk.Type {
+		case SINK_STDOUT:
+		case SINK_FILE:
+			if sk.Path == "" {
+				fail("%s: path is required", prefix)
+			}
+		case SINK_WEBHOOK:
+			u, err := url.Parse(sk.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fail("%s: url must be an http(s) URL, got %q", prefix, sk.URL)
+			}
+			if sk.Secret == "" {
+				fail("%s: secret is required", prefix)
+			}
+		case SINK_STREAM:
+			if sk.Network == "" {
+				sk.Network = "tcp"
+			}
+			if sk.Network != "tcp" && sk.Network != "unix" {
+				fail("%s: network must be tcp or unix, got %q", prefix, sk.Network)
+			}
+			if sk.Address == "" {
+				fail("%s: address is required", prefix)
+			}
+			if sk.Subject == "" || strings.ContainsAny(sk.Subject, " \t\r\n") {
+				fail("%s: subject must be a non-empty word, got %q", prefix, sk.Subject)
+			}
+		default:
+			fail("%s: type must be stdout, file, webhook or stream, got %q", prefix, sk.Type)
+			continue
+		}
+		if sk.Name == "" {
+			sk.Name = sk.defaultName()
+		}
+		if sinks[sk.Name] {
+			fail("%s: duplicate sink %q", prefix, sk.Name)
+		}
+		sinks[sk.Name] = true
+	}
+	if policy, err := deposit.NewPolicy(c.Confirmations, tiers); err != nil {
+		fail("confirmations: %v", err)
+	} else {
+		c.policy = policy
+	}
+	if len(c.Watchers) == 0 {
+		fail("no watcher configured: add watchers to the config file or pass -address/-descriptor")
+	}
+
+	names := make(map[string]bool)
+	for i := range c.Watchers {
+		w := &c.Watchers[i]
+		if w.Name == "" {
+			w.Name = fmt.Sprintf("watcher-%d", i)
+		}
+		prefix := fmt.Sprintf("watchers[%d] (%s)", i, w.Name)
+		if names[w.Name] {
+			fail("%s: duplicate watcher name", prefix)
+		}
+		if strings.ContainsAny(w.Name, `/\`) {
+			fail("%s: name must not contain path separators", prefix)
+		}
+		names[w.Name] = true
+		if w.WalletPassphrase != "" && w.Wallet == "" {
+			fail("%s: wallet_passphrase set without wallet", prefix)
+		}
+		if len(w.Addresses) == 0 && len(w.Descriptors) == 0 {
+			fail("%s: at least one address or descriptor is required", prefix)
+		}
+		if w.DescriptorRange == 0 {
+			w.DescriptorRange = DEFAULT_DESCRIPTOR_RANGE
+		}
+		if params == nil {
+			continue
+		}
+		for j, a := range w.Addresses {
+			if err := address.Validate(a, params); err != nil {
+				fail("%s: addresses[%d] %q: %v", prefix, j, a, err)
+			}
+		}
+		for j, d := range w.Descriptors {
+			desc, err := descriptor.Parse(d, params)
+			if err != nil {
+				fail("%s: descriptors[%d]: %v", prefix, j, err)
+				continue
+			}
+			if _, err := desc.Address(0); err != nil {
+				fail("%s: descriptors[%d]: no address form: %v", prefix, j, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// StatePath returns the state file of a watcher
+func (c *Config) StatePath(w *WatcherConfig) string {
+	return filepath.Join(c.StateDir, w.Name+".db")
+}
+
+// WatchedAddresses returns the addresses of a watcher, with its descriptors
+// expanded over their range
+func (c *Config) WatchedAddresses(w *WatcherConfig) ([]string, error) {
+	seen := make(map[string]bool)
+	var addrs []string
+	add := func(a string) {
+		if !seen[a] {
+			seen[a] = true
+			addrs = append(addrs, a)
+		}
+	}
+	for _, a := range w.Addresses {
+		add(a)
+	}
+	for _, s := range w.Descriptors {
+		d, err := descriptor.Parse(s, c.params)
+		if err != nil {
+			return nil, err
+		}
+		end := uint32(1)
+		if d.IsRange() {
+			end = w.DescriptorRange
+		}
+		for i := uint32(0); i < end; i++ {
+			a, err := d.Address(i)
+			if err != nil {
+				return nil, fmt.Errorf("descriptor %s: %v", s, err)
+			}
+			add(a.String())
+		}
+	}
+	return addrs, nil
+}
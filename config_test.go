@@ -0,0 +1,228 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	const watched = "btg1qmc6uua0jngs9qr38w3pchcvdcrzu878t8p8nwqtj32rtjvjfvnfqywt5pr"
+
+	var (
+		dir string
+		env map[string]string
+	)
+	lookupEnv := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+	writeFile := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(p, []byte(content), 0600)).To(Succeed())
+		return p
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "watchutxo")
+		Expect(err).NotTo(HaveOccurred())
+		env = map[string]string{}
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should load several watchers from a YAML file", func() {
+		p := writeFile("watcher.yaml", `
+rpc:
+  endpoint: 10.0.0.1:8332
+  user: user
+  password: passwd
+network: main
+minconf: 3
+poll_interval: 10s
+watchers:
+  - name: bridge
+    wallet: danny
+    addresses: [`+watched+`]
+  - wallet: other
+    descriptors:
+      - wpkh(02ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8)
+`)
+		cfg, err := LoadConfig([]string{"-config", p}, lookupEnv)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.RPC.Endpoint).To(Equal("10.0.0.1:8332"))
+		Expect(cfg.MinConf).To(Equal(uint32(3)))
+		Expect(cfg.PollInterval).To(Equal(10 * time.Second))
+		Expect(cfg.Watchers).To(HaveLen(2))
+		Expect(cfg.Watchers[1].Name).To(Equal("watcher-1"))
+		Expect(cfg.Watchers[1].DescriptorRange).To(Equal(uint32(DEFAULT_DESCRIPTOR_RANGE)))
+
+		addrs, err := cfg.WatchedAddresses(&cfg.Watchers[1])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addrs).To(HaveLen(1))
+		Expect(addrs[0]).To(HavePrefix("btg1q"))
+	})
+
+	It("should load a JSON file", func() {
+		p := writeFile("watcher.json", `{"rpc": {"user": "u"}, "watchers": [{"addresses": ["`+watched+`"]}]}`)
+		cfg, err := LoadConfig([]string{"-config", p}, lookupEnv)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.RPC.Endpoint).To(Equal(DEFAULT_RPC_ENDPOINT))
+		Expect(cfg.PollInterval).To(Equal(DEFAULT_POLL_INTERVAL))
+	})
+
+	It("should let the environment override the file and flags override both", func() {
+		p := writeFile("watcher.yaml", "rpc: {user: file, password: file}\nminconf: 2\n")
+		env["WATCHUTXO_RPC_USER"] = "env"
+		env["WATCHUTXO_RPC_PASSWORD"] = "env"
+		env["WATCHUTXO_MINCONF"] = "4"
+		env["WATCHUTXO_MEMPOOL"] = "true"
+		env["WATCHUTXO_ZMQ_ENDPOINT"] = "tcp://127.0.0.1:28332"
+		cfg, err := LoadConfig([]string{"-config", p, "-rpc-password", "flag", "-address", watched}, lookupEnv)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.RPC.User).To(Equal("env"))
+		Expect(cfg.RPC.Password).To(Equal("flag"))
+		Expect(cfg.MinConf).To(Equal(uint32(4)))
+		Expect(cfg.Mempool).To(BeTrue())
+		Expect(cfg.ZMQEndpoint).To(Equal("tcp://127.0.0.1:28332"))
+		Expect(cfg.Watchers).To(HaveLen(1))
+		Expect(cfg.Watchers[0].Name).To(Equal("cli"))
+	})
+
+	It("should read the config path from the environment", func() {
+		env["WATCHUTXO_CONFIG"] = writeFile("watcher.yaml", "rpc: {user: u}\nwatchers: [{addresses: ["+watched+"]}]\n")
+		_, err := LoadConfig(nil, lookupEnv)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should expand ranged descriptors", func() {
+		xpub := "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"
+		p := writeFile("watcher.yaml", "rpc: {user: u}\nwatchers: [{descriptors: ['wpkh("+xpub+"/0/*)'], descriptor_range: 5}]\n")
+		cfg, err := LoadConfig([]string{"-config", p}, lookupEnv)
+		Expect(err).NotTo(HaveOccurred())
+		addrs, err := cfg.WatchedAddresses(&cfg.Watchers[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addrs).To(HaveLen(5))
+	})
+
+	It("should report every invalid setting", func() {
+		p := writeFile("watcher.yaml", `
+network: mars
+poll_interval: 10ms
+zmq_endpoint: 127.0.0.1:28332
+watchers:
+  - name: a
+    addresses: [GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE5]
+  - name: a
+`)
+		_, err := LoadConfig([]string{"-config", p}, lookupEnv)
+		Expect(err).To(HaveOccurred())
+		for _, msg := range []string{"rpc.user is required", "network", "poll_interval", "zmq_endpoint", "duplicate watcher name", "at least one address"} {
+			Expect(err.Error()).To(ContainSubstring(msg))
+		}
+	})
+
+	It("should keep one state file per watcher", func() {
+		env["WATCHUTXO_STATE_DIR"] = dir
+		cfg, err := LoadConfig([]string{"-rpc-user", "u", "-address", watched}, lookupEnv)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.StatePath(&cfg.Watchers[0])).To(Equal(filepath.Join(dir, "cli.db")))
+
+		_, err = LoadConfig([]string{"-rpc-user", "u", "-state-dir", ""}, lookupEnv)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("state_dir is required"))
+	})
+
+	It("should require more confirmations from large deposits", func() {
+		p := writeFile("watcher.yaml", `
+rpc: {user: u}
+confirmations: 3
+confirmation_tiers:
+  - {min_amount: "1", confirmations: 12}
+  - {min_amount: "100.5", confirmations: 60}
+watchers: [{addresses: [`+watched+`]}]
+`)
+		cfg, err := LoadConfig([]string{"-config", p}, lookupEnv)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Policy().Required(99999999)).To(Equal(uint32(3)))
+		Expect(cfg.Policy().Required(100000000)).To(Equal(uint32(12)))
+		Expect(cfg.Policy().Required(10050000000)).To(Equal(uint32(60)))
+
+		p = writeFile("bad.yaml", "rpc: {user: u}\nconfirmation_tiers: [{min_amount: lots, confirmations: 1}]\nwatchers: [{addresses: ["+watched+"]}]\n")
+		_, err = LoadConfig([]string{"-config", p, "-confirmations", "0"}, lookupEnv)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("confirmation_tiers[0]"))
+		Expect(err.Error()).To(ContainSubstring("confirmations must be at least 1"))
+	})
+
+	It("should check the sinks", func() {
+		p := writeFile("watcher.yaml", `
+rpc: {user: u}
+sinks:
+  - {type: stdout}
+  - {type: webhook, url: "https://example.com/deposits", secret: s3cret}
+  - {type: webhook, url: "https://example.com/deposits", secret: s3cret}
+  - {type: webhook, url: "ftp://example.com", secret: s3cret}
+  - {type: webhook, url: "http://localhost:8080/hook"}
+  - {type: stream, address: /run/nats.sock, network: udp, subject: deposits}
+  - {type: file}
+  - {type: kafka}
+watchers: [{addresses: [`+watched+`]}]
+`)
+		_, err := LoadConfig([]string{"-config", p}, lookupEnv)
+		Expect(err).To(HaveOccurred())
+		for _, msg := range []string{
+			`sinks[2]: duplicate sink "webhook:https://example.com/deposits"`,
+			"sinks[3]: url must be an http(s) URL",
+			"sinks[4]: secret is required",
+			"sinks[5]: network must be tcp or unix",
+			"sinks[6]: path is required",
+			"sinks[7]: type must be stdout, file, webhook or stream",
+		} {
+			Expect(err.Error()).To(ContainSubstring(msg))
+		}
+		Expect(err.Error()).NotTo(ContainSubstring("sinks[0]"))
+		Expect(err.Error()).NotTo(ContainSubstring("sinks[1]"))
+
+		p = writeFile("good.yaml", `
+rpc: {user: u}
+sinks:
+  - {type: stdout}
+  - {type: file, path: /var/log/deposits.jsonl}
+  - {type: stream, name: nats, address: "127.0.0.1:4222", subject: btg.deposits}
+watchers: [{addresses: [`+watched+`]}]
+`)
+		cfg, err := LoadConfig([]string{"-config", p}, lookupEnv)
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, sk := range cfg.Sinks {
+			names = append(names, sk.Name)
+		}
+		Expect(names).To(Equal([]string{"stdout", "file:/var/log/deposits.jsonl", "nats"}))
+		Expect(cfg.Sinks[2].Network).To(Equal("tcp"))
+	})
+
+	It("should reject addresses of another network", func() {
+		_, err := LoadConfig([]string{"-rpc-user", "u", "-network", "test", "-address", watched}, lookupEnv)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("addresses[0]"))
+	})
+
+	It("should reject unknown keys", func() {
+		p := writeFile("watcher.yaml", "rpc: {user: u}\nwatch_addresses: ["+watched+"]\n")
+		_, err := LoadConfig([]string{"-config", p}, lookupEnv)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject an invalid environment value", func() {
+		env["WATCHUTXO_POLL_INTERVAL"] = "soon"
+		_, err := LoadConfig([]string{"-rpc-user", "u", "-address", watched}, lookupEnv)
+		Expect(err).To(HaveOccurred())
+	})
+})
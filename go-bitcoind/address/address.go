@@ -0,0 +1,243 @@
+// Package address encodes and validates Bitcoin Gold addresses locally,
+// without a round trip to the validateaddress RPC.
+package address
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Script opcodes needed to build and recognise standard output scripts
+const (
+	op0           = 0x00
+	op1           = 0x51
+	op16          = 0x60
+	opDup         = 0x76
+	opEqual       = 0x87
+	opEqualVerify = 0x88
+	opHash160     = 0xa9
+	opCheckSig    = 0xac
+)
+
+// ErrWrongNetwork is returned when an address belongs to another network
+var ErrWrongNetwork = errors.New("address: wrong network")
+
+// ErrUnsupportedScript is returned when a scriptPubKey has no address form
+var ErrUnsupportedScript = errors.New("address: script has no address form")
+
+// Type is the script type an address pays to
+type Type int
+
+const (
+	// PubKeyHash is a legacy P2PKH address
+	PubKeyHash Type = iota + 1
+	// ScriptHash is a legacy P2SH address
+	ScriptHash
+	// WitnessPubKeyHash is a version 0 P2WPKH address
+	WitnessPubKeyHash
+	// WitnessScriptHash is a version 0 P2WSH address
+	WitnessScriptHash
+	// WitnessUnknown is a witness program of version 1 to 16
+	WitnessUnknown
+)
+
+// String returns the script type name as used in bitcoind's scriptPubKey.type
+func (t Type) String() string {
+	switch t {
+	case PubKeyHash:
+		return "pubkeyhash"
+	case ScriptHash:
+		return "scripthash"
+	case WitnessPubKeyHash:
+		return "witness_v0_keyhash"
+	case WitnessScriptHash:
+		return "witness_v0_scripthash"
+	case WitnessUnknown:
+		return "witness_unknown"
+	}
+	return "nonstandard"
+}
+
+// An Address is a decoded Bitcoin Gold address
+type Address struct {
+	// The script type the address pays to
+	Type Type
+
+	// The witness version, only meaningful for segwit addresses
+	WitnessVersion byte
+
+	// The hash160 (legacy and P2WPKH), sha256 (P2WSH) or raw witness program
+	Hash []byte
+
+	params *Params
+}
+
+// Hash160 returns ripemd160(sha256(b))
+func Hash160(b []byte) []byte {
+	s := sha256.Sum256(b)
+	h := ripemd160.New()
+	h.Write(s[:])
+	return h.Sum(nil)
+}
+
+// NewPubKeyHash returns the P2PKH address of a 20 bytes public key hash
+func NewPubKeyHash(hash []byte, params *Params) (*Address, error) {
+	return newAddress(PubKeyHash, 0, hash, 20, params)
+}
+
+// NewScriptHash returns the P2SH address of a 20 bytes script hash
+func NewScriptHash(hash []byte, params *Params) (*Address, error) {
+	return newAddress(ScriptHash, 0, hash, 20, params)
+}
+
+// NewWitnessPubKeyHash returns the P2WPKH address of a 20 bytes public key hash
+func NewWitnessPubKeyHash(hash []byte, params *Params) (*Address, error) {
+	return newAddress(WitnessPubKeyHash, 0, hash, 20, params)
+}
+
+// NewWitnessScriptHash returns the P2WSH address of a 32 bytes witness script hash
+func NewWitnessScriptHash(hash []byte, params *Params) (*Address, error) {
+	return newAddress(WitnessScriptHash, 0, hash, 32, params)
+}
+
+// NewWitnessScriptHashFromScript returns the P2WSH address paying to witnessScript
+func NewWitnessScriptHashFromScript(witnessScript []byte, params *Params) (*Address, error) {
+	h := sha256.Sum256(witnessScript)
+	return NewWitnessScriptHash(h[:], params)
+}
+
+// NewScriptHashFromScript returns the P2SH address paying to redeemScript
+func NewScriptHashFromScript(redeemScript []byte, params *Params) (*Address, error) {
+	return NewScriptHash(Hash160(redeemScript), params)
+}
+
+func newAddress(t Type, version byte, hash []byte, size int, params *Params) (*Address, error) {
+	if len(hash) != size {
+		return nil, fmt.Errorf("address: %s hash must be %d bytes, got %d", t, size, len(hash))
+	}
+	if params == nil {
+		return nil, errors.New("address: nil params")
+	}
+	return &Address{Type: t, WitnessVersion: version, Hash: append([]byte{}, hash...), params: params}, nil
+}
+
+// Decode parses and validates addr for the given network
+func Decode(addr string, params *Params) (*Address, error) {
+	if params == nil {
+		return nil, errors.New("address: nil params")
+	}
+
+	// Segwit addresses carry their network in the human readable part
+	if len(addr) > len(params.Bech32HRP)+1 && bytes.EqualFold([]byte(addr[:len(params.Bech32HRP)+1]), []byte(params.Bech32HRP+"1")) {
+		version, program, err := decodeSegWit(params.Bech32HRP, addr)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case version == 0 && len(program) == 20:
+			return newAddress(WitnessPubKeyHash, 0, program, 20, params)
+		case version == 0 && len(program) == 32:
+			return newAddress(WitnessScriptHash, 0, program, 32, params)
+		default:
+			return newAddress(WitnessUnknown, version, program, len(program), params)
+		}
+	}
+
+	version, payload, err := CheckDecode(addr)
+	if err != nil {
+		if _, _, _, berr := Bech32Decode(addr); berr == nil {
+			return nil, ErrWrongNetwork
+		}
+		return nil, err
+	}
+	if len(payload) != 20 {
+		return nil, ErrInvalidFormat
+	}
+	switch version {
+	case params.PubKeyHashAddrID:
+		return NewPubKeyHash(payload, params)
+	case params.ScriptHashAddrID:
+		return NewScriptHash(payload, params)
+	}
+	return nil, ErrWrongNetwork
+}
+
+// Validate reports whether addr is a valid address of the given network
+func Validate(addr string, params *Params) error {
+	_, err := Decode(addr, params)
+	return err
+}
+
+// String encodes the address
+func (a *Address) String() string {
+	switch a.Type {
+	case PubKeyHash:
+		return CheckEncode(a.params.PubKeyHashAddrID, a.Hash)
+	case ScriptHash:
+		return CheckEncode(a.params.ScriptHashAddrID, a.Hash)
+	}
+	s, err := encodeSegWit(a.params.Bech32HRP, a.WitnessVersion, a.Hash)
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// Params returns the network parameters the address was built with
+func (a *Address) Params() *Params {
+	return a.params
+}
+
+// IsSegWit reports whether the address is a native witness program
+func (a *Address) IsSegWit() bool {
+	return a.Type == WitnessPubKeyHash || a.Type == WitnessScriptHash || a.Type == WitnessUnknown
+}
+
+// ScriptPubKey returns the output script paying to the address
+func (a *Address) ScriptPubKey() []byte {
+	switch a.Type {
+	case PubKeyHash:
+		s := []byte{opDup, opHash160, 20}
+		s = append(s, a.Hash...)
+		return append(s, opEqualVerify, opCheckSig)
+	case ScriptHash:
+		s := []byte{opHash160, 20}
+		s = append(s, a.Hash...)
+		return append(s, opEqual)
+	}
+	v := byte(op0)
+	if a.WitnessVersion > 0 {
+		v = op1 + a.WitnessVersion - 1
+	}
+	s := []byte{v, byte(len(a.Hash))}
+	return append(s, a.Hash...)
+}
+
+// FromScriptPubKey returns the address a standard output script pays to.
+// Scripts without an address form (bare multisig, OP_RETURN, ...) return ErrUnsupportedScript.
+func FromScriptPubKey(script []byte, params *Params) (*Address, error) {
+	switch {
+	case len(script) == 25 && script[0] == opDup && script[1] == opHash160 && script[2] == 20 &&
+		script[23] == opEqualVerify && script[24] == opCheckSig:
+		return NewPubKeyHash(script[3:23], params)
+	case len(script) == 23 && script[0] == opHash160 && script[1] == 20 && script[22] == opEqual:
+		return NewScriptHash(script[2:22], params)
+	case len(script) >= 4 && len(script) <= 42 && int(script[1]) == len(script)-2 &&
+		(script[0] == op0 || (script[0] >= op1 && script[0] <= op16)):
+		if script[0] == op0 {
+			switch len(script) {
+			case 22:
+				return NewWitnessPubKeyHash(script[2:], params)
+			case 34:
+				return NewWitnessScriptHash(script[2:], params)
+			}
+			return nil, ErrUnsupportedScript
+		}
+		return newAddress(WitnessUnknown, script[0]-op1+1, script[2:], len(script)-2, params)
+	}
+	return nil, ErrUnsupportedScript
+}
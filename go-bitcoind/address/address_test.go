@@ -0,0 +1,169 @@
+package address
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Address", func() {
+	hash, _ := hex.DecodeString("751e76e8199196d454941c45d1b3a323f1433bd6")
+
+	Describe("legacy addresses", func() {
+		Context("mainnet", func() {
+			It("should encode P2PKH with the G prefix", func() {
+				a, err := NewPubKeyHash(hash, &MainNetParams)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(a.String()).To(Equal("GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE5"))
+			})
+			It("should encode P2SH with the A prefix", func() {
+				a, err := NewScriptHash(hash, &MainNetParams)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(a.String()).To(Equal("AST9CekEhDWuxHPynRmeyjg5biNFSijvb3"))
+			})
+			It("should decode P2PKH to its hash and script", func() {
+				a, err := Decode("GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE5", &MainNetParams)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(a.Type).To(Equal(PubKeyHash))
+				Expect(a.Hash).To(Equal(hash))
+				Expect(hex.EncodeToString(a.ScriptPubKey())).To(Equal("76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"))
+			})
+		})
+		Context("testnet", func() {
+			It("should decode P2PKH and P2SH", func() {
+				a, err := Decode("mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r", &TestNetParams)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(a.Type).To(Equal(PubKeyHash))
+				a, err = Decode("2N3vVYSK5XRgVSGWy21PnsRmBUywSQNdCsf", &RegTestParams)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(a.Type).To(Equal(ScriptHash))
+				Expect(hex.EncodeToString(a.ScriptPubKey())).To(Equal("a914751e76e8199196d454941c45d1b3a323f1433bd687"))
+			})
+		})
+		Context("when invalid", func() {
+			It("should reject another network", func() {
+				_, err := Decode("mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r", &MainNetParams)
+				Expect(err).To(Equal(ErrWrongNetwork))
+			})
+			It("should reject a bad checksum", func() {
+				_, err := Decode("GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE6", &MainNetParams)
+				Expect(err).To(Equal(ErrChecksum))
+			})
+			It("should reject non base58 characters", func() {
+				_, err := Decode("GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE0", &MainNetParams)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("segwit addresses", func() {
+		It("should encode P2WPKH under the btg and tbtg HRPs", func() {
+			a, err := NewWitnessPubKeyHash(hash, &MainNetParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.String()).To(Equal("btg1qw508d6qejxtdg4y5r3zarvary0c5xw7k6w057a"))
+			a, err = NewWitnessPubKeyHash(hash, &TestNetParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.String()).To(Equal("tbtg1qw508d6qejxtdg4y5r3zarvary0c5xw7kduvadh"))
+		})
+		It("should round trip the watched multisig P2WSH", func() {
+			s := "btg1qmc6uua0jngs9qr38w3pchcvdcrzu878t8p8nwqtj32rtjvjfvnfqywt5pr"
+			a, err := Decode(s, &MainNetParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.Type).To(Equal(WitnessScriptHash))
+			Expect(a.Hash).To(HaveLen(32))
+			script := a.ScriptPubKey()
+			Expect(script[:2]).To(Equal([]byte{0x00, 0x20}))
+			b, err := FromScriptPubKey(script, &MainNetParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b.String()).To(Equal(s))
+		})
+		It("should accept upper case", func() {
+			a, err := Decode("BTG1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7K6W057A", &MainNetParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.Hash).To(Equal(hash))
+		})
+		It("should use bech32m for witness version 1", func() {
+			program := make([]byte, 32)
+			for i := range program {
+				program[i] = byte(i)
+			}
+			s := "btg1pqqqsyqcyq5rqwzqfpg9scrgwpugpzysnzs23v9ccrydpk8qarc0sx50xrg"
+			a, err := Decode(s, &MainNetParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.Type).To(Equal(WitnessUnknown))
+			Expect(a.WitnessVersion).To(Equal(byte(1)))
+			Expect(a.Hash).To(Equal(program))
+			Expect(a.ScriptPubKey()[0]).To(Equal(byte(0x51)))
+			Expect(a.String()).To(Equal(s))
+		})
+		It("should reject a testnet address on mainnet", func() {
+			_, err := Decode("tbtg1qw508d6qejxtdg4y5r3zarvary0c5xw7kduvadh", &MainNetParams)
+			Expect(err).To(Equal(ErrWrongNetwork))
+		})
+		It("should reject a bad checksum", func() {
+			_, err := Decode("btg1qw508d6qejxtdg4y5r3zarvary0c5xw7k6w057c", &MainNetParams)
+			Expect(err).To(Equal(ErrChecksum))
+		})
+		It("should reject mixed case", func() {
+			_, err := Decode("btg1qW508d6qejxtdg4y5r3zarvary0c5xw7k6w057a", &MainNetParams)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("BIP173 and BIP350 vectors", func() {
+		bc := &Params{Bech32HRP: "bc"}
+		It("should decode the BIP173 P2WPKH vector", func() {
+			a, err := Decode("BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", bc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hex.EncodeToString(a.ScriptPubKey())).To(Equal("0014751e76e8199196d454941c45d1b3a323f1433bd6"))
+		})
+		It("should reject a version 1 program with a bech32 checksum", func() {
+			_, err := Decode("bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7k7grplx", bc)
+			Expect(err).To(HaveOccurred())
+		})
+		It("should decode the BIP350 version 1 vector", func() {
+			a, err := Decode("bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", bc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hex.EncodeToString(a.ScriptPubKey())).To(Equal("5128751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"))
+		})
+	})
+
+	Describe("FromScriptPubKey", func() {
+		It("should reject scripts without an address", func() {
+			_, err := FromScriptPubKey([]byte{0x6a, 0x01, 0x00}, &MainNetParams)
+			Expect(err).To(Equal(ErrUnsupportedScript))
+		})
+	})
+
+	Describe("WIF", func() {
+		key, _ := hex.DecodeString("0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d")
+
+		It("should encode and decode private keys", func() {
+			Expect(EncodeWIF(key, false, &MainNetParams)).To(Equal("5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ"))
+			Expect(EncodeWIF(key, true, &MainNetParams)).To(Equal("KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617"))
+
+			got, compressed, err := DecodeWIF("KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617", &MainNetParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).To(Equal(key))
+			Expect(compressed).To(BeTrue())
+		})
+
+		It("should reject keys of another network", func() {
+			_, _, err := DecodeWIF(EncodeWIF(key, true, &TestNetParams), &MainNetParams)
+			Expect(err).To(Equal(ErrWrongNetwork))
+			_, _, err = DecodeWIF(CheckEncode(MainNetParams.PrivateKeyID, key[:31]), &MainNetParams)
+			Expect(err).To(Equal(ErrInvalidFormat))
+		})
+	})
+
+	Describe("ParamsForNetwork", func() {
+		It("should know bitcoind chain names", func() {
+			p, err := ParamsForNetwork("test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Bech32HRP).To(Equal("tbtg"))
+			_, err = ParamsForNetwork("signet")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,107 @@
+package address
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	// ErrChecksum is returned when a base58check or bech32 checksum does not match
+	ErrChecksum = errors.New("address: checksum mismatch")
+
+	// ErrInvalidFormat is returned when an encoded string is malformed
+	ErrInvalidFormat = errors.New("address: invalid format")
+)
+
+var base58Map = func() [256]int {
+	var m [256]int
+	for i := range m {
+		m[i] = -1
+	}
+	for i := 0; i < len(base58Alphabet); i++ {
+		m[base58Alphabet[i]] = i
+	}
+	return m
+}()
+
+// Base58Encode encodes b with the bitcoin base58 alphabet
+func Base58Encode(b []byte) string {
+	x := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// Base58Decode decodes a base58 string
+func Base58Decode(s string) ([]byte, error) {
+	x := new(big.Int)
+	radix := big.NewInt(58)
+	for i := 0; i < len(s); i++ {
+		d := base58Map[s[i]]
+		if d < 0 {
+			return nil, ErrInvalidFormat
+		}
+		x.Mul(x, radix)
+		x.Add(x, big.NewInt(int64(d)))
+	}
+
+	var zeros int
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), x.Bytes()...), nil
+}
+
+// DoubleSHA256 returns sha256(sha256(b))
+func DoubleSHA256(b []byte) []byte {
+	first := sha256.Sum256(b)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// CheckEncode prepends version to payload and encodes the result with a
+// four bytes double-sha256 checksum
+func CheckEncode(version byte, payload []byte) string {
+	b := make([]byte, 0, 1+len(payload)+4)
+	b = append(b, version)
+	b = append(b, payload...)
+	b = append(b, DoubleSHA256(b)[:4]...)
+	return Base58Encode(b)
+}
+
+// CheckDecode decodes a base58check string and returns its version byte and payload
+func CheckDecode(s string) (version byte, payload []byte, err error) {
+	b, err := Base58Decode(s)
+	if err != nil {
+		return
+	}
+	if len(b) < 5 {
+		err = ErrInvalidFormat
+		return
+	}
+	body, sum := b[:len(b)-4], b[len(b)-4:]
+	if !bytes.Equal(DoubleSHA256(body)[:4], sum) {
+		err = ErrChecksum
+		return
+	}
+	return body[0], body[1:], nil
+}
@@ -0,0 +1,205 @@
+package address
+
+import (
+	"errors"
+	"strings"
+)
+
+// Bech32 encoding as specified by BIP173 and its bech32m variant (BIP350)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Encoding is the checksum variant of a bech32 string
+type Encoding int
+
+const (
+	// Bech32 is the original BIP173 checksum, used by witness version 0
+	Bech32 Encoding = iota + 1
+	// Bech32m is the BIP350 checksum, used by witness versions 1 to 16
+	Bech32m
+)
+
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+var errBech32Mixed = errors.New("address: mixed case bech32 string")
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (b>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+func bech32Checksum(hrp string, data []byte, enc Encoding) []byte {
+	c := uint32(bech32Const)
+	if enc == Bech32m {
+		c = bech32mConst
+	}
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	mod := bech32Polymod(values) ^ c
+	out := make([]byte, 6)
+	for i := 0; i < 6; i++ {
+		out[i] = byte(mod>>uint(5*(5-i))) & 31
+	}
+	return out
+}
+
+// Bech32Encode encodes 5-bit groups under hrp with the given checksum variant
+func Bech32Encode(hrp string, data []byte, enc Encoding) (string, error) {
+	for _, d := range data {
+		if d > 31 {
+			return "", ErrInvalidFormat
+		}
+	}
+	hrp = strings.ToLower(hrp)
+	combined := append(append([]byte{}, data...), bech32Checksum(hrp, data, enc)...)
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range combined {
+		sb.WriteByte(bech32Charset[d])
+	}
+	return sb.String(), nil
+}
+
+// Bech32Decode decodes a bech32 or bech32m string into its hrp and 5-bit groups.
+// The checksum variant found is returned along with the data.
+func Bech32Decode(s string) (hrp string, data []byte, enc Encoding, err error) {
+	if len(s) > 90 || len(s) < 8 {
+		err = ErrInvalidFormat
+		return
+	}
+	lower, upper := strings.ToLower(s), strings.ToUpper(s)
+	if s != lower && s != upper {
+		err = errBech32Mixed
+		return
+	}
+	s = lower
+
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		err = ErrInvalidFormat
+		return
+	}
+	hrp = s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			err = ErrInvalidFormat
+			return
+		}
+	}
+
+	values := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		d := strings.IndexByte(bech32Charset, s[i])
+		if d < 0 {
+			err = ErrInvalidFormat
+			return
+		}
+		values = append(values, byte(d))
+	}
+
+	switch bech32Polymod(append(bech32HRPExpand(hrp), values...)) {
+	case bech32Const:
+		enc = Bech32
+	case bech32mConst:
+		enc = Bech32m
+	default:
+		err = ErrChecksum
+		return
+	}
+	data = values[:len(values)-6]
+	return
+}
+
+// convertBits regroups a byte slice from fromBits to toBits wide groups
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxv := uint(1)<<toBits - 1
+	out := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, v := range data {
+		if uint(v)>>fromBits != 0 {
+			return nil, ErrInvalidFormat
+		}
+		acc = acc<<fromBits | uint(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, ErrInvalidFormat
+	}
+	return out, nil
+}
+
+// encodeSegWit encodes a witness program as a segwit address
+func encodeSegWit(hrp string, version byte, program []byte) (string, error) {
+	conv, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	enc := Bech32
+	if version > 0 {
+		enc = Bech32m
+	}
+	return Bech32Encode(hrp, append([]byte{version}, conv...), enc)
+}
+
+// decodeSegWit decodes a segwit address, enforcing the BIP173/BIP350 rules
+func decodeSegWit(hrp, addr string) (version byte, program []byte, err error) {
+	gotHRP, data, enc, err := Bech32Decode(addr)
+	if err != nil {
+		return
+	}
+	if gotHRP != hrp {
+		err = ErrWrongNetwork
+		return
+	}
+	if len(data) < 1 || data[0] > 16 {
+		err = ErrInvalidFormat
+		return
+	}
+	version = data[0]
+	if (version == 0 && enc != Bech32) || (version > 0 && enc != Bech32m) {
+		err = ErrChecksum
+		return
+	}
+	program, err = convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return
+	}
+	if len(program) < 2 || len(program) > 40 || (version == 0 && len(program) != 20 && len(program) != 32) {
+		err = ErrInvalidFormat
+	}
+	return
+}
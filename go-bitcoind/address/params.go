@@ -0,0 +1,165 @@
+package address
+
+import (
+	"fmt"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/equihash"
+)
+
+// Params holds the address encoding and proof-of-work parameters of a
+// Bitcoin Gold network
+type Params struct {
+	// The network name as reported by getblockchaininfo
+	Name string
+
+	// The base58 version byte of P2PKH addresses
+	PubKeyHashAddrID byte
+
+	// The base58 version byte of P2SH addresses
+	ScriptHashAddrID byte
+
+	// The base58 version byte of WIF private keys
+	PrivateKeyID byte
+
+	// The human readable part of segwit addresses
+	Bech32HRP string
+
+	// The BIP32 version bytes of extended private and public keys
+	HDPrivateKeyID [4]byte
+	HDPublicKeyID  [4]byte
+
+	// The height of the Bitcoin Gold fork, from which block headers are
+	// hashed with their height, full nonce and Equihash solution
+	ForkHeight uint32
+
+	// The easiest targets, as compact bits, of the headers since the fork
+	// and of the Bitcoin headers before it
+	PowLimitBits       uint32
+	LegacyPowLimitBits uint32
+
+	// Whether a block may be mined at the easiest target, as on testnet
+	// after a slow block: the targets of successive headers are not compared
+	AllowMinDifficultyBlocks bool
+
+	// The Equihash variant mined since the fork, replaced by EquihashUpgrade
+	// from EquihashUpgradeHeight. A zero N leaves the solutions unchecked.
+	Equihash              equihash.Params
+	EquihashUpgrade       equihash.Params
+	EquihashUpgradeHeight uint32
+
+	// The difficulty adjustments since the fork: Digishield from
+	// DigishieldHeight, after the premine, replaced by LWMA from LwmaHeight.
+	// A zero Window leaves the targets unbounded.
+	Digishield       Retarget
+	DigishieldHeight uint32
+	Lwma             Retarget
+	LwmaHeight       uint32
+}
+
+// A Retarget bounds a difficulty adjustment: the target of a header is at
+// most Num/Den times the mean target of the Window headers before it. The
+// first Window headers of an adjustment are mined from the reset easiest
+// target and are not bounded.
+type Retarget struct {
+	Window   int
+	Num, Den int64
+}
+
+// RetargetAt returns the difficulty adjustment of the header at height, at
+// or above the fork, and the height it starts from
+func (p *Params) RetargetAt(height uint32) (Retarget, uint32) {
+	switch {
+	case p.Lwma.Window != 0 && height >= p.LwmaHeight:
+		return p.Lwma, p.LwmaHeight
+	case p.Digishield.Window != 0 && height >= p.DigishieldHeight:
+		return p.Digishield, p.DigishieldHeight
+	}
+	return Retarget{}, p.ForkHeight
+}
+
+// EquihashAt returns the Equihash variant of the header at height, at or
+// above the fork
+func (p *Params) EquihashAt(height uint32) equihash.Params {
+	if height >= p.EquihashUpgradeHeight {
+		return p.EquihashUpgrade
+	}
+	return p.Equihash
+}
+
+// MainNetParams are the Bitcoin Gold mainnet parameters (G.../A.../btg1...)
+var MainNetParams = Params{
+	Name:             "main",
+	PubKeyHashAddrID: 38,
+	ScriptHashAddrID: 23,
+	PrivateKeyID:     128,
+	Bech32HRP:        "btg",
+	HDPrivateKeyID:   [4]byte{0x04, 0x88, 0xad, 0xe4}, // xprv
+	HDPublicKeyID:    [4]byte{0x04, 0x88, 0xb2, 0x1e}, // xpub
+	ForkHeight:       491407,
+
+	PowLimitBits:          0x1f07ffff,
+	LegacyPowLimitBits:    0x1d00ffff,
+	Equihash:              equihash.Zcash,
+	EquihashUpgrade:       equihash.BTG,
+	EquihashUpgradeHeight: 536200,
+
+	// Digishield averages 30 targets and eases them by at most 32%. LWMA
+	// weighs 45 solve times capped at 6 spacings T, so a target is at most
+	// 3T(N+1)/k = 82800/13632 times the mean.
+	Digishield:       Retarget{Window: 30, Num: 132, Den: 100},
+	DigishieldHeight: 499407,
+	Lwma:             Retarget{Window: 45, Num: 82800, Den: 13632},
+	LwmaHeight:       536200,
+}
+
+// TestNetParams are the Bitcoin Gold testnet parameters (m.../n.../2.../tbtg1...)
+var TestNetParams = Params{
+	Name:             "test",
+	PubKeyHashAddrID: 111,
+	ScriptHashAddrID: 196,
+	PrivateKeyID:     239,
+	Bech32HRP:        "tbtg",
+	HDPrivateKeyID:   [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+	HDPublicKeyID:    [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+	ForkHeight:       1,
+
+	PowLimitBits:             0x1f07ffff,
+	LegacyPowLimitBits:       0x1d00ffff,
+	AllowMinDifficultyBlocks: true,
+	Equihash:                 equihash.BTG,
+	EquihashUpgrade:          equihash.BTG,
+	EquihashUpgradeHeight:    1,
+}
+
+// RegTestParams are the Bitcoin Gold regtest parameters, which share the
+// testnet prefixes. Regtest blocks are mined at the easiest target and their
+// Equihash solutions are not checked.
+var RegTestParams = Params{
+	Name:             "regtest",
+	PubKeyHashAddrID: 111,
+	ScriptHashAddrID: 196,
+	PrivateKeyID:     239,
+	Bech32HRP:        "tbtg",
+	HDPrivateKeyID:   [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+	HDPublicKeyID:    [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+	ForkHeight:       2000,
+
+	PowLimitBits:             0x207fffff,
+	LegacyPowLimitBits:       0x207fffff,
+	AllowMinDifficultyBlocks: true,
+}
+
+// ParamsForNetwork returns the parameters of the named network.
+// It accepts the chain names used by bitcoind ("main", "test", "regtest")
+// as well as the usual aliases.
+func ParamsForNetwork(network string) (*Params, error) {
+	switch network {
+	case "main", "mainnet":
+		return &MainNetParams, nil
+	case "test", "testnet":
+		return &TestNetParams, nil
+	case "regtest":
+		return &RegTestParams, nil
+	}
+	return nil, fmt.Errorf("unknown network %q", network)
+}
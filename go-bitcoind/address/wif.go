@@ -0,0 +1,30 @@
+package address
+
+// EncodeWIF returns the wallet import format of a 32 bytes private key, as
+// given by dumpprivkey, flagged for a compressed public key if compressed
+func EncodeWIF(key []byte, compressed bool, params *Params) string {
+	payload := append([]byte{}, key...)
+	if compressed {
+		payload = append(payload, 1)
+	}
+	return CheckEncode(params.PrivateKeyID, payload)
+}
+
+// DecodeWIF returns the private key of a wallet import format string of the
+// network and whether its public key is compressed
+func DecodeWIF(s string, params *Params) (key []byte, compressed bool, err error) {
+	version, payload, err := CheckDecode(s)
+	if err != nil {
+		return nil, false, err
+	}
+	if version != params.PrivateKeyID {
+		return nil, false, ErrWrongNetwork
+	}
+	switch {
+	case len(payload) == 32:
+		return payload, false, nil
+	case len(payload) == 33 && payload[32] == 1:
+		return payload[:32], true, nil
+	}
+	return nil, false, ErrInvalidFormat
+}
@@ -0,0 +1,43 @@
+package bitcoind
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// SATOSHI_PER_BTG is the number of satoshis in one BTG
+const SATOSHI_PER_BTG = 100000000
+
+// AmountToSatoshi converts a decimal BTG amount, as found in RPC results, to
+// satoshis without going through floating point. Amounts with more than 8
+// decimals are rejected.
+func AmountToSatoshi(amount string) (int64, error) {
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	r.Mul(r, big.NewRat(SATOSHI_PER_BTG, 1))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("amount %q has more than 8 decimals", amount)
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("amount %q out of range", amount)
+	}
+	return r.Num().Int64(), nil
+}
+
+// SatoshiToAmount formats satoshis as a decimal BTG amount with 8 decimals
+func SatoshiToAmount(satoshi int64) string {
+	sign := ""
+	n := new(big.Int).SetInt64(satoshi)
+	if n.Sign() < 0 {
+		sign = "-"
+		n.Neg(n)
+	}
+	s := n.String()
+	if len(s) < 9 {
+		s = strings.Repeat("0", 9-len(s)) + s
+	}
+	return sign + s[:len(s)-8] + "." + s[len(s)-8:]
+}
@@ -50,7 +50,6 @@ func (b *Bitcoind) DumpPrivKey(address string) (privKey string, err error) {
 	return
 }
 
-
 // GetAccount returns the account associated with the given address.
 func (b *Bitcoind) GetAccount(address string) (account string, err error) {
 	r, err := b.client.call("getaccount", []string{address})
@@ -85,8 +84,8 @@ func (b *Bitcoind) GetAddressesByAccount(account string) (addresses []string, er
 }
 
 // GetBalance return the balance of the server or of a specific account
-//If [account] is "", returns the server's total available balance.
-//If [account] is specified, returns the balance in the account
+// If [account] is "", returns the server's total available balance.
+// If [account] is specified, returns the balance in the account
 func (b *Bitcoind) GetBalance(account string, minconf uint64) (balance float64, err error) {
 	r, err := b.client.call("getbalance", []interface{}{account, minconf})
 	if err = handleError(err, &r); err != nil {
@@ -106,14 +105,15 @@ type BlockHeader struct {
 	Time              int64
 	Mediantime        int64
 	Nonce             uint32
-	Bits              uint32
+	Bits              string
 	Difficulty        float64
 	Chainwork         string
 	Txes              int    `json:"nTx"`
-	Previousblockhash string `json:"omitempty"`
-	Nextblockhash     string `json:"omitempty"`
+	Previousblockhash string `json:"previousblockhash,omitempty"`
+	Nextblockhash     string `json:"nextblockhash,omitempty"`
 }
 
+// GetBlockheader returns information about the header of the block with the given hash.
 func (b *Bitcoind) GetBlockheader(blockHash string) (*BlockHeader, error) {
 	r, err := b.client.call("getblockheader", []string{blockHash})
 	if err = handleError(err, &r); err != nil {
@@ -121,11 +121,22 @@ func (b *Bitcoind) GetBlockheader(blockHash string) (*BlockHeader, error) {
 	}
 
 	var blockHeader BlockHeader
-	err = json.Unmarshal(r.Result, &blockHeader)
-
+	if err = json.Unmarshal(r.Result, &blockHeader); err != nil {
+		return nil, err
+	}
 	return &blockHeader, nil
 }
 
+// GetRawBlockheader returns the serialized, hex-encoded header of the block with the given hash.
+func (b *Bitcoind) GetRawBlockheader(blockHash string) (str string, err error) {
+	r, err := b.client.call("getblockheader", []interface{}{blockHash, false})
+	if err = handleError(err, &r); err != nil {
+		return
+	}
+	err = json.Unmarshal(r.Result, &str)
+	return
+}
+
 // GetBestBlockhash returns the hash of the best (tip) block in the longest block chain.
 func (b *Bitcoind) GetBestBlockhash() (bestBlockHash string, err error) {
 	r, err := b.client.call("getbestblockhash", nil)
@@ -441,6 +452,21 @@ func (b *Bitcoind) GetTxOut(txid string, n uint32, includeMempool bool) (transac
 	return
 }
 
+// GetTxOutProof returns a hex-encoded proof that the transactions were included in a block.
+// If blockHash is empty the node looks the block up in its txindex or UTXO set.
+func (b *Bitcoind) GetTxOutProof(txids []string, blockHash string) (proof string, err error) {
+	params := []interface{}{txids}
+	if blockHash != "" {
+		params = append(params, blockHash)
+	}
+	r, err := b.client.call("gettxoutproof", params)
+	if err = handleError(err, &r); err != nil {
+		return
+	}
+	err = json.Unmarshal(r.Result, &proof)
+	return
+}
+
 // GetTxOutsetInfo returns statistics about the unspent transaction output (UTXO) set
 func (b *Bitcoind) GetTxOutsetInfo() (txOutSet TransactionOutSet, err error) {
 	r, err := b.client.call("gettxoutsetinfo", nil)
@@ -613,6 +639,7 @@ func (b *Bitcoind) ListWallet() (wallets []string, err error) {
 	err = json.Unmarshal(r.Result, &wallets)
 	return
 }
+
 // ListUnspent returns array of unspent transaction inputs in the wallet.
 func (b *Bitcoind) ListUnspent(minconf, maxconf uint32, addresses []string) (utxos []UTXO, err error) {
 	if maxconf > 999999 {
@@ -664,8 +691,9 @@ func (b *Bitcoind) Move(formAccount, toAccount string, amount float64, minconf u
 }
 
 // SendFrom send amount from fromAccount to toAddress
-//  amount is a real and is rounded to 8 decimal places.
-//  Will send the given amount to the given address, ensuring the account has a valid balance using [minconf] confirmations.
+//
+//	amount is a real and is rounded to 8 decimal places.
+//	Will send the given amount to the given address, ensuring the account has a valid balance using [minconf] confirmations.
 func (b *Bitcoind) SendFrom(fromAccount, toAddress string, amount float64, minconf uint32, comment, commentTo string) (txID string, err error) {
 	r, err := b.client.call("sendfrom", []interface{}{fromAccount, toAddress, amount, minconf, comment, commentTo})
 	if err = handleError(err, &r); err != nil {
@@ -715,6 +743,17 @@ func (b *Bitcoind) SendManyReplaceable(fromAccount string, amounts map[string]fl
 	return
 }
 
+// SendRawTransaction submits a serialized transaction, in hex, to the node
+// and the network
+func (b *Bitcoind) SendRawTransaction(txHex string) (txID string, err error) {
+	r, err := b.client.call("sendrawtransaction", []interface{}{txHex})
+	if err = handleError(err, &r); err != nil {
+		return
+	}
+	err = json.Unmarshal(r.Result, &txID)
+	return
+}
+
 // SendToAddress send an amount to a given address
 func (b *Bitcoind) SendToAddress(toAddress string, amount float64, comment, commentTo string) (txID string, err error) {
 	r, err := b.client.call("sendtoaddress", []interface{}{toAddress, amount, comment, commentTo})
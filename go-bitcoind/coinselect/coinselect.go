@@ -0,0 +1,195 @@
+// Package coinselect picks the outputs a withdrawal of the multisig spends.
+// The selection only depends on the outputs offered and the parameters, not
+// on their order. Their confirmations are not read: which outputs are
+// offered, e.g. only those deep enough to spend, is up to the caller, and
+// differs between relayers polling at different times. The relayers agree on
+// the proposer's selection, they don't repeat it.
+//
+// The outputs are ordered by amount, largest first, then by outpoint. A
+// branch and bound search first looks for outputs paying the target without
+// change, their excess under the dust threshold. Without one, the largest
+// outputs are spent until they pay the target, the change going back to the
+// multisig.
+package coinselect
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// MaxTries bounds the branch and bound search, the number of subsets of
+// the outputs it tries
+const MaxTries = 100000
+
+var (
+	// ErrInsufficientFunds is returned when the outputs don't pay the target
+	ErrInsufficientFunds = errors.New("coinselect: insufficient funds")
+
+	// ErrTooManyInputs is returned when paying the target takes more than the
+	// maximum number of inputs
+	ErrTooManyInputs = errors.New("coinselect: too many inputs")
+)
+
+// Params are the parameters of a selection
+type Params struct {
+	// Target is the amount spent, in satoshis: the payment and the fee
+	Target int64
+
+	// Dust is the smallest change output, less is left to the fee
+	Dust int64
+
+	// MaxInputs bounds the number of outputs spent, 0 for no bound
+	MaxInputs int
+}
+
+// A Selection is the outputs spent by a withdrawal and its change
+type Selection struct {
+	// Inputs are in outpoint order: txid, then vout
+	Inputs []bitcoind.UTXO
+
+	// Total is the amount of the inputs
+	Total int64
+
+	// Change is the amount paid back, 0 for none. Without change, the
+	// inputs' excess over the target is left to the fee.
+	Change int64
+}
+
+// Select picks the outputs of utxos spent to pay p.Target. It returns
+// ErrInsufficientFunds or ErrTooManyInputs, wrapped, when they can't pay it.
+func Select(utxos []bitcoind.UTXO, p Params) (*Selection, error) {
+	if p.Target <= 0 || p.Dust < 0 || p.MaxInputs < 0 {
+		return nil, fmt.Errorf("coinselect: invalid parameters %+v", p)
+	}
+	coins, err := order(utxos)
+	if err != nil {
+		return nil, err
+	}
+	limit := p.MaxInputs
+	if limit == 0 || limit > len(coins) {
+		limit = len(coins)
+	}
+
+	var total int64
+	for _, u := range coins {
+		total += u.Amount
+	}
+	if total < p.Target {
+		return nil, fmt.Errorf("%w: %d satoshis, %d needed", ErrInsufficientFunds, total, p.Target)
+	}
+
+	if picked := branchAndBound(coins, p.Target, p.Dust, limit); picked != nil {
+		return selection(picked, p), nil
+	}
+
+	// largest first
+	var sum int64
+	for i, u := range coins[:limit] {
+		sum += u.Amount
+		if sum >= p.Target {
+			return selection(coins[:i+1], p), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: the %d largest outputs pay %d satoshis, %d needed", ErrTooManyInputs, limit, sum, p.Target)
+}
+
+// order returns a copy of utxos by amount, largest first, then by outpoint
+func order(utxos []bitcoind.UTXO) ([]bitcoind.UTXO, error) {
+	coins := append([]bitcoind.UTXO(nil), utxos...)
+	sort.Slice(coins, func(i, j int) bool {
+		if coins[i].Amount != coins[j].Amount {
+			return coins[i].Amount > coins[j].Amount
+		}
+		return less(coins[i], coins[j])
+	})
+	seen := make(map[string]bool, len(coins))
+	for _, u := range coins {
+		if u.Amount <= 0 {
+			return nil, fmt.Errorf("coinselect: output %s of %d satoshis", u.OutPoint(), u.Amount)
+		}
+		if seen[u.OutPoint()] {
+			return nil, fmt.Errorf("coinselect: output %s offered twice", u.OutPoint())
+		}
+		seen[u.OutPoint()] = true
+	}
+	return coins, nil
+}
+
+// less orders the outputs by outpoint
+func less(a, b bitcoind.UTXO) bool {
+	if a.TxID != b.TxID {
+		return a.TxID < b.TxID
+	}
+	return a.Vout < b.Vout
+}
+
+// branchAndBound returns the first subset of at most limit coins, in their
+// order, whose amount is in [target, target+dust), nil if it finds none in
+// MaxTries. The search includes each coin before excluding it, and prunes
+// the branches over target+dust or unable to reach target.
+func branchAndBound(coins []bitcoind.UTXO, target, dust int64, limit int) []bitcoind.UTXO {
+	// remaining[i] is the amount of coins[i:]
+	remaining := make([]int64, len(coins)+1)
+	for i := len(coins) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + coins[i].Amount
+	}
+	var (
+		picked []bitcoind.UTXO
+		tries  int
+		search func(i int, sum int64) bool
+	)
+	search = func(i int, sum int64) bool {
+		if sum >= target {
+			return sum < target+dust
+		}
+		tries++
+		if i == len(coins) || len(picked) == limit || sum+remaining[i] < target || tries > MaxTries {
+			return false
+		}
+		picked = append(picked, coins[i])
+		if search(i+1, sum+coins[i].Amount) {
+			return true
+		}
+		picked = picked[:len(picked)-1]
+		return search(i+1, sum)
+	}
+	if !search(0, 0) {
+		return nil
+	}
+	return picked
+}
+
+// selection returns the selection spending picked
+func selection(picked []bitcoind.UTXO, p Params) *Selection {
+	s := &Selection{Inputs: append([]bitcoind.UTXO(nil), picked...)}
+	sort.Slice(s.Inputs, func(i, j int) bool { return less(s.Inputs[i], s.Inputs[j]) })
+	for _, u := range s.Inputs {
+		s.Total += u.Amount
+	}
+	if change := s.Total - p.Target; change >= p.Dust && change > 0 {
+		s.Change = change
+	}
+	return s
+}
+
+// Tx returns the unsigned transaction of the selection: its inputs in order,
+// then payment, then the change to changeScript if any
+func (s *Selection) Tx(payment *wire.TxOut, changeScript []byte) (*wire.MsgTx, error) {
+	tx := wire.NewMsgTx(2)
+	for _, u := range s.Inputs {
+		op, err := wire.NewOutPoint(u.TxID, u.Vout)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxIn(&wire.TxIn{PreviousOutPoint: op, Sequence: wire.MaxTxInSequenceNum})
+	}
+	tx.AddTxOut(payment)
+	if s.Change > 0 {
+		tx.AddTxOut(&wire.TxOut{Value: s.Change, PkScript: changeScript})
+	}
+	return tx, nil
+}
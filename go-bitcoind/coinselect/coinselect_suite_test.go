@@ -0,0 +1,13 @@
+package coinselect
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCoinselect(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Coinselect Suite")
+}
@@ -0,0 +1,177 @@
+package coinselect
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit/deposittest"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// coin returns output vout of the transaction numbered seq
+func coin(seq, vout uint32, amount int64, confirmations uint32) bitcoind.UTXO {
+	u := deposittest.UTXO(seq, "", "0020", amount, confirmations)
+	u.Vout = vout
+	return u
+}
+
+// outpoints returns the outpoints of the selection's inputs
+func outpoints(s *Selection) []string {
+	var ops []string
+	for _, u := range s.Inputs {
+		ops = append(ops, u.OutPoint())
+	}
+	return ops
+}
+
+// randomCoins returns n outputs of random amounts, some equal, and
+// confirmations
+func randomCoins(r *rand.Rand, n int) []bitcoind.UTXO {
+	var coins []bitcoind.UTXO
+	for i := 0; i < n; i++ {
+		amount := int64(r.Intn(20)+1) * 1000000
+		if r.Intn(3) == 0 {
+			amount += int64(r.Intn(1000000))
+		}
+		coins = append(coins, coin(uint32(r.Intn(n)), uint32(i), amount, uint32(r.Intn(100)+1)))
+	}
+	return coins
+}
+
+var _ = Describe("Coin selection", func() {
+	const dust = 546
+
+	It("should spend outputs paying the target without change", func() {
+		coins := []bitcoind.UTXO{coin(1, 0, 5000000, 1), coin(2, 0, 3000000, 1), coin(3, 0, 2000100, 1), coin(4, 0, 1000000, 1)}
+		s, err := Select(coins, Params{Target: 5000000, Dust: dust})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outpoints(s)).To(Equal([]string{coins[0].OutPoint()}))
+		Expect(s.Change).To(BeZero())
+
+		// 3000000+2000100, the excess is dust
+		s, err = Select(coins, Params{Target: 5000050, Dust: dust})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Inputs).To(ConsistOf(coins[1], coins[2]))
+		Expect(s.Total).To(Equal(int64(5000100)))
+		Expect(s.Change).To(BeZero())
+	})
+
+	It("should spend the largest outputs first otherwise", func() {
+		coins := []bitcoind.UTXO{coin(1, 0, 1000000, 1), coin(2, 0, 5000000, 1), coin(3, 0, 3000000, 1)}
+		s, err := Select(coins, Params{Target: 7000000, Dust: dust})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Inputs).To(ConsistOf(coins[1], coins[2]))
+		Expect(s.Change).To(Equal(int64(1000000)))
+
+		// equal amounts are spent in outpoint order
+		coins = []bitcoind.UTXO{coin(1, 1, 1000000, 1), coin(1, 0, 1000000, 1)}
+		s, err = Select(coins, Params{Target: 500000, Dust: dust})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outpoints(s)).To(Equal([]string{coins[1].OutPoint()}))
+	})
+
+	It("should respect the maximum number of inputs", func() {
+		coins := []bitcoind.UTXO{coin(1, 0, 1000000, 1), coin(2, 0, 1000000, 1), coin(3, 0, 1000000, 1)}
+		s, err := Select(coins, Params{Target: 2500000, Dust: dust, MaxInputs: 3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Inputs).To(HaveLen(3))
+
+		_, err = Select(coins, Params{Target: 2500000, Dust: dust, MaxInputs: 2})
+		Expect(errors.Is(err, ErrTooManyInputs)).To(BeTrue())
+		_, err = Select(coins, Params{Target: 3000001, Dust: dust})
+		Expect(errors.Is(err, ErrInsufficientFunds)).To(BeTrue())
+	})
+
+	It("should reject invalid outputs and parameters", func() {
+		_, err := Select([]bitcoind.UTXO{coin(1, 0, 1000, 1), coin(1, 0, 2000, 1)}, Params{Target: 500})
+		Expect(err).To(MatchError(ContainSubstring("offered twice")))
+		_, err = Select([]bitcoind.UTXO{coin(1, 0, 0, 1)}, Params{Target: 500})
+		Expect(err).To(HaveOccurred())
+		_, err = Select(nil, Params{Target: 0})
+		Expect(err).To(HaveOccurred())
+		_, err = Select(nil, Params{Target: 1, MaxInputs: -1})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should build the payment then the change", func() {
+		coins := []bitcoind.UTXO{coin(2, 0, 3000000, 1), coin(1, 1, 3000000, 1)}
+		s, err := Select(coins, Params{Target: 5000000, Dust: dust})
+		Expect(err).NotTo(HaveOccurred())
+		tx, err := s.Tx(&wire.TxOut{Value: 4990000, PkScript: []byte{0x00, 0x14}}, []byte{0x00, 0x20})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tx.TxIn).To(HaveLen(2))
+		Expect(tx.TxIn[0].PreviousOutPoint.String()).To(Equal(s.Inputs[0].OutPoint()))
+		Expect(tx.TxIn[0].Sequence).To(Equal(wire.MaxTxInSequenceNum))
+		Expect(tx.TxOut).To(HaveLen(2))
+		Expect(tx.TxOut[0].Value).To(Equal(int64(4990000)))
+		Expect(tx.TxOut[1].Value).To(Equal(int64(1000000)))
+		Expect(tx.TxOut[1].PkScript).To(Equal([]byte{0x00, 0x20}))
+	})
+
+	Describe("properties", func() {
+		It("should depend only on the outputs and the parameters", func() {
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 300; i++ {
+				coins := randomCoins(r, r.Intn(30)+1)
+				p := Params{Target: int64(r.Intn(60000000) + 1), Dust: int64(r.Intn(2) * dust * 1000), MaxInputs: r.Intn(8)}
+				want, wantErr := Select(coins, p)
+
+				// the same outputs in another order, at other confirmations
+				other := append([]bitcoind.UTXO(nil), coins...)
+				r.Shuffle(len(other), func(i, j int) { other[i], other[j] = other[j], other[i] })
+				for j := range other {
+					other[j].Confirmations += uint32(r.Intn(10))
+				}
+				got, err := Select(other, p)
+				if wantErr != nil {
+					Expect(err).To(MatchError(wantErr.Error()), "case %d", i)
+					continue
+				}
+				Expect(err).NotTo(HaveOccurred(), "case %d", i)
+				Expect(outpoints(got)).To(Equal(outpoints(want)), "case %d", i)
+				Expect(got.Change).To(Equal(want.Change), "case %d", i)
+
+				payment := &wire.TxOut{Value: p.Target, PkScript: []byte{0x00, 0x14}}
+				wantTx, _ := want.Tx(payment, []byte{0x00, 0x20})
+				gotTx, _ := got.Tx(payment, []byte{0x00, 0x20})
+				Expect(gotTx.Hex()).To(Equal(wantTx.Hex()), "case %d", i)
+			}
+		})
+
+		It("should pay the target within the limits", func() {
+			r := rand.New(rand.NewSource(2))
+			for i := 0; i < 300; i++ {
+				coins := randomCoins(r, r.Intn(30)+1)
+				p := Params{Target: int64(r.Intn(60000000) + 1), Dust: dust, MaxInputs: r.Intn(8)}
+				s, err := Select(coins, p)
+				if err != nil {
+					Expect(errors.Is(err, ErrInsufficientFunds) || errors.Is(err, ErrTooManyInputs)).To(BeTrue(), "case %d: %v", i, err)
+					continue
+				}
+				if p.MaxInputs > 0 {
+					Expect(len(s.Inputs)).To(BeNumerically("<=", p.MaxInputs), "case %d", i)
+				}
+				var total int64
+				for j, u := range s.Inputs {
+					total += u.Amount
+					Expect(coins).To(ContainElement(u), "case %d", i)
+					if j > 0 {
+						Expect(less(s.Inputs[j-1], u)).To(BeTrue(), "case %d", i)
+					}
+				}
+				Expect(s.Total).To(Equal(total), "case %d", i)
+				Expect(total).To(BeNumerically(">=", p.Target), "case %d", i)
+				if s.Change == 0 {
+					Expect(total-p.Target).To(BeNumerically("<", dust), "case %d", i)
+				} else {
+					Expect(s.Change).To(Equal(total-p.Target), "case %d", i)
+					Expect(s.Change).To(BeNumerically(">=", dust), "case %d", i)
+				}
+			}
+		})
+	})
+})
@@ -0,0 +1,85 @@
+package deposit
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Decimals is the number of decimals of BTG amounts in satoshis
+const Decimals = 8
+
+// Limits bound the deposits the bridge credits and give the fee it keeps
+type Limits struct {
+	min, max int64 // 0 for no bound
+	fee      int64
+}
+
+// NewLimits returns the limits accepting deposits of min to max satoshis,
+// either 0 for no bound, and deducting fee satoshis from each. Every deposit
+// accepted must cover the fee.
+func NewLimits(min, max, fee int64) (*Limits, error) {
+	if min < 0 || max < 0 || fee < 0 {
+		return nil, errors.New("deposit: amounts and fee must not be negative")
+	}
+	if max > 0 && max < min {
+		return nil, fmt.Errorf("deposit: maximum amount %d is below the minimum %d", max, min)
+	}
+	if max > 0 && max <= fee {
+		return nil, fmt.Errorf("deposit: maximum amount %d does not cover the fee %d", max, fee)
+	}
+	return &Limits{min: min, max: max, fee: fee}, nil
+}
+
+// Net returns the satoshis credited for a deposit of amount satoshis, the
+// fee deducted, or an error telling why the deposit is rejected
+func (l *Limits) Net(amount int64) (int64, error) {
+	switch {
+	case amount < l.min:
+		return 0, fmt.Errorf("deposit: amount %d is below the minimum %d", amount, l.min)
+	case l.max > 0 && amount > l.max:
+		return 0, fmt.Errorf("deposit: amount %d is above the maximum %d", amount, l.max)
+	case amount <= l.fee:
+		return 0, fmt.Errorf("deposit: amount %d does not cover the fee %d", amount, l.fee)
+	}
+	return amount - l.fee, nil
+}
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// Scale converts satoshis to the units of a token with the given decimals.
+// The conversion is exact: an amount finer than the token's precision is an
+// error, never rounded.
+func Scale(amount int64, decimals uint8) (*big.Int, error) {
+	units := big.NewInt(amount)
+	if decimals >= Decimals {
+		return units.Mul(units, pow10(int(decimals)-Decimals)), nil
+	}
+	q, r := new(big.Int).QuoRem(units, pow10(Decimals-int(decimals)), new(big.Int))
+	if r.Sign() != 0 {
+		return nil, fmt.Errorf("deposit: %d satoshis can't be expressed with %d decimals", amount, decimals)
+	}
+	return q, nil
+}
+
+// Unscale converts units of a token with the given decimals back to
+// satoshis, exactly like Scale
+func Unscale(units *big.Int, decimals uint8) (int64, error) {
+	amount := new(big.Int)
+	if decimals <= Decimals {
+		amount.Mul(units, pow10(Decimals-int(decimals)))
+	} else {
+		var r big.Int
+		amount.QuoRem(units, pow10(int(decimals)-Decimals), &r)
+		if r.Sign() != 0 {
+			return 0, fmt.Errorf("deposit: %s units with %d decimals are not whole satoshis", units, decimals)
+		}
+	}
+	if !amount.IsInt64() {
+		return 0, fmt.Errorf("deposit: %s units with %d decimals overflow satoshis", units, decimals)
+	}
+	return amount.Int64(), nil
+}
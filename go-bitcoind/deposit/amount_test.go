@@ -0,0 +1,66 @@
+package deposit
+
+import (
+	"math/big"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Amounts", func() {
+	const btg = 100000000
+
+	It("should deduct the fee from the deposits within the limits", func() {
+		l, err := NewLimits(btg/100, 1000*btg, 50000)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Net(btg)).To(Equal(int64(btg - 50000)))
+		Expect(l.Net(1000 * btg)).To(Equal(int64(1000*btg - 50000)))
+
+		_, err = l.Net(btg/100 - 1)
+		Expect(err).To(MatchError(ContainSubstring("below the minimum")))
+		_, err = l.Net(1000*btg + 1)
+		Expect(err).To(MatchError(ContainSubstring("above the maximum")))
+
+		free, _ := NewLimits(0, 0, 0)
+		Expect(free.Net(1)).To(Equal(int64(1)))
+		feeOnly, _ := NewLimits(0, 0, 1000)
+		_, err = feeOnly.Net(1000)
+		Expect(err).To(MatchError(ContainSubstring("does not cover the fee")))
+	})
+
+	It("should reject inconsistent limits", func() {
+		_, err := NewLimits(-1, 0, 0)
+		Expect(err).To(HaveOccurred())
+		_, err = NewLimits(10, 5, 0)
+		Expect(err).To(HaveOccurred())
+		_, err = NewLimits(0, 5, 5)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should scale satoshis exactly to the token's decimals", func() {
+		units, err := Scale(150000000, 18)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(units.String()).To(Equal("1500000000000000000"))
+		units, _ = Scale(150000000, Decimals)
+		Expect(units.Int64()).To(Equal(int64(150000000)))
+		units, err = Scale(150000000, 6)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(units.Int64()).To(Equal(int64(1500000)))
+
+		_, err = Scale(150000001, 6)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should scale token units back to satoshis", func() {
+		units, _ := new(big.Int).SetString("1500000000000000000", 10)
+		Expect(Unscale(units, 18)).To(Equal(int64(150000000)))
+		Expect(Unscale(big.NewInt(1500000), 6)).To(Equal(int64(150000000)))
+
+		units.Add(units, big.NewInt(1))
+		_, err := Unscale(units, 18)
+		Expect(err).To(HaveOccurred())
+		huge, _ := new(big.Int).SetString("100000000000000000000000000000", 10)
+		_, err = Unscale(huge, 8)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,132 @@
+// Package deposit tracks the outputs paying the watched addresses. Deposits
+// are identified by their outpoint, so every output of a transaction paying
+// the multisig is a deposit of its own.
+package deposit
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// A Deposit is an output paying a watched address
+type Deposit struct {
+	OutPoint      wire.OutPoint
+	Address       string
+	Amount        int64 // in satoshis
+	ScriptPubKey  []byte
+	Confirmations uint32
+
+	// The block containing the output and the index of the transaction in
+	// it, when known
+	Block   string
+	Height  uint64
+	TxIndex uint32
+}
+
+// FromUTXO converts a listunspent entry
+func FromUTXO(u bitcoind.UTXO) (*Deposit, error) {
+	op, err := wire.NewOutPoint(u.TxID, u.Vout)
+	if err != nil {
+		return nil, err
+	}
+	script, err := hex.DecodeString(u.ScriptPubKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Deposit{
+		OutPoint:      op,
+		Address:       u.Address,
+		Amount:        u.Amount,
+		ScriptPubKey:  script,
+		Confirmations: u.Confirmations,
+	}, nil
+}
+
+// ID returns the deterministic identifier of the deposit, its txid:vout
+func (d *Deposit) ID() string {
+	return d.OutPoint.String()
+}
+
+// Bits of the chain position in a nonce
+const (
+	NonceHeightBits  = 24
+	NonceTxIndexBits = 20
+	NonceVoutBits    = 20
+)
+
+// Nonce derives the nonce of a deposit from the position of its output in
+// the chain: the block height in the high 24 bits, the index of the
+// transaction in the block in the next 20 and the output index in the low
+// 20. Every relayer computes the same nonce for the same deposit, whatever
+// it saw before. The nonce is never 0.
+func Nonce(height uint64, txIndex, vout uint32) (uint64, error) {
+	if height == 0 || height >= 1<<NonceHeightBits || txIndex >= 1<<NonceTxIndexBits || vout >= 1<<NonceVoutBits {
+		return 0, fmt.Errorf("deposit: no nonce for position %d/%d/%d", height, txIndex, vout)
+	}
+	return height<<(NonceTxIndexBits+NonceVoutBits) | uint64(txIndex)<<NonceVoutBits | uint64(vout), nil
+}
+
+// Less orders outpoints by txid, in RPC byte order, then by output index
+func Less(a, b wire.OutPoint) bool {
+	if a.Hash != b.Hash {
+		return a.Hash.String() < b.Hash.String()
+	}
+	return a.Index < b.Index
+}
+
+// Sort orders deposits by outpoint, so every watcher handles a batch in the same order
+func Sort(deposits []*Deposit) {
+	sort.Slice(deposits, func(i, j int) bool {
+		return Less(deposits[i].OutPoint, deposits[j].OutPoint)
+	})
+}
+
+// A Tracker keeps the set of unspent deposits between two polls
+type Tracker struct {
+	unspent map[wire.OutPoint]*Deposit
+}
+
+// NewTracker returns an empty tracker
+func NewTracker() *Tracker {
+	return &Tracker{unspent: make(map[wire.OutPoint]*Deposit)}
+}
+
+// Update replaces the tracked set with the outputs of the latest poll. It
+// returns the deposits that appeared and those that are no longer unspent,
+// both sorted by outpoint. An outpoint listed twice is only added once.
+func (t *Tracker) Update(latest []*Deposit) (added, removed []*Deposit) {
+	next := make(map[wire.OutPoint]*Deposit, len(latest))
+	for _, d := range latest {
+		if _, dup := next[d.OutPoint]; dup {
+			continue
+		}
+		next[d.OutPoint] = d
+		if _, ok := t.unspent[d.OutPoint]; !ok {
+			added = append(added, d)
+		}
+	}
+	for op, d := range t.unspent {
+		if _, ok := next[op]; !ok {
+			removed = append(removed, d)
+		}
+	}
+	t.unspent = next
+	Sort(added)
+	Sort(removed)
+	return added, removed
+}
+
+// Len returns the number of tracked deposits
+func (t *Tracker) Len() int {
+	return len(t.unspent)
+}
+
+// Get returns the tracked deposit at op
+func (t *Tracker) Get(op wire.OutPoint) (*Deposit, bool) {
+	d, ok := t.unspent[op]
+	return d, ok
+}
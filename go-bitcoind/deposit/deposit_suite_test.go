@@ -0,0 +1,13 @@
+package deposit
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDeposit(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Deposit Suite")
+}
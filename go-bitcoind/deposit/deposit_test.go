@@ -0,0 +1,134 @@
+package deposit
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+)
+
+const (
+	watched = "btg1qmc6uua0jngs9qr38w3pchcvdcrzu878t8p8nwqtj32rtjvjfvnfqywt5pr"
+	script  = "0020de35ce75f29a20500e2774438be18dc0c5c3f8eb384f3701728a86b9324964d2"
+	txA     = "f35103085b7145e569eb8053365c662cb7b9b7fd6009e37cafbb684bd89b638b"
+	txB     = "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098"
+)
+
+// A listunspent result where txA pays the multisig twice (a batch payout)
+const listUnspent = `[
+  {"txid": "` + txA + `", "vout": 0, "address": "` + watched + `", "scriptPubKey": "` + script + `",
+   "amount": 1.50000000, "confirmations": 3, "spendable": false, "safe": true},
+  {"txid": "` + txA + `", "vout": 2, "address": "` + watched + `", "scriptPubKey": "` + script + `",
+   "amount": 0.00000546, "confirmations": 3, "spendable": false, "safe": true},
+  {"txid": "` + txB + `", "vout": 1, "address": "` + watched + `", "scriptPubKey": "` + script + `",
+   "amount": 21000000.00000000, "confirmations": 1, "spendable": false, "safe": true}
+]`
+
+func decode(s string) []*Deposit {
+	var utxos []bitcoind.UTXO
+	Expect(json.Unmarshal([]byte(s), &utxos)).To(Succeed())
+	var deposits []*Deposit
+	for _, u := range utxos {
+		d, err := FromUTXO(u)
+		Expect(err).NotTo(HaveOccurred())
+		deposits = append(deposits, d)
+	}
+	return deposits
+}
+
+var _ = Describe("Deposit", func() {
+	It("should decode listunspent amounts to satoshis", func() {
+		var utxos []bitcoind.UTXO
+		Expect(json.Unmarshal([]byte(listUnspent), &utxos)).To(Succeed())
+		Expect(utxos[0].Amount).To(Equal(int64(150000000)))
+		Expect(utxos[1].Amount).To(Equal(int64(546)))
+		Expect(utxos[2].Amount).To(Equal(int64(2100000000000000)))
+		Expect(utxos[1].OutPoint()).To(Equal(txA + ":2"))
+
+		b, err := json.Marshal(utxos[1])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring(`"amount":0.00000546`))
+		var back bitcoind.UTXO
+		Expect(json.Unmarshal(b, &back)).To(Succeed())
+		Expect(back).To(Equal(utxos[1]))
+	})
+
+	It("should identify each output by its outpoint", func() {
+		deposits := decode(listUnspent)
+		Expect(deposits[0].ID()).To(Equal(txA + ":0"))
+		Expect(deposits[1].ID()).To(Equal(txA + ":2"))
+		Expect(deposits[0].ID()).NotTo(Equal(deposits[1].ID()))
+	})
+
+	It("should derive the nonce from the chain position", func() {
+		n, err := Nonce(700000, 12, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(uint64(700000)<<40 | 12<<20 | 1))
+
+		// ordered by height, then transaction, then output
+		later, _ := Nonce(700001, 0, 0)
+		next, _ := Nonce(700000, 13, 0)
+		Expect(n < next && next < later).To(BeTrue())
+
+		for _, bad := range [][3]uint64{{0, 1, 0}, {1 << 24, 0, 0}, {1, 1 << 20, 0}, {1, 0, 1 << 20}} {
+			_, err := Nonce(bad[0], uint32(bad[1]), uint32(bad[2]))
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	Describe("Tracker", func() {
+		var t *Tracker
+
+		BeforeEach(func() {
+			t = NewTracker()
+		})
+
+		It("should report every output of a multi-output transaction", func() {
+			added, removed := t.Update(decode(listUnspent))
+			Expect(removed).To(BeEmpty())
+			Expect(added).To(HaveLen(3))
+			Expect(t.Len()).To(Equal(3))
+		})
+
+		It("should order new deposits by outpoint", func() {
+			added, _ := t.Update(decode(listUnspent))
+			Expect(added[0].ID()).To(Equal(txB + ":1"))
+			Expect(added[1].ID()).To(Equal(txA + ":0"))
+			Expect(added[2].ID()).To(Equal(txA + ":2"))
+		})
+
+		It("should not report known outputs again", func() {
+			t.Update(decode(listUnspent))
+			added, removed := t.Update(decode(listUnspent))
+			Expect(added).To(BeEmpty())
+			Expect(removed).To(BeEmpty())
+		})
+
+		It("should report a new output of an already seen transaction", func() {
+			all := decode(listUnspent)
+			t.Update(all[:1])
+			added, _ := t.Update(all[:2])
+			Expect(added).To(HaveLen(1))
+			Expect(added[0].ID()).To(Equal(txA + ":2"))
+		})
+
+		It("should report spent outputs individually", func() {
+			all := decode(listUnspent)
+			t.Update(all)
+			added, removed := t.Update([]*Deposit{all[1], all[2]})
+			Expect(added).To(BeEmpty())
+			Expect(removed).To(HaveLen(1))
+			Expect(removed[0].ID()).To(Equal(txA + ":0"))
+			_, ok := t.Get(all[0].OutPoint)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should add a duplicated outpoint once", func() {
+			all := decode(listUnspent)
+			added, _ := t.Update([]*Deposit{all[0], all[0]})
+			Expect(added).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,75 @@
+// Package deposittest provides a deterministic deposit.UTXOSource for the
+// tests. It refuses to run outside of a test binary, so it can't make it into
+// a running relayer.
+package deposittest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"flag"
+	"sync"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// A FakeSource lists the outputs it was given, in the order given
+type FakeSource struct {
+	mu    sync.Mutex
+	utxos []bitcoind.UTXO
+	err   error
+}
+
+// NewFakeSource returns a source listing utxos. It panics outside of a test
+// binary.
+func NewFakeSource(utxos ...bitcoind.UTXO) *FakeSource {
+	// go test registers its flags before running the tests
+	if flag.Lookup("test.v") == nil {
+		panic("deposittest: the fake UTXO source is only for tests")
+	}
+	return &FakeSource{utxos: utxos}
+}
+
+// Set replaces the listed outputs, and clears the failure
+func (s *FakeSource) Set(utxos ...bitcoind.UTXO) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.utxos, s.err = utxos, nil
+}
+
+// Fail makes the next listings fail with err, until Set
+func (s *FakeSource) Fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// ListUnspent implements deposit.UTXOSource
+func (s *FakeSource) ListUnspent() ([]bitcoind.UTXO, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return append([]bitcoind.UTXO(nil), s.utxos...), nil
+}
+
+// TxID returns the txid numbered seq, the same on every run
+func TxID(seq uint32) string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], seq)
+	return wire.Hash(sha256.Sum256(b[:])).String()
+}
+
+// UTXO returns the first output of the transaction numbered seq, paying
+// amount satoshis to address with the given script (hex)
+func UTXO(seq uint32, address, scriptPubKey string, amount int64, confirmations uint32) bitcoind.UTXO {
+	return bitcoind.UTXO{
+		TxID:          TxID(seq),
+		Address:       address,
+		ScriptPubKey:  scriptPubKey,
+		Amount:        amount,
+		Confirmations: confirmations,
+		Safe:          true,
+	}
+}
@@ -0,0 +1,41 @@
+package deposit
+
+import (
+	"fmt"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+)
+
+// A UTXOSource lists the unspent outputs paying the watched addresses
+type UTXOSource interface {
+	ListUnspent() ([]bitcoind.UTXO, error)
+}
+
+// Lister is the part of the RPC client listing unspent outputs.
+// *bitcoind.Bitcoind implements it.
+type Lister interface {
+	ListUnspent(minconf, maxconf uint32, addresses []string) ([]bitcoind.UTXO, error)
+}
+
+// An RPCSource lists the unspent outputs of the node's wallet
+type RPCSource struct {
+	node      Lister
+	minconf   uint32
+	maxconf   uint32
+	addresses []string
+}
+
+// NewRPCSource returns the source of the outputs paying addresses with
+// minconf to maxconf confirmations
+func NewRPCSource(node Lister, minconf, maxconf uint32, addresses []string) *RPCSource {
+	return &RPCSource{node: node, minconf: minconf, maxconf: maxconf, addresses: addresses}
+}
+
+// ListUnspent implements UTXOSource with listunspent
+func (s *RPCSource) ListUnspent() ([]bitcoind.UTXO, error) {
+	utxos, err := s.node.ListUnspent(s.minconf, s.maxconf, s.addresses)
+	if err != nil {
+		return nil, fmt.Errorf("listunspent: %v", err)
+	}
+	return utxos, nil
+}
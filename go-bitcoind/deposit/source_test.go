@@ -0,0 +1,71 @@
+package deposit
+
+import (
+	"encoding/json"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit/deposittest"
+)
+
+// lister records the listunspent arguments
+type lister struct {
+	minconf, maxconf uint32
+	addresses        []string
+	err              error
+}
+
+func (l *lister) ListUnspent(minconf, maxconf uint32, addresses []string) ([]bitcoind.UTXO, error) {
+	l.minconf, l.maxconf, l.addresses = minconf, maxconf, addresses
+	if l.err != nil {
+		return nil, l.err
+	}
+	var utxos []bitcoind.UTXO
+	err := json.Unmarshal([]byte(listUnspent), &utxos)
+	return utxos, err
+}
+
+var _ = Describe("UTXOSource", func() {
+	It("should list the unspent outputs of the watched addresses", func() {
+		node := &lister{}
+		var src UTXOSource = NewRPCSource(node, 1, 999999, []string{watched})
+		utxos, err := src.ListUnspent()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utxos).To(HaveLen(3))
+		Expect(node.minconf).To(Equal(uint32(1)))
+		Expect(node.maxconf).To(Equal(uint32(999999)))
+		Expect(node.addresses).To(Equal([]string{watched}))
+
+		node.err = errors.New("Loading wallet...")
+		_, err = src.ListUnspent()
+		Expect(err).To(MatchError("listunspent: Loading wallet..."))
+	})
+
+	It("should have a deterministic fake for the tests", func() {
+		var src UTXOSource = deposittest.NewFakeSource(
+			deposittest.UTXO(2, watched, script, 1000, 6),
+			deposittest.UTXO(1, watched, script, 500, 1),
+		)
+		first, err := src.ListUnspent()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first).To(HaveLen(2))
+		Expect(first[0].TxID).To(Equal(deposittest.TxID(2)))
+		Expect(first[0].TxID).NotTo(Equal(first[1].TxID))
+		d, err := FromUTXO(first[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Amount).To(Equal(int64(1000)))
+
+		again, _ := src.ListUnspent()
+		Expect(again).To(Equal(first))
+
+		fake := src.(*deposittest.FakeSource)
+		fake.Fail(errors.New("down"))
+		_, err = src.ListUnspent()
+		Expect(err).To(MatchError("down"))
+		fake.Set()
+		Expect(src.ListUnspent()).To(BeEmpty())
+	})
+})
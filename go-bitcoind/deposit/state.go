@@ -0,0 +1,122 @@
+package deposit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultConfirmations is the depth at which a deposit becomes final when no
+// tier of the policy applies
+const DefaultConfirmations = 6
+
+// State is the lifecycle state of a deposit
+type State string
+
+// Deposit states
+const (
+	// StateMempool deposits are seen in an unconfirmed transaction
+	StateMempool State = "mempool"
+
+	// StateConfirmed deposits are in the best chain, not deep enough yet
+	StateConfirmed State = "confirmed"
+
+	// StateFinal deposits reached the depth required by the policy. Only
+	// final deposits are credited on the destination chain.
+	StateFinal State = "final"
+
+	// StateOrphaned deposits were in a block that left the best chain
+	StateOrphaned State = "orphaned"
+
+	// StateSpent deposits left the watched set
+	StateSpent State = "spent"
+)
+
+// A Tier requires more confirmations from the deposits of at least MinAmount satoshis
+type Tier struct {
+	MinAmount     int64
+	Confirmations uint32
+}
+
+// A Policy gives the number of confirmations a deposit needs to become final
+type Policy struct {
+	confirmations uint32
+	tiers         []Tier // by increasing MinAmount
+}
+
+// NewPolicy returns a policy requiring confirmations from every deposit and
+// the confirmations of the highest matching tier from larger ones. A larger
+// deposit never needs fewer confirmations than a smaller one.
+func NewPolicy(confirmations uint32, tiers []Tier) (*Policy, error) {
+	if confirmations == 0 {
+		return nil, errors.New("deposit: confirmations must be at least 1")
+	}
+	sorted := append([]Tier{}, tiers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinAmount < sorted[j].MinAmount })
+	required := confirmations
+	for i, t := range sorted {
+		if t.MinAmount <= 0 {
+			return nil, fmt.Errorf("deposit: tier minimum amount must be positive, got %d", t.MinAmount)
+		}
+		if i > 0 && t.MinAmount == sorted[i-1].MinAmount {
+			return nil, fmt.Errorf("deposit: duplicate tier for %d satoshis", t.MinAmount)
+		}
+		if t.Confirmations < required {
+			return nil, fmt.Errorf("deposit: tier from %d satoshis requires %d confirmations, less than smaller deposits (%d)", t.MinAmount, t.Confirmations, required)
+		}
+		required = t.Confirmations
+	}
+	return &Policy{confirmations: confirmations, tiers: sorted}, nil
+}
+
+// ParseTiers parses tiers written as minAmount:confirmations pairs separated
+// by commas, amounts in satoshis, e.g. "100000000:12,1000000000:30"
+func ParseTiers(s string) ([]Tier, error) {
+	var tiers []Tier
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("deposit: invalid tier %q, expected amount:confirmations", pair)
+		}
+		amount, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("deposit: invalid tier amount %q", parts[0])
+		}
+		confirmations, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("deposit: invalid tier confirmations %q", parts[1])
+		}
+		tiers = append(tiers, Tier{MinAmount: amount, Confirmations: uint32(confirmations)})
+	}
+	return tiers, nil
+}
+
+// Required returns the confirmations a deposit of amount satoshis needs
+func (p *Policy) Required(amount int64) uint32 {
+	required := p.confirmations
+	for _, t := range p.tiers {
+		if amount < t.MinAmount {
+			break
+		}
+		required = t.Confirmations
+	}
+	return required
+}
+
+// State returns the state of an unspent deposit of amount satoshis with the
+// given number of confirmations
+func (p *Policy) State(amount int64, confirmations uint32) State {
+	switch {
+	case confirmations == 0:
+		return StateMempool
+	case confirmations < p.Required(amount):
+		return StateConfirmed
+	}
+	return StateFinal
+}
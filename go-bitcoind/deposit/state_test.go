@@ -0,0 +1,46 @@
+package deposit
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy", func() {
+	const btg = 100000000
+
+	tiers, _ := ParseTiers("1000000000:30, 100000000:12")
+
+	It("should require the confirmations of the highest matching tier", func() {
+		p, err := NewPolicy(DefaultConfirmations, tiers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Required(btg - 1)).To(Equal(uint32(DefaultConfirmations)))
+		Expect(p.Required(btg)).To(Equal(uint32(12)))
+		Expect(p.Required(50 * btg)).To(Equal(uint32(30)))
+	})
+
+	It("should derive the state from the confirmations", func() {
+		p, _ := NewPolicy(DefaultConfirmations, tiers)
+		Expect(p.State(btg, 0)).To(Equal(StateMempool))
+		Expect(p.State(btg, 11)).To(Equal(StateConfirmed))
+		Expect(p.State(btg, 12)).To(Equal(StateFinal))
+		Expect(p.State(1, 6)).To(Equal(StateFinal))
+	})
+
+	It("should reject inconsistent policies", func() {
+		_, err := NewPolicy(0, nil)
+		Expect(err).To(HaveOccurred())
+		_, err = NewPolicy(6, []Tier{{MinAmount: btg, Confirmations: 3}})
+		Expect(err).To(HaveOccurred())
+		_, err = NewPolicy(6, []Tier{{MinAmount: btg, Confirmations: 12}, {MinAmount: 10 * btg, Confirmations: 10}})
+		Expect(err).To(HaveOccurred())
+		_, err = NewPolicy(6, []Tier{{MinAmount: btg, Confirmations: 12}, {MinAmount: btg, Confirmations: 20}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject malformed tiers", func() {
+		for _, s := range []string{"100", "x:1", "100:-1", "1:2:3"} {
+			_, err := ParseTiers(s)
+			Expect(err).To(HaveOccurred(), s)
+		}
+	})
+})
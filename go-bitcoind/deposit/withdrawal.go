@@ -0,0 +1,62 @@
+package deposit
+
+import (
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// An Output is a destination of a withdrawal
+type Output struct {
+	Address string `json:"address,omitempty"` // empty for scripts without an address, e.g. OP_RETURN
+	Amount  int64  `json:"amount"`            // in satoshis
+	Script  []byte `json:"script"`
+}
+
+// A Withdrawal is a transaction spending watched outputs, the multisig
+// paying out
+type Withdrawal struct {
+	TxID string `json:"txid"`
+
+	// Spent are the watched outpoints the transaction spends, "txid:vout"
+	Spent []string `json:"spent"`
+
+	// Outputs are all the outputs of the transaction, change included
+	Outputs []Output `json:"outputs"`
+
+	// Fee is the total of the inputs minus the total of the outputs, -1 when
+	// the amount of an input is unknown
+	Fee int64 `json:"fee"`
+
+	// The block of the transaction, empty if it was found in the mempool
+	Block  string `json:"block,omitempty"`
+	Height uint64 `json:"height,omitempty"`
+}
+
+// NewWithdrawal returns the withdrawal of tx spending the watched outpoints
+// spent. amounts holds the value of the inputs of tx, the fee is unknown
+// unless it holds all of them.
+func NewWithdrawal(tx *wire.MsgTx, spent []wire.OutPoint, amounts map[wire.OutPoint]int64, params *address.Params) *Withdrawal {
+	w := &Withdrawal{TxID: tx.TxHash().String(), Fee: -1}
+	for _, op := range spent {
+		w.Spent = append(w.Spent, op.String())
+	}
+	var in, out int64
+	known := true
+	for _, txIn := range tx.TxIn {
+		amount, ok := amounts[txIn.PreviousOutPoint]
+		known = known && ok
+		in += amount
+	}
+	for _, txOut := range tx.TxOut {
+		o := Output{Amount: txOut.Value, Script: txOut.PkScript}
+		if addr, err := address.FromScriptPubKey(txOut.PkScript, params); err == nil {
+			o.Address = addr.String()
+		}
+		w.Outputs = append(w.Outputs, o)
+		out += txOut.Value
+	}
+	if known {
+		w.Fee = in - out
+	}
+	return w
+}
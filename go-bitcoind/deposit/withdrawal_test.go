@@ -0,0 +1,48 @@
+package deposit
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+var _ = Describe("Withdrawal", func() {
+	var (
+		tx           *wire.MsgTx
+		opA0, opB1   wire.OutPoint
+		payee, nulls []byte
+	)
+
+	BeforeEach(func() {
+		opA0, _ = wire.NewOutPoint(txA, 0)
+		opB1, _ = wire.NewOutPoint(txB, 1)
+		payee, _ = hex.DecodeString(script)
+		nulls = []byte{0x6a, 0x02, 0xbe, 0xef}
+		tx = wire.NewMsgTx(2)
+		tx.AddTxIn(&wire.TxIn{PreviousOutPoint: opA0, Sequence: wire.MaxTxInSequenceNum})
+		tx.AddTxIn(&wire.TxIn{PreviousOutPoint: opB1, Sequence: wire.MaxTxInSequenceNum})
+		tx.AddTxOut(&wire.TxOut{Value: 2500, PkScript: payee})
+		tx.AddTxOut(&wire.TxOut{Value: 0, PkScript: nulls})
+	})
+
+	It("should describe the destinations and the fee", func() {
+		amounts := map[wire.OutPoint]int64{opA0: 2000, opB1: 1000}
+		w := NewWithdrawal(tx, []wire.OutPoint{opA0}, amounts, &address.MainNetParams)
+		Expect(w.TxID).To(Equal(tx.TxHash().String()))
+		Expect(w.Spent).To(Equal([]string{txA + ":0"}))
+		Expect(w.Outputs).To(Equal([]Output{
+			{Address: watched, Amount: 2500, Script: payee},
+			{Amount: 0, Script: nulls},
+		}))
+		Expect(w.Fee).To(Equal(int64(500)))
+	})
+
+	It("should leave the fee unknown without the amount of every input", func() {
+		w := NewWithdrawal(tx, []wire.OutPoint{opA0}, map[wire.OutPoint]int64{opA0: 2000}, &address.MainNetParams)
+		Expect(w.Fee).To(Equal(int64(-1)))
+	})
+})
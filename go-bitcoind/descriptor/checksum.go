@@ -0,0 +1,94 @@
+package descriptor
+
+import (
+	"errors"
+	"strings"
+)
+
+// inputCharset maps descriptor characters to the symbols of the checksum,
+// in the order defined by bitcoind's descriptor.cpp
+const inputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+	"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+	"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+// checksumCharset is the bech32 character set the checksum is written in
+const checksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// ErrInvalidChecksum is returned when a descriptor's #checksum does not match
+var ErrInvalidChecksum = errors.New("descriptor: invalid checksum")
+
+var generator = [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+
+func polymod(c uint64, val int) uint64 {
+	c0 := c >> 35
+	c = (c&0x7ffffffff)<<5 ^ uint64(val)
+	for i := uint(0); i < 5; i++ {
+		if (c0>>i)&1 != 0 {
+			c ^= generator[i]
+		}
+	}
+	return c
+}
+
+// Checksum returns the 8 character checksum of a descriptor without its
+// #suffix, as computed by getdescriptorinfo
+func Checksum(desc string) (string, error) {
+	c := uint64(1)
+	cls, clsCount := 0, 0
+	for _, ch := range desc {
+		pos := strings.IndexRune(inputCharset, ch)
+		if pos < 0 {
+			return "", errors.New("descriptor: invalid character " + string(ch))
+		}
+		// symbols are the low 5 bits, and every 3 characters also emit
+		// the group of their upper bits
+		c = polymod(c, pos&31)
+		cls = cls*3 + pos>>5
+		if clsCount++; clsCount == 3 {
+			c = polymod(c, cls)
+			cls, clsCount = 0, 0
+		}
+	}
+	if clsCount > 0 {
+		c = polymod(c, cls)
+	}
+	for i := 0; i < 8; i++ {
+		c = polymod(c, 0)
+	}
+	c ^= 1
+
+	var sum [8]byte
+	for i := range sum {
+		sum[i] = checksumCharset[(c>>(5*(7-uint(i))))&31]
+	}
+	return string(sum[:]), nil
+}
+
+// AddChecksum appends #checksum to a descriptor
+func AddChecksum(desc string) (string, error) {
+	sum, err := Checksum(desc)
+	if err != nil {
+		return "", err
+	}
+	return desc + "#" + sum, nil
+}
+
+// splitChecksum separates a descriptor from its optional checksum and checks it
+func splitChecksum(s string) (string, error) {
+	i := strings.LastIndexByte(s, '#')
+	if i < 0 {
+		return s, nil
+	}
+	desc, sum := s[:i], s[i+1:]
+	if len(sum) != 8 {
+		return "", ErrInvalidChecksum
+	}
+	want, err := Checksum(desc)
+	if err != nil {
+		return "", err
+	}
+	if sum != want {
+		return "", ErrInvalidChecksum
+	}
+	return desc, nil
+}
@@ -0,0 +1,249 @@
+// Package descriptor parses and evaluates output script descriptors, so a
+// watched wallet can be configured as e.g. wsh(sortedmulti(2,xpub.../0/*,...))
+// and its per-deposit addresses derived locally.
+package descriptor
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/script"
+)
+
+// Kind is the script function at the root of a descriptor node
+type Kind int
+
+// Supported descriptor functions
+const (
+	SH Kind = iota
+	WSH
+	PK
+	PKH
+	WPKH
+	Multi
+	SortedMulti
+	Addr
+	Raw
+)
+
+var kindNames = map[Kind]string{
+	SH:          "sh",
+	WSH:         "wsh",
+	PK:          "pk",
+	PKH:         "pkh",
+	WPKH:        "wpkh",
+	Multi:       "multi",
+	SortedMulti: "sortedmulti",
+	Addr:        "addr",
+	Raw:         "raw",
+}
+
+// String returns the descriptor function name
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// ErrNotRange is returned when asking a fixed descriptor for a range of addresses
+var ErrNotRange = errors.New("descriptor: descriptor is not ranged")
+
+// A Descriptor is a parsed output descriptor
+type Descriptor struct {
+	Kind Kind
+
+	// The wrapped descriptor of sh() and wsh()
+	Sub *Descriptor
+
+	// The keys of pk, pkh, wpkh, multi and sortedmulti
+	Keys []*Key
+
+	// The threshold of multi and sortedmulti
+	Required int
+
+	addr   *address.Address
+	raw    []byte
+	params *address.Params
+}
+
+// context tracks where a node appears, which restricts what it may contain
+type context int
+
+const (
+	ctxTop context = iota
+	ctxP2SH
+	ctxP2WSH
+)
+
+// Parse parses a descriptor for the given network. A trailing #checksum is
+// optional but must be valid when present.
+func Parse(s string, params *address.Params) (*Descriptor, error) {
+	if params == nil {
+		return nil, errors.New("descriptor: nil params")
+	}
+	desc, err := splitChecksum(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	return parse(desc, ctxTop, params)
+}
+
+func parse(s string, ctx context, params *address.Params) (*Descriptor, error) {
+	open := strings.IndexByte(s, '(')
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("descriptor: expected function call, got %q", s)
+	}
+	name, inner := s[:open], s[open+1:len(s)-1]
+	d := &Descriptor{params: params}
+
+	witness := ctx == ctxP2WSH
+	switch name {
+	case "sh":
+		if ctx != ctxTop {
+			return nil, errors.New("descriptor: sh() is only allowed at the top level")
+		}
+		d.Kind = SH
+		sub, err := parse(inner, ctxP2SH, params)
+		if err != nil {
+			return nil, err
+		}
+		d.Sub = sub
+	case "wsh":
+		if ctx == ctxP2WSH {
+			return nil, errors.New("descriptor: wsh() cannot be nested in wsh()")
+		}
+		d.Kind = WSH
+		sub, err := parse(inner, ctxP2WSH, params)
+		if err != nil {
+			return nil, err
+		}
+		d.Sub = sub
+	case "pk", "pkh", "wpkh":
+		d.Kind = map[string]Kind{"pk": PK, "pkh": PKH, "wpkh": WPKH}[name]
+		if d.Kind == WPKH {
+			if ctx == ctxP2WSH {
+				return nil, errors.New("descriptor: wpkh() cannot be nested in wsh()")
+			}
+			witness = true
+		}
+		k, err := parseKey(inner, witness)
+		if err != nil {
+			return nil, err
+		}
+		d.Keys = []*Key{k}
+	case "multi", "sortedmulti":
+		d.Kind = Multi
+		if name == "sortedmulti" {
+			d.Kind = SortedMulti
+		}
+		args := splitArgs(inner)
+		m, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("descriptor: invalid multisig threshold %q", args[0])
+		}
+		n := len(args) - 1
+		if n < 1 || n > script.MaxPubKeysPerMultisig || m < 1 || m > n {
+			return nil, fmt.Errorf("descriptor: invalid multisig threshold %d of %d", m, n)
+		}
+		d.Required = m
+		for _, a := range args[1:] {
+			k, err := parseKey(a, witness)
+			if err != nil {
+				return nil, err
+			}
+			d.Keys = append(d.Keys, k)
+		}
+	case "addr":
+		if ctx != ctxTop {
+			return nil, errors.New("descriptor: addr() is only allowed at the top level")
+		}
+		a, err := address.Decode(inner, params)
+		if err != nil {
+			return nil, err
+		}
+		d.Kind, d.addr = Addr, a
+	case "raw":
+		if ctx != ctxTop {
+			return nil, errors.New("descriptor: raw() is only allowed at the top level")
+		}
+		b, err := hex.DecodeString(inner)
+		if err != nil {
+			return nil, fmt.Errorf("descriptor: invalid raw script: %v", err)
+		}
+		d.Kind, d.raw = Raw, b
+	default:
+		return nil, fmt.Errorf("descriptor: unsupported function %q", name)
+	}
+	return d, nil
+}
+
+// splitArgs splits a comma separated argument list, ignoring commas nested
+// in parentheses
+func splitArgs(s string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(args, s[start:])
+}
+
+// String returns the descriptor in canonical form, without checksum
+func (d *Descriptor) String() string {
+	switch d.Kind {
+	case SH, WSH:
+		return d.Kind.String() + "(" + d.Sub.String() + ")"
+	case Addr:
+		return "addr(" + d.addr.String() + ")"
+	case Raw:
+		return "raw(" + hex.EncodeToString(d.raw) + ")"
+	}
+	args := make([]string, 0, len(d.Keys)+1)
+	if d.Kind == Multi || d.Kind == SortedMulti {
+		args = append(args, strconv.Itoa(d.Required))
+	}
+	for _, k := range d.Keys {
+		args = append(args, k.String())
+	}
+	return d.Kind.String() + "(" + strings.Join(args, ",") + ")"
+}
+
+// StringWithChecksum returns the canonical form followed by its #checksum,
+// as printed by getdescriptorinfo
+func (d *Descriptor) StringWithChecksum() string {
+	s, _ := AddChecksum(d.String())
+	return s
+}
+
+// IsRange reports whether any key of the descriptor has a wildcard
+func (d *Descriptor) IsRange() bool {
+	if d.Sub != nil {
+		return d.Sub.IsRange()
+	}
+	for _, k := range d.Keys {
+		if k.IsRange() {
+			return true
+		}
+	}
+	return false
+}
+
+// AllKeys returns the keys of the descriptor and its wrapped descriptors
+func (d *Descriptor) AllKeys() []*Key {
+	if d.Sub != nil {
+		return d.Sub.AllKeys()
+	}
+	return d.Keys
+}
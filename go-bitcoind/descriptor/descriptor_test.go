@@ -0,0 +1,166 @@
+package descriptor
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/hdkeychain"
+)
+
+var _ = Describe("Descriptor", func() {
+	const (
+		keyA = "02ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8"
+		keyB = "02fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f"
+
+		// BIP32 test vector 1, m and m/0H
+		xprvM  = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+		xpub0H = "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"
+	)
+	params := &address.MainNetParams
+
+	Describe("checksums", func() {
+		It("should match getdescriptorinfo", func() {
+			Expect(AddChecksum("raw(deadbeef)")).To(Equal("raw(deadbeef)#89f8spxm"))
+			Expect(Checksum("wsh(sortedmulti(2," + keyA + "," + keyB + "))")).To(Equal("cfefn2ze"))
+			Expect(Checksum("wpkh([3442193e/0']" + xpub0H + "/1/*)")).To(Equal("vyqegm8d"))
+		})
+		It("should accept a descriptor with a valid checksum", func() {
+			d, err := Parse("sh(wsh(sortedmulti(2,"+keyA+","+keyB+")))#6dz90rxe", params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(d.StringWithChecksum()).To(HaveSuffix("#6dz90rxe"))
+		})
+		It("should reject a wrong checksum", func() {
+			_, err := Parse("raw(deadbeef)#89f8spxn", params)
+			Expect(err).To(Equal(ErrInvalidChecksum))
+		})
+		It("should reject characters outside the charset", func() {
+			_, err := Checksum("raw(dé)")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("multisig", func() {
+		It("should derive the P2WSH of the sorted keys", func() {
+			d, err := Parse("wsh(sortedmulti(2,"+keyB+","+keyA+"))", params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(d.IsRange()).To(BeFalse())
+			out, err := d.Expand(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hex.EncodeToString(out.ScriptPubKey)).To(Equal("0020b4dcb2eee00b7d71c86c08054f0a40b28e6f85572bd79d314accdfb8f30b9f77"))
+			Expect(out.WitnessScript).NotTo(BeEmpty())
+			Expect(out.RedeemScript).To(BeEmpty())
+		})
+		It("should derive the P2SH wrapped P2WSH address", func() {
+			d, err := Parse("sh(wsh(sortedmulti(2,"+keyA+","+keyB+")))", params)
+			Expect(err).NotTo(HaveOccurred())
+			a, err := d.Address(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.String()).To(Equal("ARGCSsweUgiouqXJSKQ3ScQLgBpKc36NQw"))
+			out, _ := d.Expand(0)
+			Expect(hex.EncodeToString(out.RedeemScript)).To(Equal("0020b4dcb2eee00b7d71c86c08054f0a40b28e6f85572bd79d314accdfb8f30b9f77"))
+		})
+		It("should keep the key order of multi", func() {
+			sorted, _ := Parse("wsh(sortedmulti(2,"+keyA+","+keyB+"))", params)
+			unsorted, _ := Parse("wsh(multi(2,"+keyA+","+keyB+"))", params)
+			a, _ := sorted.ScriptPubKey(0)
+			b, _ := unsorted.ScriptPubKey(0)
+			Expect(a).NotTo(Equal(b))
+		})
+		It("should reject invalid thresholds", func() {
+			_, err := Parse("wsh(sortedmulti(3,"+keyA+","+keyB+"))", params)
+			Expect(err).To(HaveOccurred())
+			_, err = Parse("wsh(sortedmulti(0,"+keyA+"))", params)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ranged keys", func() {
+		It("should derive one address per index", func() {
+			d, err := Parse("wsh(sortedmulti(1,"+xpub0H+"/0/*,"+keyA+"))", params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(d.IsRange()).To(BeTrue())
+			addrs, err := d.Addresses(0, 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(HaveLen(3))
+			Expect(addrs[0].String()).To(HavePrefix("btg1q"))
+			Expect(addrs[0].String()).NotTo(Equal(addrs[1].String()))
+		})
+		It("should match the BIP32 derivation of the key", func() {
+			master, _ := hdkeychain.NewKeyFromString(xprvM)
+			path, _ := hdkeychain.ParsePath("m/0'/1/5")
+			child, _ := master.DerivePath(path)
+
+			d, err := Parse("wpkh([3442193e/0']"+xpub0H+"/1/*)", params)
+			Expect(err).NotTo(HaveOccurred())
+			a, err := d.Address(5)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.Hash).To(Equal(address.Hash160(child.PubKeyBytes())))
+
+			fp, full := d.AllKeys()[0].Derivation(5)
+			Expect(fp).To(Equal(uint32(0x3442193e)))
+			Expect(full).To(Equal(path))
+		})
+		It("should derive hardened wildcards from private keys", func() {
+			d, err := Parse("pkh("+xprvM+"/0h/*h)", params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(d.String()).To(Equal("pkh(" + xprvM + "/0'/*')"))
+			a, err := d.Address(1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.String()).To(HavePrefix("G"))
+		})
+		It("should refuse hardened steps below an xpub", func() {
+			_, err := Parse("wpkh("+xpub0H+"/1'/*)", params)
+			Expect(err).To(Equal(hdkeychain.ErrDeriveHardFromPublic))
+			_, err = Parse("wpkh("+xpub0H+"/*')", params)
+			Expect(err).To(Equal(hdkeychain.ErrDeriveHardFromPublic))
+		})
+		It("should refuse an address range of a fixed descriptor", func() {
+			d, _ := Parse("pkh("+keyA+")", params)
+			_, err := d.Addresses(0, 1)
+			Expect(err).To(Equal(ErrNotRange))
+		})
+	})
+
+	Describe("structure", func() {
+		It("should round trip the canonical form", func() {
+			for _, s := range []string{
+				"pkh(" + keyA + ")",
+				"sh(wpkh(" + keyA + "))",
+				"wsh(multi(1," + keyA + "," + keyB + "))",
+				"wpkh([3442193e/0']" + xpub0H + "/1/*)",
+				"addr(AST9CekEhDWuxHPynRmeyjg5biNFSijvb3)",
+				"raw(deadbeef)",
+			} {
+				d, err := Parse(s, params)
+				Expect(err).NotTo(HaveOccurred(), s)
+				Expect(d.String()).To(Equal(s))
+			}
+		})
+		It("should reject misplaced functions", func() {
+			for _, s := range []string{
+				"wsh(sh(pkh(" + keyA + ")))",
+				"wsh(wpkh(" + keyA + "))",
+				"wsh(wsh(pkh(" + keyA + ")))",
+				"sh(raw(deadbeef))",
+				"tr(" + keyA + ")",
+			} {
+				_, err := Parse(s, params)
+				Expect(err).To(HaveOccurred(), s)
+			}
+		})
+		It("should reject uncompressed keys in witness scripts", func() {
+			uncompressed := "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"
+			_, err := Parse("wpkh("+uncompressed+")", params)
+			Expect(err).To(HaveOccurred())
+			_, err = Parse("pkh("+uncompressed+")", params)
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("should reject addresses of another network", func() {
+			_, err := Parse("addr(AST9CekEhDWuxHPynRmeyjg5biNFSijvb3)", &address.TestNetParams)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
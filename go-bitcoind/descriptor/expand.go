@@ -0,0 +1,125 @@
+package descriptor
+
+import (
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/script"
+)
+
+// An Output is a descriptor evaluated at one index
+type Output struct {
+	// The output script to watch
+	ScriptPubKey []byte
+
+	// The redeem script of P2SH outputs
+	RedeemScript []byte
+
+	// The witness script of P2WSH and P2SH-P2WSH outputs
+	WitnessScript []byte
+}
+
+// Expand evaluates the descriptor at index. The index is ignored by
+// descriptors that are not ranged.
+func (d *Descriptor) Expand(index uint32) (*Output, error) {
+	out := &Output{}
+	spk, err := d.expand(index, out)
+	if err != nil {
+		return nil, err
+	}
+	out.ScriptPubKey = spk
+	return out, nil
+}
+
+func (d *Descriptor) expand(index uint32, out *Output) ([]byte, error) {
+	switch d.Kind {
+	case SH:
+		redeem, err := d.Sub.expand(index, out)
+		if err != nil {
+			return nil, err
+		}
+		out.RedeemScript = redeem
+		a, err := address.NewScriptHashFromScript(redeem, d.params)
+		if err != nil {
+			return nil, err
+		}
+		return a.ScriptPubKey(), nil
+	case WSH:
+		ws, err := d.Sub.expand(index, out)
+		if err != nil {
+			return nil, err
+		}
+		out.WitnessScript = ws
+		a, err := address.NewWitnessScriptHashFromScript(ws, d.params)
+		if err != nil {
+			return nil, err
+		}
+		return a.ScriptPubKey(), nil
+	case Addr:
+		return d.addr.ScriptPubKey(), nil
+	case Raw:
+		return append([]byte{}, d.raw...), nil
+	}
+
+	keys := make([][]byte, len(d.Keys))
+	for i, k := range d.Keys {
+		pk, err := k.PubKey(index)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = pk
+	}
+	switch d.Kind {
+	case PK:
+		return script.NewBuilder().AddData(keys[0]).AddOp(script.OP_CHECKSIG).Script()
+	case PKH:
+		a, err := address.NewPubKeyHash(address.Hash160(keys[0]), d.params)
+		if err != nil {
+			return nil, err
+		}
+		return a.ScriptPubKey(), nil
+	case WPKH:
+		a, err := address.NewWitnessPubKeyHash(address.Hash160(keys[0]), d.params)
+		if err != nil {
+			return nil, err
+		}
+		return a.ScriptPubKey(), nil
+	case SortedMulti:
+		keys = script.SortPubKeys(keys)
+	}
+	return script.MultisigScript(d.Required, keys)
+}
+
+// ScriptPubKey returns the output script at index
+func (d *Descriptor) ScriptPubKey(index uint32) ([]byte, error) {
+	out, err := d.Expand(index)
+	if err != nil {
+		return nil, err
+	}
+	return out.ScriptPubKey, nil
+}
+
+// Address returns the address of the output at index. Bare pk() and
+// multisig descriptors have no address form.
+func (d *Descriptor) Address(index uint32) (*address.Address, error) {
+	spk, err := d.ScriptPubKey(index)
+	if err != nil {
+		return nil, err
+	}
+	return address.FromScriptPubKey(spk, d.params)
+}
+
+// Addresses returns the addresses of the ranged descriptor from index start
+// up to, but not including, end
+func (d *Descriptor) Addresses(start, end uint32) ([]*address.Address, error) {
+	if !d.IsRange() {
+		return nil, ErrNotRange
+	}
+	var addrs []*address.Address
+	for i := start; i < end; i++ {
+		a, err := d.Address(i)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs, nil
+}
@@ -0,0 +1,186 @@
+package descriptor
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/www222fff/watchUTXO/go-bitcoind/hdkeychain"
+)
+
+// Wildcard is the kind of trailing /* of a ranged key
+type Wildcard int
+
+// Wildcard kinds
+const (
+	NoWildcard Wildcard = iota
+	UnhardenedWildcard
+	HardenedWildcard
+)
+
+// A Key is a key expression: a hex public key or an extended key with a
+// derivation path, optionally prefixed with its [fingerprint/path] origin
+type Key struct {
+	// The key origin, if given
+	HasOrigin   bool
+	Fingerprint uint32
+	OriginPath  []uint32
+
+	// The derivation below the extended key, without the wildcard
+	Path     []uint32
+	Wildcard Wildcard
+
+	pubKey []byte
+	xkey   *hdkeychain.ExtendedKey
+}
+
+func parseKey(s string, witness bool) (*Key, error) {
+	k := &Key{}
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("descriptor: unterminated key origin in %q", s)
+		}
+		origin := strings.SplitN(s[1:end], "/", 2)
+		fp, err := hex.DecodeString(origin[0])
+		if err != nil || len(fp) != 4 {
+			return nil, fmt.Errorf("descriptor: invalid key origin fingerprint %q", origin[0])
+		}
+		k.HasOrigin = true
+		k.Fingerprint = binary.BigEndian.Uint32(fp)
+		if len(origin) == 2 {
+			if k.OriginPath, err = hdkeychain.ParsePath(origin[1]); err != nil {
+				return nil, err
+			}
+		}
+		s = s[end+1:]
+	}
+
+	if b, err := hex.DecodeString(s); err == nil {
+		if _, err := secp256k1.ParsePubKey(b); err != nil {
+			return nil, fmt.Errorf("descriptor: invalid public key %s", s)
+		}
+		if witness && len(b) != 33 {
+			return nil, fmt.Errorf("descriptor: uncompressed key %s not allowed in a witness script", s)
+		}
+		k.pubKey = b
+		return k, nil
+	}
+
+	steps := strings.Split(s, "/")
+	xkey, err := hdkeychain.NewKeyFromString(steps[0])
+	if err != nil {
+		return nil, fmt.Errorf("descriptor: invalid key %q: %v", steps[0], err)
+	}
+	k.xkey = xkey
+	steps = steps[1:]
+	if n := len(steps); n > 0 {
+		switch steps[n-1] {
+		case "*":
+			k.Wildcard = UnhardenedWildcard
+			steps = steps[:n-1]
+		case "*'", "*h", "*H":
+			k.Wildcard = HardenedWildcard
+			steps = steps[:n-1]
+		}
+	}
+	if len(steps) > 0 {
+		if k.Path, err = hdkeychain.ParsePath(strings.Join(steps, "/")); err != nil {
+			return nil, err
+		}
+	}
+	if !xkey.IsPrivate() {
+		if k.Wildcard == HardenedWildcard {
+			return nil, hdkeychain.ErrDeriveHardFromPublic
+		}
+		for _, i := range k.Path {
+			if i >= hdkeychain.HardenedKeyStart {
+				return nil, hdkeychain.ErrDeriveHardFromPublic
+			}
+		}
+	}
+	return k, nil
+}
+
+// IsRange reports whether the key ends with a wildcard
+func (k *Key) IsRange() bool {
+	return k.Wildcard != NoWildcard
+}
+
+// ExtendedKey returns the extended key, or nil for a plain public key
+func (k *Key) ExtendedKey() *hdkeychain.ExtendedKey {
+	return k.xkey
+}
+
+// childPath returns the steps derived from the extended key at index
+func (k *Key) childPath(index uint32) []uint32 {
+	path := append([]uint32{}, k.Path...)
+	switch k.Wildcard {
+	case UnhardenedWildcard:
+		path = append(path, index)
+	case HardenedWildcard:
+		path = append(path, index+hdkeychain.HardenedKeyStart)
+	}
+	return path
+}
+
+// PubKey returns the compressed (or, for hex keys, as given) public key at
+// index. The index is ignored for keys without a wildcard.
+func (k *Key) PubKey(index uint32) ([]byte, error) {
+	if k.xkey == nil {
+		return k.pubKey, nil
+	}
+	if index >= hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("descriptor: index %d out of range", index)
+	}
+	child, err := k.xkey.DerivePath(k.childPath(index))
+	if err != nil {
+		return nil, err
+	}
+	return child.PubKeyBytes(), nil
+}
+
+// Derivation returns the master fingerprint and full path of the key at
+// index, as recorded in PSBT BIP32 derivations. Without an origin the
+// extended key is taken as the master.
+func (k *Key) Derivation(index uint32) (fingerprint uint32, path []uint32) {
+	if k.HasOrigin {
+		fingerprint = k.Fingerprint
+		path = append(path, k.OriginPath...)
+	} else if k.xkey != nil {
+		fingerprint = k.xkey.Fingerprint()
+	}
+	if k.xkey != nil {
+		path = append(path, k.childPath(index)...)
+	}
+	return fingerprint, path
+}
+
+// String returns the key expression with ' marking hardened steps
+func (k *Key) String() string {
+	var b strings.Builder
+	if k.HasOrigin {
+		fmt.Fprintf(&b, "[%08x", k.Fingerprint)
+		if len(k.OriginPath) > 0 {
+			b.WriteString("/" + hdkeychain.FormatPath(k.OriginPath))
+		}
+		b.WriteString("]")
+	}
+	if k.xkey == nil {
+		b.WriteString(hex.EncodeToString(k.pubKey))
+		return b.String()
+	}
+	b.WriteString(k.xkey.String())
+	if len(k.Path) > 0 {
+		b.WriteString("/" + hdkeychain.FormatPath(k.Path))
+	}
+	switch k.Wildcard {
+	case UnhardenedWildcard:
+		b.WriteString("/*")
+	case HardenedWildcard:
+		b.WriteString("/*'")
+	}
+	return b.String()
+}
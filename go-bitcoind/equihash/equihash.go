@@ -0,0 +1,147 @@
+// Package equihash verifies the Equihash proof-of-work of Bitcoin Gold
+// headers. A solution lists 2^K indices, each selecting N bits of a BLAKE2b
+// hash of the header: paired in a binary tree, the hashes collide on N/(K+1)
+// more bits at every level and XOR to zero at the root. Zcash defined it, BTG
+// mined Equihash<200,9> from its fork then Equihash<144,5> with its own
+// personalization.
+package equihash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidSolution is returned for a solution that does not solve the
+// header
+var ErrInvalidSolution = errors.New("equihash: invalid solution")
+
+// Params are the parameters of an Equihash variant
+type Params struct {
+	N, K int
+
+	// Personal starts the BLAKE2b personalization, followed by N and K
+	Personal string
+}
+
+var (
+	// Zcash is Equihash<200,9>
+	Zcash = Params{N: 200, K: 9, Personal: "ZcashPoW"}
+
+	// BTG is Equihash<144,5> as mined by Bitcoin Gold
+	BTG = Params{N: 144, K: 5, Personal: "BgoldPoW"}
+)
+
+func (p Params) String() string {
+	return fmt.Sprintf("Equihash<%d,%d>", p.N, p.K)
+}
+
+// validate checks that solutions of p can be decoded
+func (p Params) validate() error {
+	if p.K < 1 || p.N%8 != 0 || p.N > 512 || p.N%(p.K+1) != 0 || p.N/(p.K+1) > 31 || len(p.Personal) != 8 {
+		return fmt.Errorf("equihash: unsupported parameters %s %q", p, p.Personal)
+	}
+	return nil
+}
+
+// collisionBits returns the bits the hashes collide on at each level
+func (p Params) collisionBits() int {
+	return p.N / (p.K + 1)
+}
+
+// SolutionSize returns the size of a solution in bytes, its 2^K indices
+// packed on N/(K+1)+1 bits each
+func (p Params) SolutionSize() int {
+	return (1 << uint(p.K)) * (p.collisionBits() + 1) / 8
+}
+
+// Verify checks that solution solves input, the header serialized up to its
+// nonce
+func (p Params) Verify(input, solution []byte) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	if len(solution) != p.SolutionSize() {
+		return fmt.Errorf("%w: %d bytes for %s, %d expected", ErrInvalidSolution, len(solution), p, p.SolutionSize())
+	}
+	indices := unpack(solution, p.collisionBits()+1)
+	seen := make(map[uint32]bool, len(indices))
+	rows := make([]row, len(indices))
+	for i, index := range indices {
+		if seen[index] {
+			return fmt.Errorf("%w: index %d repeated", ErrInvalidSolution, index)
+		}
+		seen[index] = true
+		rows[i] = row{hash: p.hash(input, index), first: index}
+	}
+
+	for level := 0; len(rows) > 1; level++ {
+		merged := make([]row, 0, len(rows)/2)
+		for i := 0; i < len(rows); i += 2 {
+			a, b := rows[i], rows[i+1]
+			if a.hash[level] != b.hash[level] {
+				return fmt.Errorf("%w: no collision at level %d", ErrInvalidSolution, level)
+			}
+			if a.first > b.first {
+				return fmt.Errorf("%w: indices out of order at level %d", ErrInvalidSolution, level)
+			}
+			merged = append(merged, a.xor(b))
+		}
+		rows = merged
+	}
+	if rows[0].hash[p.K] != 0 {
+		return fmt.Errorf("%w: the hashes do not XOR to zero", ErrInvalidSolution)
+	}
+	return nil
+}
+
+// A row is the XOR of the hashes of a subtree of the solution, split in
+// K+1 chunks of collision bits. first is the first index of the subtree,
+// which orders the subtrees.
+type row struct {
+	hash  []uint32
+	first uint32
+}
+
+func (a row) xor(b row) row {
+	r := row{hash: make([]uint32, len(a.hash)), first: a.first}
+	for i := range a.hash {
+		r.hash[i] = a.hash[i] ^ b.hash[i]
+	}
+	return r
+}
+
+// hash returns the N bits selected by index, in chunks of collision bits.
+// Each BLAKE2b digest of the input and a counter holds the bits of 512/N
+// consecutive indices.
+func (p Params) hash(input []byte, index uint32) []uint32 {
+	var personal [16]byte
+	copy(personal[:], p.Personal)
+	binary.LittleEndian.PutUint32(personal[8:], uint32(p.N))
+	binary.LittleEndian.PutUint32(personal[12:], uint32(p.K))
+
+	perDigest := uint32(512 / p.N)
+	data := make([]byte, len(input)+4)
+	copy(data, input)
+	binary.LittleEndian.PutUint32(data[len(input):], index/perDigest)
+	digest := blake2b(int(perDigest)*p.N/8, &personal, data)
+
+	start := int(index%perDigest) * p.N / 8
+	return unpack(digest[start:start+p.N/8], p.collisionBits())
+}
+
+// unpack splits b in big endian integers of width bits
+func unpack(b []byte, width int) []uint32 {
+	out := make([]uint32, 0, len(b)*8/width)
+	var acc uint64
+	var n int
+	for _, c := range b {
+		acc = acc<<8 | uint64(c)
+		n += 8
+		if n >= width {
+			n -= width
+			out = append(out, uint32(acc>>uint(n))&(1<<uint(width)-1))
+		}
+	}
+	return out
+}
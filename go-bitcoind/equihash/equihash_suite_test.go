@@ -0,0 +1,13 @@
+package equihash
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestEquihash(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Equihash Suite")
+}
@@ -0,0 +1,169 @@
+package equihash
+
+import (
+	"encoding/hex"
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	xblake2b "golang.org/x/crypto/blake2b"
+)
+
+// toy are small parameters a test solves in a few milliseconds
+var toy = Params{N: 48, K: 5, Personal: "ZcashPoW"}
+
+// solve returns the solutions of input found by Wagner's algorithm, their
+// indices in tree order
+func solve(p Params, input []byte) [][]uint32 {
+	type node struct {
+		hash    []uint32
+		indices []uint32
+	}
+	var rows []node
+	for i := uint32(0); i < 1<<uint(p.collisionBits()+1); i++ {
+		rows = append(rows, node{hash: p.hash(input, i), indices: []uint32{i}})
+	}
+	for level := 0; level < p.K; level++ {
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].hash[level] < rows[j].hash[level] })
+		var merged []node
+		for i := range rows {
+			for j := i + 1; j < len(rows) && rows[j].hash[level] == rows[i].hash[level]; j++ {
+				a, b := rows[i], rows[j]
+				if a.indices[0] > b.indices[0] {
+					a, b = b, a
+				}
+				r := row{hash: a.hash}.xor(row{hash: b.hash})
+				merged = append(merged, node{hash: r.hash, indices: append(append([]uint32(nil), a.indices...), b.indices...)})
+			}
+		}
+		rows = merged
+	}
+	var solutions [][]uint32
+	for _, r := range rows {
+		if r.hash[p.K] == 0 && distinct(r.indices) {
+			solutions = append(solutions, r.indices)
+		}
+	}
+	return solutions
+}
+
+func distinct(indices []uint32) bool {
+	seen := make(map[uint32]bool)
+	for _, i := range indices {
+		if seen[i] {
+			return false
+		}
+		seen[i] = true
+	}
+	return true
+}
+
+// pack encodes indices on width bits each, big endian
+func pack(indices []uint32, width int) []byte {
+	var out []byte
+	var acc uint64
+	var n int
+	for _, i := range indices {
+		acc = acc<<uint(width) | uint64(i)
+		n += width
+		for n >= 8 {
+			n -= 8
+			out = append(out, byte(acc>>uint(n)))
+		}
+	}
+	return out
+}
+
+// header returns an input of the size of a BTG header up to its nonce
+func header(nonce byte) []byte {
+	input := make([]byte, 140)
+	copy(input, "block header")
+	input[108] = nonce
+	return input
+}
+
+var _ = Describe("Equihash", func() {
+	Describe("blake2b", func() {
+		It("should match the unpersonalized BLAKE2b", func() {
+			var none [16]byte
+			for _, n := range []int{0, 1, 127, 128, 129, 300} {
+				data := make([]byte, n)
+				for i := range data {
+					data[i] = byte(i * 7)
+				}
+				for _, size := range []int{32, 50, 64} {
+					h, err := xblake2b.New(size, nil)
+					Expect(err).NotTo(HaveOccurred())
+					h.Write(data)
+					Expect(blake2b(size, &none, data)).To(Equal(h.Sum(nil)))
+				}
+			}
+		})
+		It("should be personalized", func() {
+			// python3 hashlib.blake2b(..., person=...)
+			personal := [16]byte{'Z', 'c', 'a', 's', 'h', 'P', 'o', 'W', 200, 0, 0, 0, 9}
+			Expect(hex.EncodeToString(blake2b(50, &personal, []byte("abc")))).To(Equal(
+				"52e907446f88b0d5e63e3b2ed93b9cf178cff963d9b89e2a01fe2e42f247b0a58f8f40ccd4471fdadee85d6ab7e69be29285"))
+			personal = [16]byte{'B', 'g', 'o', 'l', 'd', 'P', 'o', 'W', 144, 0, 0, 0, 5}
+			data := make([]byte, 300)
+			for i := 0; i < 256; i++ {
+				data[i] = byte(i)
+			}
+			Expect(hex.EncodeToString(blake2b(54, &personal, data))).To(Equal(
+				"7ea36c0863fad10998efebd5d1738d1a5457f7b65b1a01cd235c1ea544dfe57d3dd17ebeb2fd55226782e4dbbc3fa3448326d55d0db3"))
+		})
+	})
+
+	Describe("Verify", func() {
+		var (
+			input    []byte
+			indices  []uint32
+			solution []byte
+		)
+		BeforeEach(func() {
+			for nonce := byte(0); indices == nil; nonce++ {
+				input = header(nonce)
+				if found := solve(toy, input); len(found) > 0 {
+					indices = found[0]
+				}
+			}
+			solution = pack(indices, toy.collisionBits()+1)
+		})
+		AfterEach(func() {
+			indices = nil
+		})
+
+		It("should accept a solution", func() {
+			Expect(solution).To(HaveLen(toy.SolutionSize()))
+			Expect(toy.Verify(input, solution)).To(Succeed())
+		})
+		It("should reject the solution of another header", func() {
+			other := append([]byte(nil), input...)
+			other[0] ^= 1
+			Expect(toy.Verify(other, solution)).To(MatchError(ContainSubstring("equihash: invalid solution")))
+		})
+		It("should reject another personalization", func() {
+			btg := toy
+			btg.Personal = "BgoldPoW"
+			Expect(btg.Verify(input, solution)).NotTo(Succeed())
+		})
+		It("should reject swapped subtrees", func() {
+			swapped := append(append([]uint32(nil), indices[16:]...), indices[:16]...)
+			Expect(toy.Verify(input, pack(swapped, toy.collisionBits()+1))).To(MatchError(ContainSubstring("out of order")))
+		})
+		It("should reject a repeated index", func() {
+			repeated := append([]uint32(nil), indices...)
+			repeated[1] = repeated[0]
+			Expect(toy.Verify(input, pack(repeated, toy.collisionBits()+1))).To(MatchError(ContainSubstring("repeated")))
+		})
+		It("should reject a solution of the wrong size", func() {
+			Expect(toy.Verify(input, solution[1:])).To(MatchError(ContainSubstring("bytes for Equihash<48,5>")))
+			Expect(BTG.Verify(input, solution)).To(MatchError(ContainSubstring("100 expected")))
+		})
+	})
+
+	It("should size the solutions of the BTG variants", func() {
+		Expect(Zcash.SolutionSize()).To(Equal(1344))
+		Expect(BTG.SolutionSize()).To(Equal(100))
+	})
+})
@@ -0,0 +1,168 @@
+// Package fee sets the network fee of the withdrawals of the multisig. The
+// relayer proposing a withdrawal pays the fee rate its node estimates, held
+// between a floor and a ceiling; the others accept any fee in these bounds
+// for the withdrawal's size, the rate of the proposal being the one agreed.
+// No withdrawal pays more than the maximum fee: it waits rather than
+// overpaying.
+package fee
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// MaxSigSize is the size of a DER signature with its hash type, at most
+const MaxSigSize = 73
+
+// ErrFeeTooHigh is returned for a fee above the maximum fee
+var ErrFeeTooHigh = errors.New("fee: above the maximum fee")
+
+// A Rate is a fee rate in satoshis per 1000 virtual bytes, the unit of
+// estimatesmartfee
+type Rate int64
+
+// PerVByte returns the rate of sat satoshis per virtual byte
+func PerVByte(sat int64) Rate {
+	return Rate(sat * 1000)
+}
+
+// Fee returns the fee of vsize virtual bytes at the rate, rounded up
+func (r Rate) Fee(vsize int) int64 {
+	return (int64(r)*int64(vsize) + 999) / 1000
+}
+
+// ParseRate parses a rate in satoshis per virtual byte, with at most 3
+// decimals, e.g. "1.5"
+func ParseRate(s string) (Rate, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() < 0 {
+		return 0, fmt.Errorf("fee: invalid rate %q", s)
+	}
+	r.Mul(r, big.NewRat(1000, 1))
+	if !r.IsInt() || !r.Num().IsInt64() {
+		return 0, fmt.Errorf("fee: rate %q has more than 3 decimals", s)
+	}
+	return Rate(r.Num().Int64()), nil
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d.%03d sat/vB", r/1000, r%1000)
+}
+
+// An Estimator estimates the fee rate of a transaction confirmed within
+// confTarget blocks. *bitcoind.Bitcoind implements it.
+type Estimator interface {
+	EstimateSmartFee(confTarget int) (bitcoind.EstimateSmartFeeResult, error)
+}
+
+// A Policy sets the fees of the withdrawals
+type Policy struct {
+	// Estimator estimates the rates, nil to pay the floor
+	Estimator Estimator
+
+	// ConfTarget is the confirmation target of the estimates, in blocks
+	ConfTarget int
+
+	// Floor and Ceiling bound the rates
+	Floor, Ceiling Rate
+
+	// Fallback is the rate paid when the node has no estimate, e.g. on a
+	// chain of few transactions
+	Fallback Rate
+
+	// MaxFee is the most a withdrawal pays, in satoshis
+	MaxFee int64
+}
+
+// Validate checks the bounds of the policy
+func (p *Policy) Validate() error {
+	switch {
+	case p.Floor <= 0:
+		return errors.New("fee: the floor must be positive")
+	case p.Ceiling < p.Floor:
+		return fmt.Errorf("fee: ceiling %s under the floor %s", p.Ceiling, p.Floor)
+	case p.Fallback < p.Floor || p.Fallback > p.Ceiling:
+		return fmt.Errorf("fee: fallback %s out of [%s, %s]", p.Fallback, p.Floor, p.Ceiling)
+	case p.MaxFee <= 0:
+		return errors.New("fee: the maximum fee must be positive")
+	case p.Estimator != nil && p.ConfTarget < 1:
+		return errors.New("fee: the confirmation target must be at least 1 block")
+	}
+	return nil
+}
+
+// Rate returns the rate to pay: the node's estimate, or the fallback when
+// the node has none, held between the floor and the ceiling
+func (p *Policy) Rate() (Rate, error) {
+	if p.Estimator == nil {
+		return p.Floor, nil
+	}
+	est, err := p.Estimator.EstimateSmartFee(p.ConfTarget)
+	if err != nil {
+		return 0, fmt.Errorf("estimatesmartfee: %v", err)
+	}
+	rate := p.Fallback
+	if len(est.Errors) == 0 && est.FeeRate > 0 {
+		rate = Rate(math.Round(est.FeeRate * bitcoind.SATOSHI_PER_BTG))
+	}
+	switch {
+	case rate < p.Floor:
+		rate = p.Floor
+	case rate > p.Ceiling:
+		rate = p.Ceiling
+	}
+	return rate, nil
+}
+
+// Fee returns the fee of a withdrawal of vsize virtual bytes at the rate,
+// or ErrFeeTooHigh
+func (p *Policy) Fee(rate Rate, vsize int) (int64, error) {
+	fee := rate.Fee(vsize)
+	if fee > p.MaxFee {
+		return 0, fmt.Errorf("%w: %d satoshis at %s, at most %d", ErrFeeTooHigh, fee, rate, p.MaxFee)
+	}
+	return fee, nil
+}
+
+// Check verifies the fee of a withdrawal of vsize virtual bytes proposed by
+// another relayer: between the fees at the floor and at the ceiling, and at
+// most the maximum fee
+func (p *Policy) Check(fee int64, vsize int) error {
+	if floor := p.Floor.Fee(vsize); fee < floor {
+		return fmt.Errorf("fee: %d satoshis for %d vbytes, under the floor of %d", fee, vsize, floor)
+	}
+	if ceiling := p.Ceiling.Fee(vsize); fee > ceiling {
+		return fmt.Errorf("fee: %d satoshis for %d vbytes, over the ceiling of %d", fee, vsize, ceiling)
+	}
+	if fee > p.MaxFee {
+		return fmt.Errorf("%w: %d satoshis, at most %d", ErrFeeTooHigh, fee, p.MaxFee)
+	}
+	return nil
+}
+
+// MultisigVSize returns the virtual size of tx once its inputs, spending
+// P2WSH outputs of the required-of-n witnessScript, are signed. The
+// signatures are counted at their largest, so the size is never under the
+// signed transaction's.
+func MultisigVSize(tx *wire.MsgTx, required int, witnessScript []byte) int {
+	signed := *tx
+	signed.TxIn = make([]*wire.TxIn, len(tx.TxIn))
+	for i, in := range tx.TxIn {
+		witness := [][]byte{{}} // the extra item consumed by OP_CHECKMULTISIG
+		for j := 0; j < required; j++ {
+			witness = append(witness, make([]byte, MaxSigSize))
+		}
+		signed.TxIn[i] = &wire.TxIn{
+			PreviousOutPoint: in.PreviousOutPoint,
+			SignatureScript:  in.SignatureScript,
+			Witness:          append(witness, witnessScript),
+			Sequence:         in.Sequence,
+		}
+	}
+	return signed.VirtualSize()
+}
@@ -0,0 +1,13 @@
+package fee
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFee(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fee Suite")
+}
@@ -0,0 +1,162 @@
+package fee
+
+import (
+	"errors"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeEstimator answers estimatesmartfee with est or err
+type fakeEstimator struct {
+	est    bitcoind.EstimateSmartFeeResult
+	err    error
+	target int
+}
+
+func (e *fakeEstimator) EstimateSmartFee(confTarget int) (bitcoind.EstimateSmartFeeResult, error) {
+	e.target = confTarget
+	return e.est, e.err
+}
+
+// multisigScript returns a witness script of the size of a required-of-n
+// multisig
+func multisigScript(n int) []byte {
+	return make([]byte, 3+34*n)
+}
+
+// spend returns a transaction spending inputs multisig outputs to a P2WPKH
+// output and a P2WSH change
+func spend(inputs int) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	for i := 0; i < inputs; i++ {
+		tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: uint32(i)}, Sequence: wire.MaxTxInSequenceNum})
+	}
+	tx.AddTxOut(&wire.TxOut{Value: 100000, PkScript: make([]byte, 22)})
+	tx.AddTxOut(&wire.TxOut{Value: 200000, PkScript: make([]byte, 34)})
+	return tx
+}
+
+var _ = Describe("Fees", func() {
+	var (
+		node   *fakeEstimator
+		policy *Policy
+	)
+
+	BeforeEach(func() {
+		node = &fakeEstimator{}
+		policy = &Policy{
+			Estimator:  node,
+			ConfTarget: 6,
+			Floor:      PerVByte(1),
+			Ceiling:    PerVByte(50),
+			Fallback:   PerVByte(2),
+			MaxFee:     100000,
+		}
+		Expect(policy.Validate()).To(Succeed())
+	})
+
+	It("should parse and apply the rates", func() {
+		r, err := ParseRate("1.5")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(Rate(1500)))
+		Expect(r.String()).To(Equal("1.500 sat/vB"))
+		Expect(r.Fee(100)).To(Equal(int64(150)))
+		Expect(r.Fee(101)).To(Equal(int64(152))) // rounded up
+		_, err = ParseRate("0.0001")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseRate("-1")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseRate("fast")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should pay the node's estimate between the floor and the ceiling", func() {
+		node.est = bitcoind.EstimateSmartFeeResult{FeeRate: 0.00012345, Blocks: 6}
+		r, err := policy.Rate()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(Rate(12345)))
+		Expect(node.target).To(Equal(6))
+
+		node.est.FeeRate = 0.000001
+		Expect(policy.Rate()).To(Equal(PerVByte(1)))
+		node.est.FeeRate = 0.01
+		Expect(policy.Rate()).To(Equal(PerVByte(50)))
+	})
+
+	It("should fall back when the node has no estimate", func() {
+		node.est = bitcoind.EstimateSmartFeeResult{Errors: []string{"Insufficient data or no feerate found"}, Blocks: 0}
+		Expect(policy.Rate()).To(Equal(PerVByte(2)))
+		node.est = bitcoind.EstimateSmartFeeResult{FeeRate: -1}
+		Expect(policy.Rate()).To(Equal(PerVByte(2)))
+
+		node.err = errors.New("connection refused")
+		_, err := policy.Rate()
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+
+		// without estimator, the floor
+		policy.Estimator = nil
+		Expect(policy.Rate()).To(Equal(PerVByte(1)))
+	})
+
+	It("should not pay more than the maximum fee", func() {
+		fee, err := policy.Fee(PerVByte(10), 400)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fee).To(Equal(int64(4000)))
+		_, err = policy.Fee(PerVByte(50), 2001)
+		Expect(errors.Is(err, ErrFeeTooHigh)).To(BeTrue())
+	})
+
+	It("should check the fees proposed", func() {
+		Expect(policy.Check(400, 400)).To(Succeed())
+		Expect(policy.Check(20000, 400)).To(Succeed())
+		Expect(policy.Check(399, 400)).To(MatchError(ContainSubstring("under the floor")))
+		Expect(policy.Check(20001, 400)).To(MatchError(ContainSubstring("over the ceiling")))
+		Expect(errors.Is(policy.Check(100001, 4000), ErrFeeTooHigh)).To(BeTrue())
+	})
+
+	It("should reject inconsistent policies", func() {
+		for _, modify := range []func(p *Policy){
+			func(p *Policy) { p.Floor = 0 },
+			func(p *Policy) { p.Ceiling = PerVByte(1) / 2 },
+			func(p *Policy) { p.Fallback = PerVByte(51) },
+			func(p *Policy) { p.MaxFee = 0 },
+			func(p *Policy) { p.ConfTarget = 0 },
+		} {
+			p := *policy
+			modify(&p)
+			Expect(p.Validate()).NotTo(Succeed())
+		}
+	})
+
+	It("should estimate the size of the multisig spends", func() {
+		for _, c := range []struct{ inputs, required, n int }{{1, 2, 3}, {3, 2, 3}, {2, 3, 5}, {20, 11, 15}} {
+			tx := spend(c.inputs)
+			script := multisigScript(c.n)
+			estimate := MultisigVSize(tx, c.required, script)
+			Expect(tx.TxIn[0].Witness).To(BeNil())
+
+			// signed with the largest and smaller signatures
+			for _, size := range []int{MaxSigSize, 72, 71} {
+				for _, in := range tx.TxIn {
+					in.Witness = [][]byte{{}}
+					for j := 0; j < c.required; j++ {
+						in.Witness = append(in.Witness, make([]byte, size))
+					}
+					in.Witness = append(in.Witness, script)
+				}
+				if size == MaxSigSize {
+					Expect(tx.VirtualSize()).To(Equal(estimate), "%+v", c)
+				} else {
+					Expect(tx.VirtualSize()).To(BeNumerically("<=", estimate), "%+v", c)
+				}
+			}
+		}
+
+		// 1 input of a 2-of-3, 2 outputs
+		Expect(MultisigVSize(spend(1), 2, multisigScript(3))).To(Equal(190))
+	})
+})
@@ -1,3 +1,12 @@
 module github.com/www222fff/watchUTXO/go-bitcoind
 
 go 1.13
+
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1
+	github.com/go-zeromq/zmq4 v0.13.0
+	github.com/onsi/ginkgo v1.10.3
+	github.com/onsi/gomega v1.7.1
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+)
@@ -0,0 +1,351 @@
+// Package hdkeychain implements BIP32 hierarchical deterministic keys with the
+// Bitcoin Gold extended key version bytes.
+package hdkeychain
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+)
+
+// HardenedKeyStart is the index of the first hardened child
+const HardenedKeyStart uint32 = 0x80000000
+
+// serializedKeyLen is the length of a serialized extended key, without checksum
+const serializedKeyLen = 78
+
+var (
+	// ErrDeriveHardFromPublic is returned when deriving a hardened child of a public key
+	ErrDeriveHardFromPublic = errors.New("hdkeychain: cannot derive a hardened key from a public key")
+
+	// ErrNotPrivate is returned when a private key is requested from a public extended key
+	ErrNotPrivate = errors.New("hdkeychain: extended key is not private")
+
+	// ErrInvalidChild is returned for the (astronomically rare) invalid child indexes
+	ErrInvalidChild = errors.New("hdkeychain: invalid child, use the next index")
+
+	// ErrUnknownVersion is returned when the version bytes match no known network
+	ErrUnknownVersion = errors.New("hdkeychain: unknown extended key version")
+
+	// ErrInvalidKeyLen is returned when a serialized extended key has the wrong size
+	ErrInvalidKeyLen = errors.New("hdkeychain: invalid extended key length")
+
+	// ErrInvalidSeedLen is returned when the master seed is not 16 to 64 bytes
+	ErrInvalidSeedLen = errors.New("hdkeychain: seed must be 16 to 64 bytes")
+)
+
+// An ExtendedKey is a BIP32 private or public extended key
+type ExtendedKey struct {
+	params    *address.Params
+	key       []byte // 32 bytes private key or 33 bytes compressed public key
+	pubKey    []byte // cached compressed public key
+	chainCode []byte
+	parentFP  []byte
+	depth     uint8
+	childNum  uint32
+	isPrivate bool
+}
+
+// NewMaster derives the master private key of a seed
+func NewMaster(seed []byte, params *address.Params) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, ErrInvalidSeedLen
+	}
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	i := mac.Sum(nil)
+
+	var k secp256k1.ModNScalar
+	if overflow := k.SetByteSlice(i[:32]); overflow || k.IsZero() {
+		return nil, ErrInvalidChild
+	}
+	return &ExtendedKey{
+		params:    params,
+		key:       i[:32],
+		chainCode: i[32:],
+		parentFP:  []byte{0, 0, 0, 0},
+		isPrivate: true,
+	}, nil
+}
+
+// NewKeyFromString parses a base58 xpub/xprv (or tpub/tprv) and returns it with
+// the parameters of the network its version bytes belong to
+func NewKeyFromString(s string) (*ExtendedKey, error) {
+	b, err := address.Base58Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != serializedKeyLen+4 {
+		return nil, ErrInvalidKeyLen
+	}
+	payload, sum := b[:serializedKeyLen], b[serializedKeyLen:]
+	if !bytes.Equal(address.DoubleSHA256(payload)[:4], sum) {
+		return nil, address.ErrChecksum
+	}
+
+	var version [4]byte
+	copy(version[:], payload[:4])
+	params, isPrivate, err := paramsForVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &ExtendedKey{
+		params:    params,
+		depth:     payload[4],
+		parentFP:  append([]byte{}, payload[5:9]...),
+		childNum:  binary.BigEndian.Uint32(payload[9:13]),
+		chainCode: append([]byte{}, payload[13:45]...),
+		isPrivate: isPrivate,
+	}
+	keyData := payload[45:78]
+	if isPrivate {
+		var s secp256k1.ModNScalar
+		if keyData[0] != 0 || s.SetByteSlice(keyData[1:]) || s.IsZero() {
+			return nil, errors.New("hdkeychain: invalid private key")
+		}
+		k.key = append([]byte{}, keyData[1:]...)
+	} else {
+		if _, err := secp256k1.ParsePubKey(keyData); err != nil {
+			return nil, err
+		}
+		k.key = append([]byte{}, keyData...)
+	}
+	return k, nil
+}
+
+func paramsForVersion(version [4]byte) (*address.Params, bool, error) {
+	for _, p := range []*address.Params{&address.MainNetParams, &address.TestNetParams} {
+		switch version {
+		case p.HDPrivateKeyID:
+			return p, true, nil
+		case p.HDPublicKeyID:
+			return p, false, nil
+		}
+	}
+	return nil, false, ErrUnknownVersion
+}
+
+// String returns the base58check serialization of the key
+func (k *ExtendedKey) String() string {
+	b := make([]byte, 0, serializedKeyLen+4)
+	if k.isPrivate {
+		b = append(b, k.params.HDPrivateKeyID[:]...)
+	} else {
+		b = append(b, k.params.HDPublicKeyID[:]...)
+	}
+	b = append(b, k.depth)
+	b = append(b, k.parentFP...)
+	var child [4]byte
+	binary.BigEndian.PutUint32(child[:], k.childNum)
+	b = append(b, child[:]...)
+	b = append(b, k.chainCode...)
+	if k.isPrivate {
+		b = append(b, 0)
+	}
+	b = append(b, k.key...)
+	b = append(b, address.DoubleSHA256(b)[:4]...)
+	return address.Base58Encode(b)
+}
+
+// IsPrivate reports whether the key can derive hardened children and sign
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.isPrivate
+}
+
+// Params returns the network parameters of the key
+func (k *ExtendedKey) Params() *address.Params {
+	return k.params
+}
+
+// SetNet returns a copy of the key serialized for another network
+func (k *ExtendedKey) SetNet(params *address.Params) *ExtendedKey {
+	c := *k
+	c.params = params
+	return &c
+}
+
+// Depth returns the number of derivations from the master key
+func (k *ExtendedKey) Depth() uint8 {
+	return k.depth
+}
+
+// ChildIndex returns the index this key was derived at
+func (k *ExtendedKey) ChildIndex() uint32 {
+	return k.childNum
+}
+
+// ParentFingerprint returns the fingerprint of the parent key
+func (k *ExtendedKey) ParentFingerprint() uint32 {
+	return binary.BigEndian.Uint32(k.parentFP)
+}
+
+// PubKeyBytes returns the compressed public key
+func (k *ExtendedKey) PubKeyBytes() []byte {
+	if !k.isPrivate {
+		return k.key
+	}
+	if k.pubKey == nil {
+		k.pubKey = secp256k1.PrivKeyFromBytes(k.key).PubKey().SerializeCompressed()
+	}
+	return k.pubKey
+}
+
+// ECPubKey returns the public key
+func (k *ExtendedKey) ECPubKey() (*secp256k1.PublicKey, error) {
+	return secp256k1.ParsePubKey(k.PubKeyBytes())
+}
+
+// ECPrivKey returns the private key
+func (k *ExtendedKey) ECPrivKey() (*secp256k1.PrivateKey, error) {
+	if !k.isPrivate {
+		return nil, ErrNotPrivate
+	}
+	return secp256k1.PrivKeyFromBytes(k.key), nil
+}
+
+// Fingerprint returns the first four bytes of the key's hash160, as used in
+// key origins ([fingerprint/path]) and PSBT derivations
+func (k *ExtendedKey) Fingerprint() uint32 {
+	return binary.BigEndian.Uint32(address.Hash160(k.PubKeyBytes())[:4])
+}
+
+// Neuter returns the public version of the key
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.isPrivate {
+		return k
+	}
+	return &ExtendedKey{
+		params:    k.params,
+		key:       k.PubKeyBytes(),
+		chainCode: k.chainCode,
+		parentFP:  k.parentFP,
+		depth:     k.depth,
+		childNum:  k.childNum,
+	}
+}
+
+// Derive returns the child at index i; indexes from HardenedKeyStart are hardened
+func (k *ExtendedKey) Derive(i uint32) (*ExtendedKey, error) {
+	if k.depth == 0xff {
+		return nil, errors.New("hdkeychain: maximum derivation depth reached")
+	}
+	hardened := i >= HardenedKeyStart
+	if hardened && !k.isPrivate {
+		return nil, ErrDeriveHardFromPublic
+	}
+
+	data := make([]byte, 0, 37)
+	if hardened {
+		data = append(data, 0)
+		data = append(data, k.key...)
+	} else {
+		data = append(data, k.PubKeyBytes()...)
+	}
+	var idx [4]byte
+	binary.BigEndian.PutUint32(idx[:], i)
+	data = append(data, idx[:]...)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	ilr := mac.Sum(nil)
+
+	var il secp256k1.ModNScalar
+	if overflow := il.SetByteSlice(ilr[:32]); overflow {
+		return nil, ErrInvalidChild
+	}
+
+	child := &ExtendedKey{
+		params:    k.params,
+		chainCode: ilr[32:],
+		parentFP:  address.Hash160(k.PubKeyBytes())[:4],
+		depth:     k.depth + 1,
+		childNum:  i,
+		isPrivate: k.isPrivate,
+	}
+
+	if k.isPrivate {
+		var parent secp256k1.ModNScalar
+		parent.SetByteSlice(k.key)
+		il.Add(&parent)
+		if il.IsZero() {
+			return nil, ErrInvalidChild
+		}
+		b := il.Bytes()
+		child.key = b[:]
+		return child, nil
+	}
+
+	parentKey, err := secp256k1.ParsePubKey(k.key)
+	if err != nil {
+		return nil, err
+	}
+	var ilPoint, parentPoint, sum secp256k1.JacobianPoint
+	secp256k1.ScalarBaseMultNonConst(&il, &ilPoint)
+	parentKey.AsJacobian(&parentPoint)
+	secp256k1.AddNonConst(&ilPoint, &parentPoint, &sum)
+	if (sum.X.IsZero() && sum.Y.IsZero()) || sum.Z.IsZero() {
+		return nil, ErrInvalidChild
+	}
+	sum.ToAffine()
+	child.key = secp256k1.NewPublicKey(&sum.X, &sum.Y).SerializeCompressed()
+	return child, nil
+}
+
+// DerivePath derives successive children along path
+func (k *ExtendedKey) DerivePath(path []uint32) (*ExtendedKey, error) {
+	key := k
+	for _, i := range path {
+		var err error
+		if key, err = key.Derive(i); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// ParsePath parses a derivation path such as "m/48'/0'/0'/2'" or "0/1h".
+// Both ' and h mark hardened steps.
+func ParsePath(s string) ([]uint32, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "m"), "/")
+	if s == "" {
+		return nil, nil
+	}
+	var path []uint32
+	for _, step := range strings.Split(s, "/") {
+		hardened := strings.HasSuffix(step, "'") || strings.HasSuffix(step, "h") || strings.HasSuffix(step, "H")
+		if hardened {
+			step = step[:len(step)-1]
+		}
+		n, err := strconv.ParseUint(step, 10, 32)
+		if err != nil || uint32(n) >= HardenedKeyStart {
+			return nil, fmt.Errorf("hdkeychain: invalid path step %q", step)
+		}
+		if hardened {
+			n += uint64(HardenedKeyStart)
+		}
+		path = append(path, uint32(n))
+	}
+	return path, nil
+}
+
+// FormatPath formats a derivation path with ' marking hardened steps, without the m/ prefix
+func FormatPath(path []uint32) string {
+	steps := make([]string, len(path))
+	for i, n := range path {
+		if n >= HardenedKeyStart {
+			steps[i] = strconv.FormatUint(uint64(n-HardenedKeyStart), 10) + "'"
+		} else {
+			steps[i] = strconv.FormatUint(uint64(n), 10)
+		}
+	}
+	return strings.Join(steps, "/")
+}
@@ -0,0 +1,110 @@
+package hdkeychain
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+)
+
+var _ = Describe("ExtendedKey", func() {
+	// BIP32 test vector 1
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+	vectors := []struct {
+		path string
+		xpub string
+		xprv string
+	}{
+		{"m",
+			"xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8",
+			"xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"},
+		{"m/0H",
+			"xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw",
+			"xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7"},
+		{"m/0H/1",
+			"xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ",
+			"xprv9wTYmMFdV23N2TdNG573QoEsfRrWKQgWeibmLntzniatZvR9BmLnvSxqu53Kw1UmYPxLgboyZQaXwTCg8MSY3H2EU4pWcQDnRnrVA1xe8fs"},
+	}
+
+	It("should derive the BIP32 test vector keys", func() {
+		master, err := NewMaster(seed, &address.MainNetParams)
+		Expect(err).NotTo(HaveOccurred())
+		for _, v := range vectors {
+			path, err := ParsePath(v.path)
+			Expect(err).NotTo(HaveOccurred())
+			k, err := master.DerivePath(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k.String()).To(Equal(v.xprv), v.path)
+			Expect(k.Neuter().String()).To(Equal(v.xpub), v.path)
+		}
+	})
+
+	It("should derive public children from an xpub", func() {
+		parent, err := NewKeyFromString(vectors[1].xpub)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parent.IsPrivate()).To(BeFalse())
+		child, err := parent.Derive(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(child.String()).To(Equal(vectors[2].xpub))
+	})
+
+	It("should round trip serialized keys", func() {
+		for _, v := range vectors {
+			for _, s := range []string{v.xpub, v.xprv} {
+				k, err := NewKeyFromString(s)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k.Params()).To(Equal(&address.MainNetParams))
+				Expect(k.String()).To(Equal(s))
+			}
+		}
+	})
+
+	It("should refuse hardened derivation from a public key", func() {
+		k, _ := NewKeyFromString(vectors[0].xpub)
+		_, err := k.Derive(HardenedKeyStart)
+		Expect(err).To(Equal(ErrDeriveHardFromPublic))
+		_, err = k.ECPrivKey()
+		Expect(err).To(Equal(ErrNotPrivate))
+	})
+
+	It("should report fingerprints and depth", func() {
+		master, _ := NewMaster(seed, &address.MainNetParams)
+		Expect(master.Fingerprint()).To(Equal(uint32(0x3442193e)))
+		child, _ := master.Derive(HardenedKeyStart)
+		Expect(child.Depth()).To(Equal(uint8(1)))
+		Expect(child.ParentFingerprint()).To(Equal(master.Fingerprint()))
+	})
+
+	It("should serialize testnet keys as tpub", func() {
+		k, _ := NewKeyFromString(vectors[0].xpub)
+		t := k.SetNet(&address.TestNetParams).String()
+		Expect(t[:4]).To(Equal("tpub"))
+		back, err := NewKeyFromString(t)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(back.Params()).To(Equal(&address.TestNetParams))
+	})
+
+	It("should reject a corrupted key", func() {
+		s := vectors[0].xpub
+		_, err := NewKeyFromString(s[:len(s)-1] + "9")
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("paths", func() {
+		It("should parse and format hardened markers", func() {
+			p, err := ParsePath("m/48'/0h/0H/2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p).To(Equal([]uint32{HardenedKeyStart + 48, HardenedKeyStart, HardenedKeyStart, 2}))
+			Expect(FormatPath(p)).To(Equal("48'/0'/0'/2"))
+		})
+		It("should reject invalid steps", func() {
+			_, err := ParsePath("m/x")
+			Expect(err).To(HaveOccurred())
+			_, err = ParsePath("m/2147483648")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package hdkeychain
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHdkeychain(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Hdkeychain Suite")
+}
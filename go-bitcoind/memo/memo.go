@@ -0,0 +1,150 @@
+// Package memo reads the recipient of a deposit from an OP_RETURN output of
+// its transaction. The memo is the data following the OP_RETURN:
+//
+//	"BTGB" | version (1) | destination chain id | recipient
+//
+// The recipient is a 32-byte Substrate AccountId, or its SS58 string. A
+// transaction carries at most one memo; OP_RETURN outputs without the
+// "BTGB" prefix are not memos and are ignored.
+package memo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/script"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Magic prefixes the memos
+var Magic = []byte("BTGB")
+
+// Version1 is the only memo version
+const Version1 = 1
+
+var (
+	// ErrNoMemo is returned for a transaction without memo
+	ErrNoMemo = errors.New("memo: no memo output")
+
+	// ErrSeveralMemos is returned for a transaction with more than one memo
+	ErrSeveralMemos = errors.New("memo: several memo outputs")
+)
+
+// A Memo tells where a deposit is credited
+type Memo struct {
+	Version   byte
+	ChainID   uint8
+	Recipient [32]byte // AccountId
+}
+
+// Decode decodes the data of a memo output
+func Decode(data []byte) (*Memo, error) {
+	if !bytes.HasPrefix(data, Magic) {
+		return nil, errors.New("memo: missing prefix")
+	}
+	data = data[len(Magic):]
+	if len(data) < 2 {
+		return nil, errors.New("memo: truncated")
+	}
+	m := &Memo{Version: data[0], ChainID: data[1]}
+	if m.Version != Version1 {
+		return nil, fmt.Errorf("memo: unknown version %d", m.Version)
+	}
+	recipient := data[2:]
+	if len(recipient) == len(m.Recipient) {
+		copy(m.Recipient[:], recipient)
+		return m, nil
+	}
+	account, _, err := DecodeSS58(string(recipient))
+	if err != nil {
+		return nil, err
+	}
+	m.Recipient = account
+	return m, nil
+}
+
+// Encode returns the data of the memo, with the recipient in binary
+func (m *Memo) Encode() []byte {
+	data := append([]byte(nil), Magic...)
+	data = append(data, m.Version, m.ChainID)
+	return append(data, m.Recipient[:]...)
+}
+
+// Script returns the OP_RETURN output script carrying data
+func Script(data []byte) ([]byte, error) {
+	return script.NewBuilder().AddOp(script.OP_RETURN).AddData(data).Script()
+}
+
+// Find returns the memo of tx
+func Find(tx *wire.MsgTx) (*Memo, error) {
+	var found []byte
+	for _, out := range tx.TxOut {
+		if len(out.PkScript) == 0 || out.PkScript[0] != script.OP_RETURN {
+			continue
+		}
+		data, err := script.NullDataPayload(out.PkScript)
+		if err != nil || !bytes.HasPrefix(data, Magic) {
+			continue
+		}
+		if found != nil {
+			return nil, ErrSeveralMemos
+		}
+		found = data
+	}
+	if found == nil {
+		return nil, ErrNoMemo
+	}
+	return Decode(found)
+}
+
+var ss58Prefix = []byte("SS58PRE")
+
+// DecodeSS58 decodes the SS58 string of an AccountId and returns it with
+// its network format
+func DecodeSS58(s string) ([32]byte, uint16, error) {
+	var account [32]byte
+	b, err := address.Base58Decode(s)
+	if err != nil {
+		return account, 0, fmt.Errorf("memo: invalid SS58 address %q", s)
+	}
+	var format uint16
+	prefix := 1
+	if len(b) > 0 && b[0]&0x40 != 0 {
+		prefix = 2
+	}
+	if len(b) != prefix+len(account)+2 {
+		return account, 0, fmt.Errorf("memo: invalid SS58 address %q", s)
+	}
+	if prefix == 1 {
+		format = uint16(b[0])
+	} else {
+		format = uint16(b[0]&0x3f)<<2 | uint16(b[1]>>6) | uint16(b[1]&0x3f)<<8
+	}
+	body := b[:prefix+len(account)]
+	sum := ss58Checksum(body)
+	if !bytes.Equal(sum[:2], b[len(body):]) {
+		return account, 0, fmt.Errorf("memo: invalid SS58 checksum in %q", s)
+	}
+	copy(account[:], b[prefix:])
+	return account, format, nil
+}
+
+// EncodeSS58 returns the SS58 string of an AccountId for a network format
+func EncodeSS58(account [32]byte, format uint16) string {
+	var b []byte
+	if format < 64 {
+		b = []byte{byte(format)}
+	} else {
+		b = []byte{byte(format&0xfc)>>2 | 0x40, byte(format>>8) | byte(format&0x03)<<6}
+	}
+	b = append(b, account[:]...)
+	sum := ss58Checksum(b)
+	return address.Base58Encode(append(b, sum[:2]...))
+}
+
+func ss58Checksum(body []byte) [64]byte {
+	return blake2b.Sum512(append(append([]byte(nil), ss58Prefix...), body...))
+}
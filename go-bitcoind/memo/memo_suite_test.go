@@ -0,0 +1,13 @@
+package memo
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestMemo(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Memo Suite")
+}
@@ -0,0 +1,90 @@
+package memo
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+const (
+	alice    = "5GrwvaEF5zXb26Fz9rcQpDWS57CtERHpNehXCPcNoHGKutQY"
+	alicePub = "d43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da27d"
+)
+
+func aliceAccount() [32]byte {
+	var a [32]byte
+	b, _ := hex.DecodeString(alicePub)
+	copy(a[:], b)
+	return a
+}
+
+// deposit pays the multisig with the given OP_RETURN outputs
+func deposit(memos ...[]byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{Sequence: wire.MaxTxInSequenceNum})
+	tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: []byte{0x51}})
+	for _, data := range memos {
+		s, err := Script(data)
+		Expect(err).NotTo(HaveOccurred())
+		tx.AddTxOut(&wire.TxOut{PkScript: s})
+	}
+	return tx
+}
+
+var _ = Describe("Memo", func() {
+	It("should round trip SS58 addresses", func() {
+		account, format, err := DecodeSS58(alice)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(format).To(Equal(uint16(42)))
+		Expect(account).To(Equal(aliceAccount()))
+		Expect(EncodeSS58(account, 42)).To(Equal(alice))
+
+		// two byte network formats
+		kusama := EncodeSS58(account, 1000)
+		back, format, err := DecodeSS58(kusama)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(format).To(Equal(uint16(1000)))
+		Expect(back).To(Equal(account))
+
+		_, _, err = DecodeSS58(alice[:len(alice)-1] + "Z")
+		Expect(err).To(MatchError(ContainSubstring("checksum")))
+		_, _, err = DecodeSS58("0OIl")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should find the recipient in a binary or SS58 memo", func() {
+		m := &Memo{Version: Version1, ChainID: 1, Recipient: aliceAccount()}
+		found, err := Find(deposit([]byte("unrelated"), m.Encode()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(Equal(m))
+
+		ss58 := append([]byte("BTGB\x01\x01"), alice...)
+		found, err = Find(deposit(ss58))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(Equal(m))
+	})
+
+	It("should reject the missing or malformed memos", func() {
+		_, err := Find(deposit())
+		Expect(err).To(Equal(ErrNoMemo))
+		_, err = Find(deposit([]byte("unrelated")))
+		Expect(err).To(Equal(ErrNoMemo))
+
+		m := &Memo{Version: Version1, ChainID: 1, Recipient: aliceAccount()}
+		_, err = Find(deposit(m.Encode(), m.Encode()))
+		Expect(err).To(Equal(ErrSeveralMemos))
+
+		for _, data := range [][]byte{
+			[]byte("BTGB\x01"),
+			[]byte("BTGB\x02\x01" + string(m.Recipient[:])),
+			[]byte("BTGB\x01\x01" + string(m.Recipient[:31])),
+			[]byte("BTGB\x01\x01" + alice[1:]),
+		} {
+			_, err = Find(deposit(data))
+			Expect(err).To(HaveOccurred(), "%q", data)
+		}
+	})
+})
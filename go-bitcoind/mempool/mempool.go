@@ -0,0 +1,305 @@
+// Package mempool reports the outputs paying the watched addresses before
+// they confirm. Every transaction entering the node's mempool is decoded once;
+// the ones paying a watched script are followed until they leave the mempool,
+// mined, replaced (BIP125) or double spent.
+// Mempool deposits are informational: they are kept in memory only, never
+// get a nonce and must never be routed.
+package mempool
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// Node is the part of the RPC client the watcher queries. *bitcoind.Bitcoind
+// implements it; GetTransaction needs the wallet holding the watched
+// addresses and fails for other transactions.
+type Node interface {
+	GetRawMempool() ([]string, error)
+	GetRawTransaction(txId string, verbose bool) (interface{}, error)
+	GetTransaction(txid string) (bitcoind.Transaction, error)
+}
+
+// Kind is the kind of a mempool event
+type Kind string
+
+// Event kinds
+const (
+	// EventPending is sent for each watched output of a transaction entering the mempool
+	EventPending Kind = "pending"
+
+	// EventConflicted is sent when the wallet reports a transaction double
+	// spending the inputs of the deposit's
+	EventConflicted Kind = "conflicted"
+
+	// EventReplaced is sent when the deposit's transaction left the mempool
+	// for a transaction spending the same inputs
+	EventReplaced Kind = "replaced"
+
+	// EventMined is sent when the deposit's transaction left the mempool in a block
+	EventMined Kind = "mined"
+
+	// EventDropped is sent when the deposit's transaction left the mempool
+	// for another reason: eviction, expiry, or unknown to the wallet
+	EventDropped Kind = "dropped"
+)
+
+// An Event tells the mempool state of a deposit
+type Event struct {
+	Kind    Kind
+	Deposit *deposit.Deposit
+
+	// Replaceable is set when the transaction signals BIP125 replaceability
+	Replaceable bool
+
+	// By lists the replacing or conflicting transactions
+	By []string
+}
+
+// Change returns the change published to the sinks for the event: the
+// deposit is pending in the mempool state, without a nonce, the event and
+// the replacing or conflicting transactions being the reason. Mempool
+// deposits are not stored, see store.Publish.
+func (e *Event) Change() *store.Change {
+	d := e.Deposit
+	reason := string(e.Kind)
+	if len(e.By) > 0 {
+		reason += " by " + strings.Join(e.By, ", ")
+	}
+	c := &store.Change{Record: &store.Record{
+		OutPoint:  d.ID(),
+		Address:   d.Address,
+		Amount:    d.Amount,
+		Script:    d.ScriptPubKey,
+		Status:    store.StatusPending,
+		UpdatedAt: time.Now().UTC(),
+		Reason:    reason,
+		State:     deposit.StateMempool,
+	}}
+	if e.Kind != EventPending {
+		c.From = deposit.StateMempool
+	}
+	return c
+}
+
+// A Handler is notified of the mempool events
+type Handler interface {
+	MempoolChanged(e *Event)
+}
+
+// tracked is a mempool transaction paying a watched address
+type tracked struct {
+	txid        string
+	inputs      []wire.OutPoint
+	deposits    []*deposit.Deposit
+	replaceable bool
+	conflicts   map[string]bool
+	replacedBy  []string
+}
+
+// A Watcher follows the mempool transactions paying a set of addresses
+type Watcher struct {
+	node    Node
+	scripts map[string]string // scriptPubKey -> address
+
+	seen    map[string]bool // txids of the mempool decoded so far
+	tracked map[string]*tracked
+	spends  map[wire.OutPoint]string // input -> tracked txid spending it
+}
+
+// New returns a watcher of the mempool outputs paying addresses
+func New(node Node, params *address.Params, addresses []string) (*Watcher, error) {
+	scripts := make(map[string]string, len(addresses))
+	for _, a := range addresses {
+		addr, err := address.Decode(a, params)
+		if err != nil {
+			return nil, fmt.Errorf("mempool: %s: %v", a, err)
+		}
+		scripts[string(addr.ScriptPubKey())] = addr.String()
+	}
+	return &Watcher{
+		node:    node,
+		scripts: scripts,
+		seen:    make(map[string]bool),
+		tracked: make(map[string]*tracked),
+		spends:  make(map[wire.OutPoint]string),
+	}, nil
+}
+
+// Poll decodes the transactions that entered the mempool since the last
+// call and reports the changes of the deposits followed. A transaction that
+// can't be fetched is retried on the next poll.
+func (w *Watcher) Poll(h Handler) error {
+	ids, err := w.node.GetRawMempool()
+	if err != nil {
+		return err
+	}
+	current := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		current[id] = true
+		if w.seen[id] {
+			continue
+		}
+		tx, err := w.fetch(id)
+		if err != nil {
+			// most likely mined or replaced since getrawmempool
+			continue
+		}
+		w.seen[id] = true
+		w.add(h, id, tx)
+	}
+	for id := range w.seen {
+		if !current[id] {
+			delete(w.seen, id)
+		}
+	}
+
+	var left []string
+	for id := range w.tracked {
+		if !current[id] {
+			left = append(left, id)
+		}
+	}
+	sort.Strings(left)
+	for _, id := range left {
+		w.remove(h, w.tracked[id])
+	}
+
+	var staying []string
+	for id := range w.tracked {
+		staying = append(staying, id)
+	}
+	sort.Strings(staying)
+	for _, id := range staying {
+		w.checkConflicts(h, w.tracked[id])
+	}
+	return nil
+}
+
+func (w *Watcher) fetch(txid string) (*wire.MsgTx, error) {
+	raw, err := w.node.GetRawTransaction(txid, false)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := raw.(string)
+	if !ok {
+		return nil, fmt.Errorf("mempool: unexpected getrawtransaction result %T", raw)
+	}
+	return wire.NewMsgTxFromHex(s)
+}
+
+// add follows tx if it pays a watched address, and records it as the
+// replacement of the followed transactions it double spends
+func (w *Watcher) add(h Handler, txid string, tx *wire.MsgTx) {
+	replaceable := false
+	for _, in := range tx.TxIn {
+		if in.Sequence < wire.MaxTxInSequenceNum-1 {
+			replaceable = true
+		}
+		if other, ok := w.spends[in.PreviousOutPoint]; ok && other != txid {
+			t := w.tracked[other]
+			t.replacedBy = appendNew(t.replacedBy, txid)
+		}
+	}
+
+	deposits := w.extract(tx)
+	if len(deposits) == 0 {
+		return
+	}
+	t := &tracked{txid: txid, deposits: deposits, replaceable: replaceable, conflicts: make(map[string]bool)}
+	for _, in := range tx.TxIn {
+		t.inputs = append(t.inputs, in.PreviousOutPoint)
+		w.spends[in.PreviousOutPoint] = txid
+	}
+	w.tracked[txid] = t
+	w.notify(h, t, EventPending, nil)
+}
+
+// remove stops following t, which left the mempool, and tells why
+func (w *Watcher) remove(h Handler, t *tracked) {
+	delete(w.tracked, t.txid)
+	for _, op := range t.inputs {
+		if w.spends[op] == t.txid {
+			delete(w.spends, op)
+		}
+	}
+
+	if len(t.replacedBy) > 0 {
+		w.notify(h, t, EventReplaced, t.replacedBy)
+		return
+	}
+	wtx, err := w.node.GetTransaction(t.txid)
+	switch {
+	case err != nil:
+		w.notify(h, t, EventDropped, nil)
+	case wtx.Confirmations > 0:
+		w.notify(h, t, EventMined, nil)
+	case len(wtx.WalletConflicts) > 0:
+		w.notify(h, t, EventReplaced, wtx.WalletConflicts)
+	default:
+		w.notify(h, t, EventDropped, nil)
+	}
+}
+
+// checkConflicts reports the double spends the wallet knows of and were not reported yet
+func (w *Watcher) checkConflicts(h Handler, t *tracked) {
+	wtx, err := w.node.GetTransaction(t.txid)
+	if err != nil {
+		return
+	}
+	var by []string
+	for _, c := range wtx.WalletConflicts {
+		if !t.conflicts[c] {
+			t.conflicts[c] = true
+			by = append(by, c)
+		}
+	}
+	if len(by) > 0 {
+		w.notify(h, t, EventConflicted, by)
+	}
+}
+
+func (w *Watcher) notify(h Handler, t *tracked, kind Kind, by []string) {
+	for _, d := range t.deposits {
+		h.MempoolChanged(&Event{Kind: kind, Deposit: d, Replaceable: t.replaceable, By: by})
+	}
+}
+
+// extract returns the outputs of tx paying a watched address
+func (w *Watcher) extract(tx *wire.MsgTx) []*deposit.Deposit {
+	var deposits []*deposit.Deposit
+	var txid wire.Hash
+	for i, out := range tx.TxOut {
+		addr, ok := w.scripts[string(out.PkScript)]
+		if !ok {
+			continue
+		}
+		if txid == (wire.Hash{}) {
+			txid = tx.TxHash()
+		}
+		deposits = append(deposits, &deposit.Deposit{
+			OutPoint:     wire.OutPoint{Hash: txid, Index: uint32(i)},
+			Address:      addr,
+			Amount:       out.Value,
+			ScriptPubKey: out.PkScript,
+		})
+	}
+	return deposits
+}
+
+func appendNew(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
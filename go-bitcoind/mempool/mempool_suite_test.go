@@ -0,0 +1,13 @@
+package mempool
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestMempool(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Mempool Suite")
+}
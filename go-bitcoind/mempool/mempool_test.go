@@ -0,0 +1,180 @@
+package mempool
+
+import (
+	"encoding/hex"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+const (
+	watched       = "tbtg1qmc6uua0jngs9qr38w3pchcvdcrzu878t8p8nwqtj32rtjvjfvnfq0p027k"
+	watchedScript = "0020de35ce75f29a20500e2774438be18dc0c5c3f8eb384f3701728a86b9324964d2"
+	funding       = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+)
+
+// fakeNode serves a mempool and the wallet view of its transactions
+type fakeNode struct {
+	pool    []*wire.MsgTx
+	wallet  map[string]bitcoind.Transaction
+	fetches int
+}
+
+func (n *fakeNode) GetRawMempool() ([]string, error) {
+	ids := []string{}
+	for _, tx := range n.pool {
+		ids = append(ids, tx.TxHash().String())
+	}
+	return ids, nil
+}
+
+func (n *fakeNode) GetRawTransaction(txId string, verbose bool) (interface{}, error) {
+	n.fetches++
+	for _, tx := range n.pool {
+		if tx.TxHash().String() == txId {
+			return tx.Hex(), nil
+		}
+	}
+	return nil, errors.New("No such mempool or blockchain transaction")
+}
+
+func (n *fakeNode) GetTransaction(txid string) (bitcoind.Transaction, error) {
+	t, ok := n.wallet[txid]
+	if !ok {
+		return t, errors.New("Invalid or non-wallet transaction id")
+	}
+	return t, nil
+}
+
+// spend spends the funding output with sequence and pays value to the watched address
+func spend(sequence uint32, value int64) *wire.MsgTx {
+	script, _ := hex.DecodeString(watchedScript)
+	prev, _ := wire.NewOutPoint(funding, 0)
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: prev, Sequence: sequence})
+	tx.AddTxOut(&wire.TxOut{Value: 5, PkScript: []byte{0x51}})
+	tx.AddTxOut(&wire.TxOut{Value: value, PkScript: script})
+	return tx
+}
+
+// recorder is a Handler keeping the events in order
+type recorder struct {
+	events []*Event
+}
+
+func (r *recorder) MempoolChanged(e *Event) {
+	r.events = append(r.events, e)
+}
+
+var _ = Describe("Watcher", func() {
+	var (
+		node *fakeNode
+		w    *Watcher
+		rec  *recorder
+	)
+
+	BeforeEach(func() {
+		node = &fakeNode{wallet: make(map[string]bitcoind.Transaction)}
+		var err error
+		w, err = New(node, &address.RegTestParams, []string{watched})
+		Expect(err).NotTo(HaveOccurred())
+		rec = &recorder{}
+	})
+
+	poll := func() []*Event {
+		rec.events = nil
+		Expect(w.Poll(rec)).To(Succeed())
+		return rec.events
+	}
+
+	It("should report the watched outputs of new mempool transactions once", func() {
+		unrelated := wire.NewMsgTx(2)
+		unrelated.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: 7}, Sequence: wire.MaxTxInSequenceNum})
+		unrelated.AddTxOut(&wire.TxOut{Value: 1, PkScript: []byte{0x51}})
+		tx := spend(wire.MaxTxInSequenceNum, 1000)
+		node.pool = []*wire.MsgTx{unrelated, tx}
+
+		events := poll()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Kind).To(Equal(EventPending))
+		Expect(events[0].Deposit.ID()).To(Equal(tx.TxHash().String() + ":1"))
+		Expect(events[0].Deposit.Address).To(Equal(watched))
+		Expect(events[0].Deposit.Amount).To(Equal(int64(1000)))
+		Expect(events[0].Deposit.Confirmations).To(BeZero())
+		Expect(events[0].Replaceable).To(BeFalse())
+
+		Expect(poll()).To(BeEmpty())
+		Expect(node.fetches).To(Equal(2))
+	})
+
+	It("should report a BIP125 replacement", func() {
+		original := spend(0xfffffffd, 1000)
+		node.pool = []*wire.MsgTx{original}
+		events := poll()
+		Expect(events[0].Replaceable).To(BeTrue())
+
+		bumped := spend(0xfffffffd, 900)
+		node.pool = []*wire.MsgTx{bumped}
+		events = poll()
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Kind).To(Equal(EventPending))
+		Expect(events[0].Deposit.OutPoint.Hash).To(Equal(bumped.TxHash()))
+		Expect(events[1].Kind).To(Equal(EventReplaced))
+		Expect(events[1].Deposit.OutPoint.Hash).To(Equal(original.TxHash()))
+		Expect(events[1].By).To(Equal([]string{bumped.TxHash().String()}))
+
+		// published as pending deposits, without a nonce
+		c := events[1].Change()
+		Expect(c.From).To(Equal(deposit.StateMempool))
+		Expect(c.Record.State).To(Equal(deposit.StateMempool))
+		Expect(c.Record.Status).To(Equal(store.StatusPending))
+		Expect(c.Record.OutPoint).To(Equal(events[1].Deposit.ID()))
+		Expect(c.Record.Nonce).To(BeZero())
+		Expect(c.Record.Reason).To(Equal("replaced by " + bumped.TxHash().String()))
+		Expect(events[0].Change().From).To(BeEmpty())
+	})
+
+	It("should report the wallet conflicts of a followed transaction", func() {
+		tx := spend(wire.MaxTxInSequenceNum, 1000)
+		txid := tx.TxHash().String()
+		node.pool = []*wire.MsgTx{tx}
+		node.wallet[txid] = bitcoind.Transaction{TxID: txid}
+		poll()
+
+		node.wallet[txid] = bitcoind.Transaction{TxID: txid, WalletConflicts: []string{"ab"}}
+		events := poll()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Kind).To(Equal(EventConflicted))
+		Expect(events[0].By).To(Equal([]string{"ab"}))
+		Expect(poll()).To(BeEmpty())
+
+		// the double spend was mined
+		node.pool = nil
+		node.wallet[txid] = bitcoind.Transaction{TxID: txid, Confirmations: -1, WalletConflicts: []string{"ab"}}
+		events = poll()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Kind).To(Equal(EventReplaced))
+	})
+
+	It("should tell mined transactions from dropped ones", func() {
+		mined, dropped := spend(wire.MaxTxInSequenceNum, 1000), spend(wire.MaxTxInSequenceNum, 2000)
+		dropped.TxIn[0].PreviousOutPoint.Index = 1
+		node.pool = []*wire.MsgTx{mined, dropped}
+		poll()
+
+		node.wallet[mined.TxHash().String()] = bitcoind.Transaction{Confirmations: 1}
+		node.pool = nil
+		kinds := map[Kind]int64{}
+		for _, e := range poll() {
+			kinds[e.Kind] = e.Deposit.Amount
+		}
+		Expect(kinds).To(Equal(map[Kind]int64{EventMined: 1000, EventDropped: 2000}))
+	})
+})
@@ -0,0 +1,164 @@
+package merkle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// MaxRetarget bounds how much easier a Bitcoin header's target, before the
+// fork, may be than its parent's. Bitcoin retargets by at most as much every
+// 2016 blocks; the headers since the fork are bounded by the network's
+// difficulty adjustment instead.
+const MaxRetarget = 4
+
+var (
+	// ErrRootMismatch is returned when the partial tree does not commit to the header's merkle root
+	ErrRootMismatch = errors.New("merkle: proof does not match the header merkle root")
+
+	// ErrTxNotInProof is returned when the proof does not mark the transaction as included
+	ErrTxNotInProof = errors.New("merkle: transaction is not proven by the merkle block")
+
+	// ErrHighHash is returned when a header hash is above its proof-of-work target
+	ErrHighHash = errors.New("merkle: block hash is higher than its target")
+
+	// ErrEasyTarget is returned when a header's target is above the network's
+	// proof-of-work limit
+	ErrEasyTarget = errors.New("merkle: target above the proof-of-work limit")
+
+	// ErrDifficultyDrop is returned when a header's target is easier than
+	// the difficulty adjustment allows after the headers before it
+	ErrDifficultyDrop = errors.New("merkle: target rises too fast from the previous headers'")
+)
+
+// CompactToBig decodes the compact target representation of a header's bits
+func CompactToBig(bits uint32) *big.Int {
+	mantissa := int64(bits & 0x007fffff)
+	exponent := uint(bits >> 24)
+	var n *big.Int
+	if exponent <= 3 {
+		n = big.NewInt(mantissa >> (8 * (3 - exponent)))
+	} else {
+		n = new(big.Int).Lsh(big.NewInt(mantissa), 8*(exponent-3))
+	}
+	if bits&0x00800000 != 0 {
+		n.Neg(n)
+	}
+	return n
+}
+
+// CheckProofOfWork checks that hash is at or below the target encoded in
+// bits, which is at most the target encoded in limit
+func CheckProofOfWork(hash wire.Hash, bits, limit uint32) error {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return errors.New("merkle: invalid target bits")
+	}
+	if target.Cmp(CompactToBig(limit)) > 0 {
+		return ErrEasyTarget
+	}
+	var be [wire.HashSize]byte
+	for i := range hash {
+		be[i] = hash[wire.HashSize-1-i]
+	}
+	if new(big.Int).SetBytes(be[:]).Cmp(target) > 0 {
+		return ErrHighHash
+	}
+	return nil
+}
+
+// CheckHeader checks the proof-of-work of h, hashing to hash: its target
+// within the network's limit, the hash at or below it and, since the fork,
+// the Equihash solution
+func CheckHeader(h *wire.BlockHeader, hash wire.Hash, params *address.Params) error {
+	if h.Height < params.ForkHeight {
+		return CheckProofOfWork(hash, h.Bits, params.LegacyPowLimitBits)
+	}
+	if err := CheckProofOfWork(hash, h.Bits, params.PowLimitBits); err != nil {
+		return err
+	}
+	if eh := params.EquihashAt(h.Height); eh.N != 0 {
+		return eh.Verify(h.EquihashInput(), h.Solution)
+	}
+	return nil
+}
+
+// CheckRetarget checks the target of next against ancestors, the headers
+// before it, oldest first, ending with its parent. Before the fork the target
+// is at most MaxRetarget times the parent's. Since the fork it is bounded by
+// the difficulty adjustment of its height, as the mean target of the
+// adjustment's window, which ancestors must hold. It accepts any target on
+// the networks allowing minimum difficulty blocks, across the fork and during
+// the first window of an adjustment.
+func CheckRetarget(ancestors []*wire.BlockHeader, next *wire.BlockHeader, params *address.Params) error {
+	if params.AllowMinDifficultyBlocks {
+		return nil
+	}
+	if len(ancestors) == 0 {
+		return errors.New("merkle: no parent to check the target against")
+	}
+	prev := ancestors[len(ancestors)-1]
+	if next.Height < params.ForkHeight {
+		max := new(big.Int).Mul(CompactToBig(prev.Bits), big.NewInt(MaxRetarget))
+		if CompactToBig(next.Bits).Cmp(max) > 0 {
+			return ErrDifficultyDrop
+		}
+		return nil
+	}
+	r, start := params.RetargetAt(next.Height)
+	if r.Window == 0 || next.Height < start+uint32(r.Window) {
+		return nil
+	}
+	if len(ancestors) < r.Window {
+		return fmt.Errorf("merkle: %d headers before block %d, its target needs %d", len(ancestors), next.Height, r.Window)
+	}
+	// next/mean <= Num/Den, as next*Window*Den <= sum*Num
+	sum := new(big.Int)
+	for _, h := range ancestors[len(ancestors)-r.Window:] {
+		sum.Add(sum, CompactToBig(h.Bits))
+	}
+	target := new(big.Int).Mul(CompactToBig(next.Bits), big.NewInt(int64(r.Window)*r.Den))
+	if target.Cmp(sum.Mul(sum, big.NewInt(r.Num))) > 0 {
+		return ErrDifficultyDrop
+	}
+	return nil
+}
+
+// A Proof is a merkle block that was checked to commit to a transaction
+type Proof struct {
+	Header    wire.BlockHeader
+	BlockHash wire.Hash
+
+	// The position of the transaction in the block
+	Index uint32
+}
+
+// VerifyProof checks that the gettxoutproof merkle block proofHex commits to
+// txid under a header with valid proof-of-work on the network of params
+func VerifyProof(proofHex string, txid wire.Hash, params *address.Params) (*Proof, error) {
+	mb, err := wire.NewMerkleBlockFromHex(proofHex)
+	if err != nil {
+		return nil, err
+	}
+	root, matches, indexes, err := ExtractMatches(mb)
+	if err != nil {
+		return nil, err
+	}
+	if root != mb.Header.MerkleRoot {
+		return nil, ErrRootMismatch
+	}
+	p := &Proof{Header: mb.Header, BlockHash: mb.Header.BlockHash(params.ForkHeight)}
+	if err := CheckHeader(&p.Header, p.BlockHash, params); err != nil {
+		return nil, err
+	}
+	for i, m := range matches {
+		if m == txid {
+			p.Index = indexes[i]
+			return p, nil
+		}
+	}
+	return nil, ErrTxNotInProof
+}
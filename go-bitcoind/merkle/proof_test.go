@@ -0,0 +1,217 @@
+package merkle
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/equihash"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+func mustHash(s string) wire.Hash {
+	h, err := wire.NewHashFromStr(s)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// The transactions and header of block 100000
+var block100000 = []wire.Hash{
+	mustHash("8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87"),
+	mustHash("fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4"),
+	mustHash("6359f0868171b1d194cbee1af2f16ea598ae8fad666d9b012c8ed2b79a236ec4"),
+	mustHash("e9a66845e05d5abc0ad04ec80f774a7e585c6e8db975962d069a522137b80c1d"),
+}
+
+func header100000() wire.BlockHeader {
+	h := wire.BlockHeader{
+		Version:    1,
+		PrevBlock:  mustHash("000000000002d01c1fccc21636b607dfd930d31d01c3a62104612a1719011250"),
+		MerkleRoot: mustHash("f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766"),
+		Height:     100000,
+		Timestamp:  1293623863,
+		Bits:       0x1b04864c,
+	}
+	copy(h.Nonce[:], []byte{0x0f, 0x2b, 0x57, 0x10}) // 274148111
+	return h
+}
+
+func proofFor(txids []wire.Hash, header wire.BlockHeader, matched ...int) *wire.MsgMerkleBlock {
+	match := make([]bool, len(txids))
+	for _, i := range matched {
+		match[i] = true
+	}
+	hashes, flags := PartialTree(txids, match)
+	return &wire.MsgMerkleBlock{Header: header, Transactions: uint32(len(txids)), Hashes: hashes, Flags: flags}
+}
+
+var _ = Describe("Proof", func() {
+	params := &address.MainNetParams
+
+	It("should compute the block merkle root", func() {
+		Expect(Root(block100000)).To(Equal(header100000().MerkleRoot))
+	})
+
+	Describe("ExtractMatches", func() {
+		It("should recover the matched transactions and the root", func() {
+			for n := 1; n <= 9; n++ {
+				txids := make([]wire.Hash, n)
+				for i := range txids {
+					txids[i] = wire.DoubleHash([]byte{byte(i)})
+				}
+				for i := 0; i < n; i++ {
+					root, matches, indexes, err := ExtractMatches(proofFor(txids, wire.BlockHeader{}, i))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(root).To(Equal(Root(txids)))
+					Expect(matches).To(Equal([]wire.Hash{txids[i]}))
+					Expect(indexes).To(Equal([]uint32{uint32(i)}))
+				}
+			}
+		})
+		It("should reject leftover hashes or flags", func() {
+			mb := proofFor(block100000, header100000(), 2)
+			mb.Hashes = append(mb.Hashes, wire.Hash{})
+			_, _, _, err := ExtractMatches(mb)
+			Expect(err).To(Equal(ErrBadProof))
+
+			mb = proofFor(block100000, header100000(), 2)
+			mb.Flags = append(mb.Flags, 0)
+			_, _, _, err = ExtractMatches(mb)
+			Expect(err).To(Equal(ErrBadProof))
+		})
+		It("should reject duplicated siblings", func() {
+			// three transactions padded to four by repeating the last one
+			txids := append(append([]wire.Hash{}, block100000[:3]...), block100000[2])
+			mb := proofFor(txids, wire.BlockHeader{}, 3)
+			_, _, _, err := ExtractMatches(mb)
+			Expect(err).To(Equal(ErrBadProof))
+		})
+		It("should reject an empty block", func() {
+			_, _, _, err := ExtractMatches(&wire.MsgMerkleBlock{})
+			Expect(err).To(Equal(ErrBadProof))
+		})
+	})
+
+	Describe("VerifyProof", func() {
+		It("should accept the proof of a transaction of block 100000", func() {
+			p, err := VerifyProof(proofFor(block100000, header100000(), 2).Hex(), block100000[2], params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Index).To(Equal(uint32(2)))
+			Expect(p.BlockHash.String()).To(Equal("000000000003ba27aa200b1cecaad478d2b00432346c3f1f3986da1afd33e506"))
+		})
+		It("should reject a transaction the proof does not match", func() {
+			_, err := VerifyProof(proofFor(block100000, header100000(), 2).Hex(), block100000[1], params)
+			Expect(err).To(Equal(ErrTxNotInProof))
+		})
+		It("should reject a fabricated transaction list", func() {
+			fake := append([]wire.Hash{}, block100000...)
+			fake[2] = wire.DoubleHash([]byte("fabricated deposit"))
+			_, err := VerifyProof(proofFor(fake, header100000(), 2).Hex(), fake[2], params)
+			Expect(err).To(Equal(ErrRootMismatch))
+		})
+		It("should reject a header without proof-of-work", func() {
+			h := header100000()
+			h.Timestamp++
+			_, err := VerifyProof(proofFor(block100000, h, 2).Hex(), block100000[2], params)
+			Expect(err).To(Equal(ErrHighHash))
+		})
+	})
+
+	Describe("CheckHeader", func() {
+		// a post-fork regtest header, meeting its target
+		var h *wire.BlockHeader
+		BeforeEach(func() {
+			h = &wire.BlockHeader{Version: 4, Height: 3000, Bits: 0x207fffff}
+			mine(h)
+		})
+
+		It("should check the legacy headers against the legacy limit", func() {
+			old := header100000()
+			Expect(CheckHeader(&old, old.BlockHash(params.ForkHeight), params)).To(Succeed())
+			easy := *params
+			easy.LegacyPowLimitBits = 0x1b04864b
+			Expect(CheckHeader(&old, old.BlockHash(params.ForkHeight), &easy)).To(Equal(ErrEasyTarget))
+		})
+		It("should reject a target above the network's limit", func() {
+			hash := h.BlockHash(params.ForkHeight)
+			Expect(CheckHeader(h, hash, &address.RegTestParams)).To(Succeed())
+			Expect(CheckHeader(h, hash, params)).To(Equal(ErrEasyTarget))
+		})
+		It("should check the Equihash solution since the fork", func() {
+			checked := address.RegTestParams
+			checked.Equihash, checked.EquihashUpgrade, checked.EquihashUpgradeHeight = equihash.Zcash, equihash.BTG, 3000
+			h.Solution = make([]byte, equihash.BTG.SolutionSize())
+			hash := mine(h)
+			err := CheckHeader(h, hash, &checked)
+			Expect(errors.Is(err, equihash.ErrInvalidSolution)).To(BeTrue(), "%v", err)
+
+			checked.EquihashUpgradeHeight = 3001
+			Expect(CheckHeader(h, hash, &checked)).To(MatchError(ContainSubstring("100 bytes for Equihash<200,9>")))
+		})
+	})
+
+	Describe("CheckRetarget", func() {
+		header := func(height uint32, bits uint32) *wire.BlockHeader {
+			return &wire.BlockHeader{Height: height, Bits: bits}
+		}
+		// window returns n headers at bits up to the parent of height
+		window := func(height uint32, n int, bits uint32) []*wire.BlockHeader {
+			var headers []*wire.BlockHeader
+			for i := n; i > 0; i-- {
+				headers = append(headers, header(height-uint32(i), bits))
+			}
+			return headers
+		}
+
+		It("should bound the rise of a Bitcoin target by its parent's", func() {
+			prev := window(400000, 1, 0x1d00ffff)
+			Expect(CheckRetarget(prev, header(400000, 0x1d03fffc), params)).To(Succeed())
+			Expect(CheckRetarget(prev, header(400000, 0x1d040000), params)).To(Equal(ErrDifficultyDrop))
+			Expect(CheckRetarget(prev, header(400000, 0x1c00ffff), params)).To(Succeed())
+		})
+		It("should bound the rise of a Digishield target by the mean of its window", func() {
+			prev := window(520000, 30, 0x1d00ffff)
+			Expect(CheckRetarget(prev, header(520000, 0x1d0151ea), params)).To(Succeed())
+			Expect(CheckRetarget(prev, header(520000, 0x1d0151eb), params)).To(Equal(ErrDifficultyDrop))
+		})
+		It("should bound the rise of an LWMA target by the mean of its window", func() {
+			prev := window(600000, 45, 0x1d00ffff)
+			Expect(CheckRetarget(prev, header(600000, 0x1d05ffff), params)).To(Succeed())
+			Expect(CheckRetarget(prev, header(600000, 0x1d06ffff), params)).To(Equal(ErrDifficultyDrop))
+		})
+		It("should not let the targets compound from parent to child", func() {
+			prev := window(600000, 45, 0x1d00ffff)
+			prev[44].Bits = 0x1d05ffff
+			Expect(CheckRetarget(prev, header(600000, 0x1d07ffff), params)).To(Equal(ErrDifficultyDrop))
+		})
+		It("should require the whole window", func() {
+			prev := window(600000, 44, 0x1d00ffff)
+			Expect(CheckRetarget(prev, header(600000, 0x1d00ffff), params)).To(MatchError(ContainSubstring("needs 45")))
+		})
+		It("should accept any target across the fork and in the first window of an adjustment", func() {
+			prev := window(params.ForkHeight, 1, 0x18000001)
+			Expect(CheckRetarget(prev, header(params.ForkHeight, 0x1f07ffff), params)).To(Succeed())
+			prev = window(params.DigishieldHeight+29, 1, 0x1d00ffff)
+			Expect(CheckRetarget(prev, header(params.DigishieldHeight+29, 0x1f07ffff), params)).To(Succeed())
+			prev = window(params.LwmaHeight+44, 1, 0x1d00ffff)
+			Expect(CheckRetarget(prev, header(params.LwmaHeight+44, 0x1f07ffff), params)).To(Succeed())
+		})
+		It("should accept any target on testnet", func() {
+			prev := window(600000, 1, 0x1d00ffff)
+			Expect(CheckRetarget(prev, header(600000, 0x1f07ffff), &address.TestNetParams)).To(Succeed())
+		})
+	})
+
+	Describe("CompactToBig", func() {
+		It("should decode the compact targets", func() {
+			Expect(CompactToBig(0x1d00ffff).Text(16)).To(Equal("ffff" + "0000000000000000000000000000000000000000000000000000"))
+			Expect(CompactToBig(0x03123456).Int64()).To(Equal(int64(0x123456)))
+			Expect(CompactToBig(0x01123456).Int64()).To(Equal(int64(0x12)))
+			Expect(CompactToBig(0x04923456).Sign()).To(Equal(-1))
+		})
+	})
+})
@@ -0,0 +1,166 @@
+// Package merkle verifies that transactions are committed in the best
+// chain without trusting the RPC node: the gettxoutproof partial merkle tree
+// is checked against the header's merkle root, and the header is linked to
+// the tip through locally hashed, proof-of-work checked headers.
+package merkle
+
+import (
+	"errors"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// maxTransactions bounds the transaction count of a merkle block, as the
+// smallest transaction weighs 240 in a 4M weight block
+const maxTransactions = 4000000 / 240
+
+// ErrBadProof is returned for a malformed or non-canonical partial merkle tree
+var ErrBadProof = errors.New("merkle: malformed partial merkle tree")
+
+// hashPair returns the parent node of left and right
+func hashPair(left, right wire.Hash) wire.Hash {
+	var b [2 * wire.HashSize]byte
+	copy(b[:wire.HashSize], left[:])
+	copy(b[wire.HashSize:], right[:])
+	return wire.DoubleHash(b[:])
+}
+
+// Root computes the merkle root of a block's transaction ids
+func Root(txids []wire.Hash) wire.Hash {
+	if len(txids) == 0 {
+		return wire.Hash{}
+	}
+	level := append([]wire.Hash{}, txids...)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([]wire.Hash, len(level)/2)
+		for i := range next {
+			next[i] = hashPair(level[2*i], level[2*i+1])
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// A partialTree walks the depth-first encoding of a partial merkle tree,
+// following CPartialMerkleTree in bitcoind
+type partialTree struct {
+	transactions uint32
+	hashes       []wire.Hash
+	bits         []bool
+
+	bitsUsed, hashesUsed int
+	matches              []wire.Hash
+	indexes              []uint32
+	bad                  bool
+}
+
+// width returns the number of nodes at height, leaves being height 0
+func (t *partialTree) width(height uint) uint32 {
+	return uint32((uint64(t.transactions) + (1 << height) - 1) >> height)
+}
+
+func (t *partialTree) extract(height uint, pos uint32) wire.Hash {
+	if t.bitsUsed >= len(t.bits) {
+		t.bad = true
+		return wire.Hash{}
+	}
+	parentOfMatch := t.bits[t.bitsUsed]
+	t.bitsUsed++
+	if height == 0 || !parentOfMatch {
+		if t.hashesUsed >= len(t.hashes) {
+			t.bad = true
+			return wire.Hash{}
+		}
+		h := t.hashes[t.hashesUsed]
+		t.hashesUsed++
+		if height == 0 && parentOfMatch {
+			t.matches = append(t.matches, h)
+			t.indexes = append(t.indexes, pos)
+		}
+		return h
+	}
+	left := t.extract(height-1, pos*2)
+	right := left
+	if pos*2+1 < t.width(height-1) {
+		right = t.extract(height-1, pos*2+1)
+		// identical siblings would allow the CVE-2012-2459 duplication
+		if right == left {
+			t.bad = true
+		}
+	}
+	return hashPair(left, right)
+}
+
+// ExtractMatches returns the merkle root committed by the partial tree of mb
+// and the transactions it marks as matched, with their positions in the block
+func ExtractMatches(mb *wire.MsgMerkleBlock) (root wire.Hash, matches []wire.Hash, indexes []uint32, err error) {
+	t := &partialTree{transactions: mb.Transactions, hashes: mb.Hashes}
+	if t.transactions == 0 || t.transactions > maxTransactions ||
+		len(t.hashes) > int(t.transactions) || len(mb.Flags)*8 < len(t.hashes) {
+		return root, nil, nil, ErrBadProof
+	}
+	for i := 0; i < len(mb.Flags)*8; i++ {
+		t.bits = append(t.bits, mb.Flags[i/8]&(1<<uint(i%8)) != 0)
+	}
+
+	var height uint
+	for t.width(height) > 1 {
+		height++
+	}
+	root = t.extract(height, 0)
+	if t.bad || (t.bitsUsed+7)/8 != len(mb.Flags) || t.hashesUsed != len(t.hashes) {
+		return wire.Hash{}, nil, nil, ErrBadProof
+	}
+	return root, t.matches, t.indexes, nil
+}
+
+// PartialTree builds the hashes and flags proving the transactions for which
+// match is true, the inverse of ExtractMatches
+func PartialTree(txids []wire.Hash, match []bool) (hashes []wire.Hash, flags []byte) {
+	t := &partialTree{transactions: uint32(len(txids))}
+	var height uint
+	for t.width(height) > 1 {
+		height++
+	}
+	var bits []bool
+	var build func(height uint, pos uint32)
+	build = func(height uint, pos uint32) {
+		parentOfMatch := false
+		for p := uint64(pos) << height; p < uint64(pos+1)<<height && p < uint64(len(txids)); p++ {
+			parentOfMatch = parentOfMatch || match[p]
+		}
+		bits = append(bits, parentOfMatch)
+		if height == 0 || !parentOfMatch {
+			hashes = append(hashes, t.nodeHash(height, pos, txids))
+			return
+		}
+		build(height-1, pos*2)
+		if pos*2+1 < t.width(height-1) {
+			build(height-1, pos*2+1)
+		}
+	}
+	build(height, 0)
+
+	flags = make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		if b {
+			flags[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return hashes, flags
+}
+
+func (t *partialTree) nodeHash(height uint, pos uint32, txids []wire.Hash) wire.Hash {
+	if height == 0 {
+		return txids[pos]
+	}
+	left := t.nodeHash(height-1, pos*2, txids)
+	right := left
+	if pos*2+1 < t.width(height-1) {
+		right = t.nodeHash(height-1, pos*2+1, txids)
+	}
+	return hashPair(left, right)
+}
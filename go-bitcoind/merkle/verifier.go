@@ -0,0 +1,229 @@
+package merkle
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// DefaultMaxDepth is the number of headers walked towards the tip before
+// giving up on linking a block to it
+const DefaultMaxDepth = 1000
+
+var (
+	// ErrNotInBestChain is returned when the proven block is not an ancestor of the tip
+	ErrNotInBestChain = errors.New("merkle: block is not in the best chain")
+
+	// ErrBrokenChain is returned when a header served by the node does not link to its parent
+	ErrBrokenChain = errors.New("merkle: header does not link to its parent")
+
+	// ErrTooDeep is returned when the walk from the proven block reaches the
+	// maximum depth before the tip
+	ErrTooDeep = errors.New("merkle: block is deeper than the headers walked to the tip")
+
+	// ErrNotVerified is returned when the proven block is above the tip of
+	// the verified chain, which has not caught up yet
+	ErrNotVerified = errors.New("merkle: block is above the verified chain")
+)
+
+// Node is the part of the RPC client the verifier queries. *bitcoind.Bitcoind implements it.
+type Node interface {
+	GetTxOutProof(txids []string, blockHash string) (string, error)
+	GetBlockheader(blockHash string) (*bitcoind.BlockHeader, error)
+	GetRawBlockheader(blockHash string) (string, error)
+	GetBestBlockhash() (string, error)
+}
+
+// Chain is a hash chain whose headers were verified one by one from its
+// first block, such as the one the scanner stores. *store.Store implements
+// it.
+type Chain interface {
+	Tip() (*store.Tip, error)
+
+	// BlockHash returns store.ErrNoBlock below the first block
+	BlockHash(height uint64) (string, error)
+}
+
+// An Inclusion is a transaction verified to be in the best chain
+type Inclusion struct {
+	TxID      wire.Hash
+	BlockHash wire.Hash
+	Index     uint32
+
+	// The height in the header, committed to by the block hash after the
+	// fork
+	Height uint64
+
+	// The number of verified headers from the block to the tip, capped at the
+	// verifier's maximum depth in the verified chain
+	Confirmations int
+}
+
+// A Verifier checks deposits against proofs instead of trusting the node's
+// wallet RPCs
+type Verifier struct {
+	node     Node
+	chain    Chain
+	params   *address.Params
+	maxDepth int
+}
+
+// NewVerifier returns a verifier for the network params. The proven blocks
+// must be in chain, if not nil, from its first block on. A maxDepth of 0
+// uses DefaultMaxDepth.
+func NewVerifier(node Node, chain Chain, params *address.Params, maxDepth int) *Verifier {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	return &Verifier{node: node, chain: chain, params: params, maxDepth: maxDepth}
+}
+
+// VerifyTx fetches the inclusion proof of txid, checks it locally and links
+// its block to the best tip. blockHash may be empty if the node can locate
+// the transaction itself (txindex or unspent outputs).
+func (v *Verifier) VerifyTx(txid, blockHash string) (*Inclusion, error) {
+	id, err := wire.NewHashFromStr(txid)
+	if err != nil {
+		return nil, err
+	}
+	proofHex, err := v.node.GetTxOutProof([]string{txid}, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := VerifyProof(proofHex, id, v.params)
+	if err != nil {
+		return nil, err
+	}
+	if blockHash != "" && proof.BlockHash.String() != blockHash {
+		return nil, fmt.Errorf("merkle: proof is for block %s, expected %s", proof.BlockHash, blockHash)
+	}
+	confirmations, err := v.confirm(&proof.Header, proof.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	return &Inclusion{
+		TxID:          id,
+		BlockHash:     proof.BlockHash,
+		Index:         proof.Index,
+		Height:        uint64(proof.Header.Height),
+		Confirmations: confirmations,
+	}, nil
+}
+
+// confirm returns the confirmations of the proven block. In the verified
+// chain, the block must be the one stored at its height, committed to by its
+// hash since the fork, and is confirmed by the stored blocks. Blocks below
+// the chain are linked to the node's tip.
+func (v *Verifier) confirm(header *wire.BlockHeader, hash wire.Hash) (int, error) {
+	if v.chain == nil || header.Height < v.params.ForkHeight {
+		return v.linkToTip(header, hash)
+	}
+	confirmations, err := v.inChain(header, hash)
+	if err != nil {
+		return 0, err
+	}
+	if confirmations == 0 {
+		return v.linkToTip(header, hash)
+	}
+	return v.capped(confirmations), nil
+}
+
+// inChain returns the number of stored blocks from the block, 0 if the
+// verified chain does not reach down to its height
+func (v *Verifier) inChain(header *wire.BlockHeader, hash wire.Hash) (int, error) {
+	tip, err := v.chain.Tip()
+	if err != nil {
+		return 0, err
+	}
+	height := uint64(header.Height)
+	if tip == nil || height > tip.Height {
+		return 0, ErrNotVerified
+	}
+	stored, err := v.chain.BlockHash(height)
+	if err == store.ErrNoBlock {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if stored != hash.String() {
+		return 0, ErrNotInBestChain
+	}
+	return int(tip.Height - height + 1), nil
+}
+
+func (v *Verifier) capped(confirmations int) int {
+	if confirmations > v.maxDepth {
+		return v.maxDepth
+	}
+	return confirmations
+}
+
+// linkToTip follows the node's nextblockhash pointers from the block to the
+// best tip, hashing every header locally and checking that it commits to its
+// predecessor, meets its target within the network's limit and the
+// difficulty adjustment, and solves its Equihash. The walk stops at the
+// first block of the verified chain, which confirms the rest. It returns the
+// number of confirmations, or ErrTooDeep if neither is reached within the
+// maximum depth.
+func (v *Verifier) linkToTip(header *wire.BlockHeader, hash wire.Hash) (int, error) {
+	tip, err := v.node.GetBestBlockhash()
+	if err != nil {
+		return 0, err
+	}
+	window, err := NewWindow(v.node, header, v.params)
+	if err != nil {
+		return 0, err
+	}
+	confirmations := 1
+	for hash.String() != tip {
+		if confirmations >= v.maxDepth {
+			return 0, ErrTooDeep
+		}
+		info, err := v.node.GetBlockheader(hash.String())
+		if err != nil {
+			return 0, err
+		}
+		if info.Nextblockhash == "" {
+			return 0, ErrNotInBestChain
+		}
+		raw, err := v.node.GetRawBlockheader(info.Nextblockhash)
+		if err != nil {
+			return 0, err
+		}
+		next, err := wire.NewBlockHeaderFromHex(raw)
+		if err != nil {
+			return 0, err
+		}
+		nextHash := next.BlockHash(v.params.ForkHeight)
+		if nextHash.String() != info.Nextblockhash || next.PrevBlock != hash {
+			return 0, ErrBrokenChain
+		}
+		if header.Height >= v.params.ForkHeight && next.Height != header.Height+1 {
+			return 0, ErrBrokenChain
+		}
+		if err := CheckHeader(next, nextHash, v.params); err != nil {
+			return 0, err
+		}
+		if err := window.Check(next); err != nil {
+			return 0, err
+		}
+		window.Push(next)
+		header, hash = next, nextHash
+		confirmations++
+		if v.chain != nil && header.Height >= v.params.ForkHeight {
+			stored, err := v.inChain(header, hash)
+			if err != nil && err != ErrNotVerified {
+				return 0, err
+			}
+			if stored > 0 {
+				return v.capped(confirmations - 1 + stored), nil
+			}
+		}
+	}
+	return confirmations, nil
+}
@@ -0,0 +1,226 @@
+package merkle
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// fakeNode serves a chain of regtest headers and proofs of their transactions
+type fakeNode struct {
+	headers []*wire.BlockHeader
+	hashes  []wire.Hash
+	txids   [][]wire.Hash
+	next    map[string]string
+}
+
+func newFakeNode(blocks int) *fakeNode {
+	n := &fakeNode{next: make(map[string]string)}
+	var prev wire.Hash
+	for i := 0; i < blocks; i++ {
+		txids := []wire.Hash{wire.DoubleHash([]byte{byte(i), 0}), wire.DoubleHash([]byte{byte(i), 1})}
+		h := &wire.BlockHeader{Version: 4, PrevBlock: prev, MerkleRoot: Root(txids), Height: 3000 + uint32(i), Bits: 0x207fffff}
+		prev = mine(h)
+		if i > 0 {
+			n.next[n.hashes[i-1].String()] = prev.String()
+		}
+		n.headers = append(n.headers, h)
+		n.hashes = append(n.hashes, prev)
+		n.txids = append(n.txids, txids)
+	}
+	return n
+}
+
+// mine grinds the nonce until the header meets its target
+func mine(h *wire.BlockHeader) wire.Hash {
+	for {
+		hash := h.BlockHash(address.RegTestParams.ForkHeight)
+		if CheckProofOfWork(hash, h.Bits, address.RegTestParams.PowLimitBits) == nil {
+			return hash
+		}
+		h.Nonce[0]++
+	}
+}
+
+func (n *fakeNode) find(hash string) int {
+	for i, h := range n.hashes {
+		if h.String() == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *fakeNode) GetTxOutProof(txids []string, blockHash string) (string, error) {
+	for i, block := range n.txids {
+		for j, txid := range block {
+			if txid.String() == txids[0] {
+				return proofFor(block, *n.headers[i], j).Hex(), nil
+			}
+		}
+	}
+	return "", errors.New("Transaction not yet in block")
+}
+
+func (n *fakeNode) GetBlockheader(blockHash string) (*bitcoind.BlockHeader, error) {
+	if n.find(blockHash) < 0 {
+		return nil, errors.New("Block not found")
+	}
+	return &bitcoind.BlockHeader{Hash: blockHash, Nextblockhash: n.next[blockHash]}, nil
+}
+
+func (n *fakeNode) GetRawBlockheader(blockHash string) (string, error) {
+	i := n.find(blockHash)
+	if i < 0 {
+		return "", errors.New("Block not found")
+	}
+	return n.headers[i].Hex(), nil
+}
+
+func (n *fakeNode) GetBestBlockhash() (string, error) {
+	return n.hashes[len(n.hashes)-1].String(), nil
+}
+
+// fakeChain is a verified chain of hashes from the height start
+type fakeChain struct {
+	start  uint64
+	hashes []string
+}
+
+func (c *fakeChain) Tip() (*store.Tip, error) {
+	if len(c.hashes) == 0 {
+		return nil, nil
+	}
+	height := c.start + uint64(len(c.hashes)) - 1
+	return &store.Tip{Hash: c.hashes[len(c.hashes)-1], Height: height}, nil
+}
+
+func (c *fakeChain) BlockHash(height uint64) (string, error) {
+	if height < c.start || height >= c.start+uint64(len(c.hashes)) {
+		return "", store.ErrNoBlock
+	}
+	return c.hashes[height-c.start], nil
+}
+
+var _ = Describe("Verifier", func() {
+	var node *fakeNode
+
+	BeforeEach(func() {
+		node = newFakeNode(6)
+	})
+
+	It("should count the confirmations up to the tip", func() {
+		v := NewVerifier(node, nil, &address.RegTestParams, 0)
+		inc, err := v.VerifyTx(node.txids[2][1].String(), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inc.BlockHash).To(Equal(node.hashes[2]))
+		Expect(inc.Index).To(Equal(uint32(1)))
+		Expect(inc.Height).To(Equal(uint64(3002)))
+		Expect(inc.Confirmations).To(Equal(4))
+	})
+
+	It("should not verify a block the walk does not link to the tip within the maximum depth", func() {
+		v := NewVerifier(node, nil, &address.RegTestParams, 2)
+		_, err := v.VerifyTx(node.txids[0][0].String(), "")
+		Expect(err).To(Equal(ErrTooDeep))
+
+		v = NewVerifier(node, nil, &address.RegTestParams, 2)
+		inc, err := v.VerifyTx(node.txids[4][0].String(), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inc.Confirmations).To(Equal(2))
+	})
+
+	It("should reject a block that is not an ancestor of the tip", func() {
+		delete(node.next, node.hashes[3].String())
+		v := NewVerifier(node, nil, &address.RegTestParams, 0)
+		_, err := v.VerifyTx(node.txids[1][0].String(), "")
+		Expect(err).To(Equal(ErrNotInBestChain))
+	})
+
+	It("should reject a descendant that does not link to its parent", func() {
+		node.headers[4].PrevBlock = node.hashes[2]
+		node.hashes[4] = mine(node.headers[4])
+		node.next[node.hashes[3].String()] = node.hashes[4].String()
+		v := NewVerifier(node, nil, &address.RegTestParams, 0)
+		_, err := v.VerifyTx(node.txids[3][0].String(), "")
+		Expect(err).To(Equal(ErrBrokenChain))
+	})
+
+	It("should reject a descendant whose target rises too fast", func() {
+		strict := address.RegTestParams
+		strict.AllowMinDifficultyBlocks = false
+		strict.Digishield, strict.DigishieldHeight = address.Retarget{Window: 2, Num: 132, Den: 100}, 3000
+		for i := 1; i < 6; i++ {
+			node.headers[i].PrevBlock = node.hashes[i-1]
+			node.headers[i].Bits = 0x20000000 | 0x7fffff>>uint(i)
+			node.hashes[i] = mine(node.headers[i])
+			node.next[node.hashes[i-1].String()] = node.hashes[i].String()
+		}
+		v := NewVerifier(node, nil, &strict, 0)
+		_, err := v.VerifyTx(node.txids[1][0].String(), "")
+		Expect(err).NotTo(HaveOccurred())
+
+		node.headers[4].Bits = 0x207fffff
+		node.hashes[4] = mine(node.headers[4])
+		node.next[node.hashes[3].String()] = node.hashes[4].String()
+		node.headers[5].PrevBlock = node.hashes[4]
+		node.hashes[5] = mine(node.headers[5])
+		node.next[node.hashes[4].String()] = node.hashes[5].String()
+		_, err = v.VerifyTx(node.txids[1][0].String(), "")
+		Expect(err).To(Equal(ErrDifficultyDrop))
+	})
+
+	Describe("anchored to a verified chain", func() {
+		var chain *fakeChain
+
+		BeforeEach(func() {
+			// the chain verified the blocks from the second to the fifth
+			chain = &fakeChain{start: 3001}
+			for _, h := range node.hashes[1:5] {
+				chain.hashes = append(chain.hashes, h.String())
+			}
+		})
+
+		It("should count the confirmations from the verified tip", func() {
+			v := NewVerifier(node, chain, &address.RegTestParams, 0)
+			inc, err := v.VerifyTx(node.txids[2][0].String(), "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inc.Confirmations).To(Equal(3))
+		})
+		It("should reject a block the verified chain does not have", func() {
+			chain.hashes[1] = node.hashes[0].String()
+			v := NewVerifier(node, chain, &address.RegTestParams, 0)
+			_, err := v.VerifyTx(node.txids[2][0].String(), "")
+			Expect(err).To(Equal(ErrNotInBestChain))
+		})
+		It("should wait for the verified chain to reach the block", func() {
+			v := NewVerifier(node, chain, &address.RegTestParams, 0)
+			_, err := v.VerifyTx(node.txids[5][0].String(), "")
+			Expect(err).To(Equal(ErrNotVerified))
+		})
+		It("should link the blocks below the chain to its first block", func() {
+			v := NewVerifier(node, chain, &address.RegTestParams, 0)
+			inc, err := v.VerifyTx(node.txids[0][0].String(), "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inc.Confirmations).To(Equal(5))
+		})
+		It("should reject a block below the chain whose descendants leave it", func() {
+			chain.hashes[0] = node.hashes[0].String()
+			v := NewVerifier(node, chain, &address.RegTestParams, 0)
+			_, err := v.VerifyTx(node.txids[0][0].String(), "")
+			Expect(err).To(Equal(ErrNotInBestChain))
+		})
+	})
+
+	It("should reject a proof for another block than requested", func() {
+		v := NewVerifier(node, nil, &address.RegTestParams, 0)
+		_, err := v.VerifyTx(node.txids[1][0].String(), node.hashes[2].String())
+		Expect(err).To(HaveOccurred())
+	})
+})
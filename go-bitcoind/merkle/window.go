@@ -0,0 +1,75 @@
+package merkle
+
+import (
+	"fmt"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// HeaderSource serves raw headers by hash. The Node of the verifier and the
+// one of the scanner implement it.
+type HeaderSource interface {
+	GetRawBlockheader(blockHash string) (string, error)
+}
+
+// A Window holds the last headers of a chain, as many as the difficulty
+// adjustment of the next header averages, to check its target
+type Window struct {
+	params  *address.Params
+	headers []*wire.BlockHeader
+	size    int
+}
+
+// NewWindow returns the window ending with tip, whose ancestors are fetched
+// from node by their hashes, as far back as the target of its child needs
+func NewWindow(node HeaderSource, tip *wire.BlockHeader, params *address.Params) (*Window, error) {
+	w := &Window{params: params, headers: []*wire.BlockHeader{tip}, size: 1}
+	for _, r := range []address.Retarget{params.Digishield, params.Lwma} {
+		if r.Window > w.size {
+			w.size = r.Window
+		}
+	}
+	if params.AllowMinDifficultyBlocks || tip.Height < params.ForkHeight {
+		return w, nil
+	}
+	r, start := params.RetargetAt(tip.Height + 1)
+	if r.Window == 0 || tip.Height+1 < start+uint32(r.Window) {
+		return w, nil
+	}
+	for oldest := tip; len(w.headers) < r.Window; {
+		raw, err := node.GetRawBlockheader(oldest.PrevBlock.String())
+		if err != nil {
+			return nil, err
+		}
+		h, err := wire.NewBlockHeaderFromHex(raw)
+		if err != nil {
+			return nil, err
+		}
+		if h.BlockHash(params.ForkHeight) != oldest.PrevBlock || h.Height+1 != oldest.Height {
+			return nil, fmt.Errorf("merkle: header %s: %v", oldest.PrevBlock, ErrBrokenChain)
+		}
+		w.headers = append([]*wire.BlockHeader{h}, w.headers...)
+		oldest = h
+	}
+	return w, nil
+}
+
+// Check checks the target of next, the child of the last header, with
+// CheckRetarget
+func (w *Window) Check(next *wire.BlockHeader) error {
+	return CheckRetarget(w.headers, next, w.params)
+}
+
+// Push appends the checked child of the last header
+func (w *Window) Push(next *wire.BlockHeader) {
+	w.headers = append(w.headers, next)
+	if len(w.headers) > w.size {
+		w.headers = w.headers[len(w.headers)-w.size:]
+	}
+}
+
+// Last returns the last header of the window
+func (w *Window) Last() *wire.BlockHeader {
+	return w.headers[len(w.headers)-1]
+}
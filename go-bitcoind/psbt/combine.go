@@ -0,0 +1,168 @@
+package psbt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrDifferentTx is returned when combining packets of different transactions
+var ErrDifferentTx = errors.New("psbt: packets spend different transactions")
+
+// Combine merges the signatures and metadata of several packets of the same
+// transaction into a copy of the first one, as combinepsbt does
+func Combine(packets ...*Packet) (*Packet, error) {
+	if len(packets) == 0 {
+		return nil, errors.New("psbt: nothing to combine")
+	}
+	out := packets[0].Copy()
+	txid := out.UnsignedTx.TxHash()
+	for _, p := range packets[1:] {
+		if p.UnsignedTx.TxHash() != txid {
+			return nil, ErrDifferentTx
+		}
+		for _, x := range p.XPubs {
+			if !hasXPub(out.XPubs, x.ExtendedKey) {
+				out.XPubs = append(out.XPubs, x)
+			}
+		}
+		out.Unknowns = mergeUnknowns(out.Unknowns, p.Unknowns)
+		for i, in := range p.Inputs {
+			mergeInput(out.Inputs[i], in)
+		}
+		for i, o := range p.Outputs {
+			dst := out.Outputs[i]
+			if dst.RedeemScript == nil {
+				dst.RedeemScript = o.RedeemScript
+			}
+			if dst.WitnessScript == nil {
+				dst.WitnessScript = o.WitnessScript
+			}
+			for _, d := range o.Bip32Derivation {
+				dst.Bip32Derivation = addDerivation(dst.Bip32Derivation, d)
+			}
+			dst.Unknowns = mergeUnknowns(dst.Unknowns, o.Unknowns)
+		}
+	}
+	return out.Copy(), nil
+}
+
+func mergeInput(dst, src *Input) {
+	if dst.NonWitnessUtxo == nil {
+		dst.NonWitnessUtxo = src.NonWitnessUtxo
+	}
+	if dst.WitnessUtxo == nil {
+		dst.WitnessUtxo = src.WitnessUtxo
+	}
+	if dst.FinalScriptSig == nil && dst.FinalScriptWitness == nil {
+		dst.FinalScriptSig = src.FinalScriptSig
+		dst.FinalScriptWitness = src.FinalScriptWitness
+	}
+	if dst.SighashType == 0 {
+		dst.SighashType = src.SighashType
+	}
+	if dst.RedeemScript == nil {
+		dst.RedeemScript = src.RedeemScript
+	}
+	if dst.WitnessScript == nil {
+		dst.WitnessScript = src.WitnessScript
+	}
+	for _, s := range src.PartialSigs {
+		if findSig(dst.PartialSigs, s.PubKey) == nil {
+			dst.PartialSigs = append(dst.PartialSigs, s)
+		}
+	}
+	for _, d := range src.Bip32Derivation {
+		dst.Bip32Derivation = addDerivation(dst.Bip32Derivation, d)
+	}
+	dst.Unknowns = mergeUnknowns(dst.Unknowns, src.Unknowns)
+}
+
+func hasXPub(xs []*XPub, key []byte) bool {
+	for _, x := range xs {
+		if bytes.Equal(x.ExtendedKey, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeUnknowns(dst, src []*Unknown) []*Unknown {
+	for _, u := range src {
+		found := false
+		for _, d := range dst {
+			if bytes.Equal(d.Key, u.Key) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, u)
+		}
+	}
+	return dst
+}
+
+// InputStatus summarizes the signatures collected for an input
+type InputStatus struct {
+	// The number of signatures the input script requires
+	Required int
+
+	// The number of valid signatures present
+	Signed int
+
+	// Whether the input already has its final script sig or witness
+	Finalized bool
+
+	// The keys of the script that have signed, and those that have not
+	SignedBy [][]byte
+	Missing  [][]byte
+}
+
+// Complete reports whether the input can be finalized
+func (s *InputStatus) Complete() bool {
+	return s.Finalized || s.Signed >= s.Required
+}
+
+// SignatureStatus reports how many of the required signatures input idx holds.
+// Signatures that do not verify are not counted.
+func (p *Packet) SignatureStatus(idx int) (*InputStatus, error) {
+	in, err := p.input(idx)
+	if err != nil {
+		return nil, err
+	}
+	if in.FinalScriptSig != nil || in.FinalScriptWitness != nil {
+		return &InputStatus{Finalized: true}, nil
+	}
+	s, _, err := p.signingScript(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &InputStatus{Required: s.required}
+	keys := s.pubKeys
+	if s.multisig == nil {
+		keys = nil
+		for _, ps := range in.PartialSigs {
+			keys = append(keys, ps.PubKey)
+		}
+	}
+	for _, k := range keys {
+		sig := findSig(in.PartialSigs, k)
+		if sig != nil && p.VerifyPartialSig(idx, &PartialSig{PubKey: k, Signature: sig}) == nil {
+			status.Signed++
+			status.SignedBy = append(status.SignedBy, k)
+		} else if s.multisig != nil {
+			status.Missing = append(status.Missing, k)
+		}
+	}
+	return status, nil
+}
+
+// String returns a short m-of-n summary
+func (s *InputStatus) String() string {
+	if s.Finalized {
+		return "finalized"
+	}
+	return fmt.Sprintf("%d of %d signatures", s.Signed, s.Required)
+}
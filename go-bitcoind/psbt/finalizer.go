@@ -0,0 +1,121 @@
+package psbt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/script"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// ErrNotEnoughSignatures is returned when finalizing an input below its threshold
+var ErrNotEnoughSignatures = errors.New("psbt: not enough signatures to finalize")
+
+// ErrIncomplete is returned when extracting a packet with unfinalized inputs
+var ErrIncomplete = errors.New("psbt: packet is not finalized")
+
+// Finalize builds the final script sig and witness of input idx from its
+// partial signatures and drops the signing data, as finalizepsbt does
+func (p *Packet) Finalize(idx int) error {
+	s, _, err := p.signingScript(idx)
+	if err != nil {
+		return err
+	}
+	in := p.Inputs[idx]
+	if in.FinalScriptSig != nil || in.FinalScriptWitness != nil {
+		return nil
+	}
+
+	var stack [][]byte
+	if s.multisig != nil {
+		// CHECKMULTISIG consumes signatures in key order, plus the dummy element
+		stack = append(stack, []byte{})
+		for _, k := range s.pubKeys {
+			if len(stack)-1 == s.required {
+				break
+			}
+			if sig := findSig(in.PartialSigs, k); sig != nil {
+				stack = append(stack, sig)
+			}
+		}
+		if len(stack)-1 < s.required {
+			return ErrNotEnoughSignatures
+		}
+		stack = append(stack, s.multisig)
+	} else {
+		if len(in.PartialSigs) == 0 {
+			return ErrNotEnoughSignatures
+		}
+		ps := in.PartialSigs[0]
+		stack = append(stack, ps.Signature)
+		if script.Classify(s.scriptCode) != script.PubKey {
+			stack = append(stack, ps.PubKey)
+		}
+	}
+
+	if s.witness {
+		if s.multisig == nil && len(stack) != 2 {
+			return fmt.Errorf("psbt: input %d cannot be finalized as P2WPKH", idx)
+		}
+		in.FinalScriptWitness = stack
+		in.FinalScriptSig = []byte{}
+		if s.nested {
+			in.FinalScriptSig, err = script.NewBuilder().AddData(in.RedeemScript).Script()
+		}
+	} else {
+		b := script.NewBuilder()
+		for _, item := range stack {
+			b.AddData(item)
+		}
+		if s.nested {
+			b.AddData(in.RedeemScript)
+		}
+		in.FinalScriptSig, err = b.Script()
+	}
+	if err != nil {
+		return err
+	}
+
+	in.PartialSigs = nil
+	in.SighashType = 0
+	in.RedeemScript = nil
+	in.WitnessScript = nil
+	in.Bip32Derivation = nil
+	return nil
+}
+
+func findSig(sigs []*PartialSig, pubKey []byte) []byte {
+	for _, s := range sigs {
+		if bytes.Equal(s.PubKey, pubKey) {
+			return s.Signature
+		}
+	}
+	return nil
+}
+
+// FinalizeAll finalizes every input, stopping at the first failure
+func (p *Packet) FinalizeAll() error {
+	for i := range p.Inputs {
+		if err := p.Finalize(i); err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Extract returns the network serializable transaction of a finalized packet
+func (p *Packet) Extract() (*wire.MsgTx, error) {
+	if !p.IsComplete() {
+		return nil, ErrIncomplete
+	}
+	tx := p.UnsignedTx.Copy()
+	for i, in := range p.Inputs {
+		tx.TxIn[i].SignatureScript = append([]byte{}, in.FinalScriptSig...)
+		tx.TxIn[i].Witness = nil
+		for _, item := range in.FinalScriptWitness {
+			tx.TxIn[i].Witness = append(tx.TxIn[i].Witness, append([]byte{}, item...))
+		}
+	}
+	return tx, nil
+}
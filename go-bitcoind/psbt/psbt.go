@@ -0,0 +1,578 @@
+// Package psbt builds, updates, signs, combines and finalizes BIP174 partially
+// signed Bitcoin Gold transactions in-process, in the base64 format understood
+// by bitcoind's decodepsbt, combinepsbt and finalizepsbt.
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// magic is the "psbt" prefix followed by the 0xff separator
+var magic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// Global key types
+const (
+	globalUnsignedTx = 0x00
+	globalXPub       = 0x01
+	globalVersion    = 0xfb
+)
+
+// Input key types
+const (
+	inNonWitnessUtxo     = 0x00
+	inWitnessUtxo        = 0x01
+	inPartialSig         = 0x02
+	inSighashType        = 0x03
+	inRedeemScript       = 0x04
+	inWitnessScript      = 0x05
+	inBip32Derivation    = 0x06
+	inFinalScriptSig     = 0x07
+	inFinalScriptWitness = 0x08
+)
+
+// Output key types
+const (
+	outRedeemScript    = 0x00
+	outWitnessScript   = 0x01
+	outBip32Derivation = 0x02
+)
+
+var (
+	// ErrInvalidMagic is returned when the data does not start with the psbt magic
+	ErrInvalidMagic = errors.New("psbt: invalid magic bytes")
+
+	// ErrDuplicateKey is returned when a map holds the same key twice
+	ErrDuplicateKey = errors.New("psbt: duplicate key")
+
+	// ErrInvalidPsbtFormat is returned on any other malformed content
+	ErrInvalidPsbtFormat = errors.New("psbt: invalid format")
+)
+
+// An Unknown is a key-value pair this package does not interpret.
+// It is kept so the packet round trips unchanged.
+type Unknown struct {
+	Key   []byte
+	Value []byte
+}
+
+// A Bip32Derivation records the origin of a public key
+type Bip32Derivation struct {
+	PubKey      []byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+// A PartialSig is a signature of one of the input's keys, including the sighash byte
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// An XPub is a global extended public key with its origin
+type XPub struct {
+	ExtendedKey []byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+// An Input holds the per-input data of a packet
+type Input struct {
+	NonWitnessUtxo     *wire.MsgTx
+	WitnessUtxo        *wire.TxOut
+	PartialSigs        []*PartialSig
+	SighashType        SigHashType
+	RedeemScript       []byte
+	WitnessScript      []byte
+	Bip32Derivation    []*Bip32Derivation
+	FinalScriptSig     []byte
+	FinalScriptWitness [][]byte
+	Unknowns           []*Unknown
+}
+
+// An Output holds the per-output data of a packet
+type Output struct {
+	RedeemScript    []byte
+	WitnessScript   []byte
+	Bip32Derivation []*Bip32Derivation
+	Unknowns        []*Unknown
+}
+
+// A Packet is a partially signed transaction
+type Packet struct {
+	UnsignedTx *wire.MsgTx
+	XPubs      []*XPub
+	Version    uint32
+	Unknowns   []*Unknown
+	Inputs     []*Input
+	Outputs    []*Output
+}
+
+// New creates a packet around an unsigned transaction.
+// Every input must have empty script sigs and witnesses.
+func New(tx *wire.MsgTx) (*Packet, error) {
+	for i, in := range tx.TxIn {
+		if len(in.SignatureScript) != 0 || len(in.Witness) != 0 {
+			return nil, fmt.Errorf("psbt: input %d of the unsigned transaction is signed", i)
+		}
+	}
+	p := &Packet{UnsignedTx: tx.Copy()}
+	for range tx.TxIn {
+		p.Inputs = append(p.Inputs, &Input{})
+	}
+	for range tx.TxOut {
+		p.Outputs = append(p.Outputs, &Output{})
+	}
+	return p, nil
+}
+
+// NewFromBase64 parses a base64 packet as returned by walletcreatefundedpsbt
+func NewFromBase64(s string) (*Packet, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(bytes.NewReader(b))
+}
+
+// B64Encode returns the base64 serialization of the packet
+func (p *Packet) B64Encode() (string, error) {
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// Copy returns a deep copy of the packet
+func (p *Packet) Copy() *Packet {
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		panic(err)
+	}
+	c, err := Parse(&buf)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+type kv struct {
+	key   []byte
+	value []byte
+}
+
+// readMap reads key-value pairs up to the 0x00 separator
+func readMap(r io.Reader) ([]kv, error) {
+	var pairs []kv
+	seen := make(map[string]bool)
+	for {
+		key, err := wire.ReadVarBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			return pairs, nil
+		}
+		value, err := wire.ReadVarBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if seen[string(key)] {
+			return nil, ErrDuplicateKey
+		}
+		seen[string(key)] = true
+		pairs = append(pairs, kv{key, value})
+	}
+}
+
+func writePair(w io.Writer, keyType byte, keyData, value []byte) error {
+	if err := wire.WriteVarBytes(w, append([]byte{keyType}, keyData...)); err != nil {
+		return err
+	}
+	return wire.WriteVarBytes(w, value)
+}
+
+func parseDerivation(value []byte) (uint32, []uint32, error) {
+	if len(value) < 4 || len(value)%4 != 0 {
+		return 0, nil, ErrInvalidPsbtFormat
+	}
+	fp := binary.LittleEndian.Uint32(value)
+	var path []uint32
+	for i := 4; i < len(value); i += 4 {
+		path = append(path, binary.LittleEndian.Uint32(value[i:]))
+	}
+	return fp, path, nil
+}
+
+func serializeDerivation(fp uint32, path []uint32) []byte {
+	b := make([]byte, 4+4*len(path))
+	binary.LittleEndian.PutUint32(b, fp)
+	for i, p := range path {
+		binary.LittleEndian.PutUint32(b[4+4*i:], p)
+	}
+	return b
+}
+
+func validPubKey(b []byte) bool {
+	return (len(b) == 33 && (b[0] == 2 || b[0] == 3)) || (len(b) == 65 && b[0] == 4)
+}
+
+// Parse reads a binary packet
+func Parse(r io.Reader) (*Packet, error) {
+	var m [5]byte
+	if _, err := io.ReadFull(r, m[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(m[:], magic) {
+		return nil, ErrInvalidMagic
+	}
+
+	globals, err := readMap(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &Packet{}
+	for _, pair := range globals {
+		switch pair.key[0] {
+		case globalUnsignedTx:
+			if len(pair.key) != 1 {
+				return nil, ErrInvalidPsbtFormat
+			}
+			tx := &wire.MsgTx{}
+			if err := tx.Deserialize(bytes.NewReader(pair.value)); err != nil {
+				return nil, err
+			}
+			p.UnsignedTx = tx
+		case globalXPub:
+			fp, path, err := parseDerivation(pair.value)
+			if err != nil || len(pair.key) != 79 {
+				return nil, ErrInvalidPsbtFormat
+			}
+			p.XPubs = append(p.XPubs, &XPub{ExtendedKey: pair.key[1:], Fingerprint: fp, Path: path})
+		case globalVersion:
+			if len(pair.key) != 1 || len(pair.value) != 4 {
+				return nil, ErrInvalidPsbtFormat
+			}
+			p.Version = binary.LittleEndian.Uint32(pair.value)
+			if p.Version != 0 {
+				return nil, fmt.Errorf("psbt: unsupported version %d", p.Version)
+			}
+		default:
+			p.Unknowns = append(p.Unknowns, &Unknown{Key: pair.key, Value: pair.value})
+		}
+	}
+	if p.UnsignedTx == nil {
+		return nil, errors.New("psbt: missing unsigned transaction")
+	}
+	for i, in := range p.UnsignedTx.TxIn {
+		if len(in.SignatureScript) != 0 || len(in.Witness) != 0 {
+			return nil, fmt.Errorf("psbt: input %d of the unsigned transaction is signed", i)
+		}
+	}
+
+	for range p.UnsignedTx.TxIn {
+		pairs, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		in, err := parseInput(pairs)
+		if err != nil {
+			return nil, err
+		}
+		p.Inputs = append(p.Inputs, in)
+	}
+	for range p.UnsignedTx.TxOut {
+		pairs, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		out, err := parseOutput(pairs)
+		if err != nil {
+			return nil, err
+		}
+		p.Outputs = append(p.Outputs, out)
+	}
+	return p, nil
+}
+
+func parseInput(pairs []kv) (*Input, error) {
+	in := &Input{}
+	for _, pair := range pairs {
+		keyData := pair.key[1:]
+		switch pair.key[0] {
+		case inNonWitnessUtxo:
+			tx := &wire.MsgTx{}
+			if len(keyData) != 0 {
+				return nil, ErrInvalidPsbtFormat
+			}
+			if err := tx.Deserialize(bytes.NewReader(pair.value)); err != nil {
+				return nil, err
+			}
+			in.NonWitnessUtxo = tx
+		case inWitnessUtxo:
+			r := bytes.NewReader(pair.value)
+			var v [8]byte
+			if len(keyData) != 0 {
+				return nil, ErrInvalidPsbtFormat
+			}
+			if _, err := io.ReadFull(r, v[:]); err != nil {
+				return nil, err
+			}
+			script, err := wire.ReadVarBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			in.WitnessUtxo = &wire.TxOut{Value: int64(binary.LittleEndian.Uint64(v[:])), PkScript: script}
+		case inPartialSig:
+			if !validPubKey(keyData) {
+				return nil, ErrInvalidPsbtFormat
+			}
+			in.PartialSigs = append(in.PartialSigs, &PartialSig{PubKey: keyData, Signature: pair.value})
+		case inSighashType:
+			if len(keyData) != 0 || len(pair.value) != 4 {
+				return nil, ErrInvalidPsbtFormat
+			}
+			in.SighashType = SigHashType(binary.LittleEndian.Uint32(pair.value))
+		case inRedeemScript:
+			in.RedeemScript = pair.value
+		case inWitnessScript:
+			in.WitnessScript = pair.value
+		case inBip32Derivation:
+			fp, path, err := parseDerivation(pair.value)
+			if err != nil || !validPubKey(keyData) {
+				return nil, ErrInvalidPsbtFormat
+			}
+			in.Bip32Derivation = append(in.Bip32Derivation, &Bip32Derivation{PubKey: keyData, Fingerprint: fp, Path: path})
+		case inFinalScriptSig:
+			in.FinalScriptSig = pair.value
+		case inFinalScriptWitness:
+			witness, err := readWitness(pair.value)
+			if err != nil {
+				return nil, err
+			}
+			in.FinalScriptWitness = witness
+		default:
+			in.Unknowns = append(in.Unknowns, &Unknown{Key: pair.key, Value: pair.value})
+		}
+	}
+	return in, nil
+}
+
+func parseOutput(pairs []kv) (*Output, error) {
+	out := &Output{}
+	for _, pair := range pairs {
+		keyData := pair.key[1:]
+		switch pair.key[0] {
+		case outRedeemScript:
+			out.RedeemScript = pair.value
+		case outWitnessScript:
+			out.WitnessScript = pair.value
+		case outBip32Derivation:
+			fp, path, err := parseDerivation(pair.value)
+			if err != nil || !validPubKey(keyData) {
+				return nil, ErrInvalidPsbtFormat
+			}
+			out.Bip32Derivation = append(out.Bip32Derivation, &Bip32Derivation{PubKey: keyData, Fingerprint: fp, Path: path})
+		default:
+			out.Unknowns = append(out.Unknowns, &Unknown{Key: pair.key, Value: pair.value})
+		}
+	}
+	return out, nil
+}
+
+func readWitness(b []byte) ([][]byte, error) {
+	r := bytes.NewReader(b)
+	n, err := wire.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	var witness [][]byte
+	for i := uint64(0); i < n; i++ {
+		item, err := wire.ReadVarBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		witness = append(witness, item)
+	}
+	if r.Len() != 0 {
+		return nil, ErrInvalidPsbtFormat
+	}
+	return witness, nil
+}
+
+func serializeWitness(witness [][]byte) []byte {
+	var b bytes.Buffer
+	wire.WriteVarInt(&b, uint64(len(witness)))
+	for _, item := range witness {
+		wire.WriteVarBytes(&b, item)
+	}
+	return b.Bytes()
+}
+
+func writeUnknowns(w io.Writer, unknowns []*Unknown) error {
+	sorted := append([]*Unknown{}, unknowns...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].Key, sorted[j].Key) < 0 })
+	for _, u := range sorted {
+		if err := wire.WriteVarBytes(w, u.Key); err != nil {
+			return err
+		}
+		if err := wire.WriteVarBytes(w, u.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Serialize writes the binary packet
+func (p *Packet) Serialize(w io.Writer) error {
+	if _, err := w.Write(magic); err != nil {
+		return err
+	}
+
+	var tx bytes.Buffer
+	if err := p.UnsignedTx.SerializeNoWitness(&tx); err != nil {
+		return err
+	}
+	if err := writePair(w, globalUnsignedTx, nil, tx.Bytes()); err != nil {
+		return err
+	}
+	for _, x := range p.XPubs {
+		if err := writePair(w, globalXPub, x.ExtendedKey, serializeDerivation(x.Fingerprint, x.Path)); err != nil {
+			return err
+		}
+	}
+	if err := writeUnknowns(w, p.Unknowns); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	for _, in := range p.Inputs {
+		if err := in.serialize(w); err != nil {
+			return err
+		}
+	}
+	for _, out := range p.Outputs {
+		if err := out.serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *Input) serialize(w io.Writer) error {
+	if in.NonWitnessUtxo != nil {
+		var b bytes.Buffer
+		if err := in.NonWitnessUtxo.Serialize(&b); err != nil {
+			return err
+		}
+		if err := writePair(w, inNonWitnessUtxo, nil, b.Bytes()); err != nil {
+			return err
+		}
+	}
+	if in.WitnessUtxo != nil {
+		var b bytes.Buffer
+		var v [8]byte
+		binary.LittleEndian.PutUint64(v[:], uint64(in.WitnessUtxo.Value))
+		b.Write(v[:])
+		wire.WriteVarBytes(&b, in.WitnessUtxo.PkScript)
+		if err := writePair(w, inWitnessUtxo, nil, b.Bytes()); err != nil {
+			return err
+		}
+	}
+	if in.FinalScriptSig == nil && in.FinalScriptWitness == nil {
+		sigs := append([]*PartialSig{}, in.PartialSigs...)
+		sort.Slice(sigs, func(i, j int) bool { return bytes.Compare(sigs[i].PubKey, sigs[j].PubKey) < 0 })
+		for _, s := range sigs {
+			if err := writePair(w, inPartialSig, s.PubKey, s.Signature); err != nil {
+				return err
+			}
+		}
+		if in.SighashType != 0 {
+			var v [4]byte
+			binary.LittleEndian.PutUint32(v[:], uint32(in.SighashType))
+			if err := writePair(w, inSighashType, nil, v[:]); err != nil {
+				return err
+			}
+		}
+		if in.RedeemScript != nil {
+			if err := writePair(w, inRedeemScript, nil, in.RedeemScript); err != nil {
+				return err
+			}
+		}
+		if in.WitnessScript != nil {
+			if err := writePair(w, inWitnessScript, nil, in.WitnessScript); err != nil {
+				return err
+			}
+		}
+		if err := writeDerivations(w, inBip32Derivation, in.Bip32Derivation); err != nil {
+			return err
+		}
+	}
+	if in.FinalScriptSig != nil {
+		if err := writePair(w, inFinalScriptSig, nil, in.FinalScriptSig); err != nil {
+			return err
+		}
+	}
+	if in.FinalScriptWitness != nil {
+		if err := writePair(w, inFinalScriptWitness, nil, serializeWitness(in.FinalScriptWitness)); err != nil {
+			return err
+		}
+	}
+	if err := writeUnknowns(w, in.Unknowns); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+func (out *Output) serialize(w io.Writer) error {
+	if out.RedeemScript != nil {
+		if err := writePair(w, outRedeemScript, nil, out.RedeemScript); err != nil {
+			return err
+		}
+	}
+	if out.WitnessScript != nil {
+		if err := writePair(w, outWitnessScript, nil, out.WitnessScript); err != nil {
+			return err
+		}
+	}
+	if err := writeDerivations(w, outBip32Derivation, out.Bip32Derivation); err != nil {
+		return err
+	}
+	if err := writeUnknowns(w, out.Unknowns); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+func writeDerivations(w io.Writer, keyType byte, ds []*Bip32Derivation) error {
+	sorted := append([]*Bip32Derivation{}, ds...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].PubKey, sorted[j].PubKey) < 0 })
+	for _, d := range sorted {
+		if err := writePair(w, keyType, d.PubKey, serializeDerivation(d.Fingerprint, d.Path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsComplete reports whether every input is finalized
+func (p *Packet) IsComplete() bool {
+	for _, in := range p.Inputs {
+		if in.FinalScriptSig == nil && in.FinalScriptWitness == nil {
+			return false
+		}
+	}
+	return true
+}
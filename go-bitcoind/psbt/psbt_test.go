@@ -0,0 +1,217 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/script"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+func testKey(n byte) *secp256k1.PrivateKey {
+	b := make([]byte, 32)
+	b[31] = n
+	return secp256k1.PrivKeyFromBytes(b)
+}
+
+// multisigSpend returns a packet spending a 2-of-3 P2WSH output of the test keys
+func multisigSpend() (*Packet, []byte) {
+	var pubKeys [][]byte
+	for i := byte(1); i <= 3; i++ {
+		pubKeys = append(pubKeys, testKey(i).PubKey().SerializeCompressed())
+	}
+	witnessScript, err := script.SortedMultisigScript(2, pubKeys)
+	Expect(err).NotTo(HaveOccurred())
+	wsh := sha256.Sum256(witnessScript)
+
+	funding := wire.NewMsgTx(2)
+	funding.AddTxIn(&wire.TxIn{Sequence: wire.MaxTxInSequenceNum})
+	funding.AddTxOut(&wire.TxOut{Value: 150000000, PkScript: append([]byte{0x00, 0x20}, wsh[:]...)})
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: funding.TxHash(), Index: 0}, Sequence: wire.MaxTxInSequenceNum})
+	dest, _ := address.Decode("GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE5", &address.MainNetParams)
+	tx.AddTxOut(&wire.TxOut{Value: 149990000, PkScript: dest.ScriptPubKey()})
+
+	p, err := New(tx)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(p.AddInNonWitnessUtxo(0, funding)).To(Succeed())
+	Expect(p.AddInWitnessUtxo(0, funding.TxOut[0])).To(Succeed())
+	Expect(p.AddInWitnessScript(0, witnessScript)).To(Succeed())
+	return p, witnessScript
+}
+
+var _ = Describe("Packet", func() {
+	Describe("serialization", func() {
+		It("should round trip through base64", func() {
+			p, _ := multisigSpend()
+			Expect(p.Sign(0, testKey(1))).To(Succeed())
+			Expect(p.AddInBip32Derivation(0, &Bip32Derivation{PubKey: testKey(1).PubKey().SerializeCompressed(), Fingerprint: 0xdeadbeef, Path: []uint32{0x80000030, 0}})).To(Succeed())
+			p.Unknowns = append(p.Unknowns, &Unknown{Key: []byte{0xfc, 0x01}, Value: []byte("relayer")})
+
+			s, err := p.B64Encode()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s[:5]).To(Equal("cHNid"))
+			got, err := NewFromBase64(s)
+			Expect(err).NotTo(HaveOccurred())
+			again, err := got.B64Encode()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(again).To(Equal(s))
+			Expect(got.Inputs[0].PartialSigs).To(HaveLen(1))
+			Expect(got.Inputs[0].Bip32Derivation[0].Path).To(Equal([]uint32{0x80000030, 0}))
+			Expect(got.Unknowns).To(HaveLen(1))
+		})
+		It("should reject bad magic", func() {
+			_, err := Parse(bytes.NewReader([]byte("psbu\xff\x00")))
+			Expect(err).To(Equal(ErrInvalidMagic))
+		})
+		It("should reject duplicate keys", func() {
+			p, _ := multisigSpend()
+			var tx bytes.Buffer
+			Expect(p.UnsignedTx.SerializeNoWitness(&tx)).To(Succeed())
+			dup := bytes.NewBuffer(append([]byte{}, magic...))
+			for i := 0; i < 2; i++ {
+				Expect(writePair(dup, globalUnsignedTx, nil, tx.Bytes())).To(Succeed())
+			}
+			dup.WriteByte(0)
+			_, err := Parse(dup)
+			Expect(err).To(Equal(ErrDuplicateKey))
+		})
+	})
+
+	Describe("updating", func() {
+		It("should refuse a witness script of another output", func() {
+			p, _ := multisigSpend()
+			Expect(p.AddInWitnessScript(0, []byte{script.OP_TRUE})).NotTo(Succeed())
+		})
+		It("should refuse a funding transaction with another txid", func() {
+			p, _ := multisigSpend()
+			Expect(p.AddInNonWitnessUtxo(0, wire.NewMsgTx(1))).NotTo(Succeed())
+		})
+		It("should refuse a sighash type without fork id", func() {
+			p, _ := multisigSpend()
+			Expect(p.AddInSighashType(0, SigHashAll)).To(Equal(ErrNoForkID))
+		})
+		It("should compute the fee", func() {
+			p, _ := multisigSpend()
+			fee, err := p.Fee()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fee).To(Equal(int64(10000)))
+		})
+	})
+
+	Describe("multisig signing flow", func() {
+		It("should collect, combine and finalize 2 of 3 signatures", func() {
+			base, witnessScript := multisigSpend()
+
+			status, err := base.SignatureStatus(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Required).To(Equal(2))
+			Expect(status.Signed).To(Equal(0))
+			Expect(status.Missing).To(HaveLen(3))
+
+			a, b := base.Copy(), base.Copy()
+			Expect(a.Sign(0, testKey(1))).To(Succeed())
+			Expect(b.Sign(0, testKey(3))).To(Succeed())
+			Expect(a.Finalize(0)).To(Equal(ErrNotEnoughSignatures))
+
+			c, err := Combine(base, a, b)
+			Expect(err).NotTo(HaveOccurred())
+			status, err = c.SignatureStatus(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Signed).To(Equal(2))
+			Expect(status.Complete()).To(BeTrue())
+			Expect(status.Missing).To(Equal([][]byte{testKey(2).PubKey().SerializeCompressed()}))
+			Expect(status.String()).To(Equal("2 of 2 signatures"))
+
+			Expect(c.FinalizeAll()).To(Succeed())
+			Expect(c.IsComplete()).To(BeTrue())
+			Expect(c.Inputs[0].PartialSigs).To(BeNil())
+
+			tx, err := c.Extract()
+			Expect(err).NotTo(HaveOccurred())
+			w := tx.TxIn[0].Witness
+			Expect(w).To(HaveLen(4))
+			Expect(w[0]).To(BeEmpty())
+			Expect(w[3]).To(Equal(witnessScript))
+			Expect(w[1][len(w[1])-1]).To(Equal(byte(SigHashAllForkID)))
+			Expect(tx.TxIn[0].SignatureScript).To(BeEmpty())
+			Expect(tx.TxHash()).To(Equal(base.UnsignedTx.TxHash()))
+		})
+
+		It("should refuse keys outside the multisig", func() {
+			p, _ := multisigSpend()
+			Expect(p.Sign(0, testKey(4))).To(Equal(ErrKeyNotInScript))
+		})
+
+		It("should verify signatures received from peers", func() {
+			p, _ := multisigSpend()
+			Expect(p.Sign(0, testKey(2))).To(Succeed())
+			ps := p.Inputs[0].PartialSigs[0]
+
+			q, _ := multisigSpend()
+			Expect(q.AddPartialSig(0, ps)).To(Succeed())
+
+			forged := &PartialSig{PubKey: testKey(1).PubKey().SerializeCompressed(), Signature: ps.Signature}
+			Expect(q.AddPartialSig(0, forged)).To(Equal(ErrInvalidSignature))
+		})
+
+		It("should not combine packets of different transactions", func() {
+			p, _ := multisigSpend()
+			q, _ := multisigSpend()
+			q.UnsignedTx.LockTime = 1
+			_, err := Combine(p, q)
+			Expect(err).To(Equal(ErrDifferentTx))
+		})
+	})
+
+	Describe("single key inputs", func() {
+		It("should finalize a P2SH wrapped P2WPKH", func() {
+			key := testKey(7)
+			pub := key.PubKey().SerializeCompressed()
+			redeem := append([]byte{0x00, 0x14}, address.Hash160(pub)...)
+			spk := append(append([]byte{script.OP_HASH160, 20}, address.Hash160(redeem)...), script.OP_EQUAL)
+
+			tx := wire.NewMsgTx(2)
+			tx.AddTxIn(&wire.TxIn{Sequence: wire.MaxTxInSequenceNum})
+			tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: spk})
+			p, err := New(tx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.AddInWitnessUtxo(0, &wire.TxOut{Value: 2000, PkScript: spk})).To(Succeed())
+			Expect(p.AddInRedeemScript(0, redeem)).To(Succeed())
+			Expect(p.Sign(0, key)).To(Succeed())
+			Expect(p.Finalize(0)).To(Succeed())
+
+			final, err := p.Extract()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(final.TxIn[0].Witness).To(HaveLen(2))
+			Expect(final.TxIn[0].Witness[1]).To(Equal(pub))
+			Expect(final.TxIn[0].SignatureScript).To(Equal(append([]byte{22}, redeem...)))
+		})
+
+		It("should finalize a legacy P2PKH with a fork id signature", func() {
+			key := testKey(8)
+			a, _ := address.NewPubKeyHash(address.Hash160(key.PubKey().SerializeCompressed()), &address.MainNetParams)
+
+			tx := wire.NewMsgTx(1)
+			tx.AddTxIn(&wire.TxIn{Sequence: wire.MaxTxInSequenceNum})
+			tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: a.ScriptPubKey()})
+			p, err := New(tx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.AddInWitnessUtxo(0, &wire.TxOut{Value: 2000, PkScript: a.ScriptPubKey()})).To(Succeed())
+			Expect(p.Sign(0, key)).To(Succeed())
+			Expect(p.Finalize(0)).To(Succeed())
+			final, err := p.Extract()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(final.TxIn[0].Witness).To(BeEmpty())
+			ins, err := script.Parse(final.TxIn[0].SignatureScript)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ins).To(HaveLen(2))
+		})
+	})
+})
@@ -0,0 +1,112 @@
+package psbt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// SigHashType selects which parts of a transaction a signature commits to
+type SigHashType uint32
+
+// Signature hash types. Bitcoin Gold requires SigHashForkID on every signature.
+const (
+	SigHashAll          SigHashType = 0x01
+	SigHashNone         SigHashType = 0x02
+	SigHashSingle       SigHashType = 0x03
+	SigHashForkID       SigHashType = 0x40
+	SigHashAnyOneCanPay SigHashType = 0x80
+
+	// SigHashAllForkID is the default BTG signature hash type
+	SigHashAllForkID = SigHashAll | SigHashForkID
+
+	sigHashMask = 0x1f
+)
+
+// ForkIDBTG is the replay protection fork id mixed into every BTG signature hash
+const ForkIDBTG = 79
+
+// ErrNoForkID is returned when asked to sign without SIGHASH_FORKID, which BTG nodes reject
+var ErrNoForkID = errors.New("psbt: BTG signatures require SIGHASH_FORKID")
+
+// SignatureHash returns the BTG signature hash of input idx: the BIP143 digest
+// with the fork id shifted into the upper bytes of the hash type.
+// scriptCode is the witness script (P2WSH), the redeem script (P2SH), the
+// P2PKH script of the key (P2WPKH) or the output script (P2PKH).
+func SignatureHash(tx *wire.MsgTx, idx int, scriptCode []byte, amount int64, hashType SigHashType) ([]byte, error) {
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("psbt: input index %d out of range", idx)
+	}
+	if hashType&SigHashForkID == 0 {
+		return nil, ErrNoForkID
+	}
+	return witnessSignatureHash(tx, idx, scriptCode, amount, hashType, uint32(hashType)|ForkIDBTG<<8), nil
+}
+
+// witnessSignatureHash computes the BIP143 digest, committing to sigHashField
+// as the trailing hash type
+func witnessSignatureHash(tx *wire.MsgTx, idx int, scriptCode []byte, amount int64, hashType SigHashType, sigHashField uint32) []byte {
+	base := hashType & sigHashMask
+	anyoneCanPay := hashType&SigHashAnyOneCanPay != 0
+
+	var zero wire.Hash
+	hashPrevouts, hashSequence, hashOutputs := zero, zero, zero
+
+	if !anyoneCanPay {
+		var b bytes.Buffer
+		for _, in := range tx.TxIn {
+			b.Write(in.PreviousOutPoint.Hash[:])
+			writeUint32(&b, in.PreviousOutPoint.Index)
+		}
+		hashPrevouts = wire.DoubleHash(b.Bytes())
+	}
+	if !anyoneCanPay && base != SigHashSingle && base != SigHashNone {
+		var b bytes.Buffer
+		for _, in := range tx.TxIn {
+			writeUint32(&b, in.Sequence)
+		}
+		hashSequence = wire.DoubleHash(b.Bytes())
+	}
+	switch {
+	case base != SigHashSingle && base != SigHashNone:
+		var b bytes.Buffer
+		for _, out := range tx.TxOut {
+			writeUint64(&b, uint64(out.Value))
+			wire.WriteVarBytes(&b, out.PkScript)
+		}
+		hashOutputs = wire.DoubleHash(b.Bytes())
+	case base == SigHashSingle && idx < len(tx.TxOut):
+		var b bytes.Buffer
+		writeUint64(&b, uint64(tx.TxOut[idx].Value))
+		wire.WriteVarBytes(&b, tx.TxOut[idx].PkScript)
+		hashOutputs = wire.DoubleHash(b.Bytes())
+	}
+
+	in := tx.TxIn[idx]
+	var b bytes.Buffer
+	writeUint32(&b, uint32(tx.Version))
+	b.Write(hashPrevouts[:])
+	b.Write(hashSequence[:])
+	b.Write(in.PreviousOutPoint.Hash[:])
+	writeUint32(&b, in.PreviousOutPoint.Index)
+	wire.WriteVarBytes(&b, scriptCode)
+	writeUint64(&b, uint64(amount))
+	writeUint32(&b, in.Sequence)
+	b.Write(hashOutputs[:])
+	writeUint32(&b, tx.LockTime)
+	writeUint32(&b, sigHashField)
+
+	h := wire.DoubleHash(b.Bytes())
+	return h[:]
+}
+
+func writeUint32(b *bytes.Buffer, n uint32) {
+	b.Write([]byte{byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)})
+}
+
+func writeUint64(b *bytes.Buffer, n uint64) {
+	writeUint32(b, uint32(n))
+	writeUint32(b, uint32(n>>32))
+}
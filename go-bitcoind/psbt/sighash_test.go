@@ -0,0 +1,42 @@
+package psbt
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+var _ = Describe("SignatureHash", func() {
+	// BIP143 native P2WPKH example
+	tx, _ := wire.NewMsgTxFromHex("0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000")
+	scriptCode := mustHex("76a9141d0f172a0ecb48aee1be1f2687d2963ae33f71a188ac")
+
+	It("should compute the BIP143 digest", func() {
+		h := witnessSignatureHash(tx, 1, scriptCode, 600000000, SigHashAll, uint32(SigHashAll))
+		Expect(hex.EncodeToString(h)).To(Equal("c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670"))
+	})
+	It("should mix the BTG fork id into the hash type", func() {
+		h, err := SignatureHash(tx, 1, scriptCode, 600000000, SigHashAllForkID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h).To(Equal(witnessSignatureHash(tx, 1, scriptCode, 600000000, SigHashAllForkID, 0x4f41)))
+	})
+	It("should refuse hash types without SIGHASH_FORKID", func() {
+		_, err := SignatureHash(tx, 1, scriptCode, 600000000, SigHashAll)
+		Expect(err).To(Equal(ErrNoForkID))
+	})
+	It("should check the input index", func() {
+		_, err := SignatureHash(tx, 2, scriptCode, 600000000, SigHashAllForkID)
+		Expect(err).To(HaveOccurred())
+	})
+})
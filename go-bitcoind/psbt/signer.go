@@ -0,0 +1,198 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/script"
+)
+
+// ErrKeyNotInScript is returned when signing with a key the input script does not use
+var ErrKeyNotInScript = errors.New("psbt: key is not used by the input script")
+
+// ErrInvalidSignature is returned when a partial signature does not verify
+var ErrInvalidSignature = errors.New("psbt: invalid partial signature")
+
+// signingScript describes how an input is spent
+type signingScript struct {
+	// The script committed to by the signature hash
+	scriptCode []byte
+
+	// The keys allowed to sign, in script order
+	pubKeys [][]byte
+
+	// The number of signatures required
+	required int
+
+	// The multisig script (witness or redeem), nil for single key inputs
+	multisig []byte
+
+	// Whether the input is a witness spend, and whether it is P2SH wrapped
+	witness, nested bool
+}
+
+// signingScript resolves the script code and candidate keys of input idx
+func (p *Packet) signingScript(idx int) (*signingScript, int64, error) {
+	in, err := p.input(idx)
+	if err != nil {
+		return nil, 0, err
+	}
+	utxo, err := p.SpentOutput(idx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s := &signingScript{}
+	spk := utxo.PkScript
+	if script.Classify(spk) == script.ScriptHash {
+		if in.RedeemScript == nil {
+			return nil, 0, fmt.Errorf("psbt: missing redeem script of input %d", idx)
+		}
+		if !bytes.Equal(spk[2:22], address.Hash160(in.RedeemScript)) {
+			return nil, 0, fmt.Errorf("psbt: redeem script does not match input %d", idx)
+		}
+		spk = in.RedeemScript
+		s.nested = true
+	}
+
+	switch script.Classify(spk) {
+	case script.WitnessV0ScriptHash:
+		if in.WitnessScript == nil {
+			return nil, 0, fmt.Errorf("psbt: missing witness script of input %d", idx)
+		}
+		h := sha256.Sum256(in.WitnessScript)
+		if !bytes.Equal(spk[2:], h[:]) {
+			return nil, 0, fmt.Errorf("psbt: witness script does not match input %d", idx)
+		}
+		s.witness = true
+		s.scriptCode = in.WitnessScript
+	case script.WitnessV0KeyHash:
+		s.witness = true
+		s.scriptCode = append(append([]byte{script.OP_DUP, script.OP_HASH160, 20}, spk[2:]...), script.OP_EQUALVERIFY, script.OP_CHECKSIG)
+	default:
+		s.scriptCode = spk
+	}
+
+	if ms, err := script.ParseMultisig(s.scriptCode); err == nil {
+		s.pubKeys = ms.PubKeys
+		s.required = ms.Required
+		s.multisig = s.scriptCode
+	} else {
+		s.required = 1
+	}
+	return s, utxo.Value, nil
+}
+
+// owns reports whether pubKey may sign for the script
+func (s *signingScript) owns(pubKey []byte) bool {
+	if s.multisig != nil {
+		for _, k := range s.pubKeys {
+			if bytes.Equal(k, pubKey) {
+				return true
+			}
+		}
+		return false
+	}
+	switch script.Classify(s.scriptCode) {
+	case script.PubKeyHash:
+		return bytes.Equal(s.scriptCode[3:23], address.Hash160(pubKey))
+	case script.PubKey:
+		return bytes.Equal(s.scriptCode[1:len(s.scriptCode)-1], pubKey)
+	}
+	return false
+}
+
+func (p *Packet) hashType(idx int) SigHashType {
+	if t := p.Inputs[idx].SighashType; t != 0 {
+		return t
+	}
+	return SigHashAllForkID
+}
+
+// Sign adds the signature of privKey to input idx. The input sighash type is
+// used, SIGHASH_ALL|SIGHASH_FORKID when none is set.
+func (p *Packet) Sign(idx int, privKey *secp256k1.PrivateKey) error {
+	s, amount, err := p.signingScript(idx)
+	if err != nil {
+		return err
+	}
+	in := p.Inputs[idx]
+	if in.FinalScriptSig != nil || in.FinalScriptWitness != nil {
+		return fmt.Errorf("psbt: input %d is already finalized", idx)
+	}
+	pubKey := privKey.PubKey().SerializeCompressed()
+	if !s.owns(pubKey) {
+		return ErrKeyNotInScript
+	}
+
+	hashType := p.hashType(idx)
+	hash, err := SignatureHash(p.UnsignedTx, idx, s.scriptCode, amount, hashType)
+	if err != nil {
+		return err
+	}
+	sig := append(ecdsa.Sign(privKey, hash).Serialize(), byte(hashType))
+	in.PartialSigs = addPartialSig(in.PartialSigs, &PartialSig{PubKey: pubKey, Signature: sig})
+	return nil
+}
+
+// AddPartialSig adds a signature received from another signer after verifying it
+func (p *Packet) AddPartialSig(idx int, ps *PartialSig) error {
+	if err := p.VerifyPartialSig(idx, ps); err != nil {
+		return err
+	}
+	in := p.Inputs[idx]
+	in.PartialSigs = addPartialSig(in.PartialSigs, &PartialSig{
+		PubKey:    append([]byte{}, ps.PubKey...),
+		Signature: append([]byte{}, ps.Signature...),
+	})
+	return nil
+}
+
+// VerifyPartialSig checks that ps is a valid signature of input idx by a key of its script
+func (p *Packet) VerifyPartialSig(idx int, ps *PartialSig) error {
+	s, amount, err := p.signingScript(idx)
+	if err != nil {
+		return err
+	}
+	if !s.owns(ps.PubKey) {
+		return ErrKeyNotInScript
+	}
+	if len(ps.Signature) < 2 {
+		return ErrInvalidSignature
+	}
+	hashType := SigHashType(ps.Signature[len(ps.Signature)-1])
+	if want := p.hashType(idx); hashType != want&0xff {
+		return fmt.Errorf("psbt: signature hash type %#x, expected %#x", hashType, want)
+	}
+	hash, err := SignatureHash(p.UnsignedTx, idx, s.scriptCode, amount, hashType)
+	if err != nil {
+		return err
+	}
+	sig, err := ecdsa.ParseDERSignature(ps.Signature[:len(ps.Signature)-1])
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	key, err := secp256k1.ParsePubKey(ps.PubKey)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !sig.Verify(hash, key) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func addPartialSig(sigs []*PartialSig, ps *PartialSig) []*PartialSig {
+	for i, s := range sigs {
+		if bytes.Equal(s.PubKey, ps.PubKey) {
+			sigs[i] = ps
+			return sigs
+		}
+	}
+	return append(sigs, ps)
+}
@@ -0,0 +1,199 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/script"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// ErrMissingUtxo is returned when an input has no information about the output it spends
+var ErrMissingUtxo = errors.New("psbt: missing utxo of input")
+
+func (p *Packet) input(idx int) (*Input, error) {
+	if idx < 0 || idx >= len(p.Inputs) {
+		return nil, fmt.Errorf("psbt: input index %d out of range", idx)
+	}
+	return p.Inputs[idx], nil
+}
+
+func (p *Packet) output(idx int) (*Output, error) {
+	if idx < 0 || idx >= len(p.Outputs) {
+		return nil, fmt.Errorf("psbt: output index %d out of range", idx)
+	}
+	return p.Outputs[idx], nil
+}
+
+// AddInWitnessUtxo records the output spent by input idx
+func (p *Packet) AddInWitnessUtxo(idx int, out *wire.TxOut) error {
+	in, err := p.input(idx)
+	if err != nil {
+		return err
+	}
+	in.WitnessUtxo = &wire.TxOut{Value: out.Value, PkScript: append([]byte{}, out.PkScript...)}
+	return nil
+}
+
+// AddInNonWitnessUtxo records the full transaction spent by input idx
+func (p *Packet) AddInNonWitnessUtxo(idx int, tx *wire.MsgTx) error {
+	in, err := p.input(idx)
+	if err != nil {
+		return err
+	}
+	prev := p.UnsignedTx.TxIn[idx].PreviousOutPoint
+	if tx.TxHash() != prev.Hash {
+		return fmt.Errorf("psbt: transaction %s is not spent by input %d", tx.TxHash(), idx)
+	}
+	if int(prev.Index) >= len(tx.TxOut) {
+		return fmt.Errorf("psbt: transaction %s has no output %d", tx.TxHash(), prev.Index)
+	}
+	in.NonWitnessUtxo = tx.Copy()
+	return nil
+}
+
+// AddInRedeemScript records the P2SH redeem script of input idx
+func (p *Packet) AddInRedeemScript(idx int, redeemScript []byte) error {
+	in, err := p.input(idx)
+	if err != nil {
+		return err
+	}
+	if utxo, err := p.SpentOutput(idx); err == nil {
+		if script.Classify(utxo.PkScript) != script.ScriptHash ||
+			!bytes.Equal(utxo.PkScript[2:22], address.Hash160(redeemScript)) {
+			return fmt.Errorf("psbt: redeem script does not match the output spent by input %d", idx)
+		}
+	}
+	in.RedeemScript = append([]byte{}, redeemScript...)
+	return nil
+}
+
+// AddInWitnessScript records the P2WSH witness script of input idx
+func (p *Packet) AddInWitnessScript(idx int, witnessScript []byte) error {
+	in, err := p.input(idx)
+	if err != nil {
+		return err
+	}
+	if program, ok := p.witnessProgram(idx); ok {
+		h := sha256.Sum256(witnessScript)
+		if !bytes.Equal(program, h[:]) {
+			return fmt.Errorf("psbt: witness script does not match the output spent by input %d", idx)
+		}
+	}
+	in.WitnessScript = append([]byte{}, witnessScript...)
+	return nil
+}
+
+// AddInSighashType sets the signature hash type signers must use for input idx
+func (p *Packet) AddInSighashType(idx int, hashType SigHashType) error {
+	in, err := p.input(idx)
+	if err != nil {
+		return err
+	}
+	if hashType&SigHashForkID == 0 {
+		return ErrNoForkID
+	}
+	in.SighashType = hashType
+	return nil
+}
+
+// AddInBip32Derivation records the origin of a key used by input idx
+func (p *Packet) AddInBip32Derivation(idx int, d *Bip32Derivation) error {
+	in, err := p.input(idx)
+	if err != nil {
+		return err
+	}
+	if !validPubKey(d.PubKey) {
+		return errors.New("psbt: invalid public key in derivation")
+	}
+	in.Bip32Derivation = addDerivation(in.Bip32Derivation, d)
+	return nil
+}
+
+// AddOutWitnessScript records the witness script of output idx, e.g. the multisig change
+func (p *Packet) AddOutWitnessScript(idx int, witnessScript []byte) error {
+	out, err := p.output(idx)
+	if err != nil {
+		return err
+	}
+	out.WitnessScript = append([]byte{}, witnessScript...)
+	return nil
+}
+
+// AddOutBip32Derivation records the origin of a key used by output idx
+func (p *Packet) AddOutBip32Derivation(idx int, d *Bip32Derivation) error {
+	out, err := p.output(idx)
+	if err != nil {
+		return err
+	}
+	if !validPubKey(d.PubKey) {
+		return errors.New("psbt: invalid public key in derivation")
+	}
+	out.Bip32Derivation = addDerivation(out.Bip32Derivation, d)
+	return nil
+}
+
+func addDerivation(ds []*Bip32Derivation, d *Bip32Derivation) []*Bip32Derivation {
+	c := &Bip32Derivation{PubKey: append([]byte{}, d.PubKey...), Fingerprint: d.Fingerprint, Path: append([]uint32{}, d.Path...)}
+	for i, e := range ds {
+		if bytes.Equal(e.PubKey, d.PubKey) {
+			ds[i] = c
+			return ds
+		}
+	}
+	return append(ds, c)
+}
+
+// SpentOutput returns the output spent by input idx, from either utxo field
+func (p *Packet) SpentOutput(idx int) (*wire.TxOut, error) {
+	in, err := p.input(idx)
+	if err != nil {
+		return nil, err
+	}
+	if in.WitnessUtxo != nil {
+		return in.WitnessUtxo, nil
+	}
+	if in.NonWitnessUtxo != nil {
+		prev := p.UnsignedTx.TxIn[idx].PreviousOutPoint
+		if int(prev.Index) < len(in.NonWitnessUtxo.TxOut) {
+			return in.NonWitnessUtxo.TxOut[prev.Index], nil
+		}
+	}
+	return nil, ErrMissingUtxo
+}
+
+// witnessProgram returns the P2WSH program spent by input idx, looking
+// through a P2SH redeem script if there is one
+func (p *Packet) witnessProgram(idx int) ([]byte, bool) {
+	utxo, err := p.SpentOutput(idx)
+	if err != nil {
+		return nil, false
+	}
+	spk := utxo.PkScript
+	if r := p.Inputs[idx].RedeemScript; r != nil {
+		spk = r
+	}
+	if script.Classify(spk) != script.WitnessV0ScriptHash {
+		return nil, false
+	}
+	return spk[2:], true
+}
+
+// Fee returns the fee paid by the transaction; every input must carry its utxo
+func (p *Packet) Fee() (int64, error) {
+	var in, out int64
+	for i := range p.Inputs {
+		utxo, err := p.SpentOutput(i)
+		if err != nil {
+			return 0, err
+		}
+		in += utxo.Value
+	}
+	for _, o := range p.UnsignedTx.TxOut {
+		out += o.Value
+	}
+	return in - out, nil
+}
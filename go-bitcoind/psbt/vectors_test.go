@@ -0,0 +1,136 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Valid packets of the BIP174 test vectors
+const (
+	bip174P2PKH             = "70736274ff0100750200000001268171371edff285e937adeea4b37b78000c0566cbb3ad64641713ca42171bf60000000000feffffff02d3dff505000000001976a914d0c59903c5bac2868760e90fd521a4665aa7652088ac00e1f5050000000017a9143545e6e33b832c47050f24d3eeb93c9c03948bc787b32e1300000100fda5010100000000010289a3c71eab4d20e0371bbba4cc698fa295c9463afa2e397f8533ccb62f9567e50100000017160014be18d152a9b012039daf3da7de4f53349eecb985ffffffff86f8aa43a71dff1448893a530a7237ef6b4608bbb2dd2d0171e63aec6a4890b40100000017160014fe3e9ef1a745e974d902c4355943abcb34bd5353ffffffff0200c2eb0b000000001976a91485cff1097fd9e008bb34af709c62197b38978a4888ac72fef84e2c00000017a914339725ba21efd62ac753a9bcd067d6c7a6a39d05870247304402202712be22e0270f394f568311dc7ca9a68970b8025fdd3b240229f07f8a5f3a240220018b38d7dcd314e734c9276bd6fb40f673325bc4baa144c800d2f2f02db2765c012103d2e15674941bad4a996372cb87e1856d3652606d98562fe39c5e9e7e413f210502483045022100d12b852d85dcd961d2f5f4ab660654df6eedcc794c0c33ce5cc309ffb5fce58d022067338a8e0e1725c197fb1a88af59f51e44e4255b20167c8684031c05d1f2592a01210223b72beef0965d10be0778efecd61fcac6f79a4ea169393380734464f84f2ab300000000000000"
+	bip174Finalized         = "70736274ff0100a00200000002ab0949a08c5af7c49b8212f417e2f15ab3f5c33dcf153821a8139f877a5b7be40000000000feffffffab0949a08c5af7c49b8212f417e2f15ab3f5c33dcf153821a8139f877a5b7be40100000000feffffff02603bea0b000000001976a914768a40bbd740cbe81d988e71de2a4d5c71396b1d88ac8e240000000000001976a9146f4620b553fa095e721b9ee0efe9fa039cca459788ac000000000001076a47304402204759661797c01b036b25928948686218347d89864b719e1f7fcf57d1e511658702205309eabf56aa4d8891ffd111fdf1336f3a29da866d7f8486d75546ceedaf93190121035cdc61fc7ba971c0b501a646a2a83b102cb43881217ca682dc86e2d73fa882920001012000e1f5050000000017a9143545e6e33b832c47050f24d3eeb93c9c03948bc787010416001485d13537f2e265405a34dbafa9e3dda01fb82308000000"
+	bip174P2SHP2WSH         = "70736274ff0100550200000001279a2323a5dfb51fc45f220fa58b0fc13e1e3342792a85d7e36cd6333b5cbc390000000000ffffffff01a05aea0b000000001976a914ffe9c0061097cc3b636f2cb0460fa4fc427d2b4588ac0000000000010120955eea0b0000000017a9146345200f68d189e1adc0df1c4d16ea8f14c0dbeb87220203b1341ccba7683b6af4f1238cd6e97e7167d569fac47f1e48d47541844355bd4646304302200424b58effaaa694e1559ea5c93bbfd4a89064224055cdf070b6771469442d07021f5c8eb0fea6516d60b8acb33ad64ede60e8785bfb3aa94b99bdf86151db9a9a010104220020771fd18ad459666dd49f3d564e3dbc42f4c84774e360ada16816a8ed488d5681010547522103b1341ccba7683b6af4f1238cd6e97e7167d569fac47f1e48d47541844355bd462103de55d1e1dac805e3f8a58c1fbf9b94c02f3dbaafe127fefca4995f26f82083bd52ae220603b1341ccba7683b6af4f1238cd6e97e7167d569fac47f1e48d47541844355bd4610b4a6ba67000000800000008004000080220603de55d1e1dac805e3f8a58c1fbf9b94c02f3dbaafe127fefca4995f26f82083bd10b4a6ba670000008000000080050000800000"
+	bip174UnknownInput      = "70736274ff01003f0200000001ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff0000000000ffffffff010000000000000000036a010000000000000a0f0102030405060708090f0102030405060708090a0b0c0d0e0f0000"
+	bip174GlobalXPub        = "70736274ff01009d0100000002710ea76ab45c5cb6438e607e59cc037626981805ae9e0dfd9089012abb0be5350100000000ffffffff190994d6a8b3c8c82ccbcfb2fba4106aa06639b872a8d447465c0d42588d6d670000000000ffffffff0200e1f505000000001976a914b6bc2c0ee5655a843d79afedd0ccc3f7dd64340988ac605af405000000001600141188ef8e4ce0449eaac8fb141cbf5a1176e6a088000000004f010488b21e039e530cac800000003dbc8a5c9769f031b17e77fea1518603221a18fd18f2b9a54c6c8c1ac75cbc3502f230584b155d1c7f1cd45120a653c48d650b431b67c5b2c13f27d7142037c1691027569c503100008000000080000000800001011f00e1f5050000000016001433b982f91b28f160c920b4ab95e58ce50dda3a4a220203309680f33c7de38ea6a47cd4ecd66f1f5a49747c6ffb8808ed09039243e3ad5c47304402202d704ced830c56a909344bd742b6852dccd103e963bae92d38e75254d2bb424502202d86c437195df46c0ceda084f2a291c3da2d64070f76bf9b90b195e7ef28f77201220603309680f33c7de38ea6a47cd4ecd66f1f5a49747c6ffb8808ed09039243e3ad5c1827569c5031000080000000800000008000000000010000000001011f00e1f50500000000160014388fb944307eb77ef45197d0b0b245e079f011de220202c777161f73d0b7c72b9ee7bde650293d13f095bc7656ad1f525da5fd2e10b11047304402204cb1fb5f869c942e0e26100576125439179ae88dca8a9dc3ba08f7953988faa60220521f49ca791c27d70e273c9b14616985909361e25be274ea200d7e08827e514d01220602c777161f73d0b7c72b9ee7bde650293d13f095bc7656ad1f525da5fd2e10b1101827569c5031000080000000800000008000000000000000000000220202d20ca502ee289686d21815bd43a80637b0698e1fbcdbe4caed445f6c1a0a90ef1827569c50310000800000008000000080000000000400000000"
+	bip174P2SHP2WSHNoForkID = "768adbe5e70db1200ef6c6275b3006fda0577f83905854cf3669ff3ea3137848"
+	bip174P2SHP2WSHForkID   = "6f22af46cc7e4b36f49326f5943105e5ea78724a2649eaf5c6d164701597e357"
+)
+
+// btgMultisig spends a 2-of-3 P2WSH output of the test keys 1 to 3, paying
+// 1 BTG to GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE5 and the change back to the
+// multisig, signed by key 1 with SIGHASH_ALL|SIGHASH_FORKID. The signature
+// and its hash were computed apart from this package, the BIP143 digest with
+// the fork id 79 in the hash type.
+const (
+	btgMultisig        = "cHNidP8BAIACAAAAAZ0PY0AGjDk0pVhhvEmTmjlT+VfSY9OVzp35gwDSOj0tAQAAAAD9////AgDh9QUAAAAAGXapFHUedugZkZbUVJQcRdGzoyPxQzvWiKxwyfoCAAAAACIAIBLC/7xuwc9ddG371JsQYzViEupV9DAj/8AUWTSvIMVyAAAAAAABASuA0fAIAAAAACIAIBLC/7xuwc9ddG371JsQYzViEupV9DAj/8AUWTSvIMVyIgICeb5mfvncu6xVoGKVzocLBwKb/NstzijZWfKBWxb4F5hIMEUCIQCxGOfKSu3HP3sB9+DUqwhQNz/Jop0Pu1/Lod+r+BQRfwIgasp+5Lbf6/E37n6HDB8eOgZ8Dngo/hvHiP8NpVulsAlBAQMEQQAAAAEFaVIhAnm+Zn753LusVaBilc6HCwcCm/zbLc4o2VnygVsW+BeYIQLGBH+UQe19bTBFQG6VwHzYXHeOS4zvPKerrAm5XHCe5SEC+TCKAZJYwxBJNE+F+J1SKbUxyEWDb5mwhgHxE7zgNvlTrgAAAQFpUiECeb5mfvncu6xVoGKVzocLBwKb/NstzijZWfKBWxb4F5ghAsYEf5RB7X1tMEVAbpXAfNhcd45LjO88p6usCblccJ7lIQL5MIoBkljDEEk0T4X4nVIptTHIRYNvmbCGAfETvOA2+VOuAA=="
+	btgMultisigSigHash = "cacea3194d79362aafc49a4bc908d41ec61a0079b18d03000ab757607c784fdd"
+	btgMultisigTxID    = "ed8786b6eee9c6d2876f3545176fb95bdbb83e23730d3abcd7f314920a9362c7"
+)
+
+var _ = Describe("Test vectors", func() {
+	parse := func(s string) *Packet {
+		p, err := Parse(bytes.NewReader(mustHex(s)))
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	for _, v := range []struct {
+		name            string
+		hex             string
+		inputs, outputs int
+	}{
+		{"one P2PKH input", bip174P2PKH, 1, 2},
+		{"a finalized P2PKH input and a P2SH-P2WPKH input", bip174Finalized, 2, 2},
+		{"a P2SH-P2WSH input with one signature", bip174P2SHP2WSH, 1, 1},
+		{"unknown types in the inputs", bip174UnknownInput, 1, 1},
+		{"a global xpub", bip174GlobalXPub, 2, 2},
+	} {
+		v := v
+		It("should re-serialize the BIP174 packet with "+v.name+" byte for byte", func() {
+			p := parse(v.hex)
+			Expect(p.Inputs).To(HaveLen(v.inputs))
+			Expect(p.Outputs).To(HaveLen(v.outputs))
+			var buf bytes.Buffer
+			Expect(p.Serialize(&buf)).To(Succeed())
+			Expect(hex.EncodeToString(buf.Bytes())).To(Equal(v.hex))
+		})
+	}
+
+	It("should keep the fields of the BIP174 packets", func() {
+		p := parse(bip174P2PKH)
+		Expect(p.Inputs[0].NonWitnessUtxo.TxHash()).To(Equal(p.UnsignedTx.TxIn[0].PreviousOutPoint.Hash))
+
+		p = parse(bip174Finalized)
+		Expect(p.Inputs[0].FinalScriptSig).To(HaveLen(106))
+		Expect(p.Inputs[1].FinalScriptSig).To(BeNil())
+		Expect(p.IsComplete()).To(BeFalse())
+
+		p = parse(bip174UnknownInput)
+		Expect(p.Inputs[0].Unknowns).To(HaveLen(1))
+		Expect(p.Inputs[0].Unknowns[0].Key).To(Equal(mustHex("0f010203040506070809")))
+
+		p = parse(bip174GlobalXPub)
+		Expect(p.XPubs).To(HaveLen(1))
+		Expect(p.XPubs[0].Fingerprint).To(Equal(uint32(0x509c5627)))
+		Expect(p.XPubs[0].Path).To(Equal([]uint32{0x80000031, 0x80000000, 0x80000000}))
+	})
+
+	It("should hash the BIP174 P2SH-P2WSH input with and without the fork id", func() {
+		p := parse(bip174P2SHP2WSH)
+		in := p.Inputs[0]
+		amount := in.WitnessUtxo.Value
+
+		// the Bitcoin signature of the vector verifies against the BIP143 digest
+		h := witnessSignatureHash(p.UnsignedTx, 0, in.WitnessScript, amount, SigHashAll, uint32(SigHashAll))
+		Expect(hex.EncodeToString(h)).To(Equal(bip174P2SHP2WSHNoForkID))
+		ps := in.PartialSigs[0]
+		sig, err := ecdsa.ParseDERSignature(ps.Signature[:len(ps.Signature)-1])
+		Expect(err).NotTo(HaveOccurred())
+		key, err := secp256k1.ParsePubKey(ps.PubKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sig.Verify(h, key)).To(BeTrue())
+
+		h, err = SignatureHash(p.UnsignedTx, 0, in.WitnessScript, amount, SigHashAllForkID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hex.EncodeToString(h)).To(Equal(bip174P2SHP2WSHForkID))
+
+		// without the fork id, it is not a BTG signature
+		Expect(p.VerifyPartialSig(0, ps)).NotTo(Succeed())
+	})
+
+	It("should read, verify and complete the BTG multisig packet", func() {
+		p, err := NewFromBase64(btgMultisig)
+		Expect(err).NotTo(HaveOccurred())
+		again, err := p.B64Encode()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(btgMultisig))
+
+		in := p.Inputs[0]
+		Expect(in.SighashType).To(Equal(SigHashAllForkID))
+		h, err := SignatureHash(p.UnsignedTx, 0, in.WitnessScript, in.WitnessUtxo.Value, SigHashAllForkID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hex.EncodeToString(h)).To(Equal(btgMultisigSigHash))
+		Expect(p.VerifyPartialSig(0, in.PartialSigs[0])).To(Succeed())
+		Expect(in.PartialSigs[0].PubKey).To(Equal(testKey(1).PubKey().SerializeCompressed()))
+
+		status, err := p.SignatureStatus(0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Signed).To(Equal(1))
+		Expect(status.Required).To(Equal(2))
+		fee, err := p.Fee()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fee).To(Equal(int64(10000)))
+
+		Expect(p.Sign(0, testKey(3))).To(Succeed())
+		Expect(p.FinalizeAll()).To(Succeed())
+		tx, err := p.Extract()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tx.TxHash().String()).To(Equal(btgMultisigTxID))
+		Expect(tx.TxIn[0].Witness).To(HaveLen(4))
+	})
+})
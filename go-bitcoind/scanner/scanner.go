@@ -0,0 +1,323 @@
+// Package scanner walks the best chain block by block and records the outputs
+// paying the watched addresses and the transactions spending them. The hash chain of the processed blocks is
+// kept in the store: when the node's best chain no longer contains the stored
+// tip, blocks are disconnected until the fork point and the new branch is
+// replayed from there.
+package scanner
+
+import (
+	"fmt"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/merkle"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// Node is the part of the RPC client the scanner queries. *bitcoind.Bitcoind implements it.
+type Node interface {
+	GetBestBlockhash() (string, error)
+	GetBlockHash(height uint64) (string, error)
+	GetBlockheader(blockHash string) (*bitcoind.BlockHeader, error)
+	GetRawBlockheader(blockHash string) (string, error)
+	GetRawBlock(blockHash string) (string, error)
+
+	// GetRawTransaction looks up the inputs of the withdrawals that are not
+	// watched, to compute their fee. The node needs -txindex for those.
+	GetRawTransaction(txId string, verbose bool) (interface{}, error)
+}
+
+// A Handler is notified of the chain progress. The store is updated before
+// the handler is called, so a deposit handed to DepositChanged already has
+// its nonce.
+type Handler interface {
+	// BlockConnected is called for each block appended to the stored chain
+	BlockConnected(block store.Tip)
+
+	// BlockDisconnected is called for each block rolled back by a reorg
+	BlockDisconnected(block store.Tip)
+
+	// Withdrawn is called after BlockConnected for each transaction of the
+	// block spending watched outputs, before their DepositChanged
+	Withdrawn(w *deposit.Withdrawal)
+
+	// DepositChanged is called after BlockConnected or BlockDisconnected for
+	// every deposit whose state or confirmations moved with the block
+	DepositChanged(c *store.Change)
+}
+
+// A Scanner extracts the outputs paying a set of addresses from the blocks
+// of the best chain
+type Scanner struct {
+	node    Node
+	store   *store.Store
+	params  *address.Params
+	policy  *deposit.Policy
+	start   uint64
+	scripts map[string]string // scriptPubKey -> address
+
+	// the headers of the last stored blocks, the window the next target
+	// is checked against
+	window *merkle.Window
+}
+
+// New returns a scanner of the outputs paying addresses, final once they
+// have the confirmations required by policy. An empty store is filled from
+// the block at height start.
+func New(node Node, st *store.Store, params *address.Params, policy *deposit.Policy, addresses []string, start uint64) (*Scanner, error) {
+	scripts := make(map[string]string, len(addresses))
+	for _, a := range addresses {
+		addr, err := address.Decode(a, params)
+		if err != nil {
+			return nil, fmt.Errorf("scanner: %s: %v", a, err)
+		}
+		scripts[string(addr.ScriptPubKey())] = addr.String()
+	}
+	return &Scanner{node: node, store: st, params: params, policy: policy, start: start, scripts: scripts}, nil
+}
+
+// Scan rolls back the stored blocks that left the best chain, then connects
+// the blocks up to the node's tip. It returns the stored tip, nil if the
+// chain has not reached the start height yet. On error the blocks processed
+// so far stay stored and the next call resumes from there.
+func (s *Scanner) Scan(h Handler) (*store.Tip, error) {
+	for {
+		tip, err := s.store.Tip()
+		if err != nil {
+			return nil, err
+		}
+		bestHash, err := s.node.GetBestBlockhash()
+		if err != nil {
+			return tip, err
+		}
+		best, err := s.node.GetBlockheader(bestHash)
+		if err != nil {
+			return tip, err
+		}
+		bestHeight := uint64(best.Height)
+
+		next := s.start
+		if tip != nil {
+			inBest, err := s.inBestChain(tip, bestHeight)
+			if err != nil {
+				return tip, err
+			}
+			if !inBest {
+				if err := s.disconnect(h, tip); err != nil {
+					return tip, err
+				}
+				continue
+			}
+			next = tip.Height + 1
+		}
+		if next > bestHeight {
+			return tip, nil
+		}
+		if err := s.connect(h, tip, next); err != nil {
+			return tip, err
+		}
+	}
+}
+
+// inBestChain compares the stored tip with the block at its height in the
+// node's best chain
+func (s *Scanner) inBestChain(tip *store.Tip, bestHeight uint64) (bool, error) {
+	if tip.Height > bestHeight {
+		return false, nil
+	}
+	hash, err := s.node.GetBlockHash(tip.Height)
+	if err != nil {
+		return false, err
+	}
+	return hash == tip.Hash, nil
+}
+
+func (s *Scanner) disconnect(h Handler, tip *store.Tip) error {
+	_, changes, err := s.store.DisconnectTip()
+	if err != nil {
+		return err
+	}
+	h.BlockDisconnected(*tip)
+	for _, c := range changes {
+		h.DepositChanged(c)
+	}
+	return nil
+}
+
+// connect fetches the block at height, checks it against its hash, its
+// proof-of-work and the stored tip, and records the watched outputs it
+// contains
+func (s *Scanner) connect(h Handler, tip *store.Tip, height uint64) error {
+	hash, err := s.node.GetBlockHash(height)
+	if err != nil {
+		return err
+	}
+	raw, err := s.node.GetRawBlock(hash)
+	if err != nil {
+		return err
+	}
+	block, err := wire.NewMsgBlockFromHex(raw)
+	if err != nil {
+		return fmt.Errorf("scanner: block %s: %v", hash, err)
+	}
+
+	// the node is not trusted to serve the block it was asked for
+	got := block.Header.BlockHash(s.params.ForkHeight)
+	if got.String() != hash {
+		return fmt.Errorf("scanner: block %s hashes to %s", hash, got)
+	}
+	if err := merkle.CheckHeader(&block.Header, got, s.params); err != nil {
+		return fmt.Errorf("scanner: block %s: %v", hash, err)
+	}
+	if merkle.Root(block.TxHashes()) != block.Header.MerkleRoot {
+		return fmt.Errorf("scanner: block %s: transactions do not match the merkle root", hash)
+	}
+	prev := block.Header.PrevBlock.String()
+	if tip != nil && prev != tip.Hash {
+		// the best chain moved since it was compared, the next scan rolls back
+		return fmt.Errorf("scanner: block %s does not extend %s", hash, tip.Hash)
+	}
+	if tip != nil {
+		if err := s.checkRetarget(tip, &block.Header); err != nil {
+			return fmt.Errorf("scanner: block %s: %v", hash, err)
+		}
+	}
+
+	deposits := s.extract(block)
+	withdrawals, err := s.withdrawals(block, deposits)
+	if err != nil {
+		return err
+	}
+	connected := store.Tip{Hash: hash, Height: height}
+	changes, err := s.store.ConnectBlock(connected, prev, deposits, withdrawals, s.policy)
+	if err != nil {
+		return err
+	}
+	if s.window != nil {
+		s.window.Push(&block.Header)
+	}
+	h.BlockConnected(connected)
+	for _, w := range withdrawals {
+		h.Withdrawn(w)
+	}
+	for _, c := range changes {
+		h.DepositChanged(c)
+	}
+	return nil
+}
+
+// checkRetarget checks the target of header against the stored blocks
+// before it, the stored tip last. Their headers are kept from block to
+// block, and fetched again after a restart or a rollback.
+func (s *Scanner) checkRetarget(tip *store.Tip, header *wire.BlockHeader) error {
+	if s.window == nil || s.window.Last().BlockHash(s.params.ForkHeight).String() != tip.Hash {
+		raw, err := s.node.GetRawBlockheader(tip.Hash)
+		if err != nil {
+			return err
+		}
+		parent, err := wire.NewBlockHeaderFromHex(raw)
+		if err != nil {
+			return err
+		}
+		if got := parent.BlockHash(s.params.ForkHeight); got.String() != tip.Hash {
+			return fmt.Errorf("parent %s hashes to %s", tip.Hash, got)
+		}
+		if s.window, err = merkle.NewWindow(s.node, parent, s.params); err != nil {
+			return err
+		}
+	}
+	return s.window.Check(header)
+}
+
+// extract returns the outputs of the block paying a watched address, in
+// block order, with the index of their transaction the nonces derive from
+func (s *Scanner) extract(block *wire.MsgBlock) []*deposit.Deposit {
+	var deposits []*deposit.Deposit
+	for txIndex, tx := range block.Transactions {
+		var txid wire.Hash
+		for i, out := range tx.TxOut {
+			addr, ok := s.scripts[string(out.PkScript)]
+			if !ok {
+				continue
+			}
+			if txid == (wire.Hash{}) {
+				txid = tx.TxHash()
+			}
+			deposits = append(deposits, &deposit.Deposit{
+				OutPoint:      wire.OutPoint{Hash: txid, Index: uint32(i)},
+				Address:       addr,
+				Amount:        out.Value,
+				ScriptPubKey:  out.PkScript,
+				Confirmations: 1,
+				TxIndex:       uint32(txIndex),
+			})
+		}
+	}
+	return deposits
+}
+
+// withdrawals returns the transactions of the block spending stored deposits
+// or the deposits of the block, in block order
+func (s *Scanner) withdrawals(block *wire.MsgBlock, deposits []*deposit.Deposit) ([]*deposit.Withdrawal, error) {
+	var inputs []wire.OutPoint
+	for _, tx := range block.Transactions[1:] {
+		for _, in := range tx.TxIn {
+			inputs = append(inputs, in.PreviousOutPoint)
+		}
+	}
+	records, err := s.store.Lookup(inputs)
+	if err != nil {
+		return nil, err
+	}
+	watched := make(map[wire.OutPoint]int64, len(records)+len(deposits))
+	for op, r := range records {
+		watched[op] = r.Amount
+	}
+	for _, d := range deposits {
+		watched[d.OutPoint] = d.Amount
+	}
+
+	var withdrawals []*deposit.Withdrawal
+	for _, tx := range block.Transactions[1:] {
+		var spent []wire.OutPoint
+		amounts := make(map[wire.OutPoint]int64, len(tx.TxIn))
+		for _, in := range tx.TxIn {
+			if amount, ok := watched[in.PreviousOutPoint]; ok {
+				spent = append(spent, in.PreviousOutPoint)
+				amounts[in.PreviousOutPoint] = amount
+			}
+		}
+		if len(spent) == 0 {
+			continue
+		}
+		s.lookupInputs(tx, amounts)
+		withdrawals = append(withdrawals, deposit.NewWithdrawal(tx, spent, amounts, s.params))
+	}
+	return withdrawals, nil
+}
+
+// lookupInputs adds the amounts of the inputs of tx missing from amounts.
+// The inputs the node can't serve are left out, the fee is then unknown.
+func (s *Scanner) lookupInputs(tx *wire.MsgTx, amounts map[wire.OutPoint]int64) {
+	for _, in := range tx.TxIn {
+		op := in.PreviousOutPoint
+		if _, ok := amounts[op]; ok {
+			continue
+		}
+		raw, err := s.node.GetRawTransaction(op.Hash.String(), false)
+		if err != nil {
+			return
+		}
+		hex, ok := raw.(string)
+		if !ok {
+			return
+		}
+		prev, err := wire.NewMsgTxFromHex(hex)
+		if err != nil || int(op.Index) >= len(prev.TxOut) {
+			return
+		}
+		amounts[op] = prev.TxOut[op.Index].Value
+	}
+}
@@ -0,0 +1,454 @@
+package scanner
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/merkle"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+const (
+	watched       = "tbtg1qmc6uua0jngs9qr38w3pchcvdcrzu878t8p8nwqtj32rtjvjfvnfq0p027k"
+	watchedScript = "0020de35ce75f29a20500e2774438be18dc0c5c3f8eb384f3701728a86b9324964d2"
+	startHeight   = 100
+)
+
+// fakeNode serves a best chain of regtest blocks starting at startHeight
+type fakeNode struct {
+	blocks []*wire.MsgBlock
+	raw    map[string]string
+	txs    map[string]string // served by GetRawTransaction
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{raw: make(map[string]string), txs: make(map[string]string)}
+}
+
+// setChain makes blocks the best chain; blocks of previous chains stay
+// available by hash, like stale blocks on a real node
+func (n *fakeNode) setChain(blocks ...*wire.MsgBlock) {
+	n.blocks = blocks
+	for _, b := range blocks {
+		n.raw[blockHash(b).String()] = b.Hex()
+	}
+}
+
+func (n *fakeNode) GetBestBlockhash() (string, error) {
+	return blockHash(n.blocks[len(n.blocks)-1]).String(), nil
+}
+
+func (n *fakeNode) GetBlockHash(height uint64) (string, error) {
+	i := int(height) - startHeight
+	if i < 0 || i >= len(n.blocks) {
+		return "", errors.New("Block height out of range")
+	}
+	return blockHash(n.blocks[i]).String(), nil
+}
+
+func (n *fakeNode) GetBlockheader(blockHash string) (*bitcoind.BlockHeader, error) {
+	for i, b := range n.blocks {
+		if blockHashString(b) == blockHash {
+			return &bitcoind.BlockHeader{Hash: blockHash, Height: startHeight + i}, nil
+		}
+	}
+	return nil, errors.New("Block not found")
+}
+
+func (n *fakeNode) GetRawBlock(blockHash string) (string, error) {
+	raw, ok := n.raw[blockHash]
+	if !ok {
+		return "", errors.New("Block not found")
+	}
+	return raw, nil
+}
+
+func (n *fakeNode) GetRawBlockheader(blockHash string) (string, error) {
+	raw, ok := n.raw[blockHash]
+	if !ok {
+		return "", errors.New("Block not found")
+	}
+	b, err := wire.NewMsgBlockFromHex(raw)
+	if err != nil {
+		return "", err
+	}
+	return b.Header.Hex(), nil
+}
+
+func (n *fakeNode) GetRawTransaction(txId string, verbose bool) (interface{}, error) {
+	raw, ok := n.txs[txId]
+	if !ok {
+		return nil, errors.New("No such mempool or blockchain transaction")
+	}
+	return raw, nil
+}
+
+func blockHash(b *wire.MsgBlock) wire.Hash {
+	return b.Header.BlockHash(address.RegTestParams.ForkHeight)
+}
+
+func blockHashString(b *wire.MsgBlock) string {
+	return blockHash(b).String()
+}
+
+// newBlock mines a block on top of prev at height. tag tells apart the
+// coinbases of competing branches.
+func newBlock(prev *wire.MsgBlock, height uint32, tag byte, txs ...*wire.MsgTx) *wire.MsgBlock {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: 0xffffffff},
+		SignatureScript:  []byte{4, byte(height), byte(height >> 8), 0, 0, tag},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(&wire.TxOut{Value: 1250000000, PkScript: []byte{0x51}})
+
+	b := &wire.MsgBlock{Transactions: append([]*wire.MsgTx{coinbase}, txs...)}
+	b.Header = wire.BlockHeader{Version: 4, MerkleRoot: merkle.Root(b.TxHashes()), Height: height}
+	if prev != nil {
+		b.Header.PrevBlock = blockHash(prev)
+	}
+	return mine(b, 0x207fffff)
+}
+
+// mine sets the target of b to bits and grinds its nonce to meet it
+func mine(b *wire.MsgBlock, bits uint32) *wire.MsgBlock {
+	b.Header.Bits = bits
+	for merkle.CheckProofOfWork(blockHash(b), b.Header.Bits, address.RegTestParams.PowLimitBits) != nil {
+		b.Header.Nonce[0]++
+	}
+	return b
+}
+
+// payment pays the watched address twice, around an unrelated output
+func payment() *wire.MsgTx {
+	script, _ := hex.DecodeString(watchedScript)
+	tx := wire.NewMsgTx(2)
+	prev, _ := wire.NewOutPoint("4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b", 0)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: prev, Sequence: wire.MaxTxInSequenceNum})
+	tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: script})
+	tx.AddTxOut(&wire.TxOut{Value: 5, PkScript: []byte{0x51}})
+	tx.AddTxOut(&wire.TxOut{Value: 2000, PkScript: script})
+	return tx
+}
+
+// An event is a connected or disconnected block with the withdrawals and
+// the deposit changes it caused
+type event struct {
+	connected   bool
+	block       store.Tip
+	withdrawals []*deposit.Withdrawal
+	changes     []*store.Change
+}
+
+// recorder is a Handler keeping the events in order
+type recorder struct {
+	events []event
+}
+
+func (r *recorder) BlockConnected(block store.Tip) {
+	r.events = append(r.events, event{connected: true, block: block})
+}
+
+func (r *recorder) BlockDisconnected(block store.Tip) {
+	r.events = append(r.events, event{connected: false, block: block})
+}
+
+func (r *recorder) Withdrawn(w *deposit.Withdrawal) {
+	last := &r.events[len(r.events)-1]
+	last.withdrawals = append(last.withdrawals, w)
+}
+
+func (r *recorder) DepositChanged(c *store.Change) {
+	last := &r.events[len(r.events)-1]
+	last.changes = append(last.changes, c)
+}
+
+// payout spends the first output of payment, with another input of the
+// given amount, and pays 1500 satoshis out
+func payout(other int64) (*wire.MsgTx, *wire.MsgTx) {
+	funding := wire.NewMsgTx(2)
+	funding.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: 7}, Sequence: wire.MaxTxInSequenceNum})
+	funding.AddTxOut(&wire.TxOut{Value: other, PkScript: []byte{0x51}})
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: payment().TxHash(), Index: 0}, Sequence: wire.MaxTxInSequenceNum})
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: funding.TxHash(), Index: 0}, Sequence: wire.MaxTxInSequenceNum})
+	tx.AddTxOut(&wire.TxOut{Value: 1500, PkScript: []byte{0x51}})
+	return tx, funding
+}
+
+func nonceAt(height uint64, txIndex, vout uint32) uint64 {
+	n, err := deposit.Nonce(height, txIndex, vout)
+	Expect(err).NotTo(HaveOccurred())
+	return n
+}
+
+var _ = Describe("Scanner", func() {
+	var (
+		dir  string
+		st   *store.Store
+		node *fakeNode
+		s    *Scanner
+		rec  *recorder
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "scanner")
+		Expect(err).NotTo(HaveOccurred())
+		st, err = store.Open(filepath.Join(dir, "state.db"))
+		Expect(err).NotTo(HaveOccurred())
+		node = newFakeNode()
+		policy, err := deposit.NewPolicy(2, nil)
+		Expect(err).NotTo(HaveOccurred())
+		s, err = New(node, st, &address.RegTestParams, policy, []string{watched}, startHeight)
+		Expect(err).NotTo(HaveOccurred())
+		rec = &recorder{}
+	})
+	AfterEach(func() {
+		st.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should record every watched output of the blocks from the start height", func() {
+		b0 := newBlock(nil, startHeight, 0)
+		b1 := newBlock(b0, startHeight+1, 0, payment())
+		b2 := newBlock(b1, startHeight+2, 0)
+		node.setChain(b0, b1, b2)
+
+		tip, err := s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*tip).To(Equal(store.Tip{Hash: blockHashString(b2), Height: startHeight + 2}))
+		Expect(rec.events).To(HaveLen(3))
+
+		changes := rec.events[1].changes
+		Expect(changes).To(HaveLen(2))
+		txid := payment().TxHash().String()
+		first, second := changes[0].Record, changes[1].Record
+		Expect(first.OutPoint).To(Equal(txid + ":0"))
+		Expect(first.Amount).To(Equal(int64(1000)))
+		Expect(first.Address).To(Equal(watched))
+		Expect(first.Nonce).To(Equal(nonceAt(startHeight+1, 1, 0)))
+		Expect(first.State).To(Equal(deposit.StateConfirmed))
+		Expect(second.OutPoint).To(Equal(txid + ":2"))
+		Expect(second.Nonce).To(Equal(nonceAt(startHeight+1, 1, 2)))
+		Expect(second.Height).To(Equal(uint64(startHeight + 1)))
+
+		// final one block later
+		Expect(rec.events[2].changes).To(HaveLen(2))
+		Expect(rec.events[2].changes[0].Record.State).To(Equal(deposit.StateFinal))
+
+		// nothing new
+		rec.events = nil
+		_, err = s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rec.events).To(BeEmpty())
+	})
+
+	It("should roll back to the fork point and replay the new branch", func() {
+		b0 := newBlock(nil, startHeight, 0)
+		a1 := newBlock(b0, startHeight+1, 'a', payment())
+		a2 := newBlock(a1, startHeight+2, 'a')
+		node.setChain(b0, a1, a2)
+		_, err := s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the payment is mined one block later on the winning branch
+		c1 := newBlock(b0, startHeight+1, 'c')
+		c2 := newBlock(c1, startHeight+2, 'c', payment())
+		c3 := newBlock(c2, startHeight+3, 'c')
+		node.setChain(b0, c1, c2, c3)
+		rec.events = nil
+		tip, err := s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tip.Hash).To(Equal(blockHashString(c3)))
+
+		Expect(rec.events).To(HaveLen(5))
+		Expect(rec.events[0].connected).To(BeFalse())
+		Expect(rec.events[0].block.Hash).To(Equal(blockHashString(a2)))
+		Expect(rec.events[1].connected).To(BeFalse())
+		Expect(rec.events[1].block.Hash).To(Equal(blockHashString(a1)))
+		Expect(rec.events[1].changes).To(HaveLen(2))
+		Expect(rec.events[1].changes[0].From).To(Equal(deposit.StateFinal))
+		Expect(rec.events[1].changes[0].Record.State).To(Equal(deposit.StateOrphaned))
+
+		replayed := rec.events[3]
+		Expect(replayed.connected).To(BeTrue())
+		Expect(replayed.block.Hash).To(Equal(blockHashString(c2)))
+		Expect(replayed.changes).To(HaveLen(2))
+		Expect(replayed.changes[0].Record.Nonce).To(Equal(nonceAt(startHeight+2, 1, 0)))
+		Expect(replayed.changes[0].Record.State).To(Equal(deposit.StateConfirmed))
+		Expect(rec.events[4].changes[0].Record.State).To(Equal(deposit.StateFinal))
+
+		for h, b := range []*wire.MsgBlock{b0, c1, c2, c3} {
+			Expect(st.BlockHash(uint64(startHeight + h))).To(Equal(blockHashString(b)))
+		}
+	})
+
+	It("should derive the same nonces as a scanner with another history", func() {
+		b0 := newBlock(nil, startHeight, 0)
+		a1 := newBlock(b0, startHeight+1, 'a', payment())
+		node.setChain(b0, a1)
+		_, err := s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the other relayer starts later, once the payment moved to another
+		// branch behind an unrelated transaction
+		_, unrelated := payout(300)
+		c1 := newBlock(b0, startHeight+1, 'c')
+		c2 := newBlock(c1, startHeight+2, 'c', unrelated, payment())
+		node.setChain(b0, c1, c2)
+		_, err = s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+
+		other, err := store.Open(filepath.Join(dir, "other.db"))
+		Expect(err).NotTo(HaveOccurred())
+		defer other.Close()
+		policy, _ := deposit.NewPolicy(2, nil)
+		late, err := New(node, other, &address.RegTestParams, policy, []string{watched}, startHeight+2)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = late.Scan(&recorder{})
+		Expect(err).NotTo(HaveOccurred())
+
+		mine, err := st.List("")
+		Expect(err).NotTo(HaveOccurred())
+		theirs, err := other.List("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(theirs).To(HaveLen(2))
+		Expect(mine).To(HaveLen(2))
+		for i := range mine {
+			Expect(mine[i].OutPoint).To(Equal(theirs[i].OutPoint))
+			Expect(mine[i].Nonce).To(Equal(theirs[i].Nonce))
+		}
+		Expect(mine[1].Nonce).To(Equal(nonceAt(startHeight+2, 2, 2)))
+	})
+
+	It("should roll back when the best chain gets shorter", func() {
+		b0 := newBlock(nil, startHeight, 0)
+		b1 := newBlock(b0, startHeight+1, 0, payment())
+		node.setChain(b0, b1)
+		s.Scan(rec)
+
+		node.setChain(b0)
+		tip, err := s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tip.Hash).To(Equal(blockHashString(b0)))
+		orphaned, err := st.List("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphaned).To(HaveLen(2))
+		Expect(orphaned[0].State).To(Equal(deposit.StateOrphaned))
+	})
+
+	It("should reject a block that does not match its hash", func() {
+		b0 := newBlock(nil, startHeight, 0)
+		b1 := newBlock(b0, startHeight+1, 0)
+		node.setChain(b0, b1)
+		forged := newBlock(b0, startHeight+1, 0, payment())
+		node.raw[blockHashString(b1)] = forged.Hex()
+
+		tip, err := s.Scan(rec)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("hashes to"))
+		Expect(tip.Hash).To(Equal(blockHashString(b0)))
+		Expect(st.List("")).To(BeEmpty())
+	})
+
+	It("should reject a block whose target rises too fast from its parent's", func() {
+		strict := address.RegTestParams
+		strict.AllowMinDifficultyBlocks = false
+		policy, err := deposit.NewPolicy(2, nil)
+		Expect(err).NotTo(HaveOccurred())
+		s, err = New(node, st, &strict, policy, []string{watched}, startHeight)
+		Expect(err).NotTo(HaveOccurred())
+
+		b0 := mine(newBlock(nil, startHeight, 0), 0x2007ffff)
+		b1 := mine(newBlock(b0, startHeight+1, 0), 0x201ffffc)
+		b2 := mine(newBlock(b1, startHeight+2, 0), 0x207fffff)
+		node.setChain(b0, b1, b2)
+
+		tip, err := s.Scan(rec)
+		Expect(err).To(MatchError(ContainSubstring(merkle.ErrDifficultyDrop.Error())))
+		Expect(tip.Hash).To(Equal(blockHashString(b1)))
+	})
+
+	It("should reject a block above the proof-of-work limit", func() {
+		b0 := newBlock(nil, startHeight, 0)
+		node.setChain(b0)
+		strict := address.RegTestParams
+		strict.LegacyPowLimitBits = 0x201fffff
+		policy, err := deposit.NewPolicy(2, nil)
+		Expect(err).NotTo(HaveOccurred())
+		s, err = New(node, st, &strict, policy, []string{watched}, startHeight)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = s.Scan(rec)
+		Expect(err).To(MatchError(ContainSubstring(merkle.ErrEasyTarget.Error())))
+	})
+
+	It("should wait for the chain to reach the start height", func() {
+		node.setChain(newBlock(nil, startHeight, 0))
+		s.start = startHeight + 1
+
+		tip, err := s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tip).To(BeNil())
+		Expect(rec.events).To(BeEmpty())
+	})
+
+	It("should report the transactions spending watched outputs", func() {
+		tx, funding := payout(600)
+		node.txs[funding.TxHash().String()] = funding.Hex()
+		b0 := newBlock(nil, startHeight, 0)
+		b1 := newBlock(b0, startHeight+1, 0, payment())
+		b2 := newBlock(b1, startHeight+2, 0, tx)
+		node.setChain(b0, b1, b2)
+		_, err := s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+
+		spending := rec.events[2]
+		Expect(spending.withdrawals).To(HaveLen(1))
+		w := spending.withdrawals[0]
+		Expect(w.TxID).To(Equal(tx.TxHash().String()))
+		Expect(w.Spent).To(Equal([]string{payment().TxHash().String() + ":0"}))
+		Expect(w.Outputs).To(Equal([]deposit.Output{{Amount: 1500, Script: []byte{0x51}}}))
+		Expect(w.Fee).To(Equal(int64(100)))
+		Expect(w.Block).To(Equal(blockHashString(b2)))
+		Expect(w.Height).To(Equal(uint64(startHeight + 2)))
+
+		// the spent deposit first, then the other one becoming final
+		Expect(spending.changes).To(HaveLen(2))
+		Expect(spending.changes[0].Record.State).To(Equal(deposit.StateSpent))
+		Expect(spending.changes[0].Record.SpentBy).To(Equal(w))
+		Expect(spending.changes[1].Record.State).To(Equal(deposit.StateFinal))
+
+		// the payout is rolled back with its block
+		node.setChain(b0, b1)
+		rec.events = nil
+		_, err = s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rec.events[0].changes).To(HaveLen(1))
+		Expect(rec.events[0].changes[0].Record.State).To(Equal(deposit.StateConfirmed))
+		Expect(rec.events[0].changes[0].Record.SpentBy).To(BeNil())
+	})
+
+	It("should leave the fee unknown when an input can't be looked up", func() {
+		tx, _ := payout(600)
+		b0 := newBlock(nil, startHeight, 0)
+		b1 := newBlock(b0, startHeight+1, 0, payment(), tx)
+		node.setChain(b0, b1)
+		_, err := s.Scan(rec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rec.events[1].withdrawals).To(HaveLen(1))
+		Expect(rec.events[1].withdrawals[0].Fee).To(Equal(int64(-1)))
+	})
+})
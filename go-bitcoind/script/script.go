@@ -0,0 +1,229 @@
+// Package script assembles, disassembles and classifies Bitcoin Gold scripts.
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrMalformedPush is returned when a push opcode runs past the end of the script
+var ErrMalformedPush = errors.New("script: malformed data push")
+
+// MaxScriptElementSize is the largest element that can be pushed on the stack
+const MaxScriptElementSize = 520
+
+// An Instruction is a single parsed script operation
+type Instruction struct {
+	// The opcode
+	Op byte
+
+	// The pushed data, for push opcodes
+	Data []byte
+}
+
+// IsPush reports whether the instruction pushes data (including OP_0)
+func (i Instruction) IsPush() bool {
+	return i.Op <= OP_PUSHDATA4
+}
+
+// Parse splits a serialized script into instructions
+func Parse(script []byte) ([]Instruction, error) {
+	var out []Instruction
+	for pc := 0; pc < len(script); {
+		op := script[pc]
+		pc++
+		if op > OP_PUSHDATA4 {
+			out = append(out, Instruction{Op: op})
+			continue
+		}
+
+		var n int
+		switch op {
+		case OP_PUSHDATA1:
+			if pc+1 > len(script) {
+				return out, ErrMalformedPush
+			}
+			n = int(script[pc])
+			pc++
+		case OP_PUSHDATA2:
+			if pc+2 > len(script) {
+				return out, ErrMalformedPush
+			}
+			n = int(binary.LittleEndian.Uint16(script[pc:]))
+			pc += 2
+		case OP_PUSHDATA4:
+			if pc+4 > len(script) {
+				return out, ErrMalformedPush
+			}
+			n = int(binary.LittleEndian.Uint32(script[pc:]))
+			pc += 4
+		default:
+			n = int(op)
+		}
+		if n < 0 || pc+n > len(script) {
+			return out, ErrMalformedPush
+		}
+		out = append(out, Instruction{Op: op, Data: script[pc : pc+n]})
+		pc += n
+	}
+	return out, nil
+}
+
+// Disasm returns the human readable form of script, matching the asm field
+// bitcoind returns in ScriptPubKey.Asm: pushes of up to 4 bytes are shown as
+// numbers, longer pushes as hex and other opcodes by name.
+func Disasm(script []byte) string {
+	ins, err := Parse(script)
+	parts := make([]string, 0, len(ins)+1)
+	for _, in := range ins {
+		switch {
+		case in.IsPush() && len(in.Data) <= 4:
+			parts = append(parts, strconv.FormatInt(decodeScriptNum(in.Data), 10))
+		case in.IsPush():
+			parts = append(parts, hex.EncodeToString(in.Data))
+		default:
+			parts = append(parts, OpName(in.Op))
+		}
+	}
+	if err != nil {
+		parts = append(parts, "[error]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Assemble parses the asm form produced by Disasm back into a script.
+// Numbers are pushed minimally, other tokens are either opcode names or hex data.
+func Assemble(asm string) ([]byte, error) {
+	b := NewBuilder()
+	for _, tok := range strings.Fields(asm) {
+		if op, ok := opCodes[tok]; ok {
+			b.AddOp(op)
+			continue
+		}
+		// bitcoind never prints numbers wider than 4 bytes, anything longer is hex
+		if len(tok) <= 11 {
+			if n, err := strconv.ParseInt(tok, 10, 32); err == nil {
+				b.AddInt64(n)
+				continue
+			}
+		}
+		data, err := hex.DecodeString(tok)
+		if err != nil {
+			return nil, fmt.Errorf("script: invalid token %q", tok)
+		}
+		b.AddData(data)
+	}
+	return b.Script()
+}
+
+// decodeScriptNum decodes a little endian, sign-magnitude script number
+func decodeScriptNum(b []byte) int64 {
+	if len(b) == 0 {
+		return 0
+	}
+	var n int64
+	for i, c := range b {
+		n |= int64(c) << uint(8*i)
+	}
+	if b[len(b)-1]&0x80 != 0 {
+		n &^= int64(0x80) << uint(8*(len(b)-1))
+		return -n
+	}
+	return n
+}
+
+// encodeScriptNum encodes n as a minimal script number
+func encodeScriptNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	var out []byte
+	for n > 0 {
+		out = append(out, byte(n&0xff))
+		n >>= 8
+	}
+	if out[len(out)-1]&0x80 != 0 {
+		if neg {
+			out = append(out, 0x80)
+		} else {
+			out = append(out, 0)
+		}
+	} else if neg {
+		out[len(out)-1] |= 0x80
+	}
+	return out
+}
+
+// A Builder assembles a script from opcodes and data pushes
+type Builder struct {
+	script []byte
+	err    error
+}
+
+// NewBuilder returns an empty script builder
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp appends an opcode
+func (b *Builder) AddOp(op byte) *Builder {
+	b.script = append(b.script, op)
+	return b
+}
+
+// AddInt64 appends n using OP_0..OP_16, OP_1NEGATE or a minimal number push
+func (b *Builder) AddInt64(n int64) *Builder {
+	switch {
+	case n == -1:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 0 && n <= 16:
+		return b.AddOp(smallIntOp(int(n)))
+	}
+	return b.addPush(encodeScriptNum(n))
+}
+
+// AddData appends a minimal push of data, as required by the MINIMALDATA rule
+func (b *Builder) AddData(data []byte) *Builder {
+	switch {
+	case len(data) == 0:
+		return b.AddOp(OP_0)
+	case len(data) == 1 && data[0] >= 1 && data[0] <= 16:
+		return b.AddOp(smallIntOp(int(data[0])))
+	case len(data) == 1 && data[0] == 0x81:
+		return b.AddOp(OP_1NEGATE)
+	}
+	return b.addPush(data)
+}
+
+func (b *Builder) addPush(data []byte) *Builder {
+	if len(data) > MaxScriptElementSize {
+		b.err = fmt.Errorf("script: push of %d bytes exceeds %d", len(data), MaxScriptElementSize)
+		return b
+	}
+	switch n := len(data); {
+	case n < OP_PUSHDATA1:
+		b.script = append(b.script, byte(n))
+	case n <= 0xff:
+		b.script = append(b.script, OP_PUSHDATA1, byte(n))
+	default:
+		b.script = append(b.script, OP_PUSHDATA2, byte(n), byte(n>>8))
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// Script returns the assembled script, or the first error met while building it
+func (b *Builder) Script() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return append([]byte{}, b.script...), nil
+}
@@ -0,0 +1,69 @@
+package script
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+var _ = Describe("Script", func() {
+	Describe("Disasm", func() {
+		It("should match bitcoind asm for P2PKH", func() {
+			s := mustHex("76a914751e76e8199196d454941c45d1b3a323f1433bd688ac")
+			Expect(Disasm(s)).To(Equal("OP_DUP OP_HASH160 751e76e8199196d454941c45d1b3a323f1433bd6 OP_EQUALVERIFY OP_CHECKSIG"))
+		})
+		It("should match bitcoind asm for P2WSH", func() {
+			s := mustHex("0020b4dcb2eee00b7d71c86c08054f0a40b28e6f85572bd79d314accdfb8f30b9f77")
+			Expect(Disasm(s)).To(Equal("0 b4dcb2eee00b7d71c86c08054f0a40b28e6f85572bd79d314accdfb8f30b9f77"))
+		})
+		It("should print short pushes as numbers", func() {
+			Expect(Disasm([]byte{0x6a, 0x02, 0xe8, 0x03, 0x01, 0x81, 0x4f})).To(Equal("OP_RETURN 1000 -1 -1"))
+		})
+		It("should flag truncated pushes", func() {
+			Expect(Disasm([]byte{0x6a, 0x05, 0x01})).To(Equal("OP_RETURN [error]"))
+		})
+	})
+
+	Describe("Assemble", func() {
+		It("should round trip through Disasm", func() {
+			asm := "2 02fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f 02ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8 2 OP_CHECKMULTISIG"
+			s, err := Assemble(asm)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Disasm(s)).To(Equal(asm))
+		})
+		It("should push numbers minimally", func() {
+			s, err := Assemble("1000 -1 0 16 17 -200")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hex.EncodeToString(s)).To(Equal("02e8034f0060011102c880"))
+		})
+		It("should reject unknown tokens", func() {
+			_, err := Assemble("OP_DUP OP_FOO")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Builder", func() {
+		It("should use PUSHDATA for long data", func() {
+			s, err := NewBuilder().AddData(make([]byte, 80)).Script()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s[:2]).To(Equal([]byte{OP_PUSHDATA1, 80}))
+			ins, err := Parse(s)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ins).To(HaveLen(1))
+			Expect(ins[0].Data).To(HaveLen(80))
+		})
+		It("should refuse oversized pushes", func() {
+			_, err := NewBuilder().AddData(make([]byte, MaxScriptElementSize+1)).Script()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
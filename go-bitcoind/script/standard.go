@@ -0,0 +1,258 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+)
+
+// MaxPubKeysPerMultisig is the largest n bitcoind accepts in createmultisig
+const MaxPubKeysPerMultisig = 16
+
+// ErrNotMultisig is returned when a script is not an m-of-n OP_CHECKMULTISIG template
+var ErrNotMultisig = errors.New("script: not a multisig script")
+
+// Class is a standard script template
+type Class int
+
+const (
+	NonStandard Class = iota
+	PubKey
+	PubKeyHash
+	ScriptHash
+	MultiSig
+	NullData
+	WitnessV0KeyHash
+	WitnessV0ScriptHash
+	WitnessV1Taproot
+	WitnessUnknown
+)
+
+// String returns the template name used in bitcoind's scriptPubKey.type
+func (c Class) String() string {
+	switch c {
+	case PubKey:
+		return "pubkey"
+	case PubKeyHash:
+		return "pubkeyhash"
+	case ScriptHash:
+		return "scripthash"
+	case MultiSig:
+		return "multisig"
+	case NullData:
+		return "nulldata"
+	case WitnessV0KeyHash:
+		return "witness_v0_keyhash"
+	case WitnessV0ScriptHash:
+		return "witness_v0_scripthash"
+	case WitnessV1Taproot:
+		return "witness_v1_taproot"
+	case WitnessUnknown:
+		return "witness_unknown"
+	}
+	return "nonstandard"
+}
+
+// Classify returns the standard template matched by script
+func Classify(script []byte) Class {
+	if version, program, ok := WitnessProgram(script); ok {
+		switch {
+		case version == 0 && len(program) == 20:
+			return WitnessV0KeyHash
+		case version == 0 && len(program) == 32:
+			return WitnessV0ScriptHash
+		case version == 1 && len(program) == 32:
+			return WitnessV1Taproot
+		case version != 0:
+			return WitnessUnknown
+		}
+		return NonStandard
+	}
+
+	switch {
+	case len(script) == 25 && script[0] == OP_DUP && script[1] == OP_HASH160 && script[2] == 20 &&
+		script[23] == OP_EQUALVERIFY && script[24] == OP_CHECKSIG:
+		return PubKeyHash
+	case len(script) == 23 && script[0] == OP_HASH160 && script[1] == 20 && script[22] == OP_EQUAL:
+		return ScriptHash
+	case len(script) > 0 && script[0] == OP_RETURN:
+		if _, err := NullDataPayload(script); err == nil {
+			return NullData
+		}
+		return NonStandard
+	}
+
+	ins, err := Parse(script)
+	if err != nil {
+		return NonStandard
+	}
+	if len(ins) == 2 && ins[1].Op == OP_CHECKSIG && isPubKey(ins[0].Data) {
+		return PubKey
+	}
+	if _, err := ParseMultisig(script); err == nil {
+		return MultiSig
+	}
+	return NonStandard
+}
+
+// WitnessProgram returns the version and program of a native segwit output script
+func WitnessProgram(script []byte) (version int, program []byte, ok bool) {
+	if len(script) < 4 || len(script) > 42 || int(script[1]) != len(script)-2 {
+		return 0, nil, false
+	}
+	v, isSmall := SmallInt(script[0])
+	if !isSmall {
+		return 0, nil, false
+	}
+	return v, script[2:], true
+}
+
+// NullDataPayload returns the concatenated pushes following OP_RETURN
+func NullDataPayload(script []byte) ([]byte, error) {
+	if len(script) == 0 || script[0] != OP_RETURN {
+		return nil, errors.New("script: not an OP_RETURN script")
+	}
+	ins, err := Parse(script[1:])
+	if err != nil {
+		return nil, err
+	}
+	var payload []byte
+	for _, in := range ins {
+		if !in.IsPush() && in.Op > OP_16 {
+			return nil, errors.New("script: OP_RETURN followed by non push opcode")
+		}
+		payload = append(payload, in.Data...)
+	}
+	return payload, nil
+}
+
+func isPubKey(b []byte) bool {
+	switch len(b) {
+	case 33:
+		return b[0] == 0x02 || b[0] == 0x03
+	case 65:
+		return b[0] == 0x04
+	}
+	return false
+}
+
+// SortPubKeys sorts public keys lexicographically as required by BIP67.
+// The input slice is left untouched.
+func SortPubKeys(pubKeys [][]byte) [][]byte {
+	sorted := make([][]byte, len(pubKeys))
+	copy(sorted, pubKeys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return sorted
+}
+
+// A Multisig is a decoded m-of-n OP_CHECKMULTISIG script
+type Multisig struct {
+	// The number of signatures required
+	Required int
+
+	// The public keys in script order
+	PubKeys [][]byte
+}
+
+// IsSorted reports whether the public keys follow the BIP67 order
+func (m *Multisig) IsSorted() bool {
+	return sort.SliceIsSorted(m.PubKeys, func(i, j int) bool {
+		return bytes.Compare(m.PubKeys[i], m.PubKeys[j]) < 0
+	})
+}
+
+// MultisigScript builds an m-of-n OP_CHECKMULTISIG script with the keys in the given order
+func MultisigScript(required int, pubKeys [][]byte) ([]byte, error) {
+	n := len(pubKeys)
+	if n == 0 || n > MaxPubKeysPerMultisig {
+		return nil, fmt.Errorf("script: multisig needs 1 to %d keys, got %d", MaxPubKeysPerMultisig, n)
+	}
+	if required < 1 || required > n {
+		return nil, fmt.Errorf("script: invalid multisig threshold %d of %d", required, n)
+	}
+	b := NewBuilder().AddInt64(int64(required))
+	for i, pk := range pubKeys {
+		if !isPubKey(pk) {
+			return nil, fmt.Errorf("script: invalid public key at index %d", i)
+		}
+		b.AddData(pk)
+	}
+	return b.AddInt64(int64(n)).AddOp(OP_CHECKMULTISIG).Script()
+}
+
+// SortedMultisigScript builds a BIP67 m-of-n redeem or witness script.
+// Witness scripts only accept compressed keys, which is enforced here.
+func SortedMultisigScript(required int, pubKeys [][]byte) ([]byte, error) {
+	for i, pk := range pubKeys {
+		if len(pk) != 33 {
+			return nil, fmt.Errorf("script: public key at index %d is not compressed", i)
+		}
+	}
+	return MultisigScript(required, SortPubKeys(pubKeys))
+}
+
+// ParseMultisig extracts the threshold and public keys of an m-of-n script
+func ParseMultisig(script []byte) (*Multisig, error) {
+	ins, err := Parse(script)
+	if err != nil {
+		return nil, err
+	}
+	if len(ins) < 4 || ins[len(ins)-1].Op != OP_CHECKMULTISIG {
+		return nil, ErrNotMultisig
+	}
+	m, ok := SmallInt(ins[0].Op)
+	if !ok || m == 0 {
+		return nil, ErrNotMultisig
+	}
+	n, ok := SmallInt(ins[len(ins)-2].Op)
+	if !ok || n == 0 || n != len(ins)-3 || m > n {
+		return nil, ErrNotMultisig
+	}
+	keys := make([][]byte, 0, n)
+	for _, in := range ins[1 : len(ins)-2] {
+		if !in.IsPush() || !isPubKey(in.Data) {
+			return nil, ErrNotMultisig
+		}
+		keys = append(keys, append([]byte{}, in.Data...))
+	}
+	return &Multisig{Required: m, PubKeys: keys}, nil
+}
+
+// ParseWitnessMultisig extracts the threshold and public keys from the
+// witness of a P2WSH multisig input (the witness script is the last item)
+func ParseWitnessMultisig(witness [][]byte) (*Multisig, error) {
+	if len(witness) == 0 {
+		return nil, ErrNotMultisig
+	}
+	return ParseMultisig(witness[len(witness)-1])
+}
+
+// VerifyMultisigAddress checks that addr pays to the BIP67 m-of-n witness
+// script of pubKeys, as a native P2WSH or a P2SH wrapped P2WSH.
+func VerifyMultisigAddress(addr *address.Address, required int, pubKeys [][]byte) error {
+	witnessScript, err := SortedMultisigScript(required, pubKeys)
+	if err != nil {
+		return err
+	}
+	wsh := sha256.Sum256(witnessScript)
+	switch addr.Type {
+	case address.WitnessScriptHash:
+		if bytes.Equal(addr.Hash, wsh[:]) {
+			return nil
+		}
+	case address.ScriptHash:
+		redeem := append([]byte{OP_0, 32}, wsh[:]...)
+		if bytes.Equal(addr.Hash, address.Hash160(redeem)) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("script: %s address cannot hold a multisig", addr.Type)
+	}
+	return fmt.Errorf("script: %s is not the %d-of-%d multisig of the given keys", addr, required, len(pubKeys))
+}
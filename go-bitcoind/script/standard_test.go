@@ -0,0 +1,119 @@
+package script
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+)
+
+var _ = Describe("Standard", func() {
+	// BIP67 test vector 1
+	keyA := mustHex("02ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8")
+	keyB := mustHex("02fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f")
+	sortedScript := "522102fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f2102ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f852ae"
+
+	Describe("SortedMultisigScript", func() {
+		It("should match the BIP67 vector", func() {
+			s, err := SortedMultisigScript(2, [][]byte{keyA, keyB})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hex.EncodeToString(s)).To(Equal(sortedScript))
+			a, err := address.NewScriptHashFromScript(s, &address.Params{ScriptHashAddrID: 5})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.String()).To(Equal("39bgKC7RFbpoCRbtD5KEdkYKtNyhpsNa3Z"))
+		})
+		It("should not reorder the caller's slice", func() {
+			keys := [][]byte{keyA, keyB}
+			_, err := SortedMultisigScript(1, keys)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys[0]).To(Equal(keyA))
+		})
+		It("should reject invalid thresholds", func() {
+			_, err := SortedMultisigScript(3, [][]byte{keyA, keyB})
+			Expect(err).To(HaveOccurred())
+			_, err = SortedMultisigScript(0, [][]byte{keyA, keyB})
+			Expect(err).To(HaveOccurred())
+		})
+		It("should reject uncompressed keys", func() {
+			_, err := SortedMultisigScript(1, [][]byte{append([]byte{0x04}, make([]byte, 64)...)})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ParseMultisig", func() {
+		It("should extract threshold and keys", func() {
+			ms, err := ParseMultisig(mustHex(sortedScript))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ms.Required).To(Equal(2))
+			Expect(ms.PubKeys).To(Equal([][]byte{keyB, keyA}))
+			Expect(ms.IsSorted()).To(BeTrue())
+		})
+		It("should read the witness script of a P2WSH input", func() {
+			witness := [][]byte{{}, mustHex("3044"), mustHex("3045"), mustHex(sortedScript)}
+			ms, err := ParseWitnessMultisig(witness)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ms.Required).To(Equal(2))
+			Expect(ms.PubKeys).To(HaveLen(2))
+		})
+		It("should report unsorted keys", func() {
+			s, err := MultisigScript(1, [][]byte{keyA, keyB})
+			Expect(err).NotTo(HaveOccurred())
+			ms, err := ParseMultisig(s)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ms.IsSorted()).To(BeFalse())
+		})
+		It("should reject a key count mismatch", func() {
+			s := mustHex(sortedScript)
+			s[len(s)-2] = OP_3
+			_, err := ParseMultisig(s)
+			Expect(err).To(Equal(ErrNotMultisig))
+		})
+	})
+
+	Describe("Classify", func() {
+		It("should classify standard templates", func() {
+			Expect(Classify(mustHex("76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"))).To(Equal(PubKeyHash))
+			Expect(Classify(mustHex("a914751e76e8199196d454941c45d1b3a323f1433bd687"))).To(Equal(ScriptHash))
+			Expect(Classify(mustHex("0014751e76e8199196d454941c45d1b3a323f1433bd6"))).To(Equal(WitnessV0KeyHash))
+			Expect(Classify(mustHex("0020b4dcb2eee00b7d71c86c08054f0a40b28e6f85572bd79d314accdfb8f30b9f77"))).To(Equal(WitnessV0ScriptHash))
+			Expect(Classify(mustHex("5120b4dcb2eee00b7d71c86c08054f0a40b28e6f85572bd79d314accdfb8f30b9f77"))).To(Equal(WitnessV1Taproot))
+			Expect(Classify(mustHex(sortedScript))).To(Equal(MultiSig))
+			Expect(Classify(append(append([]byte{33}, keyA...), OP_CHECKSIG))).To(Equal(PubKey))
+			Expect(Classify(mustHex("6a0568656c6c6f"))).To(Equal(NullData))
+			Expect(Classify(mustHex("51"))).To(Equal(NonStandard))
+		})
+		It("should use bitcoind type names", func() {
+			Expect(WitnessV0ScriptHash.String()).To(Equal("witness_v0_scripthash"))
+			Expect(NullData.String()).To(Equal("nulldata"))
+		})
+	})
+
+	Describe("NullDataPayload", func() {
+		It("should return the pushed bytes", func() {
+			p, err := NullDataPayload(mustHex("6a0568656c6c6f"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(p)).To(Equal("hello"))
+		})
+	})
+
+	Describe("VerifyMultisigAddress", func() {
+		wsh := mustHex("b4dcb2eee00b7d71c86c08054f0a40b28e6f85572bd79d314accdfb8f30b9f77")
+
+		It("should accept the P2WSH of the sorted relayer set", func() {
+			a, err := address.NewWitnessScriptHash(wsh, &address.MainNetParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(VerifyMultisigAddress(a, 2, [][]byte{keyA, keyB})).To(Succeed())
+		})
+		It("should accept the P2SH wrapped P2WSH", func() {
+			a, err := address.Decode("ARGCSsweUgiouqXJSKQ3ScQLgBpKc36NQw", &address.MainNetParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(VerifyMultisigAddress(a, 2, [][]byte{keyB, keyA})).To(Succeed())
+		})
+		It("should reject another threshold", func() {
+			a, err := address.NewWitnessScriptHash(wsh, &address.MainNetParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(VerifyMultisigAddress(a, 1, [][]byte{keyA, keyB})).NotTo(Succeed())
+		})
+	})
+})
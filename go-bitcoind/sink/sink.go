@@ -0,0 +1,211 @@
+// Package sink publishes the deposit changes to several outputs at once:
+// JSON lines on stdout or in a file, webhooks, a NATS stream. Each change is
+// queued for every sink in the store's outbox, in the transaction of the
+// change, and the Dispatcher publishes each sink's queue in order, retrying
+// a failed event with exponential backoff before moving to the next. A slow
+// or failing sink never holds the others back.
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+)
+
+// A DepositEvent is a change of a deposit's state or confirmations. The
+// spending of a deposit is a withdrawal event: its state is spent and it
+// carries the withdrawal. The rejection of a deposit out of the bridge's
+// limits is a rejection event: its status is rejected and it carries the
+// reason.
+type DepositEvent struct {
+	// ID numbers the events, it is the same in every sink and across retries
+	ID uint64 `json:"id"`
+
+	OutPoint      string        `json:"outpoint"`
+	Address       string        `json:"address"`
+	Amount        int64         `json:"amount"` // in satoshis
+	Confirmations uint32        `json:"confirmations"`
+	BlockHash     string        `json:"blockHash,omitempty"`
+	Height        uint64        `json:"height,omitempty"`
+	State         deposit.State `json:"state"`
+	PreviousState deposit.State `json:"previousState,omitempty"` // empty for a new deposit
+	Nonce         uint64        `json:"nonce"`
+	Status        store.Status  `json:"status"`
+	Reason        string        `json:"reason,omitempty"`
+	Time          time.Time     `json:"time"`
+
+	// Withdrawal is the transaction spending a spent deposit, when known
+	Withdrawal *deposit.Withdrawal `json:"withdrawal,omitempty"`
+}
+
+// NewDepositEvent returns the event of a change
+func NewDepositEvent(id uint64, c *store.Change) DepositEvent {
+	r := c.Record
+	return DepositEvent{
+		ID:            id,
+		OutPoint:      r.OutPoint,
+		Address:       r.Address,
+		Amount:        r.Amount,
+		Confirmations: r.Confirmations,
+		BlockHash:     r.Block,
+		Height:        r.Height,
+		State:         r.State,
+		PreviousState: c.From,
+		Nonce:         r.Nonce,
+		Status:        r.Status,
+		Reason:        r.Reason,
+		Time:          r.UpdatedAt,
+		Withdrawal:    r.SpentBy,
+	}
+}
+
+// Render queues the event of a change as JSON, it is the store.Notify renderer
+func Render(id uint64, c *store.Change) ([]byte, error) {
+	return json.Marshal(NewDepositEvent(id, c))
+}
+
+// A Sink publishes the events. Publish returns once the event is accepted;
+// on error the same event is published again later, so the sinks receive
+// each event at least once.
+type Sink interface {
+	Publish(ctx context.Context, e DepositEvent) error
+}
+
+// Default settings of a Dispatcher
+const (
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = time.Hour
+	DefaultTimeout    = 10 * time.Second
+)
+
+// A Dispatcher publishes the events queued in a store's outbox to the sinks
+type Dispatcher struct {
+	store *store.Store
+	sinks map[string]Sink
+
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Timeout    time.Duration // of a Publish
+
+	now func() time.Time
+}
+
+// NewDispatcher makes st queue every deposit change for each sink and
+// returns the dispatcher publishing them. Sinks are named after their
+// queue: the events queued for a name no longer configured are dropped.
+// It must be called before st is used.
+func NewDispatcher(st *store.Store, sinks map[string]Sink) *Dispatcher {
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	st.Notify(names, Render)
+	return &Dispatcher{
+		store:      st,
+		sinks:      sinks,
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		Timeout:    DefaultTimeout,
+		now:        time.Now,
+	}
+}
+
+// Dispatch publishes the events that are due, oldest first for each sink.
+// It returns the number of events published and the last failure, if any.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	queued, err := d.store.Outbox()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		published int
+		lastErr   error
+		blocked   = make(map[string]bool) // sinks with an earlier event pending
+	)
+	for _, m := range queued {
+		s, ok := d.sinks[m.Target]
+		if !ok {
+			if err := d.store.Delivered(m.ID); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if blocked[m.Target] || ctx.Err() != nil {
+			continue
+		}
+		now := d.now()
+		if m.NextAttempt.After(now) {
+			blocked[m.Target] = true
+			continue
+		}
+		if err := d.publish(ctx, s, m); err != nil {
+			if ctx.Err() != nil {
+				// stopping, not a failure of the sink
+				return published, nil
+			}
+			lastErr = fmt.Errorf("sink %s: message %d: %v", m.Target, m.ID, err)
+			blocked[m.Target] = true
+			if err := d.store.Postpone(m.ID, now.Add(d.backoff(m.Attempts)), err); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if err := d.store.Delivered(m.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, lastErr
+}
+
+func (d *Dispatcher) publish(ctx context.Context, s Sink, m *store.Message) error {
+	var e DepositEvent
+	if err := json.Unmarshal(m.Payload, &e); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+	return s.Publish(ctx, e)
+}
+
+// Run dispatches the events every interval until stop is closed, failures
+// are passed to onErr
+func (d *Dispatcher) Run(interval time.Duration, stop <-chan struct{}, onErr func(error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		if _, err := d.Dispatch(ctx); err != nil && ctx.Err() == nil {
+			onErr(err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// backoff returns the delay before the retry of an event that failed attempts times before
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	b := d.MinBackoff
+	for i := 0; i < attempts && b < d.MaxBackoff; i++ {
+		b *= 2
+	}
+	if b > d.MaxBackoff {
+		b = d.MaxBackoff
+	}
+	return b
+}
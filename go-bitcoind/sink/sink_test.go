@@ -0,0 +1,212 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+const txA = "f35103085b7145e569eb8053365c662cb7b9b7fd6009e37cafbb684bd89b638b"
+
+// recorder is a sink keeping the events, it fails while down
+type recorder struct {
+	mu     sync.Mutex
+	down   bool
+	events []DepositEvent
+}
+
+func (r *recorder) Publish(ctx context.Context, e DepositEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.down {
+		return errors.New("down")
+	}
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recorder) outpoints() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ops []string
+	for _, e := range r.events {
+		ops = append(ops, e.OutPoint)
+	}
+	return ops
+}
+
+var _ = Describe("Dispatcher", func() {
+	var (
+		dir    string
+		path   string
+		st     *store.Store
+		a, b   *recorder
+		d      *Dispatcher
+		now    time.Time
+		policy *deposit.Policy
+		ctx    = context.Background()
+	)
+
+	open := func(sinks map[string]Sink) {
+		var err error
+		st, err = store.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		d = NewDispatcher(st, sinks)
+		d.now = func() time.Time { return now }
+	}
+	observe := func(vout uint32, confirmations uint32) {
+		op, _ := wire.NewOutPoint(txA, vout)
+		dep := &deposit.Deposit{OutPoint: op, Address: "btg1q", Amount: 1000, ScriptPubKey: []byte{0}, Confirmations: confirmations}
+		if confirmations > 0 {
+			dep.Block, dep.Height = "00ab", 100
+		}
+		_, _, err := st.Observe(dep, policy)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "sink")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "state.db")
+		policy, err = deposit.NewPolicy(2, nil)
+		Expect(err).NotTo(HaveOccurred())
+		// events are queued at the real time, ahead of the first attempts
+		now = time.Now().Add(time.Minute)
+		a, b = &recorder{}, &recorder{}
+		open(map[string]Sink{"a": a, "b": b})
+	})
+	AfterEach(func() {
+		st.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should publish every change to every sink", func() {
+		observe(0, 0)
+		observe(0, 1)
+		published, err := d.Dispatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(published).To(Equal(4))
+
+		Expect(a.events).To(Equal(b.events))
+		Expect(a.events).To(HaveLen(2))
+		e := a.events[1]
+		Expect(e.ID).To(Equal(uint64(2)))
+		Expect(e.OutPoint).To(Equal(txA + ":0"))
+		Expect(e.Address).To(Equal("btg1q"))
+		Expect(e.Amount).To(Equal(int64(1000)))
+		Expect(e.Confirmations).To(Equal(uint32(1)))
+		Expect(e.BlockHash).To(Equal("00ab"))
+		Expect(e.Height).To(Equal(uint64(100)))
+		Expect(e.State).To(Equal(deposit.StateConfirmed))
+		Expect(e.PreviousState).To(Equal(deposit.StateMempool))
+		Expect(e.Nonce).To(Equal(uint64(100) << 40))
+
+		published, _ = d.Dispatch(ctx)
+		Expect(published).To(BeZero())
+	})
+
+	It("should publish the withdrawal spending a deposit", func() {
+		observe(0, 3)
+		w := &deposit.Withdrawal{TxID: "ee", Spent: []string{txA + ":0"}, Outputs: []deposit.Output{{Amount: 900, Script: []byte{0x51}}}, Fee: 100}
+		_, err := st.Spend(w)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = d.Dispatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(a.events).To(HaveLen(2))
+		Expect(a.events[0].Withdrawal).To(BeNil())
+		e := a.events[1]
+		Expect(e.State).To(Equal(deposit.StateSpent))
+		Expect(e.PreviousState).To(Equal(deposit.StateFinal))
+		Expect(e.Withdrawal).To(Equal(w))
+	})
+
+	It("should publish the rejection of a deposit", func() {
+		observe(0, 3)
+		op, _ := wire.NewOutPoint(txA, 0)
+		_, err := st.Reject(op, "deposit: amount 1000 is below the minimum 5000")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = d.Dispatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(a.events).To(HaveLen(2))
+		Expect(a.events[0].Status).To(Equal(store.StatusPending))
+		e := a.events[1]
+		Expect(e.State).To(Equal(deposit.StateFinal))
+		Expect(e.PreviousState).To(Equal(deposit.StateFinal))
+		Expect(e.Status).To(Equal(store.StatusRejected))
+		Expect(e.Reason).To(ContainSubstring("below the minimum"))
+	})
+
+	It("should retry a failing sink in order with exponential backoff, across restarts", func() {
+		a.down = true
+		observe(0, 0)
+		observe(1, 0)
+		published, err := d.Dispatch(ctx)
+		Expect(err).To(MatchError(ContainSubstring("sink a")))
+		Expect(published).To(Equal(2)) // b is not held back
+		Expect(b.outpoints()).To(Equal([]string{txA + ":0", txA + ":1"}))
+
+		queued, _ := st.Outbox()
+		Expect(queued).To(HaveLen(2))
+		Expect(queued[0].Attempts).To(Equal(1))
+		Expect(queued[0].NextAttempt.Equal(now.Add(time.Second))).To(BeTrue())
+		Expect(queued[1].Attempts).To(BeZero()) // waits for the first one
+
+		now = now.Add(time.Second)
+		d.Dispatch(ctx)
+		queued, _ = st.Outbox()
+		Expect(queued[0].NextAttempt.Equal(now.Add(2 * time.Second))).To(BeTrue())
+
+		st.Close()
+		open(map[string]Sink{"a": a, "b": b})
+		a.down = false
+		published, _ = d.Dispatch(ctx)
+		Expect(published).To(BeZero())
+
+		now = now.Add(2 * time.Second)
+		published, err = d.Dispatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(published).To(Equal(2))
+		Expect(a.outpoints()).To(Equal([]string{txA + ":0", txA + ":1"}))
+	})
+
+	It("should drop the events of a sink removed from the configuration", func() {
+		a.down = true
+		observe(0, 0)
+		d.Dispatch(ctx)
+		st.Close()
+
+		open(map[string]Sink{"b": b})
+		d.Dispatch(ctx)
+		queued, _ := st.Outbox()
+		Expect(queued).To(BeEmpty())
+	})
+
+	It("should cap the backoff", func() {
+		Expect(d.backoff(0)).To(Equal(time.Second))
+		Expect(d.backoff(3)).To(Equal(8 * time.Second))
+		Expect(d.backoff(40)).To(Equal(time.Hour))
+	})
+
+	It("should publish while running", func() {
+		stop := make(chan struct{})
+		defer close(stop)
+		go d.Run(10*time.Millisecond, stop, func(error) {})
+		observe(0, 0)
+		observe(1, 0)
+		Eventually(b.outpoints).Should(Equal([]string{txA + ":0", txA + ":1"}))
+	})
+})
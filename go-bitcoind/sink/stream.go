@@ -0,0 +1,136 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Stream publishes the events to a subject of a NATS server, or of any
+// local stand-in speaking the NATS client protocol, over TCP or a Unix
+// socket. An event is acknowledged once the server answered the PING
+// following its PUB, the server handling the commands of a connection in
+// order.
+type Stream struct {
+	network string
+	address string
+	subject string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewStream returns a sink publishing on subject at network ("tcp" or
+// "unix") address. The connection is opened by the first event and again
+// after a failure.
+func NewStream(network, address, subject string) *Stream {
+	return &Stream{network: network, address: address, subject: subject}
+}
+
+// Publish implements Sink
+func (s *Stream) Publish(ctx context.Context, e DepositEvent) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	// the deadline of ctx, or its cancellation, ends a blocked exchange
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetDeadline(deadline)
+	} else {
+		s.conn.SetDeadline(time.Time{})
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func(conn net.Conn) {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}(s.conn)
+
+	if err := s.exchange(payload); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *Stream) connect(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err == nil && !strings.HasPrefix(line, "INFO") {
+		err = fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	if err == nil {
+		_, err = conn.Write([]byte(`CONNECT {"verbose":false,"pedantic":false,"name":"watchUTXO"}` + "\r\n"))
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	s.conn, s.r = conn, r
+	return nil
+}
+
+// exchange sends the event and waits for the server to have handled it
+func (s *Stream) exchange(payload []byte) error {
+	msg := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", s.subject, len(payload), payload)
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		return err
+	}
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("stream: " + line)
+		}
+		// +OK and INFO updates need no answer
+	}
+}
+
+// Close closes the connection
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,172 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// standIn serves the part of the NATS client protocol a publisher uses
+type standIn struct {
+	l net.Listener
+
+	mu       sync.Mutex
+	subjects []string
+	events   []DepositEvent
+	reject   bool
+}
+
+func newStandIn(network, address string) *standIn {
+	l, err := net.Listen(network, address)
+	Expect(err).NotTo(HaveOccurred())
+	s := &standIn{l: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *standIn) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"stand-in\",\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PUB":
+			var size int
+			fmt.Sscan(fields[len(fields)-1], &size)
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.mu.Lock()
+			reject := s.reject
+			if !reject {
+				var e DepositEvent
+				json.Unmarshal(payload[:size], &e)
+				s.subjects = append(s.subjects, fields[1])
+				s.events = append(s.events, e)
+			}
+			s.mu.Unlock()
+			if reject {
+				fmt.Fprintf(conn, "-ERR 'Permissions Violation for Publish to %s'\r\n", fields[1])
+				return
+			}
+		case "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+		}
+	}
+}
+
+func (s *standIn) ids() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []uint64
+	for _, e := range s.events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+var _ = Describe("Stream", func() {
+	var (
+		dir    string
+		sock   string
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		var err error
+		dir, err = ioutil.TempDir("", "stream")
+		Expect(err).NotTo(HaveOccurred())
+		sock = filepath.Join(dir, "events.sock")
+	})
+	AfterEach(func() {
+		cancel()
+		os.RemoveAll(dir)
+	})
+
+	It("should publish the events on the subject over a Unix socket", func() {
+		server := newStandIn("unix", sock)
+		defer server.l.Close()
+		s := NewStream("unix", sock, "watchutxo.deposits")
+		defer s.Close()
+
+		Expect(s.Publish(ctx, DepositEvent{ID: 1, OutPoint: txA + ":0"})).To(Succeed())
+		Expect(s.Publish(ctx, DepositEvent{ID: 2, OutPoint: txA + ":1"})).To(Succeed())
+		// acknowledged events were handled by the server
+		Expect(server.ids()).To(Equal([]uint64{1, 2}))
+		Expect(server.subjects).To(Equal([]string{"watchutxo.deposits", "watchutxo.deposits"}))
+	})
+
+	It("should report the errors of the server and reconnect", func() {
+		server := newStandIn("tcp", "127.0.0.1:0")
+		defer server.l.Close()
+		s := NewStream("tcp", server.l.Addr().String(), "deposits")
+		defer s.Close()
+
+		server.reject = true
+		err := s.Publish(ctx, DepositEvent{ID: 1})
+		Expect(err).To(MatchError(ContainSubstring("Permissions Violation")))
+
+		server.mu.Lock()
+		server.reject = false
+		server.mu.Unlock()
+		Expect(s.Publish(ctx, DepositEvent{ID: 1})).To(Succeed())
+		Expect(server.ids()).To(Equal([]uint64{1}))
+	})
+
+	It("should fail while the server is down", func() {
+		s := NewStream("unix", sock, "deposits")
+		Expect(s.Publish(ctx, DepositEvent{ID: 1})).NotTo(Succeed())
+
+		server := newStandIn("unix", sock)
+		defer server.l.Close()
+		Expect(s.Publish(ctx, DepositEvent{ID: 1})).To(Succeed())
+	})
+
+	It("should give up when the context is done", func() {
+		l, err := net.Listen("unix", sock)
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		go func() {
+			// greets, then never answers
+			conn, err := l.Accept()
+			if err == nil {
+				fmt.Fprintf(conn, "INFO {}\r\n")
+			}
+		}()
+		s := NewStream("unix", sock, "deposits")
+		short, stop := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer stop()
+		Expect(s.Publish(short, DepositEvent{ID: 1})).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,61 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// A Writer writes the events as JSON lines
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriter returns a sink writing to w, e.g. os.Stdout
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Publish implements Sink
+func (s *Writer) Publish(ctx context.Context, e DepositEvent) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// A File appends the events as JSON lines to a file, synced before an event
+// is acknowledged
+type File struct {
+	Writer
+	f *os.File
+}
+
+// OpenFile opens or creates the file at path
+func OpenFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Writer: Writer{w: f}, f: f}, nil
+}
+
+// Publish implements Sink
+func (s *File) Publish(ctx context.Context, e DepositEvent) error {
+	if err := s.Writer.Publish(ctx, e); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Close closes the file
+func (s *File) Close() error {
+	return s.f.Close()
+}
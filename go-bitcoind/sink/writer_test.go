@@ -0,0 +1,43 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+)
+
+var _ = Describe("Writer", func() {
+	It("should write one JSON line per event", func() {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		Expect(w.Publish(context.Background(), DepositEvent{ID: 1, OutPoint: txA + ":0", State: deposit.StateMempool})).To(Succeed())
+		Expect(w.Publish(context.Background(), DepositEvent{ID: 2, OutPoint: txA + ":0", State: deposit.StateFinal})).To(Succeed())
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		Expect(lines).To(HaveLen(2))
+		Expect(string(lines[1])).To(HavePrefix(`{"id":2,"outpoint":"` + txA + `:0"`))
+		Expect(string(lines[1])).To(ContainSubstring(`"state":"final"`))
+	})
+
+	It("should append to a file", func() {
+		dir, err := ioutil.TempDir("", "sink")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "events.jsonl")
+		for i := uint64(1); i <= 2; i++ {
+			f, err := OpenFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Publish(context.Background(), DepositEvent{ID: i})).To(Succeed())
+			Expect(f.Close()).To(Succeed())
+		}
+		b, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Count(b, []byte("\n"))).To(Equal(2))
+	})
+})
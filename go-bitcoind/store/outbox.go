@@ -0,0 +1,137 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNoMessage is returned when no message is queued with an id
+var ErrNoMessage = errors.New("store: message not found")
+
+// A Message is a notification waiting in the outbox until its target
+// acknowledges it
+type Message struct {
+	ID          uint64    `json:"id"`
+	Target      string    `json:"target"`
+	Payload     []byte    `json:"payload"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// notify renders the changes into outbox messages
+type notify struct {
+	targets []string
+	render  func(id uint64, c *Change) ([]byte, error)
+}
+
+// Notify makes every deposit change queue a message for each target, in the
+// same transaction as the change, so no notification is lost by a crash.
+// render gives the payload of a change, id numbers the changes and is the
+// same for every target. Notify must be called before the store is used.
+func (s *Store) Notify(targets []string, render func(id uint64, c *Change) ([]byte, error)) {
+	s.notify = &notify{targets: targets, render: render}
+}
+
+// Publish queues the messages of changes of deposits that are not stored,
+// e.g. seen in the mempool, if the store notifies them
+func (s *Store) Publish(changes ...*Change) error {
+	if s.notify == nil {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.enqueue(tx, changes...)
+	})
+}
+
+// enqueue queues the messages of changes, if the store notifies them
+func (s *Store) enqueue(tx *bolt.Tx, changes ...*Change) error {
+	if s.notify == nil {
+		return nil
+	}
+	b := tx.Bucket(outboxBucket)
+	meta := tx.Bucket(metaBucket)
+	now := time.Now().UTC()
+	for _, c := range changes {
+		var event uint64
+		if v := meta.Get(eventKey); v != nil {
+			event = binary.BigEndian.Uint64(v)
+		}
+		event++
+		if err := meta.Put(eventKey, uint64Key(event)); err != nil {
+			return err
+		}
+		payload, err := s.notify.render(event, c)
+		if err != nil {
+			return err
+		}
+		for _, target := range s.notify.targets {
+			id, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			m := &Message{ID: id, Target: target, Payload: payload, CreatedAt: now, NextAttempt: now}
+			if err := putMessage(b, m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func putMessage(b *bolt.Bucket, m *Message) error {
+	v, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return b.Put(uint64Key(m.ID), v)
+}
+
+// Outbox returns the queued messages, oldest first
+func (s *Store) Outbox() ([]*Message, error) {
+	var queued []*Message
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(outboxBucket).ForEach(func(k, v []byte) error {
+			m := &Message{}
+			if err := json.Unmarshal(v, m); err != nil {
+				return err
+			}
+			queued = append(queued, m)
+			return nil
+		})
+	})
+	return queued, err
+}
+
+// Delivered removes an acknowledged message from the outbox
+func (s *Store) Delivered(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(outboxBucket).Delete(uint64Key(id))
+	})
+}
+
+// Postpone records a failed delivery of a message and when to retry it
+func (s *Store) Postpone(id uint64, next time.Time, cause error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(outboxBucket)
+		v := b.Get(uint64Key(id))
+		if v == nil {
+			return ErrNoMessage
+		}
+		m := &Message{}
+		if err := json.Unmarshal(v, m); err != nil {
+			return err
+		}
+		m.Attempts++
+		m.NextAttempt = next.UTC()
+		if cause != nil {
+			m.LastError = cause.Error()
+		}
+		return putMessage(b, m)
+	})
+}
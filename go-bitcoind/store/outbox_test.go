@@ -0,0 +1,112 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+)
+
+var _ = Describe("Outbox", func() {
+	const txA = "f35103085b7145e569eb8053365c662cb7b9b7fd6009e37cafbb684bd89b638b"
+
+	var (
+		dir    string
+		path   string
+		s      *Store
+		policy *deposit.Policy
+	)
+	render := func(id uint64, c *Change) ([]byte, error) {
+		return []byte(fmt.Sprintf("%d %s %s", id, c.Record.OutPoint, c.Record.State)), nil
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "outbox")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "state.db")
+		s, err = Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		s.Notify([]string{"a", "b"}, render)
+		policy, err = deposit.NewPolicy(2, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		s.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should queue a message per target with every change", func() {
+		d := testDeposit(txA, 0, 100)
+		d.Confirmations = 1
+		d.Block, d.Height = "00aa", 10
+		r, _, err := s.Observe(d, policy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Block).To(Equal("00aa"))
+		s.Observe(d, policy) // unchanged
+		_, err = s.ConnectBlock(Tip{Hash: "bb", Height: 11}, "", []*deposit.Deposit{testDeposit(txA, 1, 100)}, nil, policy)
+		Expect(err).NotTo(HaveOccurred())
+
+		queued, err := s.Outbox()
+		Expect(err).NotTo(HaveOccurred())
+		// the block also makes the first deposit final
+		Expect(queued).To(HaveLen(6))
+		Expect(queued[0].Target).To(Equal("a"))
+		Expect(queued[1].Target).To(Equal("b"))
+		var payloads []string
+		for _, m := range queued[1:] {
+			if m.Target == "b" {
+				payloads = append(payloads, string(m.Payload))
+			}
+		}
+		Expect(payloads).To(Equal([]string{"1 " + txA + ":0 confirmed", "2 " + txA + ":1 confirmed", "3 " + txA + ":0 final"}))
+	})
+
+	It("should keep undelivered messages across restarts until delivered", func() {
+		s.Observe(testDeposit(txA, 0, 100), policy)
+		queued, _ := s.Outbox()
+		Expect(queued).To(HaveLen(2))
+		Expect(s.Delivered(queued[0].ID)).To(Succeed())
+
+		later := time.Now().Add(time.Minute)
+		Expect(s.Postpone(queued[1].ID, later, errors.New("503 Service Unavailable"))).To(Succeed())
+		Expect(s.Postpone(42, later, nil)).To(Equal(ErrNoMessage))
+
+		Expect(s.Close()).To(Succeed())
+		var err error
+		s, err = Open(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		queued, _ = s.Outbox()
+		Expect(queued).To(HaveLen(1))
+		Expect(queued[0].NextAttempt.Equal(later)).To(BeTrue())
+		Expect(queued[0].Attempts).To(Equal(1))
+		Expect(queued[0].LastError).To(Equal("503 Service Unavailable"))
+	})
+
+	It("should queue the changes of deposits that are not stored", func() {
+		r := &Record{OutPoint: txA + ":0", Amount: 100, Status: StatusPending, State: deposit.StateMempool}
+		Expect(s.Publish(&Change{Record: r})).To(Succeed())
+		queued, err := s.Outbox()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queued).To(HaveLen(2))
+		Expect(string(queued[0].Payload)).To(Equal("1 " + txA + ":0 mempool"))
+		seen, _ := s.Seen(testDeposit(txA, 0, 100).OutPoint)
+		Expect(seen).To(BeFalse())
+	})
+
+	It("should not record a change whose message can't be rendered", func() {
+		s.Notify([]string{"a"}, func(uint64, *Change) ([]byte, error) { return nil, errors.New("boom") })
+		_, _, err := s.Observe(testDeposit(txA, 0, 100), policy)
+		Expect(err).To(HaveOccurred())
+		seen, _ := s.Seen(testDeposit(txA, 0, 100).OutPoint)
+		Expect(seen).To(BeFalse())
+	})
+})
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNoPayout is returned when no payout is stored for a transfer
+var ErrNoPayout = errors.New("store: payout not found")
+
+// PayoutStatus is the progress of a payout
+type PayoutStatus string
+
+// Payout statuses
+const (
+	// PayoutSigning payouts wait for the signatures of the multisig
+	PayoutSigning PayoutStatus = "signing"
+
+	// PayoutBroadcast payouts were sent to the network
+	PayoutBroadcast PayoutStatus = "broadcast"
+
+	// PayoutFailed payouts can't be paid, e.g. their recipient is not an
+	// address. They wait for the operators.
+	PayoutFailed PayoutStatus = "failed"
+)
+
+// A Payout is the stored state of the withdrawal paying a transfer from
+// another chain, identified by its source chain and deposit nonce
+type Payout struct {
+	Source    uint8        `json:"source"`
+	Nonce     uint64       `json:"nonce"`
+	Recipient string       `json:"recipient,omitempty"`
+	Amount    int64        `json:"amount"` // of the transfer, paid to the recipient the fee deducted
+	Fee       int64        `json:"fee"`    // deducted by the current withdrawal
+	Status    PayoutStatus `json:"status"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+
+	// Why the payout failed
+	Reason string `json:"reason,omitempty"`
+
+	// The outpoints the withdrawals of the payout spend, "txid:vout", and
+	// the current withdrawal as a base64 PSBT holding the signatures
+	// gathered so far
+	Inputs []string `json:"inputs,omitempty"`
+	PSBT   string   `json:"psbt,omitempty"`
+
+	// An input of the first withdrawal signed for the payout. Every
+	// withdrawal signed after spends it too, so at most one is mined.
+	Anchor string `json:"anchor,omitempty"`
+
+	// The withdrawal's txid once broadcast
+	TxID string `json:"txid,omitempty"`
+}
+
+// payoutKey encodes a transfer as its source chain followed by the big
+// endian nonce
+func payoutKey(source uint8, nonce uint64) []byte {
+	k := make([]byte, 9)
+	k[0] = source
+	binary.BigEndian.PutUint64(k[1:], nonce)
+	return k
+}
+
+// Payout returns the payout of the transfer nonce from source, or ErrNoPayout
+func (s *Store) Payout(source uint8, nonce uint64) (*Payout, error) {
+	var p *Payout
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(payoutsBucket).Get(payoutKey(source, nonce))
+		if v == nil {
+			return ErrNoPayout
+		}
+		p = &Payout{}
+		return json.Unmarshal(v, p)
+	})
+	return p, err
+}
+
+// PutPayout stores p, replacing the payout of the same transfer
+func (s *Store) PutPayout(p *Payout) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		p.UpdatedAt = time.Now().UTC()
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = p.UpdatedAt
+		}
+		v, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(payoutsBucket).Put(payoutKey(p.Source, p.Nonce), v)
+	})
+}
+
+// Payouts returns the payouts with a status, by source chain and nonce
+func (s *Store) Payouts(status PayoutStatus) ([]*Payout, error) {
+	var payouts []*Payout
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(payoutsBucket).ForEach(func(k, v []byte) error {
+			p := &Payout{}
+			if err := json.Unmarshal(v, p); err != nil {
+				return err
+			}
+			if p.Status == status {
+				payouts = append(payouts, p)
+			}
+			return nil
+		})
+	})
+	return payouts, err
+}
+
+// Reserved returns the outpoints spent by the payouts that did not fail, so
+// no other payout spends them
+func (s *Store) Reserved() (map[string]bool, error) {
+	reserved := make(map[string]bool)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(payoutsBucket).ForEach(func(k, v []byte) error {
+			p := &Payout{}
+			if err := json.Unmarshal(v, p); err != nil {
+				return err
+			}
+			if p.Status == PayoutFailed {
+				return nil
+			}
+			for _, op := range p.Inputs {
+				reserved[op] = true
+			}
+			return nil
+		})
+	})
+	return reserved, err
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Payouts", func() {
+	const txA = "f35103085b7145e569eb8053365c662cb7b9b7fd6009e37cafbb684bd89b638b"
+
+	var (
+		dir string
+		s   *Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "payouts")
+		Expect(err).NotTo(HaveOccurred())
+		s, err = Open(filepath.Join(dir, "state.db"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		s.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should store the payouts by source chain and nonce", func() {
+		_, err := s.Payout(1, 7)
+		Expect(err).To(Equal(ErrNoPayout))
+
+		p := &Payout{Source: 1, Nonce: 7, Recipient: "btg1q", Amount: 90000, Fee: 10000, Status: PayoutSigning, Inputs: []string{txA + ":0"}, PSBT: "cHNidP8="}
+		Expect(s.PutPayout(p)).To(Succeed())
+		got, err := s.Payout(1, 7)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Recipient).To(Equal("btg1q"))
+		Expect(got.Inputs).To(Equal(p.Inputs))
+		Expect(got.UpdatedAt.IsZero()).To(BeFalse())
+		Expect(got.CreatedAt).To(Equal(got.UpdatedAt))
+		created := got.CreatedAt
+
+		// the same nonce from another chain is another transfer
+		_, err = s.Payout(2, 7)
+		Expect(err).To(Equal(ErrNoPayout))
+
+		got.Status, got.TxID = PayoutBroadcast, txA
+		Expect(s.PutPayout(got)).To(Succeed())
+		got, err = s.Payout(1, 7)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Status).To(Equal(PayoutBroadcast))
+		Expect(got.TxID).To(Equal(txA))
+		Expect(got.CreatedAt.Equal(created)).To(BeTrue())
+	})
+
+	It("should reserve the inputs of the payouts that did not fail", func() {
+		Expect(s.PutPayout(&Payout{Source: 1, Nonce: 1, Status: PayoutSigning, Inputs: []string{txA + ":0"}})).To(Succeed())
+		Expect(s.PutPayout(&Payout{Source: 1, Nonce: 2, Status: PayoutBroadcast, Inputs: []string{txA + ":1"}})).To(Succeed())
+		Expect(s.PutPayout(&Payout{Source: 1, Nonce: 3, Status: PayoutFailed, Inputs: []string{txA + ":2"}})).To(Succeed())
+
+		reserved, err := s.Reserved()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reserved).To(Equal(map[string]bool{txA + ":0": true, txA + ":1": true}))
+
+		signing, err := s.Payouts(PayoutSigning)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signing).To(HaveLen(1))
+		Expect(signing[0].Nonce).To(Equal(uint64(1)))
+	})
+})
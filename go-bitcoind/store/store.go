@@ -0,0 +1,684 @@
+// Package store persists the watcher state in a local bbolt file: the
+// deposits seen with their nonce and status, the last processed block, the
+// hash chain leading to it, the outbox of the notifications to deliver and
+// the payouts of the transfers to the chain.
+// Every update is a single bolt transaction, so a crash leaves either the
+// previous or the new state on disk.
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	depositsBucket = []byte("deposits")
+	metaBucket     = []byte("meta")
+	blocksBucket   = []byte("blocks")
+	outboxBucket   = []byte("outbox")
+	payoutsBucket  = []byte("payouts")
+
+	eventKey = []byte("event")
+	tipKey   = []byte("tip")
+)
+
+var (
+	// ErrNotFound is returned when no deposit is stored at an outpoint
+	ErrNotFound = errors.New("store: deposit not found")
+
+	// ErrNoBlock is returned when no block is stored at a height
+	ErrNoBlock = errors.New("store: no block at this height")
+
+	// ErrNotConnected is returned when a block does not extend the stored tip
+	ErrNotConnected = errors.New("store: block does not extend the stored tip")
+)
+
+// Status is the delivery status of a deposit, independent of its lifecycle
+// state on chain
+type Status string
+
+// Deposit statuses
+const (
+	// StatusPending deposits were not confirmed as routed. They are routed
+	// once final, and again with the same nonce after a restart if the send
+	// was not confirmed.
+	StatusPending Status = "pending"
+
+	// StatusSent deposits were handed to the router
+	StatusSent Status = "sent"
+
+	// StatusQuarantined deposits can't be routed, e.g. their recipient is
+	// missing or malformed. They wait for the operators.
+	StatusQuarantined Status = "quarantined"
+
+	// StatusRejected deposits are out of the bridge's limits, e.g. below the
+	// minimum amount. They are never routed.
+	StatusRejected Status = "rejected"
+)
+
+// A Record is the stored state of a deposit
+type Record struct {
+	OutPoint  string    `json:"outpoint"`
+	Address   string    `json:"address"`
+	Amount    int64     `json:"amount"`
+	Script    []byte    `json:"script"`
+	Nonce     uint64    `json:"nonce"` // 0 until the block of the deposit is known
+	Status    Status    `json:"status"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Why the deposit is quarantined or rejected, or the mempool event of a
+	// published deposit that is not stored
+	Reason string `json:"reason,omitempty"`
+
+	// The block the deposit was found in and the index of its transaction
+	// in the block, when known
+	Height  uint64 `json:"height,omitempty"`
+	Block   string `json:"block,omitempty"`
+	TxIndex uint32 `json:"txIndex,omitempty"`
+
+	// The lifecycle state and the confirmations it was computed from.
+	// Confirmations are no longer updated once the deposit is final.
+	State         deposit.State `json:"state"`
+	Confirmations uint32        `json:"confirmations"`
+
+	// The withdrawal spending the deposit, once known, and the state the
+	// deposit had before, restored if the withdrawal's block is rolled back
+	SpentBy   *deposit.Withdrawal `json:"spentBy,omitempty"`
+	SpentFrom deposit.State       `json:"spentFrom,omitempty"`
+}
+
+// A Change is a lifecycle transition of a stored deposit: a new state, or
+// new confirmations of a deposit that is not final yet
+type Change struct {
+	Record            *Record
+	From              deposit.State // empty for a new deposit
+	FromConfirmations uint32
+}
+
+// transition moves r to state and returns the change, nil if nothing moved
+func transition(r *Record, state deposit.State, confirmations uint32) *Change {
+	if r.State == state && (r.Confirmations == confirmations || state == deposit.StateFinal) {
+		return nil
+	}
+	c := &Change{Record: r, From: r.State, FromConfirmations: r.Confirmations}
+	r.State = state
+	r.Confirmations = confirmations
+	return c
+}
+
+// Deposit returns the deposit the record was created from
+func (r *Record) Deposit() (*deposit.Deposit, error) {
+	op, err := wire.NewOutPointFromStr(r.OutPoint)
+	if err != nil {
+		return nil, err
+	}
+	return &deposit.Deposit{OutPoint: op, Address: r.Address, Amount: r.Amount, ScriptPubKey: r.Script, Block: r.Block, Height: r.Height, TxIndex: r.TxIndex}, nil
+}
+
+// A Tip is the last processed block
+type Tip struct {
+	Hash   string `json:"hash"`
+	Height uint64 `json:"height"`
+}
+
+// A Store is an open state file
+type Store struct {
+	db     *bolt.DB
+	notify *notify // nil unless Notify was called
+}
+
+// Open opens or creates the state file at path
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("store: open %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{depositsBucket, metaBucket, blocksBucket, outboxBucket, payoutsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the state file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// outPointKey encodes an outpoint as txid bytes followed by the big endian
+// index, so keys sort by outpoint
+func outPointKey(op wire.OutPoint) []byte {
+	k := make([]byte, wire.HashSize+4)
+	copy(k, op.Hash[:])
+	binary.BigEndian.PutUint32(k[wire.HashSize:], op.Index)
+	return k
+}
+
+func getRecord(b *bolt.Bucket, op wire.OutPoint) (*Record, error) {
+	v := b.Get(outPointKey(op))
+	if v == nil {
+		return nil, ErrNotFound
+	}
+	r := &Record{}
+	if err := json.Unmarshal(v, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func putRecord(b *bolt.Bucket, op wire.OutPoint, r *Record) error {
+	r.UpdatedAt = time.Now().UTC()
+	v, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return b.Put(outPointKey(op), v)
+}
+
+// Get returns the record of the deposit at op, or ErrNotFound
+func (s *Store) Get(op wire.OutPoint) (*Record, error) {
+	var r *Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		r, err = getRecord(tx.Bucket(depositsBucket), op)
+		return err
+	})
+	return r, err
+}
+
+// Seen reports whether a deposit was already stored at op
+func (s *Store) Seen(op wire.OutPoint) (bool, error) {
+	_, err := s.Get(op)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Observe records a deposit seen with d.Confirmations confirmations outside
+// of the scanned blocks, e.g. by listunspent. A new deposit starts pending.
+// The state follows policy, except that a final deposit stays final: only a
+// reorg rolls it back, by DisconnectTip. The change is nil if neither the
+// state nor the confirmations moved. The block of d, if given, is recorded
+// with the nonce derived from it.
+func (s *Store) Observe(d *deposit.Deposit, policy *deposit.Policy) (*Record, *Change, error) {
+	var (
+		r      *Record
+		change *Change
+	)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(depositsBucket)
+		var err error
+		r, err = getRecord(b, d.OutPoint)
+		if err == ErrNotFound {
+			r, err = newRecord(d), nil
+		}
+		if err != nil {
+			return err
+		}
+		state := policy.State(d.Amount, d.Confirmations)
+		if r.State == deposit.StateFinal {
+			state = deposit.StateFinal
+		}
+		change = transition(r, state, d.Confirmations)
+		moved := d.Block != "" && d.Block != r.Block
+		if moved {
+			if err := place(r, d.Block, d.Height, d.TxIndex, d.OutPoint.Index); err != nil {
+				return err
+			}
+		}
+		if change == nil {
+			if moved {
+				return putRecord(b, d.OutPoint, r)
+			}
+			return nil
+		}
+		if err := putRecord(b, d.OutPoint, r); err != nil {
+			return err
+		}
+		return s.enqueue(tx, change)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, change, nil
+}
+
+// newRecord returns a pending record for d, without a block yet
+func newRecord(d *deposit.Deposit) *Record {
+	return &Record{
+		OutPoint: d.ID(),
+		Address:  d.Address,
+		Amount:   d.Amount,
+		Script:   d.ScriptPubKey,
+		Status:   StatusPending,
+	}
+}
+
+// place moves r to the transaction txIndex of a block and derives its nonce
+// from there. The nonce of a deposit already sent is the one it was routed
+// with and never changes.
+func place(r *Record, block string, height uint64, txIndex, vout uint32) error {
+	nonce, err := deposit.Nonce(height, txIndex, vout)
+	if err != nil {
+		return err
+	}
+	r.Block, r.Height, r.TxIndex = block, height, txIndex
+	if r.Status != StatusSent {
+		r.Nonce = nonce
+	}
+	return nil
+}
+
+// SetStatus updates the status of a stored deposit
+func (s *Store) SetStatus(op wire.OutPoint, status Status) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(depositsBucket)
+		r, err := getRecord(b, op)
+		if err != nil {
+			return err
+		}
+		r.Status = status
+		return putRecord(b, op, r)
+	})
+}
+
+// Spend marks the stored deposits spent by w as spent and records w with
+// them, in one transaction. The outpoints of w that are not stored, or
+// already recorded as spent by w, are skipped. A deposit already marked spent
+// without its withdrawal yields a change from and to the spent state.
+func (s *Store) Spend(w *deposit.Withdrawal) ([]*Change, error) {
+	var changes []*Change
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		changes, err = spend(tx.Bucket(depositsBucket), w)
+		if err != nil {
+			return err
+		}
+		return s.enqueue(tx, changes...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func spend(b *bolt.Bucket, w *deposit.Withdrawal) ([]*Change, error) {
+	var changes []*Change
+	for _, id := range w.Spent {
+		op, err := wire.NewOutPointFromStr(id)
+		if err != nil {
+			return nil, err
+		}
+		r, err := getRecord(b, op)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.SpentBy != nil && r.SpentBy.TxID == w.TxID && r.SpentBy.Block == w.Block {
+			continue
+		}
+		c := &Change{Record: r, From: r.State, FromConfirmations: r.Confirmations}
+		if r.State != deposit.StateSpent {
+			r.SpentFrom = r.State
+		}
+		r.State = deposit.StateSpent
+		r.SpentBy = w
+		if err := putRecord(b, op, r); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// Lookup returns the records of the stored deposits among ops
+func (s *Store) Lookup(ops []wire.OutPoint) (map[wire.OutPoint]*Record, error) {
+	records := make(map[wire.OutPoint]*Record)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(depositsBucket)
+		for _, op := range ops {
+			r, err := getRecord(b, op)
+			if err == ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			records[op] = r
+		}
+		return nil
+	})
+	return records, err
+}
+
+// Quarantine sets aside a stored deposit that can't be routed, for reason,
+// and queues the event of the quarantine, a change keeping the state. A
+// deposit already quarantined is left as is and the change is nil.
+func (s *Store) Quarantine(op wire.OutPoint, reason string) (*Change, error) {
+	var change *Change
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(depositsBucket)
+		r, err := getRecord(b, op)
+		if err != nil {
+			return err
+		}
+		if r.Status == StatusQuarantined {
+			return nil
+		}
+		r.Status = StatusQuarantined
+		r.Reason = reason
+		if err := putRecord(b, op, r); err != nil {
+			return err
+		}
+		change = &Change{Record: r, From: r.State, FromConfirmations: r.Confirmations}
+		return s.enqueue(tx, change)
+	})
+	return change, err
+}
+
+// Reject marks a stored deposit rejected for reason and queues the event of
+// the rejection, a change keeping the state. A deposit already rejected is
+// left as is and the change is nil.
+func (s *Store) Reject(op wire.OutPoint, reason string) (*Change, error) {
+	var change *Change
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(depositsBucket)
+		r, err := getRecord(b, op)
+		if err != nil {
+			return err
+		}
+		if r.Status == StatusRejected {
+			return nil
+		}
+		r.Status = StatusRejected
+		r.Reason = reason
+		if err := putRecord(b, op, r); err != nil {
+			return err
+		}
+		change = &Change{Record: r, From: r.State, FromConfirmations: r.Confirmations}
+		return s.enqueue(tx, change)
+	})
+	return change, err
+}
+
+// SetState moves a stored deposit to state, keeping its confirmations. The
+// change is nil if the deposit was already in that state.
+func (s *Store) SetState(op wire.OutPoint, state deposit.State) (*Change, error) {
+	var change *Change
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(depositsBucket)
+		r, err := getRecord(b, op)
+		if err != nil {
+			return err
+		}
+		if r.State == state {
+			return nil
+		}
+		change = transition(r, state, r.Confirmations)
+		if err := putRecord(b, op, r); err != nil {
+			return err
+		}
+		return s.enqueue(tx, change)
+	})
+	return change, err
+}
+
+// List returns the stored deposits with the given status, or all of them
+// if status is empty, ordered by nonce
+func (s *Store) List(status Status) ([]*Record, error) {
+	var records []*Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		records, err = findRecords(tx.Bucket(depositsBucket), func(r *Record) bool {
+			return status == "" || r.Status == status
+		})
+		return err
+	})
+	return records, err
+}
+
+// SetTip records the last processed block
+func (s *Store) SetTip(t Tip) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putTip(tx, &t)
+	})
+}
+
+func putTip(tx *bolt.Tx, t *Tip) error {
+	if t == nil {
+		return tx.Bucket(metaBucket).Delete(tipKey)
+	}
+	v, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(metaBucket).Put(tipKey, v)
+}
+
+func getTip(tx *bolt.Tx) (*Tip, error) {
+	v := tx.Bucket(metaBucket).Get(tipKey)
+	if v == nil {
+		return nil, nil
+	}
+	t := &Tip{}
+	return t, json.Unmarshal(v, t)
+}
+
+// uint64Key encodes a height or an id in big endian, so keys sort numerically
+func uint64Key(n uint64) []byte {
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], n)
+	return k[:]
+}
+
+// BlockHash returns the hash of the block connected at height, or ErrNoBlock
+func (s *Store) BlockHash(height uint64) (string, error) {
+	var hash string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(blocksBucket).Get(uint64Key(height))
+		if v == nil {
+			return ErrNoBlock
+		}
+		hash = string(v)
+		return nil
+	})
+	return hash, err
+}
+
+// ConnectBlock appends a block to the stored hash chain, makes it the tip
+// and records the deposits and the withdrawals it contains, in one
+// transaction. The block must be the child of the stored tip, if any.
+// Deposits seen before keep their status and are moved to this block, their
+// nonce derived from the position given by d.TxIndex. The withdrawals are moved to this block too, and their deposits
+// marked spent as by Spend. The deposits of earlier blocks that are not
+// final yet gain a confirmation. The changes are returned for the deposits
+// of the block first, in the order given, then for the deposits spent by
+// the withdrawals, then for the earlier deposits by nonce.
+func (s *Store) ConnectBlock(block Tip, prev string, deposits []*deposit.Deposit, withdrawals []*deposit.Withdrawal, policy *deposit.Policy) ([]*Change, error) {
+	var changes []*Change
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		tip, err := getTip(tx)
+		if err != nil {
+			return err
+		}
+		if tip != nil && (tip.Height+1 != block.Height || tip.Hash != prev) {
+			return ErrNotConnected
+		}
+		if err := tx.Bucket(blocksBucket).Put(uint64Key(block.Height), []byte(block.Hash)); err != nil {
+			return err
+		}
+		if err := putTip(tx, &block); err != nil {
+			return err
+		}
+
+		b := tx.Bucket(depositsBucket)
+		for _, d := range deposits {
+			r, err := getRecord(b, d.OutPoint)
+			if err == ErrNotFound {
+				r, err = newRecord(d), nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := place(r, block.Hash, block.Height, d.TxIndex, d.OutPoint.Index); err != nil {
+				return err
+			}
+			if c := transition(r, policy.State(r.Amount, 1), 1); c != nil {
+				changes = append(changes, c)
+			}
+			if err := putRecord(b, d.OutPoint, r); err != nil {
+				return err
+			}
+		}
+		for _, w := range withdrawals {
+			w.Block, w.Height = block.Hash, block.Height
+			spent, err := spend(b, w)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, spent...)
+		}
+
+		deeper, err := findRecords(b, func(r *Record) bool {
+			return r.State == deposit.StateConfirmed && r.Height > 0 && r.Height < block.Height
+		})
+		if err != nil {
+			return err
+		}
+		for _, r := range deeper {
+			confirmations := uint32(block.Height - r.Height + 1)
+			c := transition(r, policy.State(r.Amount, confirmations), confirmations)
+			if c == nil {
+				continue
+			}
+			if err := putRecordAt(b, r); err != nil {
+				return err
+			}
+			changes = append(changes, c)
+		}
+		return s.enqueue(tx, changes...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// findRecords returns the records of b matching keep, ordered by nonce then
+// outpoint. Records are collected before being updated, as bolt cursors are
+// invalidated by writes.
+func findRecords(b *bolt.Bucket, keep func(r *Record) bool) ([]*Record, error) {
+	var records []*Record
+	err := b.ForEach(func(k, v []byte) error {
+		r := &Record{}
+		if err := json.Unmarshal(v, r); err != nil {
+			return err
+		}
+		if keep(r) {
+			records = append(records, r)
+		}
+		return nil
+	})
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Nonce < records[j].Nonce })
+	return records, err
+}
+
+// putRecordAt stores r under its own outpoint
+func putRecordAt(b *bolt.Bucket, r *Record) error {
+	op, err := wire.NewOutPointFromStr(r.OutPoint)
+	if err != nil {
+		return err
+	}
+	return putRecord(b, op, r)
+}
+
+// DisconnectTip removes the tip from the stored hash chain, restores the
+// deposits spent in it to their previous state and marks the deposits found
+// in it as orphaned, in one transaction. The orphans keep their nonce until
+// they are found in another block. It returns the new tip, nil once
+// the chain is empty, and the changes of the deposits.
+func (s *Store) DisconnectTip() (*Tip, []*Change, error) {
+	var (
+		parent  *Tip
+		changes []*Change
+	)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		tip, err := getTip(tx)
+		if err != nil {
+			return err
+		}
+		if tip == nil {
+			return ErrNoBlock
+		}
+		blocks := tx.Bucket(blocksBucket)
+		if err := blocks.Delete(uint64Key(tip.Height)); err != nil {
+			return err
+		}
+		if tip.Height > 0 {
+			if v := blocks.Get(uint64Key(tip.Height - 1)); v != nil {
+				parent = &Tip{Hash: string(v), Height: tip.Height - 1}
+			}
+		}
+		if err := putTip(tx, parent); err != nil {
+			return err
+		}
+
+		b := tx.Bucket(depositsBucket)
+		spentIn := func(r *Record) bool { return r.SpentBy != nil && r.SpentBy.Block == tip.Hash }
+		affected, err := findRecords(b, func(r *Record) bool { return r.Block == tip.Hash || spentIn(r) })
+		if err != nil {
+			return err
+		}
+		for _, r := range affected {
+			c := &Change{Record: r, From: r.State, FromConfirmations: r.Confirmations}
+			if spentIn(r) {
+				r.State, r.SpentBy, r.SpentFrom = r.SpentFrom, nil, ""
+			}
+			if r.Block == tip.Hash {
+				r.Height, r.Block, r.TxIndex = 0, "", 0
+				r.State, r.Confirmations = deposit.StateOrphaned, 0
+			}
+			if r.State != c.From || r.Confirmations != c.FromConfirmations {
+				changes = append(changes, c)
+			}
+			if err := putRecordAt(b, r); err != nil {
+				return err
+			}
+		}
+		return s.enqueue(tx, changes...)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return parent, changes, nil
+}
+
+// Tip returns the last processed block, or nil if none was recorded
+func (s *Store) Tip() (*Tip, error) {
+	var t *Tip
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		t, err = getTip(tx)
+		return err
+	})
+	return t, err
+}
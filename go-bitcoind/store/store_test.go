@@ -0,0 +1,401 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+func testDeposit(txid string, vout uint32, amount int64) *deposit.Deposit {
+	op, err := wire.NewOutPoint(txid, vout)
+	Expect(err).NotTo(HaveOccurred())
+	return &deposit.Deposit{OutPoint: op, Address: "btg1q", Amount: amount, ScriptPubKey: []byte{0, 32}}
+}
+
+// mined places d in the transaction txIndex of block at height
+func mined(d *deposit.Deposit, block string, height uint64, txIndex uint32, confirmations uint32) *deposit.Deposit {
+	d.Block, d.Height, d.TxIndex, d.Confirmations = block, height, txIndex, confirmations
+	return d
+}
+
+func nonceAt(height uint64, txIndex, vout uint32) uint64 {
+	n, err := deposit.Nonce(height, txIndex, vout)
+	Expect(err).NotTo(HaveOccurred())
+	return n
+}
+
+var _ = Describe("Store", func() {
+	const txA = "f35103085b7145e569eb8053365c662cb7b9b7fd6009e37cafbb684bd89b638b"
+
+	var (
+		dir    string
+		path   string
+		s      *Store
+		policy *deposit.Policy
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "store")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "state.db")
+		s, err = Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		// two confirmations, three from 1000 satoshis
+		policy, err = deposit.NewPolicy(2, []deposit.Tier{{MinAmount: 1000, Confirmations: 3}})
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		s.Close()
+		os.RemoveAll(dir)
+	})
+
+	reopen := func() {
+		Expect(s.Close()).To(Succeed())
+		var err error
+		s, err = Open(path)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	observe := func(d *deposit.Deposit) (*Record, *Change) {
+		r, c, err := s.Observe(d, policy)
+		Expect(err).NotTo(HaveOccurred())
+		return r, c
+	}
+
+	It("should derive the nonce from the position of the deposit", func() {
+		r, c := observe(testDeposit(txA, 1, 100))
+		Expect(c.From).To(BeEmpty())
+		Expect(c.Record.State).To(Equal(deposit.StateMempool))
+		Expect(r.Nonce).To(BeZero())
+		Expect(r.Status).To(Equal(StatusPending))
+
+		r, _ = observe(mined(testDeposit(txA, 1, 100), "aa", 10, 3, 1))
+		Expect(r.Nonce).To(Equal(nonceAt(10, 3, 1)))
+		Expect(r.TxIndex).To(Equal(uint32(3)))
+		again, c := observe(mined(testDeposit(txA, 1, 100), "aa", 10, 3, 1))
+		Expect(c).To(BeNil())
+		Expect(again.Nonce).To(Equal(r.Nonce))
+	})
+
+	It("should derive the same nonces whatever each store saw before", func() {
+		other, err := Open(filepath.Join(dir, "other.db"))
+		Expect(err).NotTo(HaveOccurred())
+		defer other.Close()
+
+		// this store saw the deposits from the mempool on, in another order
+		// and along with an unrelated one
+		observe(testDeposit(txA, 5, 100))
+		observe(testDeposit(txA, 1, 200))
+		observe(testDeposit(txA, 0, 300))
+		observe(mined(testDeposit(txA, 1, 200), "aa", 10, 7, 3))
+		observe(mined(testDeposit(txA, 0, 300), "aa", 10, 7, 3))
+		for _, d := range []*deposit.Deposit{mined(testDeposit(txA, 0, 300), "aa", 10, 7, 3), mined(testDeposit(txA, 1, 200), "aa", 10, 7, 3)} {
+			_, _, err := other.Observe(d, policy)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		for _, vout := range []uint32{0, 1} {
+			op := testDeposit(txA, vout, 0).OutPoint
+			mine, err := s.Get(op)
+			Expect(err).NotTo(HaveOccurred())
+			theirs, err := other.Get(op)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mine.Nonce).To(Equal(theirs.Nonce))
+			Expect(mine.Nonce).To(Equal(nonceAt(10, 7, vout)))
+		}
+	})
+
+	It("should move observed deposits through their states", func() {
+		d := testDeposit(txA, 0, 100)
+		var states []deposit.State
+		for _, confirmations := range []uint32{0, 1, 1, 2, 3, 4} {
+			d.Confirmations = confirmations
+			if _, c := observe(d); c != nil {
+				states = append(states, c.Record.State)
+			}
+		}
+		// final deposits don't report their confirmations any more
+		Expect(states).To(Equal([]deposit.State{deposit.StateMempool, deposit.StateConfirmed, deposit.StateFinal}))
+
+		c, err := s.SetState(d.OutPoint, deposit.StateSpent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.From).To(Equal(deposit.StateFinal))
+		c, err = s.SetState(d.OutPoint, deposit.StateSpent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c).To(BeNil())
+	})
+
+	It("should keep a final deposit final when fewer confirmations are observed", func() {
+		d := testDeposit(txA, 0, 100)
+		d.Confirmations = 2
+		r, _ := observe(d)
+		Expect(r.State).To(Equal(deposit.StateFinal))
+		d.Confirmations = 1
+		r, c := observe(d)
+		Expect(c).To(BeNil())
+		Expect(r.State).To(Equal(deposit.StateFinal))
+	})
+
+	It("should require the confirmations of the amount tier", func() {
+		d := testDeposit(txA, 0, 5000)
+		d.Confirmations = 2
+		r, _ := observe(d)
+		Expect(r.State).To(Equal(deposit.StateConfirmed))
+		d.Confirmations = 3
+		r, _ = observe(d)
+		Expect(r.State).To(Equal(deposit.StateFinal))
+	})
+
+	It("should keep deposits, nonces and statuses across restarts", func() {
+		d0, d1 := mined(testDeposit(txA, 0, 100), "aa", 10, 1, 1), mined(testDeposit(txA, 1, 200), "aa", 10, 1, 1)
+		observe(d0)
+		observe(d1)
+		Expect(s.SetStatus(d0.OutPoint, StatusSent)).To(Succeed())
+		reopen()
+
+		seen, err := s.Seen(d1.OutPoint)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(seen).To(BeTrue())
+
+		// the deposit reserved before the "crash" is still pending with its nonce
+		pending, err := s.List(StatusPending)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(HaveLen(1))
+		Expect(pending[0].OutPoint).To(Equal(d1.ID()))
+		Expect(pending[0].Nonce).To(Equal(nonceAt(10, 1, 1)))
+		back, err := pending[0].Deposit()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(back.TxIndex).To(Equal(uint32(1)))
+	})
+
+	It("should quarantine the deposits that can't be routed", func() {
+		d := testDeposit(txA, 3, 100)
+		observe(d)
+		c, err := s.Quarantine(d.OutPoint, "memo: no memo output")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.From).To(Equal(c.Record.State))
+		Expect(c.Record.Status).To(Equal(StatusQuarantined))
+		c, err = s.Quarantine(d.OutPoint, "again")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c).To(BeNil())
+		reopen()
+
+		pending, err := s.List(StatusPending)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(BeEmpty())
+		quarantined, err := s.List(StatusQuarantined)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quarantined).To(HaveLen(1))
+		Expect(quarantined[0].Reason).To(Equal("memo: no memo output"))
+		_, err = s.Quarantine(testDeposit(txA, 9, 1).OutPoint, "")
+		Expect(err).To(Equal(ErrNotFound))
+	})
+
+	It("should reject the deposits out of the limits once", func() {
+		d := testDeposit(txA, 3, 100)
+		observe(d)
+		c, err := s.Reject(d.OutPoint, "deposit: amount 100 is below the minimum 1000")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.From).To(Equal(c.Record.State))
+		Expect(c.Record.Status).To(Equal(StatusRejected))
+		c, err = s.Reject(d.OutPoint, "again")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c).To(BeNil())
+
+		rejected, err := s.List(StatusRejected)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rejected).To(HaveLen(1))
+		Expect(rejected[0].Reason).To(ContainSubstring("below the minimum"))
+		_, err = s.Reject(testDeposit(txA, 9, 1).OutPoint, "")
+		Expect(err).To(Equal(ErrNotFound))
+	})
+
+	It("should rebuild the deposit from its record", func() {
+		d := testDeposit(txA, 4, 100)
+		r, _ := observe(d)
+		back, err := r.Deposit()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(back).To(Equal(d))
+	})
+
+	It("should list every deposit ordered by nonce", func() {
+		for i := uint32(0); i < 5; i++ {
+			observe(mined(testDeposit(txA, i, 100), "aa", 10, 4-i, 1))
+		}
+		observe(testDeposit(txA, 5, 100)) // not mined yet
+		all, err := s.List("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(HaveLen(6))
+		Expect(all[0].Nonce).To(BeZero())
+		for i, r := range all[1:] {
+			Expect(r.Nonce).To(Equal(nonceAt(10, uint32(i), 4-uint32(i))))
+		}
+	})
+
+	It("should report unknown deposits", func() {
+		d := testDeposit(txA, 9, 1)
+		Expect(s.SetStatus(d.OutPoint, StatusSent)).To(Equal(ErrNotFound))
+		_, err := s.SetState(d.OutPoint, deposit.StateSpent)
+		Expect(err).To(Equal(ErrNotFound))
+		_, err = s.Get(d.OutPoint)
+		Expect(err).To(Equal(ErrNotFound))
+	})
+
+	It("should persist the last processed block", func() {
+		t, err := s.Tip()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t).To(BeNil())
+		Expect(s.SetTip(Tip{Hash: "00ff", Height: 42})).To(Succeed())
+		reopen()
+		t, err = s.Tip()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*t).To(Equal(Tip{Hash: "00ff", Height: 42}))
+	})
+
+	It("should only connect children of the tip", func() {
+		_, err := s.ConnectBlock(Tip{Hash: "aa", Height: 10}, "", nil, nil, policy)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = s.ConnectBlock(Tip{Hash: "bb", Height: 11}, "ff", nil, nil, policy)
+		Expect(err).To(Equal(ErrNotConnected))
+		_, err = s.ConnectBlock(Tip{Hash: "bb", Height: 12}, "aa", nil, nil, policy)
+		Expect(err).To(Equal(ErrNotConnected))
+		_, err = s.ConnectBlock(Tip{Hash: "bb", Height: 11}, "aa", nil, nil, policy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.BlockHash(10)).To(Equal("aa"))
+		Expect(s.BlockHash(11)).To(Equal("bb"))
+	})
+
+	It("should confirm the deposits of connected blocks until they are final", func() {
+		small, large := testDeposit(txA, 0, 100), testDeposit(txA, 1, 5000)
+		changes, err := s.ConnectBlock(Tip{Hash: "aa", Height: 10}, "", []*deposit.Deposit{small, large}, nil, policy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(2))
+		Expect(changes[0].Record.State).To(Equal(deposit.StateConfirmed))
+		Expect(changes[0].Record.Confirmations).To(Equal(uint32(1)))
+		Expect(changes[0].Record.Height).To(Equal(uint64(10)))
+
+		changes, _ = s.ConnectBlock(Tip{Hash: "bb", Height: 11}, "aa", nil, nil, policy)
+		Expect(changes).To(HaveLen(2))
+		Expect(changes[0].Record.State).To(Equal(deposit.StateFinal))
+		Expect(changes[1].Record.State).To(Equal(deposit.StateConfirmed))
+		Expect(changes[1].Record.Confirmations).To(Equal(uint32(2)))
+
+		changes, _ = s.ConnectBlock(Tip{Hash: "cc", Height: 12}, "bb", nil, nil, policy)
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].Record.OutPoint).To(Equal(large.ID()))
+		Expect(changes[0].From).To(Equal(deposit.StateConfirmed))
+		Expect(changes[0].Record.State).To(Equal(deposit.StateFinal))
+
+		changes, _ = s.ConnectBlock(Tip{Hash: "dd", Height: 13}, "cc", nil, nil, policy)
+		Expect(changes).To(BeEmpty())
+	})
+
+	It("should orphan the deposits of a disconnected block and keep their nonce", func() {
+		d0, d1 := testDeposit(txA, 0, 100), testDeposit(txA, 1, 200)
+		_, err := s.ConnectBlock(Tip{Hash: "aa", Height: 10}, "", []*deposit.Deposit{d0}, nil, policy)
+		Expect(err).NotTo(HaveOccurred())
+		d1.TxIndex = 2
+		changes, err := s.ConnectBlock(Tip{Hash: "bb", Height: 11}, "aa", []*deposit.Deposit{d1}, nil, policy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes[0].Record.Nonce).To(Equal(nonceAt(11, 2, 1)))
+		Expect(changes[0].Record.Block).To(Equal("bb"))
+		Expect(s.SetStatus(d1.OutPoint, StatusSent)).To(Succeed())
+
+		tip, changes, err := s.DisconnectTip()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*tip).To(Equal(Tip{Hash: "aa", Height: 10}))
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].Record.OutPoint).To(Equal(d1.ID()))
+		Expect(changes[0].From).To(Equal(deposit.StateConfirmed))
+		_, err = s.BlockHash(11)
+		Expect(err).To(Equal(ErrNoBlock))
+		reopen()
+
+		r, err := s.Get(d1.OutPoint)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.State).To(Equal(deposit.StateOrphaned))
+		Expect(r.Status).To(Equal(StatusSent))
+
+		Expect(r.Nonce).To(Equal(nonceAt(11, 2, 1)))
+
+		// mined again on the other branch, elsewhere in the block: the nonce
+		// it was routed with stays
+		d1.TxIndex = 5
+		changes, err = s.ConnectBlock(Tip{Hash: "cc", Height: 11}, "aa", []*deposit.Deposit{d1}, nil, policy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes[0].Record.Nonce).To(Equal(nonceAt(11, 2, 1)))
+		Expect(changes[0].Record.TxIndex).To(Equal(uint32(5)))
+		Expect(changes[0].From).To(Equal(deposit.StateOrphaned))
+		Expect(changes[0].Record.State).To(Equal(deposit.StateConfirmed))
+		Expect(changes[0].Record.Block).To(Equal("cc"))
+
+		s.DisconnectTip()
+		tip, _, err = s.DisconnectTip()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tip).To(BeNil())
+		_, _, err = s.DisconnectTip()
+		Expect(err).To(Equal(ErrNoBlock))
+	})
+
+	It("should record the withdrawal spending a deposit", func() {
+		d0, d1 := testDeposit(txA, 0, 100), testDeposit(txA, 1, 200)
+		d1.Confirmations = 5
+		observe(d0)
+		observe(d1)
+		w := &deposit.Withdrawal{TxID: "ee", Spent: []string{d1.ID(), "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098:0"}, Fee: 10}
+
+		changes, err := s.Spend(w)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].From).To(Equal(deposit.StateFinal))
+		Expect(changes[0].Record.State).To(Equal(deposit.StateSpent))
+		reopen()
+
+		r, err := s.Get(d1.OutPoint)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.SpentBy).To(Equal(w))
+		changes, err = s.Spend(w)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(BeEmpty())
+
+		records, err := s.Lookup([]wire.OutPoint{d0.OutPoint, d1.OutPoint, {Index: 3}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(HaveLen(2))
+		Expect(records[d0.OutPoint].State).To(Equal(deposit.StateMempool))
+	})
+
+	It("should restore the deposits spent in a disconnected block", func() {
+		d0, d1 := testDeposit(txA, 0, 100), testDeposit(txA, 1, 200)
+		_, err := s.ConnectBlock(Tip{Hash: "aa", Height: 10}, "", []*deposit.Deposit{d0}, nil, policy)
+		Expect(err).NotTo(HaveOccurred())
+
+		// d1 is paid and spent in the next block, next to d0
+		w := &deposit.Withdrawal{TxID: "ee", Spent: []string{d0.ID(), d1.ID()}, Fee: -1}
+		changes, err := s.ConnectBlock(Tip{Hash: "bb", Height: 11}, "aa", []*deposit.Deposit{d1}, []*deposit.Withdrawal{w}, policy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(3))
+		Expect(changes[0].Record.State).To(Equal(deposit.StateConfirmed))
+		Expect(changes[1].Record.OutPoint).To(Equal(d0.ID()))
+		Expect(changes[1].Record.State).To(Equal(deposit.StateSpent))
+		Expect(changes[1].Record.SpentBy.Block).To(Equal("bb"))
+		Expect(changes[1].Record.SpentBy.Height).To(Equal(uint64(11)))
+		Expect(changes[2].Record.OutPoint).To(Equal(d1.ID()))
+		Expect(changes[2].Record.State).To(Equal(deposit.StateSpent))
+
+		_, changes, err = s.DisconnectTip()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(2))
+		Expect(changes[0].Record.OutPoint).To(Equal(d0.ID()))
+		Expect(changes[0].From).To(Equal(deposit.StateSpent))
+		Expect(changes[0].Record.State).To(Equal(deposit.StateConfirmed))
+		Expect(changes[0].Record.SpentBy).To(BeNil())
+		Expect(changes[1].Record.OutPoint).To(Equal(d1.ID()))
+		Expect(changes[1].Record.State).To(Equal(deposit.StateOrphaned))
+	})
+})
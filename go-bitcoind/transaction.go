@@ -1,5 +1,10 @@
 package bitcoind
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // A ScriptSig represents a scriptsyg
 type ScriptSig struct {
 	Asm string `json:"asm"`
@@ -73,16 +78,52 @@ type Transaction struct {
 	Hex             string               `json:"hex,omitempty"`
 }
 
-// UTXO represents a transaction
+// UTXO represents an unspent output returned by listunspent
 type UTXO struct {
-	TxID            string               `json:"txid"`
-	Amount          int64                `json:"amount"`
-	Address         string               `json:"address,omitempty"`
-	ScriptPubKey    string               `json:"scriptPubKey"`
-	Label           string               `json:"label,omitempty"`
-	Refresh         bool                 `json:"label,omitempty"`
+	TxID          string `json:"txid"`
+	Vout          uint32 `json:"vout"`
+	Amount        int64  `json:"amount"` // in satoshis
+	Address       string `json:"address,omitempty"`
+	ScriptPubKey  string `json:"scriptPubKey"`
+	Label         string `json:"label,omitempty"`
+	WitnessScript string `json:"witnessScript,omitempty"`
+	Confirmations uint32 `json:"confirmations"`
+	Spendable     bool   `json:"spendable"`
+	Safe          bool   `json:"safe"`
 }
 
+// OutPoint returns the "txid:vout" identifier of the output
+func (u *UTXO) OutPoint() string {
+	return fmt.Sprintf("%s:%d", u.TxID, u.Vout)
+}
+
+// utxoJSON has the layout of UTXO with its amount in BTG, as bitcoind reports it
+type utxoJSON struct {
+	utxo
+	Amount json.Number `json:"amount"`
+}
+
+type utxo UTXO
+
+// UnmarshalJSON decodes a listunspent entry, converting its amount to satoshis
+func (u *UTXO) UnmarshalJSON(b []byte) error {
+	var v utxoJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*u = UTXO(v.utxo)
+	amount, err := AmountToSatoshi(v.Amount.String())
+	if err != nil {
+		return err
+	}
+	u.Amount = amount
+	return nil
+}
+
+// MarshalJSON encodes the UTXO in the listunspent layout
+func (u UTXO) MarshalJSON() ([]byte, error) {
+	return json.Marshal(utxoJSON{utxo: utxo(u), Amount: json.Number(SatoshiToAmount(u.Amount))})
+}
 
 // UTransactionOut represents a unspent transaction out (UTXO)
 type UTransactionOut struct {
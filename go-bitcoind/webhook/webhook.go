@@ -0,0 +1,89 @@
+// Package webhook is the sink POSTing the deposit events as signed JSON to
+// an HTTP endpoint. The sink.Dispatcher retries an event until the endpoint
+// answers 2xx.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/sink"
+)
+
+// Headers of a delivery
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256, keyed by
+	// the endpoint's secret, of the timestamp, a dot and the body
+	SignatureHeader = "X-WatchUTXO-Signature"
+
+	// TimestampHeader carries the Unix time of the attempt
+	TimestampHeader = "X-WatchUTXO-Timestamp"
+
+	// DeliveryHeader carries the event id, the same on every retry
+	DeliveryHeader = "X-WatchUTXO-Delivery"
+)
+
+// Sign returns the signature header value of body sent at timestamp
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a delivery, for the receivers
+func Verify(secret []byte, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// A Sink posts the events to an endpoint
+type Sink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// New returns a sink posting to url, signed with secret
+func New(url, secret string, client *http.Client) *Sink {
+	return &Sink{url: url, secret: []byte(secret), client: client}
+}
+
+// Publish implements sink.Sink, the event is accepted by a 2xx answer
+func (s *Sink) Publish(ctx context.Context, e sink.DepositEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(s.secret, timestamp, body))
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(e.ID, 10))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/sink"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+const txA = "f35103085b7145e569eb8053365c662cb7b9b7fd6009e37cafbb684bd89b638b"
+
+// receiver is an endpoint checking the signatures, it fails while down
+type receiver struct {
+	mu     sync.Mutex
+	server *httptest.Server
+	secret []byte
+	down   bool
+	events []sink.DepositEvent
+	ids    []string
+}
+
+func newReceiver(secret string) *receiver {
+	r := &receiver{secret: []byte(secret)}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		body, _ := ioutil.ReadAll(req.Body)
+		if !Verify(r.secret, req.Header.Get(TimestampHeader), body, req.Header.Get(SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e sink.DepositEvent
+		Expect(json.Unmarshal(body, &e)).To(Succeed())
+		r.events = append(r.events, e)
+		r.ids = append(r.ids, req.Header.Get(DeliveryHeader))
+	}))
+	return r
+}
+
+func (r *receiver) states() []deposit.State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var states []deposit.State
+	for _, e := range r.events {
+		states = append(states, e.State)
+	}
+	return states
+}
+
+var _ = Describe("Sink", func() {
+	var (
+		rcv *receiver
+		s   *Sink
+		e   sink.DepositEvent
+	)
+
+	BeforeEach(func() {
+		rcv = newReceiver("s3cret")
+		s = New(rcv.server.URL, "s3cret", rcv.server.Client())
+		e = sink.DepositEvent{
+			ID:            7,
+			OutPoint:      txA + ":0",
+			Address:       "btg1q",
+			Amount:        1000,
+			Confirmations: 1,
+			BlockHash:     "00ab",
+			State:         deposit.StateConfirmed,
+			PreviousState: deposit.StateMempool,
+		}
+	})
+	AfterEach(func() {
+		rcv.server.Close()
+	})
+
+	It("should post the signed event", func() {
+		Expect(s.Publish(context.Background(), e)).To(Succeed())
+		Expect(rcv.events).To(HaveLen(1))
+		got := rcv.events[0]
+		Expect(got.OutPoint).To(Equal(txA + ":0"))
+		Expect(got.Amount).To(Equal(int64(1000)))
+		Expect(got.BlockHash).To(Equal("00ab"))
+		Expect(got.State).To(Equal(deposit.StateConfirmed))
+		Expect(got.PreviousState).To(Equal(deposit.StateMempool))
+		Expect(rcv.ids).To(Equal([]string{"7"}))
+	})
+
+	It("should fail unless the endpoint answers 2xx", func() {
+		rcv.down = true
+		Expect(s.Publish(context.Background(), e)).To(MatchError(ContainSubstring("503")))
+	})
+
+	It("should not be accepted with another secret", func() {
+		rcv.secret = []byte("other")
+		Expect(s.Publish(context.Background(), e)).To(MatchError(ContainSubstring("401")))
+	})
+
+	It("should deliver the changes of a store through a dispatcher", func() {
+		dir, err := ioutil.TempDir("", "webhook")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		st, err := store.Open(filepath.Join(dir, "state.db"))
+		Expect(err).NotTo(HaveOccurred())
+		defer st.Close()
+		policy, err := deposit.NewPolicy(2, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		d := sink.NewDispatcher(st, map[string]sink.Sink{"webhook": s})
+		d.MinBackoff = 10 * time.Millisecond
+		stop := make(chan struct{})
+		defer close(stop)
+		go d.Run(10*time.Millisecond, stop, func(error) {})
+
+		rcv.mu.Lock()
+		rcv.down = true
+		rcv.mu.Unlock()
+		op, _ := wire.NewOutPoint(txA, 0)
+		dep := &deposit.Deposit{OutPoint: op, Address: "btg1q", Amount: 1000, ScriptPubKey: []byte{0}}
+		_, _, err = st.Observe(dep, policy)
+		Expect(err).NotTo(HaveOccurred())
+		dep.Confirmations, dep.Block, dep.Height = 2, "00ab", 100
+		_, _, err = st.Observe(dep, policy)
+		Expect(err).NotTo(HaveOccurred())
+
+		Consistently(rcv.states, 50*time.Millisecond).Should(BeEmpty())
+		rcv.mu.Lock()
+		rcv.down = false
+		rcv.mu.Unlock()
+		Eventually(rcv.states).Should(Equal([]deposit.State{deposit.StateMempool, deposit.StateFinal}))
+	})
+})
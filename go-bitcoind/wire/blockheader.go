@@ -0,0 +1,138 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// A BlockHeader is a Bitcoin Gold block header. Since the fork BTG headers
+// carry the block height, 28 reserved bytes, a 256-bit nonce and the Equihash
+// solution; blocks below the fork height are still hashed in the 80 byte
+// Bitcoin layout.
+type BlockHeader struct {
+	Version    int32
+	PrevBlock  Hash
+	MerkleRoot Hash
+	Height     uint32
+	Reserved   [7]uint32
+	Timestamp  uint32
+	Bits       uint32
+	Nonce      Hash
+	Solution   []byte
+}
+
+// BlockHash returns the hash identifying the block. forkHeight is the first
+// height hashed with the full BTG header, see address.Params.ForkHeight.
+func (h *BlockHeader) BlockHash(forkHeight uint32) Hash {
+	var buf bytes.Buffer
+	if h.Height < forkHeight {
+		h.encodeLegacy(&buf)
+	} else {
+		h.Serialize(&buf)
+	}
+	return DoubleHash(buf.Bytes())
+}
+
+// encodeLegacy writes the pre-fork header, which keeps only the low 32 bits of the nonce
+func (h *BlockHeader) encodeLegacy(w io.Writer) error {
+	writeUint32(w, uint32(h.Version))
+	w.Write(h.PrevBlock[:])
+	w.Write(h.MerkleRoot[:])
+	writeUint32(w, h.Timestamp)
+	writeUint32(w, h.Bits)
+	_, err := w.Write(h.Nonce[:4])
+	return err
+}
+
+// Serialize writes the header as returned by getblockheader <hash> false
+func (h *BlockHeader) Serialize(w io.Writer) error {
+	if err := h.encodeInput(w); err != nil {
+		return err
+	}
+	return WriteVarBytes(w, h.Solution)
+}
+
+// encodeInput writes the header up to its nonce, without the solution
+func (h *BlockHeader) encodeInput(w io.Writer) error {
+	if err := writeUint32(w, uint32(h.Version)); err != nil {
+		return err
+	}
+	w.Write(h.PrevBlock[:])
+	w.Write(h.MerkleRoot[:])
+	writeUint32(w, h.Height)
+	for _, r := range h.Reserved {
+		writeUint32(w, r)
+	}
+	writeUint32(w, h.Timestamp)
+	writeUint32(w, h.Bits)
+	_, err := w.Write(h.Nonce[:])
+	return err
+}
+
+// EquihashInput returns the 140 bytes of the header its Equihash solution
+// solves: all of it up to the nonce
+func (h *BlockHeader) EquihashInput() []byte {
+	var buf bytes.Buffer
+	h.encodeInput(&buf)
+	return buf.Bytes()
+}
+
+// Deserialize reads a header in the BTG layout
+func (h *BlockHeader) Deserialize(r io.Reader) error {
+	version, err := readUint32(r)
+	if err != nil {
+		return err
+	}
+	h.Version = int32(version)
+	if _, err := io.ReadFull(r, h.PrevBlock[:]); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r, h.MerkleRoot[:]); err != nil {
+		return err
+	}
+	if h.Height, err = readUint32(r); err != nil {
+		return err
+	}
+	for i := range h.Reserved {
+		if h.Reserved[i], err = readUint32(r); err != nil {
+			return err
+		}
+	}
+	if h.Timestamp, err = readUint32(r); err != nil {
+		return err
+	}
+	if h.Bits, err = readUint32(r); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r, h.Nonce[:]); err != nil {
+		return err
+	}
+	h.Solution, err = ReadVarBytes(r)
+	return err
+}
+
+// NewBlockHeaderFromHex decodes the hex serialization returned by getblockheader <hash> false
+func NewBlockHeaderFromHex(s string) (*BlockHeader, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	h := &BlockHeader{}
+	r := bytes.NewReader(b)
+	if err := h.Deserialize(r); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("wire: %d trailing bytes after block header", r.Len())
+	}
+	return h, nil
+}
+
+// Hex returns the hex serialization of the header
+func (h *BlockHeader) Hex() string {
+	var buf bytes.Buffer
+	h.Serialize(&buf)
+	return hex.EncodeToString(buf.Bytes())
+}
@@ -0,0 +1,84 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BlockHeader", func() {
+	// Block 100000, inherited from Bitcoin and hashed in the legacy layout
+	header := func() *BlockHeader {
+		prev, _ := NewHashFromStr("000000000002d01c1fccc21636b607dfd930d31d01c3a62104612a1719011250")
+		root, _ := NewHashFromStr("f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766")
+		h := &BlockHeader{
+			Version:    1,
+			PrevBlock:  prev,
+			MerkleRoot: root,
+			Height:     100000,
+			Timestamp:  1293623863,
+			Bits:       0x1b04864c,
+		}
+		nonce := uint32(274148111)
+		h.Nonce[0], h.Nonce[1], h.Nonce[2], h.Nonce[3] = byte(nonce), byte(nonce>>8), byte(nonce>>16), byte(nonce>>24)
+		return h
+	}
+
+	It("should hash pre-fork headers in the legacy layout", func() {
+		Expect(header().BlockHash(491407).String()).To(Equal("000000000003ba27aa200b1cecaad478d2b00432346c3f1f3986da1afd33e506"))
+	})
+
+	It("should hash post-fork headers with the full serialization", func() {
+		h := header()
+		var buf bytes.Buffer
+		Expect(h.Serialize(&buf)).To(Succeed())
+		Expect(h.BlockHash(1)).To(Equal(DoubleHash(buf.Bytes())))
+		Expect(h.BlockHash(1)).NotTo(Equal(h.BlockHash(491407)))
+	})
+
+	It("should round trip the BTG serialization", func() {
+		h := header()
+		h.Reserved[6] = 7
+		h.Solution = []byte{1, 2, 3, 4}
+		s := h.Hex()
+		Expect(len(s) / 2).To(Equal(140 + 1 + 4))
+		back, err := NewBlockHeaderFromHex(s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(back).To(Equal(h))
+	})
+
+	It("should give the Equihash input without the solution", func() {
+		h := header()
+		h.Solution = []byte{1, 2, 3, 4}
+		Expect(h.EquihashInput()).To(HaveLen(140))
+		Expect(hex.EncodeToString(h.EquihashInput())).To(Equal(h.Hex()[:280]))
+	})
+
+	It("should reject trailing bytes", func() {
+		_, err := NewBlockHeaderFromHex(header().Hex() + "00")
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("MsgMerkleBlock", func() {
+		It("should round trip", func() {
+			m := &MsgMerkleBlock{
+				Header:       *header(),
+				Transactions: 4,
+				Hashes:       []Hash{DoubleHash([]byte{1}), DoubleHash([]byte{2})},
+				Flags:        []byte{0x1d},
+			}
+			m.Header.Solution = []byte{}
+			back, err := NewMerkleBlockFromHex(m.Hex())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(back).To(Equal(m))
+		})
+		It("should reject truncated proofs", func() {
+			m := &MsgMerkleBlock{Header: *header(), Transactions: 1, Hashes: []Hash{{}}, Flags: []byte{1}}
+			s := m.Hex()
+			_, err := NewMerkleBlockFromHex(s[:len(s)-4])
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,168 @@
+// Package wire implements the Bitcoin Gold serialization of transactions and
+// block headers, as returned by the raw RPCs (getrawtransaction, getblock 0, ...).
+package wire
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// HashSize is the size of a double-sha256 hash
+const HashSize = 32
+
+// maxVarIntPayload caps the length prefixes read from untrusted input
+const maxVarIntPayload = 32 * 1024 * 1024
+
+// ErrOversized is returned when a length prefix exceeds what a message can hold
+var ErrOversized = errors.New("wire: length prefix too large")
+
+// Hash is a double-sha256 hash in internal (little endian) byte order
+type Hash [HashSize]byte
+
+// String returns the hash in the reversed hex form used by the RPC interface
+func (h Hash) String() string {
+	var r [HashSize]byte
+	for i := 0; i < HashSize; i++ {
+		r[i] = h[HashSize-1-i]
+	}
+	return hex.EncodeToString(r[:])
+}
+
+// NewHashFromStr parses a hash in its RPC (reversed hex) form
+func NewHashFromStr(s string) (Hash, error) {
+	var h Hash
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return h, err
+	}
+	if len(b) != HashSize {
+		return h, fmt.Errorf("wire: hash must be %d bytes, got %d", HashSize, len(b))
+	}
+	for i := 0; i < HashSize; i++ {
+		h[i] = b[HashSize-1-i]
+	}
+	return h, nil
+}
+
+// DoubleHash returns sha256(sha256(b))
+func DoubleHash(b []byte) Hash {
+	first := sha256.Sum256(b)
+	return Hash(sha256.Sum256(first[:]))
+}
+
+// ReadVarInt reads a bitcoin CompactSize integer
+func ReadVarInt(r io.Reader) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return 0, err
+	}
+	switch b[0] {
+	case 0xfd:
+		if _, err := io.ReadFull(r, b[:2]); err != nil {
+			return 0, err
+		}
+		return uint64(binary.LittleEndian.Uint16(b[:2])), nil
+	case 0xfe:
+		if _, err := io.ReadFull(r, b[:4]); err != nil {
+			return 0, err
+		}
+		return uint64(binary.LittleEndian.Uint32(b[:4])), nil
+	case 0xff:
+		if _, err := io.ReadFull(r, b[:8]); err != nil {
+			return 0, err
+		}
+		return binary.LittleEndian.Uint64(b[:8]), nil
+	}
+	return uint64(b[0]), nil
+}
+
+// WriteVarInt writes n as a bitcoin CompactSize integer
+func WriteVarInt(w io.Writer, n uint64) error {
+	var b [9]byte
+	switch {
+	case n < 0xfd:
+		b[0] = byte(n)
+		_, err := w.Write(b[:1])
+		return err
+	case n <= 0xffff:
+		b[0] = 0xfd
+		binary.LittleEndian.PutUint16(b[1:], uint16(n))
+		_, err := w.Write(b[:3])
+		return err
+	case n <= 0xffffffff:
+		b[0] = 0xfe
+		binary.LittleEndian.PutUint32(b[1:], uint32(n))
+		_, err := w.Write(b[:5])
+		return err
+	}
+	b[0] = 0xff
+	binary.LittleEndian.PutUint64(b[1:], n)
+	_, err := w.Write(b[:9])
+	return err
+}
+
+// VarIntSize returns the serialized size of n as a CompactSize integer
+func VarIntSize(n uint64) int {
+	switch {
+	case n < 0xfd:
+		return 1
+	case n <= 0xffff:
+		return 3
+	case n <= 0xffffffff:
+		return 5
+	}
+	return 9
+}
+
+// ReadVarBytes reads a CompactSize length prefixed byte slice
+func ReadVarBytes(r io.Reader) ([]byte, error) {
+	n, err := ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxVarIntPayload {
+		return nil, ErrOversized
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+// WriteVarBytes writes b prefixed by its CompactSize length
+func WriteVarBytes(w io.Writer, b []byte) error {
+	if err := WriteVarInt(w, uint64(len(b))); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	var b [4]byte
+	_, err := io.ReadFull(r, b[:])
+	return binary.LittleEndian.Uint32(b[:]), err
+}
+
+func writeUint32(w io.Writer, n uint32) error {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], n)
+	_, err := w.Write(b[:])
+	return err
+}
+
+func readUint64(r io.Reader) (uint64, error) {
+	var b [8]byte
+	_, err := io.ReadFull(r, b[:])
+	return binary.LittleEndian.Uint64(b[:]), err
+}
+
+func writeUint64(w io.Writer, n uint64) error {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	_, err := w.Write(b[:])
+	return err
+}
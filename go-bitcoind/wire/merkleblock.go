@@ -0,0 +1,80 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// A MsgMerkleBlock is a block header with a partial merkle tree proving the
+// inclusion of some of its transactions, as returned by gettxoutproof
+type MsgMerkleBlock struct {
+	Header       BlockHeader
+	Transactions uint32
+	Hashes       []Hash
+	Flags        []byte
+}
+
+// Serialize writes the merkle block
+func (m *MsgMerkleBlock) Serialize(w io.Writer) error {
+	if err := m.Header.Serialize(w); err != nil {
+		return err
+	}
+	writeUint32(w, m.Transactions)
+	WriteVarInt(w, uint64(len(m.Hashes)))
+	for _, h := range m.Hashes {
+		w.Write(h[:])
+	}
+	return WriteVarBytes(w, m.Flags)
+}
+
+// Deserialize reads a merkle block
+func (m *MsgMerkleBlock) Deserialize(r io.Reader) error {
+	if err := m.Header.Deserialize(r); err != nil {
+		return err
+	}
+	var err error
+	if m.Transactions, err = readUint32(r); err != nil {
+		return err
+	}
+	n, err := ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	if n > maxVarIntPayload/HashSize {
+		return ErrOversized
+	}
+	m.Hashes = make([]Hash, n)
+	for i := range m.Hashes {
+		if _, err := io.ReadFull(r, m.Hashes[i][:]); err != nil {
+			return err
+		}
+	}
+	m.Flags, err = ReadVarBytes(r)
+	return err
+}
+
+// NewMerkleBlockFromHex decodes the hex proof returned by gettxoutproof
+func NewMerkleBlockFromHex(s string) (*MsgMerkleBlock, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	m := &MsgMerkleBlock{}
+	r := bytes.NewReader(b)
+	if err := m.Deserialize(r); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("wire: %d trailing bytes after merkle block", r.Len())
+	}
+	return m, nil
+}
+
+// Hex returns the hex serialization of the merkle block
+func (m *MsgMerkleBlock) Hex() string {
+	var buf bytes.Buffer
+	m.Serialize(&buf)
+	return hex.EncodeToString(buf.Bytes())
+}
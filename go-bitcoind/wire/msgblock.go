@@ -0,0 +1,87 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// A MsgBlock is a full block, as returned by getblock <hash> 0
+type MsgBlock struct {
+	Header       BlockHeader
+	Transactions []*MsgTx
+}
+
+// Serialize writes the block
+func (b *MsgBlock) Serialize(w io.Writer) error {
+	if err := b.Header.Serialize(w); err != nil {
+		return err
+	}
+	if err := WriteVarInt(w, uint64(len(b.Transactions))); err != nil {
+		return err
+	}
+	for _, tx := range b.Transactions {
+		if err := tx.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deserialize reads a block
+func (b *MsgBlock) Deserialize(r io.Reader) error {
+	if err := b.Header.Deserialize(r); err != nil {
+		return err
+	}
+	n, err := ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	// the smallest transaction takes 60 bytes
+	if n > maxVarIntPayload/60 {
+		return ErrOversized
+	}
+	b.Transactions = make([]*MsgTx, 0, n)
+	for i := uint64(0); i < n; i++ {
+		tx := &MsgTx{}
+		if err := tx.Deserialize(r); err != nil {
+			return err
+		}
+		b.Transactions = append(b.Transactions, tx)
+	}
+	return nil
+}
+
+// TxHashes returns the txids of the block, in block order
+func (b *MsgBlock) TxHashes() []Hash {
+	hashes := make([]Hash, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		hashes[i] = tx.TxHash()
+	}
+	return hashes
+}
+
+// NewMsgBlockFromHex decodes the hex serialization returned by getblock <hash> 0
+func NewMsgBlockFromHex(s string) (*MsgBlock, error) {
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	b := &MsgBlock{}
+	r := bytes.NewReader(raw)
+	if err := b.Deserialize(r); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("wire: %d trailing bytes after block", r.Len())
+	}
+	return b, nil
+}
+
+// Hex returns the hex serialization of the block
+func (b *MsgBlock) Hex() string {
+	var buf bytes.Buffer
+	b.Serialize(&buf)
+	return hex.EncodeToString(buf.Bytes())
+}
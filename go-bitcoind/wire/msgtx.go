@@ -0,0 +1,351 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxTxInSequenceNum is the sequence of a final input
+const MaxTxInSequenceNum uint32 = 0xffffffff
+
+// witnessMarker and witnessFlag introduce the BIP144 extended serialization
+const (
+	witnessMarker = 0x00
+	witnessFlag   = 0x01
+)
+
+// An OutPoint references a transaction output
+type OutPoint struct {
+	Hash  Hash
+	Index uint32
+}
+
+// NewOutPoint returns an outpoint from an RPC txid and output index
+func NewOutPoint(txid string, index uint32) (OutPoint, error) {
+	h, err := NewHashFromStr(txid)
+	return OutPoint{Hash: h, Index: index}, err
+}
+
+// NewOutPointFromStr parses an outpoint in its txid:vout form
+func NewOutPointFromStr(s string) (OutPoint, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return OutPoint{}, fmt.Errorf("wire: invalid outpoint %q", s)
+	}
+	index, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return OutPoint{}, fmt.Errorf("wire: invalid outpoint %q", s)
+	}
+	return NewOutPoint(s[:i], uint32(index))
+}
+
+// String returns the outpoint as txid:vout
+func (o OutPoint) String() string {
+	return fmt.Sprintf("%s:%d", o.Hash, o.Index)
+}
+
+// A TxIn is a transaction input
+type TxIn struct {
+	PreviousOutPoint OutPoint
+	SignatureScript  []byte
+	Witness          [][]byte
+	Sequence         uint32
+}
+
+// A TxOut is a transaction output
+type TxOut struct {
+	// The value in satoshis
+	Value int64
+
+	// The output script
+	PkScript []byte
+}
+
+// A MsgTx is a transaction
+type MsgTx struct {
+	Version  int32
+	TxIn     []*TxIn
+	TxOut    []*TxOut
+	LockTime uint32
+}
+
+// NewMsgTx returns an empty transaction of the given version
+func NewMsgTx(version int32) *MsgTx {
+	return &MsgTx{Version: version}
+}
+
+// AddTxIn appends an input
+func (tx *MsgTx) AddTxIn(in *TxIn) {
+	tx.TxIn = append(tx.TxIn, in)
+}
+
+// AddTxOut appends an output
+func (tx *MsgTx) AddTxOut(out *TxOut) {
+	tx.TxOut = append(tx.TxOut, out)
+}
+
+// HasWitness reports whether any input carries witness data
+func (tx *MsgTx) HasWitness() bool {
+	for _, in := range tx.TxIn {
+		if len(in.Witness) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy returns a deep copy of the transaction
+func (tx *MsgTx) Copy() *MsgTx {
+	c := &MsgTx{Version: tx.Version, LockTime: tx.LockTime}
+	for _, in := range tx.TxIn {
+		n := &TxIn{
+			PreviousOutPoint: in.PreviousOutPoint,
+			SignatureScript:  append([]byte(nil), in.SignatureScript...),
+			Sequence:         in.Sequence,
+		}
+		for _, item := range in.Witness {
+			n.Witness = append(n.Witness, append([]byte{}, item...))
+		}
+		c.TxIn = append(c.TxIn, n)
+	}
+	for _, out := range tx.TxOut {
+		c.TxOut = append(c.TxOut, &TxOut{Value: out.Value, PkScript: append([]byte(nil), out.PkScript...)})
+	}
+	return c
+}
+
+// TxHash returns the transaction id, which never commits to witness data
+func (tx *MsgTx) TxHash() Hash {
+	var buf bytes.Buffer
+	tx.SerializeNoWitness(&buf)
+	return DoubleHash(buf.Bytes())
+}
+
+// WitnessHash returns the wtxid
+func (tx *MsgTx) WitnessHash() Hash {
+	var buf bytes.Buffer
+	tx.Serialize(&buf)
+	return DoubleHash(buf.Bytes())
+}
+
+// Serialize writes the transaction, using the BIP144 format when it has witness data
+func (tx *MsgTx) Serialize(w io.Writer) error {
+	return tx.encode(w, tx.HasWitness())
+}
+
+// SerializeNoWitness writes the legacy serialization of the transaction
+func (tx *MsgTx) SerializeNoWitness(w io.Writer) error {
+	return tx.encode(w, false)
+}
+
+// SerializeSize returns the number of bytes Serialize writes
+func (tx *MsgTx) SerializeSize() int {
+	n := tx.baseSize()
+	if tx.HasWitness() {
+		n += 2
+		for _, in := range tx.TxIn {
+			n += VarIntSize(uint64(len(in.Witness)))
+			for _, item := range in.Witness {
+				n += VarIntSize(uint64(len(item))) + len(item)
+			}
+		}
+	}
+	return n
+}
+
+// SerializeSizeStripped returns the size of the transaction without witness data
+func (tx *MsgTx) SerializeSizeStripped() int {
+	return tx.baseSize()
+}
+
+// VirtualSize returns the BIP141 virtual size, rounded up
+func (tx *MsgTx) VirtualSize() int {
+	weight := tx.baseSize()*3 + tx.SerializeSize()
+	return (weight + 3) / 4
+}
+
+func (tx *MsgTx) baseSize() int {
+	n := 8 + VarIntSize(uint64(len(tx.TxIn))) + VarIntSize(uint64(len(tx.TxOut)))
+	for _, in := range tx.TxIn {
+		n += 40 + VarIntSize(uint64(len(in.SignatureScript))) + len(in.SignatureScript)
+	}
+	for _, out := range tx.TxOut {
+		n += 8 + VarIntSize(uint64(len(out.PkScript))) + len(out.PkScript)
+	}
+	return n
+}
+
+func (tx *MsgTx) encode(w io.Writer, witness bool) error {
+	if err := writeUint32(w, uint32(tx.Version)); err != nil {
+		return err
+	}
+	if witness {
+		if _, err := w.Write([]byte{witnessMarker, witnessFlag}); err != nil {
+			return err
+		}
+	}
+	if err := WriteVarInt(w, uint64(len(tx.TxIn))); err != nil {
+		return err
+	}
+	for _, in := range tx.TxIn {
+		if _, err := w.Write(in.PreviousOutPoint.Hash[:]); err != nil {
+			return err
+		}
+		if err := writeUint32(w, in.PreviousOutPoint.Index); err != nil {
+			return err
+		}
+		if err := WriteVarBytes(w, in.SignatureScript); err != nil {
+			return err
+		}
+		if err := writeUint32(w, in.Sequence); err != nil {
+			return err
+		}
+	}
+	if err := WriteVarInt(w, uint64(len(tx.TxOut))); err != nil {
+		return err
+	}
+	for _, out := range tx.TxOut {
+		if err := writeUint64(w, uint64(out.Value)); err != nil {
+			return err
+		}
+		if err := WriteVarBytes(w, out.PkScript); err != nil {
+			return err
+		}
+	}
+	if witness {
+		for _, in := range tx.TxIn {
+			if err := WriteVarInt(w, uint64(len(in.Witness))); err != nil {
+				return err
+			}
+			for _, item := range in.Witness {
+				if err := WriteVarBytes(w, item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return writeUint32(w, tx.LockTime)
+}
+
+// Deserialize reads a transaction in either the legacy or the BIP144 format
+func (tx *MsgTx) Deserialize(r io.Reader) error {
+	version, err := readUint32(r)
+	if err != nil {
+		return err
+	}
+	tx.Version = int32(version)
+
+	count, err := ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	witness := false
+	if count == witnessMarker {
+		var flag [1]byte
+		if _, err := io.ReadFull(r, flag[:]); err != nil {
+			return err
+		}
+		if flag[0] != witnessFlag {
+			return fmt.Errorf("wire: unknown witness flag %#x", flag[0])
+		}
+		witness = true
+		if count, err = ReadVarInt(r); err != nil {
+			return err
+		}
+	}
+	if count > maxVarIntPayload/41 {
+		return ErrOversized
+	}
+
+	tx.TxIn = make([]*TxIn, 0, count)
+	for i := uint64(0); i < count; i++ {
+		in := &TxIn{}
+		if _, err := io.ReadFull(r, in.PreviousOutPoint.Hash[:]); err != nil {
+			return err
+		}
+		if in.PreviousOutPoint.Index, err = readUint32(r); err != nil {
+			return err
+		}
+		if in.SignatureScript, err = ReadVarBytes(r); err != nil {
+			return err
+		}
+		if in.Sequence, err = readUint32(r); err != nil {
+			return err
+		}
+		tx.TxIn = append(tx.TxIn, in)
+	}
+
+	if count, err = ReadVarInt(r); err != nil {
+		return err
+	}
+	if count > maxVarIntPayload/9 {
+		return ErrOversized
+	}
+	tx.TxOut = make([]*TxOut, 0, count)
+	for i := uint64(0); i < count; i++ {
+		out := &TxOut{}
+		value, err := readUint64(r)
+		if err != nil {
+			return err
+		}
+		out.Value = int64(value)
+		if out.PkScript, err = ReadVarBytes(r); err != nil {
+			return err
+		}
+		tx.TxOut = append(tx.TxOut, out)
+	}
+
+	if witness {
+		for _, in := range tx.TxIn {
+			n, err := ReadVarInt(r)
+			if err != nil {
+				return err
+			}
+			if n > maxVarIntPayload {
+				return ErrOversized
+			}
+			for j := uint64(0); j < n; j++ {
+				item, err := ReadVarBytes(r)
+				if err != nil {
+					return err
+				}
+				in.Witness = append(in.Witness, item)
+			}
+		}
+		if !tx.HasWitness() {
+			return errors.New("wire: witness flag set without witness data")
+		}
+	}
+
+	tx.LockTime, err = readUint32(r)
+	return err
+}
+
+// NewMsgTxFromHex decodes the hex serialization returned by getrawtransaction
+func NewMsgTxFromHex(s string) (*MsgTx, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	tx := &MsgTx{}
+	r := bytes.NewReader(b)
+	if err := tx.Deserialize(r); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("wire: %d trailing bytes after transaction", r.Len())
+	}
+	return tx, nil
+}
+
+// Hex returns the hex serialization of the transaction
+func (tx *MsgTx) Hex() string {
+	var buf bytes.Buffer
+	tx.Serialize(&buf)
+	return hex.EncodeToString(buf.Bytes())
+}
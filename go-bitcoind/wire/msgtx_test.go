@@ -0,0 +1,92 @@
+package wire
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The genesis coinbase transaction
+const genesisTxHex = "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+
+var _ = Describe("MsgTx", func() {
+	Describe("legacy serialization", func() {
+		It("should decode the genesis coinbase and compute its txid", func() {
+			tx, err := NewMsgTxFromHex(genesisTxHex)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tx.TxIn).To(HaveLen(1))
+			Expect(tx.TxOut).To(HaveLen(1))
+			Expect(tx.TxOut[0].Value).To(Equal(int64(5000000000)))
+			Expect(tx.TxHash().String()).To(Equal("4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"))
+			Expect(tx.Hex()).To(Equal(genesisTxHex))
+			Expect(tx.SerializeSize()).To(Equal(len(genesisTxHex) / 2))
+		})
+		It("should reject trailing bytes", func() {
+			_, err := NewMsgTxFromHex(genesisTxHex + "00")
+			Expect(err).To(HaveOccurred())
+		})
+		It("should reject truncated data", func() {
+			_, err := NewMsgTxFromHex(genesisTxHex[:100])
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("witness serialization", func() {
+		tx := NewMsgTx(2)
+		prev, _ := NewOutPoint("4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b", 1)
+		tx.AddTxIn(&TxIn{PreviousOutPoint: prev, Sequence: MaxTxInSequenceNum, Witness: [][]byte{{}, {1, 2, 3}}})
+		tx.AddTxOut(&TxOut{Value: 1000, PkScript: []byte{0x00, 0x14}})
+
+		It("should round trip and keep the txid witness free", func() {
+			var buf bytes.Buffer
+			Expect(tx.Serialize(&buf)).To(Succeed())
+			Expect(buf.Len()).To(Equal(tx.SerializeSize()))
+
+			got := &MsgTx{}
+			Expect(got.Deserialize(&buf)).To(Succeed())
+			Expect(got.TxIn[0].Witness).To(Equal([][]byte{{}, {1, 2, 3}}))
+			Expect(got.TxHash()).To(Equal(tx.TxHash()))
+			Expect(got.WitnessHash()).NotTo(Equal(got.TxHash()))
+
+			stripped := tx.Copy()
+			stripped.TxIn[0].Witness = nil
+			Expect(stripped.TxHash()).To(Equal(tx.TxHash()))
+		})
+		It("should compute the virtual size", func() {
+			Expect(tx.VirtualSize()).To(Equal((tx.SerializeSizeStripped()*3 + tx.SerializeSize() + 3) / 4))
+		})
+	})
+
+	Describe("OutPoint", func() {
+		It("should print as txid:vout", func() {
+			op, err := NewOutPoint("4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b", 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(op.String()).To(Equal("4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b:3"))
+		})
+		It("should parse its txid:vout form", func() {
+			s := "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b:3"
+			op, err := NewOutPointFromStr(s)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(op.Index).To(Equal(uint32(3)))
+			Expect(op.String()).To(Equal(s))
+			for _, bad := range []string{s[:64], s[:64] + ":x", s[:64] + ":-1", "zz:0"} {
+				_, err := NewOutPointFromStr(bad)
+				Expect(err).To(HaveOccurred(), bad)
+			}
+		})
+	})
+
+	Describe("VarInt", func() {
+		It("should round trip every width", func() {
+			for _, n := range []uint64{0, 0xfc, 0xfd, 0xffff, 0x10000, 0xffffffff, 0x100000000} {
+				var buf bytes.Buffer
+				Expect(WriteVarInt(&buf, n)).To(Succeed())
+				Expect(buf.Len()).To(Equal(VarIntSize(n)))
+				got, err := ReadVarInt(&buf)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(got).To(Equal(n))
+			}
+		})
+	})
+})
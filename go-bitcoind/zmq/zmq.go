@@ -0,0 +1,223 @@
+// Package zmq subscribes to the ZMQ notifications of a bitcoind or BTG node
+// (-zmqpubrawtx, -zmqpubhashblock, -zmqpubrawblock, -zmqpubsequence) and
+// decodes them. The node numbers the messages of each topic, so a lost
+// message shows as a gap in the numbering: the notification following it is
+// flagged and the consumer catches up with RPC.
+// ZMQ only shortens the delay of the RPC polling, it doesn't replace it:
+// messages sent before the subscription, or while disconnected, are lost.
+package zmq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// Topics published by the node
+const (
+	TopicHashBlock = "hashblock"
+	TopicHashTx    = "hashtx"
+	TopicRawBlock  = "rawblock"
+	TopicRawTx     = "rawtx"
+	TopicSequence  = "sequence"
+)
+
+// Labels of the sequence topic
+const (
+	SequenceConnected    = 'C' // block connected
+	SequenceDisconnected = 'D' // block disconnected
+	SequenceAdded        = 'A' // transaction added to the mempool
+	SequenceRemoved      = 'R' // transaction removed from the mempool, not by a block
+)
+
+// A Notification is a decoded message
+type Notification struct {
+	Topic string
+
+	// Seq numbers the messages of the topic
+	Seq uint32
+
+	// Gap is set when messages of the topic were lost before this one, or
+	// the connection was lost since the previous notification
+	Gap bool
+
+	Block *wire.MsgBlock // rawblock
+	Tx    *wire.MsgTx    // rawtx
+	Hash  wire.Hash      // hashblock, hashtx and sequence
+
+	// Label and MempoolSeq are set by the sequence topic, MempoolSeq for
+	// the mempool labels A and R only
+	Label      byte
+	MempoolSeq uint64
+}
+
+// AffectsChain tells whether the best chain may have moved since the
+// previous notification: a block notification, or lost messages
+func (n *Notification) AffectsChain() bool {
+	switch n.Topic {
+	case TopicHashBlock, TopicRawBlock:
+		return true
+	case TopicSequence:
+		return n.Gap || n.Label == SequenceConnected || n.Label == SequenceDisconnected
+	}
+	return n.Gap
+}
+
+// AffectsMempool tells whether the mempool may have changed since the
+// previous notification. The transactions of connected blocks are
+// published too, they leave the mempool.
+func (n *Notification) AffectsMempool() bool {
+	return n.Gap || n.Topic != TopicSequence || n.Label == SequenceAdded || n.Label == SequenceRemoved
+}
+
+// A Subscriber receives the notifications of a node
+type Subscriber struct {
+	sock zmq4.Socket
+	last map[string]uint32 // last Seq by topic
+}
+
+// Subscribe connects to the node's endpoint, e.g. tcp://127.0.0.1:28332,
+// and subscribes to topics
+func Subscribe(endpoint string, topics ...string) (*Subscriber, error) {
+	sock := zmq4.NewSub(context.Background(), zmq4.WithDialerRetry(time.Second))
+	if err := sock.Dial(endpoint); err != nil {
+		sock.Close()
+		return nil, fmt.Errorf("zmq: dial %s: %v", endpoint, err)
+	}
+	for _, t := range topics {
+		if err := sock.SetOption(zmq4.OptionSubscribe, t); err != nil {
+			sock.Close()
+			return nil, fmt.Errorf("zmq: subscribe %s: %v", t, err)
+		}
+	}
+	return &Subscriber{sock: sock, last: make(map[string]uint32)}, nil
+}
+
+// Next blocks until the next notification
+func (s *Subscriber) Next() (*Notification, error) {
+	msg, err := s.sock.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Frames) != 3 || len(msg.Frames[2]) != 4 {
+		return nil, fmt.Errorf("zmq: unexpected message of %d frames", len(msg.Frames))
+	}
+	n := &Notification{
+		Topic: string(msg.Frames[0]),
+		Seq:   binary.LittleEndian.Uint32(msg.Frames[2]),
+	}
+	if last, ok := s.last[n.Topic]; ok && n.Seq != last+1 {
+		n.Gap = true
+	}
+	s.last[n.Topic] = n.Seq
+
+	if err := n.decode(msg.Frames[1]); err != nil {
+		return nil, fmt.Errorf("zmq: %s %d: %v", n.Topic, n.Seq, err)
+	}
+	return n, nil
+}
+
+// Close closes the connection, a blocked Next returns an error
+func (s *Subscriber) Close() error {
+	return s.sock.Close()
+}
+
+func (n *Notification) decode(body []byte) error {
+	var err error
+	switch n.Topic {
+	case TopicRawBlock:
+		n.Block = &wire.MsgBlock{}
+		err = n.Block.Deserialize(bytes.NewReader(body))
+	case TopicRawTx:
+		n.Tx = &wire.MsgTx{}
+		err = n.Tx.Deserialize(bytes.NewReader(body))
+	case TopicHashBlock, TopicHashTx:
+		n.Hash, err = hashFromDisplay(body)
+	case TopicSequence:
+		if len(body) != 33 && len(body) != 41 {
+			return fmt.Errorf("invalid sequence body of %d bytes", len(body))
+		}
+		n.Hash, _ = hashFromDisplay(body[:32])
+		n.Label = body[32]
+		if len(body) == 41 {
+			n.MempoolSeq = binary.LittleEndian.Uint64(body[33:])
+		}
+	}
+	return err
+}
+
+// hashFromDisplay reads a hash published in the byte order it is displayed in
+func hashFromDisplay(b []byte) (wire.Hash, error) {
+	var h wire.Hash
+	if len(b) != wire.HashSize {
+		return h, errors.New("invalid hash length")
+	}
+	for i := range b {
+		h[wire.HashSize-1-i] = b[i]
+	}
+	return h, nil
+}
+
+// Follow delivers the notifications of endpoint until stop is closed, then
+// closes the returned channel. Failures are passed to onErr and the
+// subscription is renewed after retry; the first notification received
+// afterwards is flagged as a gap.
+func Follow(endpoint string, topics []string, retry time.Duration, stop <-chan struct{}, onErr func(error)) <-chan *Notification {
+	out := make(chan *Notification)
+	go func() {
+		defer close(out)
+		gap := false
+		for {
+			s, err := Subscribe(endpoint, topics...)
+			if err == nil {
+				err = s.forward(out, stop, gap)
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			onErr(err)
+			gap = true
+			select {
+			case <-stop:
+				return
+			case <-time.After(retry):
+			}
+		}
+	}()
+	return out
+}
+
+// forward sends the notifications to out until an error, or stop is closed
+func (s *Subscriber) forward(out chan<- *Notification, stop <-chan struct{}, gap bool) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		s.Close()
+	}()
+
+	for {
+		n, err := s.Next()
+		if err != nil {
+			return err
+		}
+		n.Gap = n.Gap || gap
+		gap = false
+		select {
+		case out <- n:
+		case <-stop:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package zmq
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestZmq(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Zmq Suite")
+}
@@ -0,0 +1,215 @@
+package zmq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+const txid = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+
+// publisher plays the node's side: it numbers the messages of each topic
+type publisher struct {
+	sock zmq4.Socket
+	seq  map[string]uint32
+}
+
+func newPublisher() *publisher {
+	sock := zmq4.NewPub(context.Background())
+	Expect(sock.Listen("tcp://127.0.0.1:0")).To(Succeed())
+	return &publisher{sock: sock, seq: make(map[string]uint32)}
+}
+
+func (p *publisher) endpoint() string {
+	return "tcp://" + p.sock.Addr().String()
+}
+
+// skip loses the next message of topic, as a full queue of the node would
+func (p *publisher) skip(topic string) {
+	p.seq[topic]++
+}
+
+func (p *publisher) publish(topic string, body []byte) {
+	seq := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seq, p.seq[topic])
+	p.seq[topic]++
+	Expect(p.sock.Send(zmq4.NewMsgFrom([]byte(topic), body, seq))).To(Succeed())
+}
+
+// displayed returns the hash in the byte order of its string form
+func displayed(h wire.Hash) []byte {
+	b := make([]byte, wire.HashSize)
+	for i := range h {
+		b[wire.HashSize-1-i] = h[i]
+	}
+	return b
+}
+
+func testTx() *wire.MsgTx {
+	prev, _ := wire.NewOutPoint(txid, 1)
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: prev, Sequence: wire.MaxTxInSequenceNum})
+	tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: []byte{0x51}})
+	return tx
+}
+
+func serialize(tx *wire.MsgTx) []byte {
+	var buf bytes.Buffer
+	Expect(tx.Serialize(&buf)).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("Subscriber", func() {
+	var (
+		pub *publisher
+		sub *Subscriber
+	)
+
+	// sync publishes hashblock notifications until the subscription reached
+	// the publisher, messages published before are dropped
+	sync := func() {
+		received := make(chan *Notification, 1)
+		go func() {
+			n, err := sub.Next()
+			if err == nil {
+				received <- n
+			}
+		}()
+		Eventually(func() bool {
+			pub.publish(TopicHashBlock, make([]byte, 32))
+			select {
+			case <-received:
+				return true
+			case <-time.After(20 * time.Millisecond):
+				return false
+			}
+		}, 5*time.Second).Should(BeTrue())
+	}
+
+	BeforeEach(func() {
+		pub = newPublisher()
+		var err error
+		sub, err = Subscribe(pub.endpoint(), TopicHashBlock, TopicRawTx, TopicRawBlock, TopicSequence)
+		Expect(err).NotTo(HaveOccurred())
+		sync()
+	})
+	AfterEach(func() {
+		sub.Close()
+		pub.sock.Close()
+	})
+
+	It("should decode the notifications of every topic", func() {
+		tx := testTx()
+		hash, _ := wire.NewHashFromStr(txid)
+		block := &wire.MsgBlock{Transactions: []*wire.MsgTx{tx}}
+		block.Header = wire.BlockHeader{Version: 4, Height: 3000}
+		var raw bytes.Buffer
+		Expect(block.Serialize(&raw)).To(Succeed())
+
+		pub.publish(TopicRawTx, serialize(tx))
+		pub.publish(TopicHashBlock, displayed(hash))
+		pub.publish(TopicRawBlock, raw.Bytes())
+		added := append(displayed(tx.TxHash()), SequenceAdded, 7, 0, 0, 0, 0, 0, 0, 0)
+		pub.publish(TopicSequence, added)
+		pub.publish(TopicSequence, append(displayed(hash), SequenceConnected))
+
+		n, err := sub.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Topic).To(Equal(TopicRawTx))
+		Expect(n.Tx.TxHash()).To(Equal(tx.TxHash()))
+		Expect(n.Gap).To(BeFalse())
+
+		n, _ = sub.Next()
+		Expect(n.Hash.String()).To(Equal(txid))
+		Expect(n.Gap).To(BeFalse())
+
+		n, _ = sub.Next()
+		Expect(n.Block.Header.Height).To(Equal(uint32(3000)))
+		Expect(n.Block.Transactions).To(HaveLen(1))
+
+		n, _ = sub.Next()
+		Expect(n.Label).To(Equal(byte(SequenceAdded)))
+		Expect(n.Hash).To(Equal(tx.TxHash()))
+		Expect(n.MempoolSeq).To(Equal(uint64(7)))
+		Expect(n.AffectsChain()).To(BeFalse())
+		Expect(n.AffectsMempool()).To(BeTrue())
+
+		n, _ = sub.Next()
+		Expect(n.Label).To(Equal(byte(SequenceConnected)))
+		Expect(n.AffectsChain()).To(BeTrue())
+		Expect(n.AffectsMempool()).To(BeFalse())
+		Expect(n.MempoolSeq).To(BeZero())
+		Expect(n.Seq).To(Equal(uint32(1)))
+	})
+
+	It("should flag the notification following lost messages", func() {
+		pub.publish(TopicSequence, append(make([]byte, 32), SequenceConnected))
+		pub.skip(TopicSequence)
+		pub.publish(TopicSequence, append(make([]byte, 32), SequenceConnected))
+		pub.publish(TopicHashBlock, make([]byte, 32))
+
+		first, _ := sub.Next()
+		Expect(first.Gap).To(BeFalse())
+		second, _ := sub.Next()
+		Expect(second.Gap).To(BeTrue())
+		Expect(second.AffectsMempool()).To(BeTrue())
+		Expect(second.Seq).To(Equal(first.Seq + 2))
+		other, _ := sub.Next()
+		Expect(other.Gap).To(BeFalse())
+	})
+
+	It("should reject malformed messages", func() {
+		pub.publish(TopicSequence, []byte{1, 2, 3})
+		_, err := sub.Next()
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Follow", func() {
+	It("should deliver notifications until stopped and renew failed subscriptions", func() {
+		pub := newPublisher()
+		defer pub.sock.Close()
+		stop := make(chan struct{})
+		errs := make(chan error, 10)
+		out := Follow(pub.endpoint(), []string{TopicHashBlock, TopicSequence}, 10*time.Millisecond, stop, func(err error) { errs <- err })
+
+		next := func() *Notification {
+			var n *Notification
+			Eventually(func() bool {
+				pub.publish(TopicHashBlock, make([]byte, 32))
+				select {
+				case n = <-out:
+					return true
+				case <-time.After(20 * time.Millisecond):
+					return false
+				}
+			}, 5*time.Second).Should(BeTrue())
+			return n
+		}
+		Expect(next().Gap).To(BeFalse())
+
+		// a malformed message fails the subscription, the next one starts with a gap
+		pub.publish(TopicSequence, []byte{1})
+		Eventually(errs, 5*time.Second).Should(Receive(HaveOccurred()))
+		// hashblocks sent before the failure was noticed may come first
+		Eventually(func() bool { return next().Gap }, 5*time.Second).Should(BeTrue())
+
+		close(stop)
+		Eventually(func() bool {
+			select {
+			case _, ok := <-out:
+				return !ok
+			default:
+				return false
+			}
+		}, 5*time.Second).Should(BeTrue())
+		Consistently(errs).ShouldNot(Receive())
+	})
+})
@@ -2,4 +2,11 @@ module watchUTXO
 
 go 1.13
 
-require github.com/www222fff/watchUTXO/go-bitcoind v0.0.0-20220429091437-97a95e17e4f1 // indirect
+require (
+	github.com/onsi/ginkgo v1.10.3
+	github.com/onsi/gomega v1.7.1
+	github.com/www222fff/watchUTXO/go-bitcoind v0.0.0-20220429091437-97a95e17e4f1
+	gopkg.in/yaml.v2 v2.2.4
+)
+
+replace github.com/www222fff/watchUTXO/go-bitcoind => ./go-bitcoind
@@ -1,81 +1,49 @@
 package main
 
 import (
-	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"fmt"
 	"log"
-	"time"
-       )
-
-const (
-	SERVER_HOST        = "127.0.0.1"
-	SERVER_PORT        = 8332
-	RPCUSER            = "danny"
-	RPCPASSWD          = "danny_wang"
-	USESSL             = false
-	WALLET_NAME        = "danny"
-	WALLET_PASSPHRASE  = "test"
-      )
-
-var watch_addresses = []string{"btg1qmc6uua0jngs9qr38w3pchcvdcrzu878t8p8nwqtj32rtjvjfvnfqywt5pr"}
-
-func findWallet(slice []string, s string) int {
-	for index, value := range slice {
-		if value == s {
-			return index
-		}
-	}
-	return -1
-}
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
 
 func main() {
-	bc1, err := bitcoind.New(SERVER_HOST, SERVER_PORT, "", RPCUSER, RPCPASSWD, USESSL)
+	cfg, err := LoadConfig(os.Args[1:], os.LookupEnv)
 	if err != nil {
-		log.Fatalln(err)
-	}
-
-	wallets, err := bc1.ListWallet()
-	r := findWallet(wallets, WALLET_NAME)
-	if r == -1 {
-		err = bc1.LoadWallet(WALLET_NAME, false)
-		log.Println(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	bc, err := bitcoind.New(SERVER_HOST, SERVER_PORT, WALLET_NAME, RPCUSER, RPCPASSWD, USESSL)
+	sinks, closeSinks, err := openSinks(cfg)
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatal(err)
 	}
+	defer closeSinks()
 
-	err = bc.WalletPassphrase(WALLET_PASSPHRASE, 100000000)
-	log.Println(err)
-
-	utxoMap := make(map[string]bitcoind.UTXO)
-
-	for {
-		//list all utxo of watched multisig address
-		utxos, err := bc.ListUnspent(1, 999999, watch_addresses)
+	var watchers []*watcher
+	for i := range cfg.Watchers {
+		w, err := newWatcher(cfg, &cfg.Watchers[i], sinks)
 		if err != nil {
-			log.Fatalln(err)
-		}
-
-		//filter delta utxo
-		deltaUtxoMap := make(map[string]bitcoind.UTXO)
-		for _, utxo := range utxos {
-			_, ok := utxoMap[utxo.TxID]
-			if (ok) {
-				log.Println("existed utxo", utxo)
-			} else {
-				log.Println("found new utxo", utxo)
-				utxoMap[utxo.TxID] = utxo
-				deltaUtxoMap[utxo.TxID] = utxo
-			}
-		}
-
-		//handle new utxo, send deposit event
-		for txid := range deltaUtxoMap {
-			log.Println(txid)
+			log.Fatalf("watcher %s: %v", cfg.Watchers[i].Name, err)
 		}
+		watchers = append(watchers, w)
+	}
 
-		time.Sleep(1 * time.Second)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, w := range watchers {
+		wg.Add(1)
+		go func(w *watcher) {
+			defer wg.Done()
+			w.run(stop)
+		}(w)
 	}
 
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	log.Println("received", <-sig, "shutting down")
+	close(stop)
+	wg.Wait()
 }
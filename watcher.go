@@ -0,0 +1,498 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind"
+	"github.com/www222fff/watchUTXO/go-bitcoind/address"
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/mempool"
+	"github.com/www222fff/watchUTXO/go-bitcoind/sink"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/webhook"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+	"github.com/www222fff/watchUTXO/go-bitcoind/zmq"
+)
+
+// WALLET_UNLOCK_TIMEOUT is how long, in seconds, a wallet stays unlocked
+const WALLET_UNLOCK_TIMEOUT = 100000000
+
+func findWallet(slice []string, s string) int {
+	for index, value := range slice {
+		if value == s {
+			return index
+		}
+	}
+	return -1
+}
+
+// A watcher polls the UTXOs of its addresses and reports the new ones
+type watcher struct {
+	name      string
+	bc        *bitcoind.Bitcoind
+	addresses []string
+	params    *address.Params
+	utxos     deposit.UTXOSource
+	interval  time.Duration
+	policy    *deposit.Policy
+	store     *store.Store
+	mempool   *mempool.Watcher // nil unless enabled
+	zmq       string           // endpoint of the node's notifications, if any
+	sinks     *sink.Dispatcher // nil without sinks
+	log       *log.Logger
+}
+
+// openSinks opens the sinks of the configuration, shared by the watchers.
+// The returned function closes the files and connections.
+func openSinks(cfg *Config) (map[string]sink.Sink, func(), error) {
+	sinks := make(map[string]sink.Sink)
+	var closers []io.Closer
+	closeAll := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+	for _, sc := range cfg.Sinks {
+		switch sc.Type {
+		case SINK_STDOUT:
+			sinks[sc.Name] = sink.NewWriter(os.Stdout)
+		case SINK_FILE:
+			f, err := sink.OpenFile(sc.Path)
+			if err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("sink %s: %v", sc.Name, err)
+			}
+			closers = append(closers, f)
+			sinks[sc.Name] = f
+		case SINK_WEBHOOK:
+			sinks[sc.Name] = webhook.New(sc.URL, sc.Secret, &http.Client{})
+		case SINK_STREAM:
+			s := sink.NewStream(sc.Network, sc.Address, sc.Subject)
+			closers = append(closers, s)
+			sinks[sc.Name] = s
+		}
+	}
+	return sinks, closeAll, nil
+}
+
+// newWatcher connects to the wallet of w, loading and unlocking it if needed.
+// The deposit events of the watcher are published to sinks.
+func newWatcher(cfg *Config, w *WatcherConfig, sinks map[string]sink.Sink) (*watcher, error) {
+	addresses, err := cfg.WatchedAddresses(w)
+	if err != nil {
+		return nil, err
+	}
+
+	rpc := cfg.RPC
+	if w.Wallet != "" {
+		bc, err := bitcoind.New(rpc.Endpoint, "", rpc.User, rpc.Password, rpc.SSL, rpc.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		wallets, err := bc.ListWallet()
+		if err != nil {
+			return nil, fmt.Errorf("listwallets: %v", err)
+		}
+		if findWallet(wallets, w.Wallet) == -1 {
+			if err = bc.LoadWallet(w.Wallet, false); err != nil {
+				return nil, fmt.Errorf("loadwallet %s: %v", w.Wallet, err)
+			}
+		}
+	}
+
+	bc, err := bitcoind.New(rpc.Endpoint, w.Wallet, rpc.User, rpc.Password, rpc.SSL, rpc.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if w.WalletPassphrase != "" {
+		if err = bc.WalletPassphrase(w.WalletPassphrase, WALLET_UNLOCK_TIMEOUT); err != nil {
+			return nil, fmt.Errorf("walletpassphrase %s: %v", w.Wallet, err)
+		}
+	}
+
+	if err := os.MkdirAll(cfg.StateDir, 0700); err != nil {
+		return nil, err
+	}
+	st, err := store.Open(cfg.StatePath(w))
+	if err != nil {
+		return nil, fmt.Errorf("state %s: %v", cfg.StatePath(w), err)
+	}
+
+	// the events are queued with the changes, before the first poll
+	var dispatcher *sink.Dispatcher
+	if len(sinks) > 0 {
+		dispatcher = sink.NewDispatcher(st, sinks)
+		dispatcher.Timeout = DEFAULT_SINK_TIMEOUT
+	}
+
+	var mp *mempool.Watcher
+	if cfg.Mempool {
+		if mp, err = mempool.New(bc, cfg.Params(), addresses); err != nil {
+			st.Close()
+			return nil, err
+		}
+	}
+
+	return &watcher{
+		name:      w.Name,
+		bc:        bc,
+		addresses: addresses,
+		params:    cfg.Params(),
+		utxos:     deposit.NewRPCSource(bc, cfg.MinConf, DEFAULT_MAXCONF, addresses),
+		interval:  cfg.PollInterval,
+		policy:    cfg.Policy(),
+		store:     st,
+		mempool:   mp,
+		zmq:       cfg.ZMQEndpoint,
+		sinks:     dispatcher,
+		log:       log.New(log.Writer(), "["+w.Name+"] ", log.Flags()),
+	}, nil
+}
+
+// run polls until stop is closed. Polling errors are logged and retried on
+// the next interval. With ZMQ, the notifications trigger the polls they
+// concern right away; a lost notification triggers both.
+func (w *watcher) run(stop <-chan struct{}) {
+	defer w.store.Close()
+	w.log.Println("watching", len(w.addresses), "addresses")
+	if tip, err := w.store.Tip(); err == nil && tip != nil {
+		w.log.Println("resuming after block", tip.Height, tip.Hash)
+	}
+	tracker := deposit.NewTracker()
+
+	if w.sinks != nil {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.sinks.Run(DEFAULT_SINK_INTERVAL, stop, func(err error) {
+				w.log.Println("sink:", err)
+			})
+		}()
+		// the store is closed once the sinks stopped
+		defer wg.Wait()
+	}
+
+	var notifications <-chan *zmq.Notification
+	if w.zmq != "" {
+		topics := []string{zmq.TopicHashBlock, zmq.TopicSequence}
+		if w.mempool != nil {
+			topics = append(topics, zmq.TopicHashTx)
+		}
+		notifications = zmq.Follow(w.zmq, topics, w.interval, stop, func(err error) {
+			w.log.Println("zmq:", err)
+		})
+	}
+
+	chain, pool := true, true
+	for {
+		if chain {
+			if err := w.poll(tracker); err != nil {
+				w.log.Println("poll failed:", err)
+			}
+		}
+		if pool && w.mempool != nil {
+			if err := w.mempool.Poll(w); err != nil {
+				w.log.Println("mempool poll failed:", err)
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(w.interval):
+			chain, pool = true, true
+		case n := <-notifications:
+			if n.Gap {
+				w.log.Println("zmq: lost notifications, catching up")
+			}
+			chain, pool = n.AffectsChain(), n.AffectsMempool()
+		}
+	}
+}
+
+// poll lists the unspent outputs of the watched addresses, moves each of them
+// through its lifecycle states and reports the outputs that became final as
+// deposits of their own. The outputs no longer listed are spent, by the
+// withdrawals found in the wallet when possible.
+func (w *watcher) poll(tracker *deposit.Tracker) error {
+	since, err := w.store.Tip()
+	if err != nil {
+		return err
+	}
+	//list all utxo of watched multisig address
+	utxos, err := w.utxos.ListUnspent()
+	if err != nil {
+		return err
+	}
+	deposits := make([]*deposit.Deposit, 0, len(utxos))
+	for _, utxo := range utxos {
+		d, err := deposit.FromUTXO(utxo)
+		if err != nil {
+			return fmt.Errorf("utxo %s: %v", utxo.OutPoint(), err)
+		}
+		deposits = append(deposits, d)
+	}
+
+	deposit.Sort(deposits)
+
+	best, err := w.bestTip()
+	if err != nil {
+		return err
+	}
+	for _, d := range deposits {
+		if err := w.locate(d); err != nil {
+			return err
+		}
+	}
+
+	//handle new utxo, send deposit event
+	_, removed := tracker.Update(deposits)
+	for _, d := range deposits {
+		// the store tells which outputs were already seen, and reported,
+		// before a restart
+		_, c, err := w.store.Observe(d, w.policy)
+		if err != nil {
+			return fmt.Errorf("observe %s: %v", d.ID(), err)
+		}
+		if err := w.changed(c); err != nil {
+			return err
+		}
+	}
+	withdrawals, err := w.withdrawals(removed, since)
+	if err != nil {
+		return err
+	}
+	for _, wd := range withdrawals {
+		w.log.Printf("withdrawal %s spends %v to %d outputs, fee %d", wd.TxID, wd.Spent, len(wd.Outputs), wd.Fee)
+		for _, o := range wd.Outputs {
+			w.log.Printf("withdrawal %s pays %d to %q", wd.TxID, o.Amount, o.Address)
+		}
+		changes, err := w.store.Spend(wd)
+		if err != nil {
+			return fmt.Errorf("spend %s: %v", wd.TxID, err)
+		}
+		for _, c := range changes {
+			if err := w.changed(c); err != nil {
+				return err
+			}
+		}
+	}
+	for _, d := range removed {
+		// spent by a transaction the wallet doesn't know, or already marked
+		c, err := w.store.SetState(d.OutPoint, deposit.StateSpent)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("mark %s spent: %v", d.ID(), err)
+		}
+		if err := w.changed(c); err != nil {
+			return err
+		}
+	}
+
+	return w.store.SetTip(*best)
+}
+
+// withdrawals looks the transactions spending the removed deposits up among
+// the wallet transactions since the tip of the previous poll, mempool
+// included
+func (w *watcher) withdrawals(removed []*deposit.Deposit, since *store.Tip) ([]*deposit.Withdrawal, error) {
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	gone := make(map[wire.OutPoint]int64, len(removed))
+	for _, d := range removed {
+		gone[d.OutPoint] = d.Amount
+	}
+	hash := ""
+	if since != nil {
+		hash = since.Hash
+	}
+	txs, err := w.bc.ListSinceBlock(hash, 1)
+	if err != nil {
+		return nil, fmt.Errorf("listsinceblock: %v", err)
+	}
+
+	var withdrawals []*deposit.Withdrawal
+	seen := make(map[string]bool)
+	for _, t := range txs {
+		if seen[t.TxID] {
+			continue
+		}
+		seen[t.TxID] = true
+		tx, block, err := w.walletTx(t.TxID)
+		if err != nil {
+			return nil, err
+		}
+		var spent []wire.OutPoint
+		amounts := make(map[wire.OutPoint]int64, len(tx.TxIn))
+		for _, in := range tx.TxIn {
+			if amount, ok := gone[in.PreviousOutPoint]; ok {
+				spent = append(spent, in.PreviousOutPoint)
+				amounts[in.PreviousOutPoint] = amount
+			}
+		}
+		if len(spent) == 0 {
+			continue
+		}
+		w.lookupInputs(tx, amounts)
+		wd := deposit.NewWithdrawal(tx, spent, amounts, w.params)
+		if block.BlockHash != "" && block.Confirmations > 0 {
+			height, err := w.blockHeight(block.BlockHash)
+			if err != nil {
+				return nil, err
+			}
+			wd.Block, wd.Height = block.BlockHash, height
+		}
+		withdrawals = append(withdrawals, wd)
+	}
+	return withdrawals, nil
+}
+
+// walletTx returns a wallet transaction and where it was mined
+func (w *watcher) walletTx(txid string) (*wire.MsgTx, bitcoind.Transaction, error) {
+	t, err := w.bc.GetTransaction(txid)
+	if err != nil {
+		return nil, t, fmt.Errorf("gettransaction %s: %v", txid, err)
+	}
+	tx, err := wire.NewMsgTxFromHex(t.Hex)
+	if err != nil {
+		return nil, t, fmt.Errorf("transaction %s: %v", txid, err)
+	}
+	return tx, t, nil
+}
+
+// lookupInputs adds the amounts of the other inputs of tx, from the stored
+// deposits or the wallet. The inputs neither knows are left out, the fee is
+// then unknown.
+func (w *watcher) lookupInputs(tx *wire.MsgTx, amounts map[wire.OutPoint]int64) {
+	var missing []wire.OutPoint
+	for _, in := range tx.TxIn {
+		if _, ok := amounts[in.PreviousOutPoint]; !ok {
+			missing = append(missing, in.PreviousOutPoint)
+		}
+	}
+	records, err := w.store.Lookup(missing)
+	if err != nil {
+		return
+	}
+	for _, op := range missing {
+		if r, ok := records[op]; ok {
+			amounts[op] = r.Amount
+			continue
+		}
+		prev, _, err := w.walletTx(op.Hash.String())
+		if err != nil || int(op.Index) >= len(prev.TxOut) {
+			continue
+		}
+		amounts[op] = prev.TxOut[op.Index].Value
+	}
+}
+
+// locate sets the block of a confirmed deposit whose state may change with
+// this poll, so the change records it with the nonce derived from it. The
+// block and the index of the transaction in it are looked up in the wallet,
+// the height in the block's header: the confirmations, listed before the
+// best block was read, may be one behind it.
+func (w *watcher) locate(d *deposit.Deposit) error {
+	if d.Confirmations == 0 {
+		return nil
+	}
+	r, err := w.store.Get(d.OutPoint)
+	if err == nil && (r.State == deposit.StateFinal || r.Confirmations == d.Confirmations) {
+		return nil
+	}
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+	txid := d.OutPoint.Hash.String()
+	tx, err := w.bc.GetTransaction(txid)
+	if err != nil {
+		return fmt.Errorf("gettransaction %s: %v", txid, err)
+	}
+	if tx.BlockHash == "" {
+		// disconnected since the outputs were listed
+		return nil
+	}
+	height, err := w.blockHeight(tx.BlockHash)
+	if err != nil {
+		return err
+	}
+	d.Block = tx.BlockHash
+	d.Height = height
+	d.TxIndex = uint32(tx.BlockIndex)
+	return nil
+}
+
+// blockHeight returns the height of a block
+func (w *watcher) blockHeight(hash string) (uint64, error) {
+	header, err := w.bc.GetBlockheader(hash)
+	if err != nil {
+		return 0, fmt.Errorf("getblockheader %s: %v", hash, err)
+	}
+	return uint64(header.Height), nil
+}
+
+// changed logs a state change, if any, and reports the deposit once final
+func (w *watcher) changed(c *store.Change) error {
+	if c == nil {
+		return nil
+	}
+	r := c.Record
+	from := string(c.From)
+	if from == "" {
+		from = "new"
+	}
+	w.log.Printf("deposit %s %s -> %s (%d confirmations)", r.OutPoint, from, r.State, r.Confirmations)
+	if r.State != deposit.StateFinal || r.Status != store.StatusPending {
+		return nil
+	}
+
+	w.log.Println("found new utxo", r.OutPoint, r.Address, r.Amount, "nonce", r.Nonce)
+	op, err := wire.NewOutPointFromStr(r.OutPoint)
+	if err != nil {
+		return err
+	}
+	if err := w.store.SetStatus(op, store.StatusSent); err != nil {
+		return fmt.Errorf("mark %s sent: %v", r.OutPoint, err)
+	}
+	return nil
+}
+
+// bestTip returns the node's best block, recorded once the poll succeeded
+func (w *watcher) bestTip() (*store.Tip, error) {
+	hash, err := w.bc.GetBestBlockhash()
+	if err != nil {
+		return nil, fmt.Errorf("getbestblockhash: %v", err)
+	}
+	header, err := w.bc.GetBlockheader(hash)
+	if err != nil {
+		return nil, fmt.Errorf("getblockheader %s: %v", hash, err)
+	}
+	return &store.Tip{Hash: hash, Height: uint64(header.Height)}, nil
+}
+
+// MempoolChanged implements mempool.Handler. Mempool deposits are logged and
+// published to the sinks, they are reported once final like any other.
+func (w *watcher) MempoolChanged(e *mempool.Event) {
+	d := e.Deposit
+	switch e.Kind {
+	case mempool.EventPending:
+		w.log.Printf("pending deposit %s %s %d (replaceable: %t)", d.ID(), d.Address, d.Amount, e.Replaceable)
+	case mempool.EventReplaced, mempool.EventConflicted:
+		w.log.Printf("pending deposit %s %s by %v", d.ID(), e.Kind, e.By)
+	default:
+		w.log.Printf("pending deposit %s %s", d.ID(), e.Kind)
+	}
+	if err := w.store.Publish(e.Change()); err != nil {
+		w.log.Printf("publishing pending deposit %s: %v", d.ID(), err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/www222fff/watchUTXO/go-bitcoind/deposit"
+	"github.com/www222fff/watchUTXO/go-bitcoind/mempool"
+	"github.com/www222fff/watchUTXO/go-bitcoind/sink"
+	"github.com/www222fff/watchUTXO/go-bitcoind/store"
+	"github.com/www222fff/watchUTXO/go-bitcoind/wire"
+)
+
+// recordSink keeps the events published to it
+type recordSink struct {
+	events []sink.DepositEvent
+}
+
+func (s *recordSink) Publish(ctx context.Context, e sink.DepositEvent) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+var _ = Describe("Watcher", func() {
+	var (
+		dir string
+		w   *watcher
+		rec *recordSink
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "watchutxo")
+		Expect(err).NotTo(HaveOccurred())
+		st, err := store.Open(filepath.Join(dir, "state.db"))
+		Expect(err).NotTo(HaveOccurred())
+		rec = &recordSink{}
+		w = &watcher{
+			name:  "test",
+			store: st,
+			sinks: sink.NewDispatcher(st, map[string]sink.Sink{"rec": rec}),
+			log:   log.New(ioutil.Discard, "", 0),
+		}
+	})
+	AfterEach(func() {
+		w.store.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should publish the mempool events to the sinks", func() {
+		op, err := wire.NewOutPoint("f35103085b7145e569eb8053365c662cb7b9b7fd6009e37cafbb684bd89b638b", 1)
+		Expect(err).NotTo(HaveOccurred())
+		d := &deposit.Deposit{OutPoint: op, Address: "btg1qmc6uua0jngs9qr38w3pchcvdcrzu878t8p8nwqtj32rtjvjfvnfqywt5pr", Amount: 1000}
+		w.MempoolChanged(&mempool.Event{Kind: mempool.EventPending, Deposit: d, Replaceable: true})
+		w.MempoolChanged(&mempool.Event{Kind: mempool.EventConflicted, Deposit: d, By: []string{"aa"}})
+		_, err = w.sinks.Dispatch(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rec.events).To(HaveLen(2))
+		for _, e := range rec.events {
+			Expect(e.OutPoint).To(Equal(d.ID()))
+			Expect(e.State).To(Equal(deposit.StateMempool))
+			Expect(e.Status).To(Equal(store.StatusPending))
+			Expect(e.Nonce).To(BeZero())
+		}
+		Expect(rec.events[0].Reason).To(Equal("pending"))
+		Expect(rec.events[1].PreviousState).To(Equal(deposit.StateMempool))
+		Expect(rec.events[1].Reason).To(Equal("conflicted by aa"))
+
+		// mempool deposits are not stored
+		Expect(w.store.Seen(op)).To(BeFalse())
+	})
+})